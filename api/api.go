@@ -1,40 +1,342 @@
 package api
 
 import (
+	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"runtime"
+	"slices"
+	"sync/atomic"
+	"time"
 
 	"github.com/josepheid/file-explorer/api/handlers"
+	"github.com/josepheid/file-explorer/api/internal/audit"
 	"github.com/josepheid/file-explorer/api/internal/auth"
+	"github.com/josepheid/file-explorer/api/internal/checksum"
+	"github.com/josepheid/file-explorer/api/internal/duplicates"
+	"github.com/josepheid/file-explorer/api/internal/health"
+	"github.com/josepheid/file-explorer/api/internal/metrics"
 	"github.com/josepheid/file-explorer/api/internal/middleware"
+	"github.com/josepheid/file-explorer/api/internal/oidc"
+	"github.com/josepheid/file-explorer/api/internal/respond"
 	"github.com/josepheid/file-explorer/api/internal/sessions"
+	"github.com/josepheid/file-explorer/api/internal/sftpd"
+	"github.com/josepheid/file-explorer/api/internal/shares"
+	"github.com/josepheid/file-explorer/api/internal/thumbnail"
+	"github.com/josepheid/file-explorer/api/internal/tokens"
+	"github.com/josepheid/file-explorer/api/internal/totp"
+	"github.com/josepheid/file-explorer/api/internal/usage"
+	"github.com/josepheid/file-explorer/api/internal/watch"
 	"github.com/rs/cors"
+	"golang.org/x/crypto/ssh"
+)
+
+// Timeouts applied to connections unless overridden with WithTimeouts
+const (
+	DefaultReadHeaderTimeout = 10 * time.Second
+	DefaultWriteTimeout      = 5 * time.Minute
+	DefaultIdleTimeout       = 2 * time.Minute
 )
 
 // Server serves the directory browser API and webapp.
 type Server struct {
 	handler http.Handler
+	server  *http.Server
+	// certFile and keyFile hold the serving certificate and its key in PEM format
+	certFile string
+	keyFile  string
+	// clientCAs is set when mutual TLS is enabled
+	clientCAs *x509.CertPool
+	// auditLog is set when audit logging is enabled
+	auditLog *audit.Log
+	// metricsServer is set when metrics are served on a separate listener
+	metricsServer *http.Server
+	watcher       *watch.Service
+	usage         *usage.Manager
+	duplicates    *duplicates.Manager
+	logger        *slog.Logger
+	// sftpServer is set when files are also served over SFTP, on sftpAddr
+	sftpServer *sftpd.Server
+	sftpAddr   string
+	// certificate is the serving certificate, set once ListenAndServe has loaded it
+	certificate atomic.Pointer[x509.Certificate]
+	// thumbnailTemp is set when thumbnails are cached in a temporary directory, which is removed on shutdown
+	thumbnailTemp string
 }
 
 // NewServer creates a directory browser server.
 // It serves webassets from the provided filesystem.
-func NewServer(webassets fs.FS, rootPath string) (*Server, error) {
+func NewServer(webassets fs.FS, rootPath string, opts ...Option) (*Server, error) {
+	var cfg config
+	for _, opt := range opts {
+		if err := opt(&cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.logger == nil {
+		cfg.logger = slog.Default()
+	}
+	if cfg.certFile == "" {
+		cfg.certFile = "./api/internal/certs/localhost.pem"
+		cfg.keyFile = "./api/internal/certs/localhost-key.pem"
+	}
+	if !cfg.timeoutsSet {
+		cfg.readHeaderTimeout = DefaultReadHeaderTimeout
+		cfg.writeTimeout = DefaultWriteTimeout
+		cfg.idleTimeout = DefaultIdleTimeout
+	}
+	if cfg.thumbnailJobs == 0 {
+		cfg.thumbnailJobs = runtime.NumCPU()
+	}
+
 	mux := http.NewServeMux()
-	s := &Server{handler: mux}
+	s := &Server{
+		handler:   mux,
+		certFile:  cfg.certFile,
+		keyFile:   cfg.keyFile,
+		clientCAs: cfg.clientCAs,
+		logger:    cfg.logger,
+	}
+
+	// release the audit log, watcher and background job managers if a later step fails
+	created := false
+	defer func() {
+		if created {
+			return
+		}
+		if s.auditLog != nil {
+			s.auditLog.Close()
+		}
+		if s.watcher != nil {
+			s.watcher.Close()
+		}
+		if s.usage != nil {
+			s.usage.Close()
+		}
+		if s.duplicates != nil {
+			s.duplicates.Close()
+		}
+		if s.thumbnailTemp != "" {
+			os.RemoveAll(s.thumbnailTemp)
+		}
+	}()
 
-	auth := auth.New()
+	if cfg.auditPath != "" {
+		auditLog, err := audit.New(cfg.auditPath, cfg.auditMaxSize, cfg.auditMaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		s.auditLog = auditLog
+	}
+	// every API request is recorded in the audit log, if one is configured
+	audited := func(action string, h http.Handler) http.Handler {
+		return middleware.Audit(s.auditLog, action)(h)
+	}
+
+	authService := auth.New()
 	session := sessions.New()
 
-	// API routes
-	mux.Handle("POST /api/v1/login", handlers.NewLoginHandler(auth, session))
-	mux.Handle("POST /api/v1/logout", handlers.NewLogoutHandler(session))
+	var serverMetrics *metrics.Metrics
+	if cfg.metrics {
+		serverMetrics = metrics.New(session.Count)
+	}
+	tokenService := tokens.New()
+	totpService := totp.New("File Explorer")
+
+	// local users are checked first, then the directory if one is configured
+	var authenticator auth.Authenticator = authService
+	if cfg.ldap != nil {
+		directory, err := auth.NewLDAP(*cfg.ldap)
+		if err != nil {
+			return nil, err
+		}
+		authenticator = auth.Chain{authService, directory}
+	}
+
+	authOpts := []middleware.Option{middleware.WithTokens(tokenService)}
+	if cfg.clientCAs != nil {
+		for identity, username := range cfg.clientCertUsers {
+			authService.MapCertificate(identity, username)
+		}
+		authOpts = append(authOpts, middleware.WithClientCertificates(authService))
+	}
+	requireAuth := middleware.RequireAuth(session, authOpts...)
+
+	// Probes for orchestrators, they are deliberately not authenticated
+	readiness := health.NewChecker(
+		health.Check{Name: "root", Func: health.DirectoryReadable(rootPath)},
+		health.Check{Name: "certificate", Func: s.checkCertificate},
+		// sessions are held in memory, the check times out if the store is stuck behind its lock
+		health.Check{Name: "sessions", Func: func(ctx context.Context) error {
+			session.Count()
+			return nil
+		}},
+	)
+	mux.Handle("GET /healthz", handlers.NewHealthHandler())
+	mux.Handle("GET /readyz", handlers.NewReadyHandler(readiness))
+
+	// API routes, every route registered here is described in openapi.json
+	mux.Handle("GET /api/v1/openapi.json", handlers.NewOpenAPIHandler(openAPISpec))
+	mux.Handle("POST /api/v1/login", audited("login", handlers.NewLoginHandler(authenticator, session, totpService)))
+	mux.Handle("POST /api/v1/login/totp", audited("login.totp", handlers.NewTOTPLoginHandler(totpService, session)))
+	mux.Handle("POST /api/v1/logout", audited("logout", handlers.NewLogoutHandler(session)))
+
+	if cfg.oidc != nil {
+		sso := oidc.New(oidc.Config(*cfg.oidc))
+		mux.Handle("GET /api/v1/oidc/login", audited("oidc.login", handlers.NewOIDCLoginHandler(sso)))
+		mux.Handle("GET /api/v1/oidc/callback", audited("oidc.callback", handlers.NewOIDCCallbackHandler(sso, session)))
+	}
 
 	// Protected routes
-	mux.Handle("GET /api/v1/browse", middleware.RequireAuth(session)(handlers.NewBrowseHandler(rootPath)))
+	mux.Handle("GET /api/v1/browse", audited("browse", requireAuth(middleware.RequireScope(tokens.ScopeRead)(handlers.NewBrowseHandler(rootPath)))))
+	mux.Handle("GET /api/v1/stat", audited("stat", requireAuth(middleware.RequireScope(tokens.ScopeRead)(handlers.NewStatHandler(rootPath)))))
+
+	// File previews, the stylesheet for highlighted code holds nothing private
+	mux.Handle("GET /api/v1/preview", audited("preview", requireAuth(middleware.RequireScope(tokens.ScopeRead)(handlers.NewPreviewHandler(rootPath)))))
+	mux.Handle("GET /api/v1/preview/style.css", handlers.NewPreviewStyleHandler())
+
+	// Image thumbnails, generated on demand and cached on disk. Without a configured directory they are cached in one
+	// only this process can use, as a fixed path below the shared temporary directory could be created by anyone.
+	if cfg.thumbnailDir == "" {
+		dir, err := os.MkdirTemp("", "file-explorer-thumbnails-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create thumbnail cache: %w", err)
+		}
+		s.thumbnailTemp = dir
+		cfg.thumbnailDir = dir
+	}
+	thumbnails, err := thumbnail.New(cfg.thumbnailDir, cfg.thumbnailJobs)
+	if err != nil {
+		return nil, err
+	}
+	mux.Handle("GET /api/v1/thumbnail", audited("thumbnail", requireAuth(middleware.RequireScope(tokens.ScopeRead)(handlers.NewThumbnailHandler(rootPath, thumbnails)))))
+
+	// Live directory updates, streams are ended on shutdown so they do not hold up draining
+	watcher, err := watch.New(watch.DefaultDebounce, cfg.logger)
+	if err != nil {
+		return nil, err
+	}
+	s.watcher = watcher
+	mux.Handle("GET /api/v1/watch", audited("watch", requireAuth(middleware.RequireScope(tokens.ScopeRead)(handlers.NewWatchHandler(rootPath, watcher)))))
+
+	// Checksums, verifying a manifest only reads files so it needs no more than read scope
+	sums := checksum.New()
+	mux.Handle("GET /api/v1/checksum", audited("checksum", requireAuth(middleware.RequireScope(tokens.ScopeRead)(handlers.NewChecksumHandler(rootPath, sums)))))
+	mux.Handle("GET /api/v1/checksum/manifest", audited("checksum.manifest", requireAuth(middleware.RequireScope(tokens.ScopeRead)(handlers.NewManifestHandler(rootPath, sums)))))
+	mux.Handle("POST /api/v1/checksum/verify", audited("checksum.verify", requireAuth(middleware.RequireScope(tokens.ScopeRead)(handlers.NewVerifyHandler(rootPath, sums)))))
+
+	// Disk usage analysis runs in the background, clients poll until the report is ready
+	s.usage = usage.New()
+	usageHandler := handlers.NewUsageHandler(rootPath, s.usage)
+	mux.Handle("GET /api/v1/usage", audited("usage", requireAuth(middleware.RequireScope(tokens.ScopeRead)(usageHandler))))
+	mux.Handle("DELETE /api/v1/usage", audited("usage.cancel", requireAuth(middleware.RequireScope(tokens.ScopeRead)(usageHandler))))
+
+	// Duplicate searches also run in the background, sharing cached checksums with the checksum endpoints
+	s.duplicates = duplicates.New(sums)
+	duplicatesHandler := handlers.NewDuplicatesHandler(rootPath, s.duplicates)
+	mux.Handle("GET /api/v1/duplicates", audited("duplicates", requireAuth(middleware.RequireScope(tokens.ScopeRead)(duplicatesHandler))))
+	mux.Handle("DELETE /api/v1/duplicates", audited("duplicates.cancel", requireAuth(middleware.RequireScope(tokens.ScopeRead)(duplicatesHandler))))
+
+	// Share links, creating one hands out access so it needs write scope. Shared files are served without a login,
+	// the secret in the URL confines each request to the shared file or directory.
+	shareService := shares.New()
+	mux.Handle("POST /api/v1/shares", audited("share.create", requireAuth(middleware.RequireScope(tokens.ScopeWrite)(handlers.NewCreateShareHandler(rootPath, shareService)))))
+	mux.Handle("GET /api/v1/shares", audited("share.list", requireAuth(middleware.RequireScope(tokens.ScopeRead)(handlers.NewListSharesHandler(shareService)))))
+	mux.Handle("DELETE /api/v1/shares/{id}", audited("share.revoke", requireAuth(middleware.RequireScope(tokens.ScopeWrite)(handlers.NewRevokeShareHandler(shareService)))))
+	mux.Handle("GET /api/v1/shared/{token}", audited("share.open", handlers.NewSharedHandler(rootPath, shareService)))
+
+	// WebDAV for file managers, which cannot log in so they send basic auth with every request.
+	// It is kept off the API routes so browsers never see a basic auth challenge from them.
+	if cfg.davEnabled {
+		davAuth := middleware.RequireAuth(session, append(slices.Clone(authOpts), middleware.WithBasicAuth(authenticator, totpService.Enabled, "File Explorer"))...)
+		dav := davAuth(middleware.RequireScope(tokens.ScopeRead)(handlers.NewDAVHandler(rootPath, cfg.davWritable)))
+		mux.Handle(handlers.DAVPrefix+"/", audited("dav", dav))
+	} else {
+		// answered here rather than by the web app, so clients do not take index.html for a file
+		mux.Handle(handlers.DAVPrefix+"/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			respond.WithError(w, r, respond.CodeWebDAVDisabled, "WebDAV is not enabled on this server")
+		}))
+	}
+
+	// SFTP for clients that do not speak HTTP, on its own listener but with the same users and access rules
+	if cfg.sftp != nil {
+		var hostKey ssh.Signer
+		if cfg.sftp.HostKeyFile != "" {
+			hostKey, err = sftpd.LoadHostKey(cfg.sftp.HostKeyFile)
+		} else {
+			cfg.logger.Warn("no SFTP host key configured, generated one that changes on every restart")
+			hostKey, err = sftpd.GenerateHostKey()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if cfg.sftp.AuthorizedKeysDir != "" {
+			if err := authService.LoadAuthorizedKeys(cfg.sftp.AuthorizedKeysDir); err != nil {
+				return nil, err
+			}
+		}
+
+		s.sftpServer = sftpd.New(sftpd.Config{
+			Root:         rootPath,
+			HostKey:      hostKey,
+			Credentials:  authenticator,
+			SecondFactor: totpService.Enabled,
+			Keys:         authService.KeyAuthorized,
+			Tokens:       tokenService,
+			Writable:     cfg.sftp.Writable,
+			AuditLog:     s.auditLog,
+			Logger:       cfg.logger,
+		})
+		s.sftpAddr = cfg.sftp.Addr
+	}
+
+	// Account management is limited to admin scope, which sessions and client certificates always have
+	requireAdmin := func(h http.Handler) http.Handler {
+		return requireAuth(middleware.RequireScope(tokens.ScopeAdmin)(h))
+	}
+	mux.Handle("POST /api/v1/tokens", audited("token.create", requireAdmin(handlers.NewCreateTokenHandler(tokenService))))
+	mux.Handle("GET /api/v1/tokens", audited("token.list", requireAdmin(handlers.NewListTokensHandler(tokenService))))
+	mux.Handle("DELETE /api/v1/tokens/{id}", audited("token.revoke", requireAdmin(handlers.NewRevokeTokenHandler(tokenService))))
+
+	// Two-factor authentication enrolment
+	mux.Handle("POST /api/v1/totp/enroll", audited("totp.enroll", requireAdmin(handlers.NewTOTPEnrollHandler(totpService))))
+	mux.Handle("POST /api/v1/totp/confirm", audited("totp.confirm", requireAdmin(handlers.NewTOTPConfirmHandler(totpService))))
+	mux.Handle("POST /api/v1/totp/disable", audited("totp.disable", requireAdmin(handlers.NewTOTPDisableHandler(totpService))))
+
+	// Metrics are either protected like the rest of the API or only served on their own listener
+	if serverMetrics != nil {
+		if cfg.metricsAddr == "" {
+			mux.Handle("GET /metrics", requireAuth(middleware.RequireScope(tokens.ScopeRead)(serverMetrics.Handler())))
+		} else {
+			metricsMux := http.NewServeMux()
+			metricsMux.Handle("GET /metrics", serverMetrics.Handler())
+			s.metricsServer = &http.Server{
+				Addr:              cfg.metricsAddr,
+				Handler:           metricsMux,
+				ReadHeaderTimeout: cfg.readHeaderTimeout,
+				WriteTimeout:      cfg.writeTimeout,
+				IdleTimeout:       cfg.idleTimeout,
+				ErrorLog:          slog.NewLogLogger(cfg.logger.Handler(), slog.LevelWarn),
+			}
+		}
+	}
+
+	// The audit log itself can only be read by the configured administrators
+	if s.auditLog != nil {
+		requireAuditor := func(h http.Handler) http.Handler {
+			return requireAuth(middleware.RequireAdmin(cfg.adminUsers)(h))
+		}
+		mux.Handle("GET /api/v1/audit", audited("audit.query", requireAuditor(handlers.NewAuditHandler(s.auditLog))))
+	}
 
 	// web assets
 	hfs := http.FS(webassets)
@@ -49,23 +351,86 @@ func NewServer(webassets fs.FS, rootPath string) (*Server, error) {
 	}
 	mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if _, err := w.Write(index); err != nil {
-			log.Println("failed to serve index.html", err)
+			middleware.LoggerFromContext(r.Context()).Error("failed to serve index.html", slog.Any("error", err))
 		}
 	}))
 
-	s.handler = cors.Default().Handler(mux)
+	// every request gets an ID and is logged, including the web assets
+	s.handler = middleware.RequestID(middleware.Logging(cfg.logger)(middleware.Instrument(serverMetrics)(cors.Default().Handler(mux))))
+
+	// The write timeout bounds ordinary responses. Responses that can take longer manage their own deadline with
+	// http.ResponseController: streams (watch, checksum manifests) and downloads (share links, WebDAV) extend it on
+	// every write, and checksums lift it while hashing, see handlers/deadline.go.
+	s.server = &http.Server{
+		Handler:           s.handler,
+		ReadHeaderTimeout: cfg.readHeaderTimeout,
+		WriteTimeout:      cfg.writeTimeout,
+		IdleTimeout:       cfg.idleTimeout,
+		ErrorLog:          slog.NewLogLogger(cfg.logger.Handler(), slog.LevelWarn),
+	}
+	s.server.RegisterOnShutdown(func() {
+		if err := watcher.Close(); err != nil {
+			cfg.logger.Error("failed to stop directory watcher", slog.Any("error", err))
+		}
+	})
+	s.server.RegisterOnShutdown(s.usage.Close)
+	s.server.RegisterOnShutdown(s.duplicates.Close)
 
+	created = true
 	return s, nil
 }
 
+// ServeHTTP serves a request with the server's handler, e.g. to run the API in tests with httptest
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// ListenAndServe serves the API over TLS on addr until Shutdown is called, when it returns http.ErrServerClosed.
+// If mutual TLS was enabled with WithClientCA, client certificates are verified against the configured CA bundle.
 func (s *Server) ListenAndServe(addr string) error {
-	certFile := "./api/internal/certs/localhost.pem"
-	keyFile := "./api/internal/certs/localhost-key.pem"
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
 
-	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	return s.serve(ln)
+}
+
+// Shutdown gracefully stops the server: listeners are closed straight away, then it waits for in-flight requests,
+// such as downloads, to complete until ctx is done. SFTP sessions are ended without waiting, as they can stay open
+// indefinitely. Finally the audit log is flushed and closed, and a temporary thumbnail cache removed.
+// Sessions are only held in memory and do not survive a restart.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.server.Shutdown(ctx)
+	if s.metricsServer != nil {
+		err = errors.Join(err, s.metricsServer.Shutdown(ctx))
+	}
+	if s.sftpServer != nil {
+		err = errors.Join(err, s.sftpServer.Close())
+	}
+	if s.auditLog != nil {
+		err = errors.Join(err, s.auditLog.Close())
+	}
+	if s.thumbnailTemp != "" {
+		err = errors.Join(err, os.RemoveAll(s.thumbnailTemp))
+	}
+
+	return err
+}
+
+// serve loads the TLS certificate and serves the API on ln, and SFTP and metrics on their own listeners if configured
+func (s *Server) serve(ln net.Listener) error {
+	cert, err := tls.LoadX509KeyPair(s.certFile, s.keyFile)
 	if err != nil {
+		ln.Close()
 		return fmt.Errorf("failed to load TLS certificate: %w", err)
 	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		ln.Close()
+		return fmt.Errorf("failed to parse TLS certificate: %w", err)
+	}
+	s.certificate.Store(leaf)
 
 	tlsConfig := &tls.Config{
 		Certificates: []tls.Certificate{cert},
@@ -88,13 +453,64 @@ func (s *Server) ListenAndServe(addr string) error {
 		PreferServerCipherSuites: true,
 	}
 
-	server := &http.Server{
-		Addr:      addr,
-		Handler:   s.handler,
-		TLSConfig: tlsConfig,
+	// With mutual TLS enabled, certificates are verified if presented but not required,
+	// so browser users without one can still log in with a password
+	if s.clientCAs != nil {
+		tlsConfig.ClientCAs = s.clientCAs
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
 	}
 
-	return server.ListenAndServeTLS(certFile, keyFile)
+	s.server.TLSConfig = tlsConfig
+
+	// like metrics, SFTP is listened for before serving the API so a bad address is reported straight away
+	if s.sftpServer != nil {
+		sftpLn, err := net.Listen("tcp", s.sftpAddr)
+		if err != nil {
+			ln.Close()
+			return fmt.Errorf("failed to listen for SFTP: %w", err)
+		}
+		s.logger.Info("serving SFTP", slog.String("addr", sftpLn.Addr().String()))
+		go func() {
+			if err := s.sftpServer.Serve(sftpLn); !errors.Is(err, sftpd.ErrServerClosed) {
+				s.logger.Error("SFTP listener stopped", slog.Any("error", err))
+			}
+		}()
+	}
+
+	if s.metricsServer != nil {
+		// listen before serving the API, so a bad metrics address is reported straight away
+		metricsLn, err := net.Listen("tcp", s.metricsServer.Addr)
+		if err != nil {
+			ln.Close()
+			if s.sftpServer != nil {
+				s.sftpServer.Close()
+			}
+			return fmt.Errorf("failed to listen for metrics: %w", err)
+		}
+		s.logger.Info("serving metrics", slog.String("addr", metricsLn.Addr().String()))
+		go func() {
+			if err := s.metricsServer.Serve(metricsLn); !errors.Is(err, http.ErrServerClosed) {
+				s.logger.Error("metrics listener stopped", slog.Any("error", err))
+			}
+		}()
+	}
+
+	// the certificate is already in tlsConfig
+	return s.server.ServeTLS(ln, "", "")
+}
+
+// checkCertificate reports whether the serving certificate is loaded and currently valid
+func (s *Server) checkCertificate(ctx context.Context) error {
+	cert := s.certificate.Load()
+	if cert == nil {
+		return errors.New("TLS certificate not loaded")
+	}
+
+	now := time.Now()
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return fmt.Errorf("TLS certificate is only valid from %s to %s", cert.NotBefore.Format(time.RFC3339), cert.NotAfter.Format(time.RFC3339))
+	}
+	return nil
 }
 
 func extractIndexHTML(fs http.FileSystem) ([]byte, error) {
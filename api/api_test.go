@@ -0,0 +1,448 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/josepheid/file-explorer/api/internal/audit"
+)
+
+// writeCertificate writes a self-signed certificate for 127.0.0.1 and its key to dir
+func writeCertificate(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// writeClientCertificate writes a self-signed client certificate for commonName to dir, returning the file to trust
+// it with as a CA and the certificate for clients to present
+func writeClientCertificate(t *testing.T, dir, commonName string) (caFile string, cert tls.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caFile = filepath.Join(dir, "client-ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return caFile, tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// startServer serves s on a random local port, returning its base URL and the result of serving
+func startServer(t *testing.T, s *Server) (string, <-chan error) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- s.serve(ln)
+	}()
+
+	return "https://" + ln.Addr().String(), done
+}
+
+func newTestServer(t *testing.T, opts ...Option) *Server {
+	t.Helper()
+
+	certFile, keyFile := writeCertificate(t, t.TempDir())
+	webassets := fstest.MapFS{"index.html": {Data: []byte("<html></html>")}}
+
+	s, err := NewServer(webassets, t.TempDir(), append([]Option{WithTLSCertificate(certFile, keyFile), WithThumbnails(t.TempDir(), 1)}, opts...)...)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	return s
+}
+
+var testClient = &http.Client{
+	Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	Timeout:   5 * time.Second,
+}
+
+func TestServerProbes(t *testing.T) {
+	s := newTestServer(t)
+	url, done := startServer(t, s)
+	defer func() {
+		s.Shutdown(context.Background())
+		<-done
+	}()
+
+	for _, path := range []string{"/healthz", "/readyz"} {
+		resp, err := testClient.Get(url + path)
+		if err != nil {
+			t.Fatalf("GET %s error = %v", path, err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s status = %d, want %d", path, resp.StatusCode, http.StatusOK)
+		}
+	}
+}
+
+func TestServerShutdown(t *testing.T) {
+	s := newTestServer(t, WithAuditLog(filepath.Join(t.TempDir(), "audit.log"), 1<<20, 1))
+
+	// a slow request stands in for a long download
+	started := make(chan struct{})
+	release := make(chan struct{})
+	api := s.server.Handler
+	s.server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(started)
+			<-release
+			w.Write([]byte("done"))
+			return
+		}
+		api.ServeHTTP(w, r)
+	})
+
+	url, done := startServer(t, s)
+
+	respErr := make(chan error, 1)
+	go func() {
+		resp, err := testClient.Get(url + "/slow")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				err = errors.New(resp.Status)
+			}
+		}
+		respErr <- err
+	}()
+	<-started
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		shutdownErr <- s.Shutdown(context.Background())
+	}()
+
+	select {
+	case err := <-shutdownErr:
+		t.Fatalf("Shutdown() returned before the in-flight request finished: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-respErr; err != nil {
+		t.Errorf("in-flight request failed: %v", err)
+	}
+	if err := <-shutdownErr; err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+	if err := <-done; !errors.Is(err, http.ErrServerClosed) {
+		t.Errorf("serve() error = %v, want http.ErrServerClosed", err)
+	}
+	if err := s.auditLog.Record(audit.Event{}); err == nil {
+		t.Error("expected audit log to be closed after Shutdown()")
+	}
+}
+
+func TestServerShutdownTimeout(t *testing.T) {
+	s := newTestServer(t)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	s.server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+
+	url, done := startServer(t, s)
+	go testClient.Get(url + "/slow")
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown() error = %v, want context.DeadlineExceeded", err)
+	}
+	<-done
+}
+
+func TestServerWebDAV(t *testing.T) {
+	s := newTestServer(t, WithWebDAV(true, false))
+	url, done := startServer(t, s)
+	defer func() {
+		s.Shutdown(context.Background())
+		<-done
+	}()
+
+	propfind := func(username, password string) *http.Response {
+		req, _ := http.NewRequest("PROPFIND", url+"/dav/", nil)
+		req.Header.Set("Depth", "1")
+		if username != "" {
+			req.SetBasicAuth(username, password)
+		}
+		resp, err := testClient.Do(req)
+		if err != nil {
+			t.Fatalf("PROPFIND error = %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	if resp := propfind("testuser", "password123"); resp.StatusCode != http.StatusMultiStatus {
+		t.Errorf("PROPFIND status = %d, want %d", resp.StatusCode, http.StatusMultiStatus)
+	}
+	resp := propfind("", "")
+	if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") == "" {
+		t.Errorf("PROPFIND without credentials = %d %v, want a basic auth challenge", resp.StatusCode, resp.Header)
+	}
+
+	// the API itself neither accepts basic auth nor challenges for it, so browsers never prompt
+	req, _ := http.NewRequest(http.MethodGet, url+"/api/v1/browse", nil)
+	req.SetBasicAuth("testuser", "password123")
+	resp, err := testClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /api/v1/browse error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") != "" {
+		t.Errorf("GET /api/v1/browse with basic auth = %d %v, want 401 without a challenge", resp.StatusCode, resp.Header)
+	}
+}
+
+func TestServerWebDAVDisabled(t *testing.T) {
+	// WebDAV is opt-in
+	s := newTestServer(t)
+	url, done := startServer(t, s)
+	defer func() {
+		s.Shutdown(context.Background())
+		<-done
+	}()
+
+	req, _ := http.NewRequest("PROPFIND", url+"/dav/", nil)
+	req.SetBasicAuth("testuser", "password123")
+	resp, err := testClient.Do(req)
+	if err != nil {
+		t.Fatalf("PROPFIND error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("PROPFIND status = %d, want %d without a WebDAV endpoint", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestServerSFTP(t *testing.T) {
+	// reserve a free port for the SFTP listener
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	s := newTestServer(t, WithSFTP(SFTPConfig{Addr: addr}))
+	_, done := startServer(t, s)
+
+	var conn *ssh.Client
+	for i := 0; ; i++ {
+		conn, err = ssh.Dial("tcp", addr, &ssh.ClientConfig{
+			User:            "testuser",
+			Auth:            []ssh.AuthMethod{ssh.Password("password123")},
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		})
+		if err == nil {
+			break
+		}
+		if i == 50 {
+			t.Fatalf("failed to connect over SFTP: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	defer conn.Close()
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		t.Fatalf("sftp.NewClient() error = %v", err)
+	}
+	if _, err := client.ReadDir("/"); err != nil {
+		t.Errorf("ReadDir() error = %v", err)
+	}
+
+	// shutdown ends open SFTP sessions instead of waiting for them
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+	<-done
+	if _, err := client.ReadDir("/"); err == nil {
+		t.Error("ReadDir() after shutdown succeeded")
+	}
+}
+
+func TestServerThumbnailCacheDefault(t *testing.T) {
+	home, tmp := t.TempDir(), t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(home, ".cache"))
+	t.Setenv("TMPDIR", tmp)
+
+	certFile, keyFile := writeCertificate(t, t.TempDir())
+	webassets := fstest.MapFS{"index.html": {Data: []byte("<html></html>")}}
+	s, err := NewServer(webassets, t.TempDir(), WithTLSCertificate(certFile, keyFile))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+
+	if entries, _ := os.ReadDir(home); len(entries) != 0 {
+		t.Errorf("server wrote %v into the home directory", entries)
+	}
+	// the cache is a directory of the server's own rather than a fixed path another user could create first
+	caches, _ := filepath.Glob(filepath.Join(tmp, "file-explorer-thumbnails-*"))
+	if len(caches) != 1 {
+		t.Fatalf("expected one thumbnail cache in the temporary directory, got %v", caches)
+	}
+	if info, err := os.Stat(caches[0]); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("thumbnail cache %v, %v, want a directory only the server can use", info, err)
+	}
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if _, err := os.Stat(caches[0]); !os.IsNotExist(err) {
+		t.Errorf("thumbnail cache not removed on shutdown: %v", err)
+	}
+}
+
+func TestServerSlowDownloads(t *testing.T) {
+	// the file has to be larger than the socket buffers, so the server is still writing when the write timeout passes
+	root := t.TempDir()
+	data := make([]byte, 16<<20)
+	if err := os.WriteFile(filepath.Join(root, "large.bin"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the client authenticates with a certificate, as checking a password can take longer than the write timeout
+	// under the race detector
+	certFile, keyFile := writeCertificate(t, t.TempDir())
+	caFile, clientCert := writeClientCertificate(t, t.TempDir(), "testuser")
+	webassets := fstest.MapFS{"index.html": {Data: []byte("<html></html>")}}
+	s, err := NewServer(webassets, root, WithTLSCertificate(certFile, keyFile), WithClientCA(caFile),
+		WithThumbnails(t.TempDir(), 1), WithWebDAV(true, false), WithTimeouts(time.Second, 200*time.Millisecond, time.Second))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	url, done := startServer(t, s)
+	defer func() {
+		s.Shutdown(context.Background())
+		<-done
+	}()
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true, Certificates: []tls.Certificate{clientCert}}},
+		Timeout:   30 * time.Second,
+	}
+
+	// a share link to the file
+	resp, err := client.Post(url+"/api/v1/shares", "application/json", bytes.NewBufferString(`{"path": "/large.bin"}`))
+	if err != nil {
+		t.Fatalf("create share error = %v", err)
+	}
+	var share struct {
+		URL string `json:"url"`
+	}
+	json.NewDecoder(resp.Body).Decode(&share)
+	resp.Body.Close()
+	if share.URL == "" {
+		t.Fatalf("create share status = %d, want a link", resp.StatusCode)
+	}
+
+	for name, path := range map[string]string{"share": share.URL, "webdav": "/dav/large.bin"} {
+		t.Run(name, func(t *testing.T) {
+			resp, err := client.Get(url + path)
+			if err != nil {
+				t.Fatalf("GET error = %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("GET status = %d, want %d", resp.StatusCode, http.StatusOK)
+			}
+
+			// read slowly, so the download takes several times the write timeout
+			start := time.Now()
+			var n int64
+			for {
+				read, err := io.CopyN(io.Discard, resp.Body, 1<<20)
+				n += read
+				if err != nil {
+					break
+				}
+				time.Sleep(50 * time.Millisecond)
+			}
+			if n != int64(len(data)) {
+				t.Errorf("read %d bytes in %v, want all %d", n, time.Since(start), len(data))
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/josepheid/file-explorer/api/internal/audit"
+	"github.com/josepheid/file-explorer/api/internal/middleware"
+	"github.com/josepheid/file-explorer/api/internal/respond"
+)
+
+// defaultAuditLimit is how many events are returned when no limit is given
+const defaultAuditLimit = 1000
+
+// AuditHandler queries the audit log
+type AuditHandler struct {
+	log *audit.Log
+}
+
+// NewAuditHandler creates a new AuditHandler, it takes an audit log as a parameter
+func NewAuditHandler(log *audit.Log) *AuditHandler {
+	return &AuditHandler{log: log}
+}
+
+// AuditResponse represents the response body for an audit log query
+type AuditResponse struct {
+	Events []audit.Event `json:"events"`
+}
+
+// ServeHTTP handles the audit query. It accepts the optional query parameters user, path (a prefix),
+// from and to (RFC 3339 times) and limit, and returns the most recent matching events in chronological order.
+func (h *AuditHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respond.WithError(w, r, respond.CodeMethodNotAllowed, "Method not allowed, method: "+r.Method)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := audit.Filter{
+		UserID:     query.Get("user"),
+		PathPrefix: query.Get("path"),
+		Limit:      defaultAuditLimit,
+	}
+
+	var err error
+	if from := query.Get("from"); from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			respondInvalidParameter(w, r, "from", "Invalid from time, expected RFC 3339")
+			return
+		}
+	}
+	if to := query.Get("to"); to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			respondInvalidParameter(w, r, "to", "Invalid to time, expected RFC 3339")
+			return
+		}
+	}
+	if limit := query.Get("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit <= 0 {
+			respondInvalidParameter(w, r, "limit", "Invalid limit")
+			return
+		}
+	}
+
+	events, err := h.log.Query(filter)
+	if err != nil {
+		middleware.LoggerFromContext(r.Context()).Error("failed to read audit log", slog.Any("error", err))
+		respond.WithError(w, r, respond.CodeInternal, "Failed to read audit log")
+		return
+	}
+
+	respond.WithJSON(w, AuditResponse{Events: events}, http.StatusOK)
+}
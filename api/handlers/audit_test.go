@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/josepheid/file-explorer/api/internal/audit"
+)
+
+func TestAuditHandler(t *testing.T) {
+	auditLog, err := audit.New(filepath.Join(t.TempDir(), "audit.log"), 1<<20, 1)
+	if err != nil {
+		t.Fatalf("audit.New() error = %v", err)
+	}
+	defer auditLog.Close()
+
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i, user := range []string{"alice", "bob", "alice"} {
+		e := audit.Event{Time: base.Add(time.Duration(i) * time.Hour), Action: "browse", UserID: user, Path: "/builds"}
+		if err := auditLog.Record(e); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		query      string
+		wantStatus int
+		wantEvents int
+	}{
+		{name: "all events", method: http.MethodGet, wantStatus: http.StatusOK, wantEvents: 3},
+		{name: "by user", method: http.MethodGet, query: "?user=alice", wantStatus: http.StatusOK, wantEvents: 2},
+		{name: "by path", method: http.MethodGet, query: "?path=/logs", wantStatus: http.StatusOK, wantEvents: 0},
+		{name: "time range", method: http.MethodGet, query: "?from=2024-01-01T12:30:00Z&to=2024-01-01T13:30:00Z", wantStatus: http.StatusOK, wantEvents: 1},
+		{name: "limit", method: http.MethodGet, query: "?limit=2", wantStatus: http.StatusOK, wantEvents: 2},
+		{name: "invalid time", method: http.MethodGet, query: "?from=yesterday", wantStatus: http.StatusBadRequest},
+		{name: "invalid limit", method: http.MethodGet, query: "?limit=0", wantStatus: http.StatusBadRequest},
+		{name: "wrong method", method: http.MethodPost, wantStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/v1/audit"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			NewAuditHandler(auditLog).ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, rr.Code)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp AuditResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if len(resp.Events) != tt.wantEvents {
+				t.Errorf("expected %d events, got %d", tt.wantEvents, len(resp.Events))
+			}
+		})
+	}
+}
@@ -1,26 +1,42 @@
 package handlers
 
 import (
+	"context"
+	"log/slog"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
-	"strings"
+	"time"
 
+	"github.com/josepheid/file-explorer/api/internal/dirsize"
+	"github.com/josepheid/file-explorer/api/internal/metrics"
+	"github.com/josepheid/file-explorer/api/internal/middleware"
 	"github.com/josepheid/file-explorer/api/internal/respond"
+	"github.com/josepheid/file-explorer/api/internal/thumbnail"
 )
 
+// recursiveSizeTimeout bounds the time spent computing recursive sizes for one listing,
+// sizes not computed in time are returned as approximate
+const recursiveSizeTimeout = 10 * time.Second
+
 type BrowseHandler struct {
 	rootDir string
+	sizes   *dirsize.Calculator
 }
 
 func NewBrowseHandler(rootDir string) *BrowseHandler {
-	return &BrowseHandler{rootDir: rootDir}
+	return &BrowseHandler{rootDir: rootDir, sizes: dirsize.New(0)}
 }
 
 type FileInfo struct {
 	Name string `json:"name"`
 	Type string `json:"type"`
 	Size int64  `json:"size"`
+	// Thumbnail links to a preview of images, it is only set when requested with thumbnails=true
+	Thumbnail string `json:"thumbnail,omitempty"`
+	// Approximate is set for directories whose recursive size could not be computed in full
+	Approximate bool `json:"approximate,omitempty"`
 }
 
 type BrowseResponse struct {
@@ -28,46 +44,20 @@ type BrowseResponse struct {
 	Type     string     `json:"type"`
 	Size     int64      `json:"size"`
 	Contents []FileInfo `json:"contents"`
+	// Approximate is set if a recursive size could not be computed in full
+	Approximate bool `json:"approximate,omitempty"`
 }
 
 func (h *BrowseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Only allow GET requests
 	if r.Method != http.MethodGet {
-		respond.WithError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		respond.WithError(w, r, respond.CodeMethodNotAllowed, "Method not allowed, method: "+r.Method)
 		return
 	}
 
-	// Get the path from query parameters
-	requestPath := r.URL.Query().Get("path")
-	if requestPath == "" {
-		requestPath = "/"
-	}
-
-	// Clean and validate the path format
-	cleanPath := filepath.Clean(requestPath)
-	if !strings.HasPrefix(cleanPath, "/") {
-		respond.WithError(w, "Invalid path", http.StatusBadRequest)
-		return
-	}
-
-	absRootDir, err := filepath.Abs(h.rootDir)
+	cleanPath, absPath, err := resolvePath(r, h.rootDir, r.URL.Query().Get("path"))
 	if err != nil {
-		respond.WithError(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
-
-	// Construct and validate the full filesystem path
-	fullPath := filepath.Join(absRootDir, cleanPath)
-	absPath, err := filepath.Abs(fullPath)
-	if err != nil {
-		respond.WithError(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
-
-	// Validate that the requested path is within the root directory
-	// This needs to happen before we check if the path exists
-	if !isSubpath(absRootDir, absPath) {
-		respond.WithError(w, "Invalid path", http.StatusBadRequest)
+		respondPathError(w, r, err)
 		return
 	}
 
@@ -75,24 +65,37 @@ func (h *BrowseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// check if it exists and get file info
 	info, err := os.Stat(absPath)
 	if err != nil {
-		if os.IsNotExist(err) {
-			respond.WithError(w, "Path not found", http.StatusNotFound)
-		} else {
-			respond.WithError(w, "Internal server error", http.StatusInternalServerError)
-		}
+		respondStatError(w, r, cleanPath, err)
 		return
 	}
 
 	// Check if path is a directory
 	if !info.IsDir() {
-		respond.WithError(w, "Path is not a directory", http.StatusBadRequest)
+		respond.WithError(w, r, respond.CodeNotADirectory, "Path is not a directory")
 		return
 	}
 
+	withThumbnails := r.URL.Query().Get("thumbnails") == "true"
+
+	// With size=recursive, directories are sized by their contents like du, rather than by the directory inode
+	var recursive bool
+	switch r.URL.Query().Get("size") {
+	case "":
+	case "recursive":
+		recursive = true
+	default:
+		respondInvalidParameter(w, r, "size", "Invalid size, expected recursive")
+		return
+	}
+	sizeCtx, cancel := context.WithTimeout(r.Context(), recursiveSizeTimeout)
+	defer cancel()
+	approximate := false
+
 	// Read directory contents
 	dir, err := os.ReadDir(absPath)
 	if err != nil {
-		respond.WithError(w, "Error reading directory", http.StatusInternalServerError)
+		middleware.LoggerFromContext(r.Context()).Error("failed to read directory", slog.String("path", cleanPath), slog.Any("error", err))
+		respond.WithError(w, r, respond.CodeInternal, "Error reading directory")
 		return
 	}
 
@@ -111,30 +114,34 @@ func (h *BrowseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			fileType = "dir"
 		}
 
-		contents = append(contents, FileInfo{
+		fileInfo := FileInfo{
 			Name: info.Name(),
 			Type: fileType,
 			Size: info.Size(),
-		})
+		}
+		if recursive && info.IsDir() {
+			size := h.sizes.Size(sizeCtx, filepath.Join(absPath, info.Name()))
+			fileInfo.Size = size.Size
+			fileInfo.Approximate = size.Approximate
+			approximate = approximate || size.Approximate
+		}
+		if withThumbnails && info.Mode().IsRegular() && thumbnail.Supported(info.Name()) {
+			fileInfo.Thumbnail = thumbnailURL(path.Join(cleanPath, info.Name()), info)
+		}
+		contents = append(contents, fileInfo)
 
-		totalSize += info.Size()
+		totalSize += fileInfo.Size
 	}
 
+	metrics.FromContext(r.Context()).ObserveListing(len(contents))
+
 	response := BrowseResponse{
-		Name:     filepath.Base(cleanPath),
-		Type:     "dir",
-		Size:     totalSize,
-		Contents: contents,
+		Name:        filepath.Base(cleanPath),
+		Type:        "dir",
+		Size:        totalSize,
+		Contents:    contents,
+		Approximate: approximate,
 	}
 
 	respond.WithJSON(w, response, http.StatusOK)
 }
-
-// isSubpath checks if childPath is a subpath of parentPath
-func isSubpath(parentPath, childPath string) bool {
-	relativePath, err := filepath.Rel(parentPath, childPath)
-	if err != nil {
-		return false
-	}
-	return !strings.HasPrefix(relativePath, ".."+string(filepath.Separator)) && relativePath != ".."
-}
@@ -7,6 +7,8 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/josepheid/file-explorer/api/internal/middleware"
 )
 
 // setupTestDirectory creates a temporary directory structure for testing
@@ -278,3 +280,94 @@ func TestPathTraversalAttempts(t *testing.T) {
 		})
 	}
 }
+
+func TestBrowseHandlerPathRestriction(t *testing.T) {
+	rootDir, cleanup := setupTestDirectory(t)
+	defer cleanup()
+
+	identity := middleware.Identity{UserID: "testuser", Method: middleware.MethodToken, Path: "/dir1"}
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+	}{
+		{
+			name:           "Restricted Path",
+			path:           "/dir1",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Nested Restricted Path",
+			path:           "/dir1/subdir",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Outside Restricted Path",
+			path:           "/empty",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Traversal Out Of Restricted Path",
+			path:           "/dir1/../empty",
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewBrowseHandler(rootDir)
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/browse?path="+tt.path, nil)
+			req = req.WithContext(middleware.WithIdentity(req.Context(), identity))
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestBrowseHandlerRecursiveSize(t *testing.T) {
+	rootDir, cleanup := setupTestDirectory(t)
+	defer cleanup()
+
+	handler := NewBrowseHandler(rootDir)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/browse?path=/&size=recursive", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	var resp BrowseResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	sizes := make(map[string]int64)
+	for _, entry := range resp.Contents {
+		sizes[entry.Name] = entry.Size
+		if entry.Approximate {
+			t.Errorf("unexpected approximate size for %s", entry.Name)
+		}
+	}
+	if sizes["dir1"] != 600 || sizes["empty"] != 0 {
+		t.Errorf("expected recursive sizes dir1=600 and empty=0, got %v", sizes)
+	}
+	if resp.Size != 600 || resp.Approximate {
+		t.Errorf("expected exact total size 600, got %d (approximate %v)", resp.Size, resp.Approximate)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/browse?path=/&size=huge", nil)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d for an invalid size mode, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/josepheid/file-explorer/api/internal/checksum"
+	"github.com/josepheid/file-explorer/api/internal/middleware"
+	"github.com/josepheid/file-explorer/api/internal/respond"
+)
+
+// manifestWriteTimeout bounds each write of a manifest, which can take longer than the server's write timeout
+const manifestWriteTimeout = 30 * time.Second
+
+// ChecksumResponse represents the response body for the checksum request
+type ChecksumResponse struct {
+	Path      string `json:"path"`
+	Algorithm string `json:"algorithm"`
+	Checksum  string `json:"checksum"`
+	Size      int64  `json:"size"`
+}
+
+// ChecksumHandler computes the checksum of a file
+type ChecksumHandler struct {
+	rootDir string
+	sums    *checksum.Service
+}
+
+// NewChecksumHandler creates a new ChecksumHandler, it takes the root directory and a checksum service as parameters
+func NewChecksumHandler(rootDir string, sums *checksum.Service) *ChecksumHandler {
+	return &ChecksumHandler{rootDir: rootDir, sums: sums}
+}
+
+// ServeHTTP handles the checksum request for the file at path, the optional algorithm query parameter is one of
+// sha256 (the default), sha1, md5 or blake3
+func (h *ChecksumHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respond.WithError(w, r, respond.CodeMethodNotAllowed, "Method not allowed, method: "+r.Method)
+		return
+	}
+
+	algorithm, ok := checksumAlgorithm(w, r)
+	if !ok {
+		return
+	}
+
+	cleanPath, absPath, err := resolvePath(r, h.rootDir, r.URL.Query().Get("path"))
+	if err != nil {
+		respondPathError(w, r, err)
+		return
+	}
+
+	info, err := os.Stat(absPath)
+	if err != nil {
+		respondStatError(w, r, cleanPath, err)
+		return
+	}
+
+	restore := liftWriteDeadline(w)
+	sum, err := h.sums.File(r.Context(), absPath, algorithm)
+	restore()
+	if err != nil {
+		respondError(w, r, err, "failed to compute checksum", slog.String("path", cleanPath))
+		return
+	}
+
+	respond.WithJSON(w, ChecksumResponse{
+		Path:      cleanPath,
+		Algorithm: algorithm,
+		Checksum:  sum,
+		Size:      info.Size(),
+	}, http.StatusOK)
+}
+
+// ManifestHandler writes the checksums of every file below a directory
+type ManifestHandler struct {
+	rootDir string
+	sums    *checksum.Service
+}
+
+// NewManifestHandler creates a new ManifestHandler, it takes the root directory and a checksum service as parameters
+func NewManifestHandler(rootDir string, sums *checksum.Service) *ManifestHandler {
+	return &ManifestHandler{rootDir: rootDir, sums: sums}
+}
+
+// ServeHTTP handles the manifest request for the directory at path. The manifest is streamed as it is computed,
+// in the format written by sha256sum so `sha256sum -c` can check a downloaded copy of the directory.
+// Files that cannot be read are left out and counted in the X-Checksum-Skipped trailer.
+func (h *ManifestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respond.WithError(w, r, respond.CodeMethodNotAllowed, "Method not allowed, method: "+r.Method)
+		return
+	}
+
+	algorithm, ok := checksumAlgorithm(w, r)
+	if !ok {
+		return
+	}
+
+	cleanPath, absPath, ok := resolveDir(w, r, h.rootDir)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", manifestName(algorithm)))
+	w.Header().Set("Trailer", "X-Checksum-Skipped")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	skipped := 0
+	err := h.sums.Manifest(r.Context(), absPath, algorithm, func(e checksum.Entry) error {
+		if err := rc.SetWriteDeadline(time.Now().Add(manifestWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		_, err := w.Write([]byte(checksum.FormatEntry(e)))
+		return err
+	}, func(rel string, err error) {
+		skipped++
+		middleware.LoggerFromContext(r.Context()).Warn("skipped file in checksum manifest", slog.String("path", cleanPath), slog.String("file", rel), slog.Any("error", err))
+	})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		// the status is already sent, so the manifest just ends early
+		middleware.LoggerFromContext(r.Context()).Error("failed to write checksum manifest", slog.String("path", cleanPath), slog.Any("error", err))
+	}
+	w.Header().Set("X-Checksum-Skipped", strconv.Itoa(skipped))
+}
+
+// VerifyResponse represents the response body for the verify request
+type VerifyResponse struct {
+	Path      string `json:"path"`
+	Algorithm string `json:"algorithm"`
+	// OK is set if every file in the manifest matched
+	OK         bool              `json:"ok"`
+	Matched    int               `json:"matched"`
+	Mismatched int               `json:"mismatched"`
+	Missing    int               `json:"missing"`
+	Errors     int               `json:"errors"`
+	Results    []checksum.Result `json:"results"`
+}
+
+// VerifyHandler checks a directory against a manifest
+type VerifyHandler struct {
+	rootDir string
+	sums    *checksum.Service
+}
+
+// NewVerifyHandler creates a new VerifyHandler, it takes the root directory and a checksum service as parameters
+func NewVerifyHandler(rootDir string, sums *checksum.Service) *VerifyHandler {
+	return &VerifyHandler{rootDir: rootDir, sums: sums}
+}
+
+// ServeHTTP handles the verify request, the body is a manifest in the format written by sha256sum
+// with paths relative to the directory at path
+func (h *VerifyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respond.WithError(w, r, respond.CodeMethodNotAllowed, "Method not allowed, method: "+r.Method)
+		return
+	}
+
+	algorithm, ok := checksumAlgorithm(w, r)
+	if !ok {
+		return
+	}
+
+	cleanPath, absPath, ok := resolveDir(w, r, h.rootDir)
+	if !ok {
+		return
+	}
+
+	entries, err := checksum.ParseManifest(http.MaxBytesReader(w, r.Body, checksum.MaxManifestSize), algorithm)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respond.WithError(w, r, respond.CodeRequestTooLarge, "Manifest too large")
+			return
+		}
+		respond.WithError(w, r, respond.CodeInvalidManifest, strings.TrimPrefix(err.Error(), "checksum: "))
+		return
+	}
+
+	restore := liftWriteDeadline(w)
+	results, err := h.sums.Verify(r.Context(), absPath, algorithm, entries)
+	restore()
+	if err != nil {
+		respondError(w, r, err, "failed to verify checksums", slog.String("path", cleanPath))
+		return
+	}
+
+	response := VerifyResponse{Path: cleanPath, Algorithm: algorithm, Results: results}
+	for _, result := range results {
+		switch result.Status {
+		case checksum.StatusOK:
+			response.Matched++
+		case checksum.StatusMismatch:
+			response.Mismatched++
+		case checksum.StatusMissing:
+			response.Missing++
+		default:
+			response.Errors++
+		}
+	}
+	response.OK = response.Matched == len(results)
+
+	respond.WithJSON(w, response, http.StatusOK)
+}
+
+// checksumAlgorithm reads the algorithm query parameter, responding with an error if it is not supported
+func checksumAlgorithm(w http.ResponseWriter, r *http.Request) (string, bool) {
+	algorithm := strings.ToLower(r.URL.Query().Get("algorithm"))
+	if algorithm == "" {
+		algorithm = checksum.SHA256
+	}
+	if !checksum.Valid(algorithm) {
+		respondInvalidParameter(w, r, "algorithm", "Invalid algorithm, expected sha256, sha1, md5 or blake3")
+		return "", false
+	}
+	return algorithm, true
+}
+
+// resolveDir resolves the path query parameter to a directory, responding with an error if it is not one
+func resolveDir(w http.ResponseWriter, r *http.Request, rootDir string) (string, string, bool) {
+	cleanPath, absPath, err := resolvePath(r, rootDir, r.URL.Query().Get("path"))
+	if err != nil {
+		respondPathError(w, r, err)
+		return "", "", false
+	}
+
+	info, err := os.Stat(absPath)
+	if err != nil {
+		respondStatError(w, r, cleanPath, err)
+		return "", "", false
+	}
+	if !info.IsDir() {
+		respond.WithError(w, r, respond.CodeNotADirectory, "Path is not a directory")
+		return "", "", false
+	}
+	return cleanPath, absPath, true
+}
+
+// manifestName is the conventional file name for a manifest, e.g. SHA256SUMS
+func manifestName(algorithm string) string {
+	if algorithm == checksum.BLAKE3 {
+		return "B3SUMS"
+	}
+	return strings.ToUpper(algorithm) + "SUMS"
+}
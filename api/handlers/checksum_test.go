@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/josepheid/file-explorer/api/internal/checksum"
+	"github.com/josepheid/file-explorer/api/internal/middleware"
+)
+
+// sha256 of "abc"
+const abcSHA256 = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+
+func setupChecksumDirectory(t *testing.T) (string, func()) {
+	t.Helper()
+
+	rootDir, cleanup := setupTestDirectory(t)
+	for _, name := range []string{"dir1/abc.txt", "dir1/subdir/abc.txt"} {
+		if err := os.WriteFile(filepath.Join(rootDir, name), []byte("abc"), 0644); err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+	}
+	return rootDir, cleanup
+}
+
+func TestChecksumHandler(t *testing.T) {
+	rootDir, cleanup := setupChecksumDirectory(t)
+	defer cleanup()
+
+	handler := NewChecksumHandler(rootDir, checksum.New())
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantSum    string
+	}{
+		{name: "default algorithm", query: "?path=/dir1/abc.txt", wantStatus: http.StatusOK, wantSum: abcSHA256},
+		{name: "md5", query: "?path=/dir1/abc.txt&algorithm=MD5", wantStatus: http.StatusOK, wantSum: "900150983cd24fb0d6963f7d28e17f72"},
+		{name: "blake3", query: "?path=/dir1/abc.txt&algorithm=blake3", wantStatus: http.StatusOK, wantSum: "6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85"},
+		{name: "unknown algorithm", query: "?path=/dir1/abc.txt&algorithm=crc32", wantStatus: http.StatusBadRequest},
+		{name: "directory", query: "?path=/dir1", wantStatus: http.StatusBadRequest},
+		{name: "not found", query: "?path=/dir1/missing.txt", wantStatus: http.StatusNotFound},
+		{name: "path traversal", query: "?path=../etc/passwd", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/checksum"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+			if tt.wantSum == "" {
+				return
+			}
+
+			var resp ChecksumResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if resp.Checksum != tt.wantSum || resp.Path != "/dir1/abc.txt" || resp.Size != 3 {
+				t.Errorf("unexpected response %+v", resp)
+			}
+		})
+	}
+}
+
+func TestManifestHandler(t *testing.T) {
+	rootDir, cleanup := setupChecksumDirectory(t)
+	defer cleanup()
+
+	handler := NewManifestHandler(rootDir, checksum.New())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/checksum/manifest?path=/dir1/subdir", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if cd := rr.Header().Get("Content-Disposition"); cd != `attachment; filename="SHA256SUMS"` {
+		t.Errorf("unexpected Content-Disposition %q", cd)
+	}
+
+	// entries are in lexical order, file3.txt is 300 zero bytes
+	lines := strings.Split(strings.TrimSuffix(rr.Body.String(), "\n"), "\n")
+	if len(lines) != 2 || lines[0] != abcSHA256+"  abc.txt" || !strings.HasSuffix(lines[1], "  file3.txt") || len(lines[1]) != 64+len("  file3.txt") {
+		t.Errorf("unexpected manifest\n%s", rr.Body.String())
+	}
+	if skipped := rr.Result().Trailer.Get("X-Checksum-Skipped"); skipped != "0" {
+		t.Errorf("expected no skipped files, got %q", skipped)
+	}
+
+	// a file is not a directory
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/checksum/manifest?path=/dir1/abc.txt", nil)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d for a file, got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+func TestVerifyHandler(t *testing.T) {
+	rootDir, cleanup := setupChecksumDirectory(t)
+	defer cleanup()
+
+	handler := NewVerifyHandler(rootDir, checksum.New())
+	restricted := middleware.Identity{UserID: "testuser", Method: middleware.MethodToken, Path: "/dir1/subdir"}
+
+	tests := []struct {
+		name       string
+		query      string
+		manifest   string
+		identity   *middleware.Identity
+		wantStatus int
+		wantOK     bool
+		wantCounts [4]int // matched, mismatched, missing, errors
+	}{
+		{
+			name:       "all match",
+			query:      "?path=/dir1",
+			manifest:   abcSHA256 + "  abc.txt\n" + abcSHA256 + "  subdir/abc.txt\n",
+			wantStatus: http.StatusOK,
+			wantOK:     true,
+			wantCounts: [4]int{2, 0, 0, 0},
+		},
+		{
+			name:       "mismatch, missing and escaping paths",
+			query:      "?path=/dir1/subdir",
+			manifest:   abcSHA256 + "  abc.txt\n" + abcSHA256 + "  file3.txt\n" + abcSHA256 + "  gone.txt\n" + abcSHA256 + "  ../file1.txt\n",
+			identity:   &restricted,
+			wantStatus: http.StatusOK,
+			wantCounts: [4]int{1, 1, 1, 1},
+		},
+		{name: "invalid manifest", query: "?path=/dir1", manifest: "not a manifest\n", wantStatus: http.StatusBadRequest},
+		{name: "wrong algorithm", query: "?path=/dir1&algorithm=md5", manifest: abcSHA256 + "  abc.txt\n", wantStatus: http.StatusBadRequest},
+		{name: "outside restricted path", query: "?path=/dir1", manifest: abcSHA256 + "  abc.txt\n", identity: &restricted, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/checksum/verify"+tt.query, strings.NewReader(tt.manifest))
+			if tt.identity != nil {
+				req = req.WithContext(middleware.WithIdentity(req.Context(), *tt.identity))
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp VerifyResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			counts := [4]int{resp.Matched, resp.Mismatched, resp.Missing, resp.Errors}
+			if resp.OK != tt.wantOK || counts != tt.wantCounts {
+				t.Errorf("unexpected result ok=%v counts=%v, want ok=%v counts=%v", resp.OK, counts, tt.wantOK, tt.wantCounts)
+			}
+		})
+	}
+}
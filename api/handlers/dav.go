@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"golang.org/x/net/webdav"
+
+	"github.com/josepheid/file-explorer/api/internal/middleware"
+	"github.com/josepheid/file-explorer/api/internal/respond"
+	"github.com/josepheid/file-explorer/api/internal/tokens"
+)
+
+// DAVPrefix is where the WebDAV handler is mounted
+const DAVPrefix = "/dav"
+
+// davReadMethods are the WebDAV methods that do not change anything, the others need write access
+var davReadMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	"PROPFIND":         true,
+}
+
+// DAVHandler serves the root directory over WebDAV so it can be mounted in file managers
+type DAVHandler struct {
+	dav      *webdav.Handler
+	writable bool
+}
+
+// NewDAVHandler creates a new DAVHandler, it takes the root directory and whether clients may change files as parameters
+func NewDAVHandler(rootDir string, writable bool) *DAVHandler {
+	return &DAVHandler{
+		dav: &webdav.Handler{
+			Prefix:     DAVPrefix,
+			FileSystem: davFileSystem{dir: webdav.Dir(rootDir), writable: writable},
+			LockSystem: webdav.NewMemLS(),
+			Logger: func(r *http.Request, err error) {
+				if err != nil && !errors.Is(err, fs.ErrNotExist) {
+					middleware.LoggerFromContext(r.Context()).Warn("webdav request failed", slog.String("method", r.Method), slog.Any("error", err))
+				}
+			},
+		},
+		writable: writable,
+	}
+}
+
+// ServeHTTP handles WebDAV requests below DAVPrefix. Methods that change files need write scope and are rejected
+// unless the handler is writable. A path restricted identity can only reach its own subtree, so such clients
+// mount that directory rather than the root.
+func (h *DAVHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	middleware.SetPath(r.Context(), davPath(r.URL.Path))
+
+	identity, ok := middleware.IdentityFromContext(r.Context())
+	if !ok {
+		respond.WithError(w, r, respond.CodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	if !davReadMethods[r.Method] {
+		if !h.writable {
+			respond.WithError(w, r, respond.CodeMethodNotAllowed, "Method not allowed, method: "+r.Method)
+			return
+		}
+		if !identity.HasScope(tokens.ScopeWrite) {
+			respond.WithError(w, r, respond.CodeForbidden, "Forbidden")
+			return
+		}
+	}
+
+	// COPY and MOVE also name a destination, which has to be allowed as well
+	paths := []string{r.URL.Path}
+	if destination := r.Header.Get("Destination"); destination != "" {
+		u, err := url.Parse(destination)
+		if err != nil {
+			respond.WithError(w, r, respond.CodeBadRequest, "Invalid destination")
+			return
+		}
+		paths = append(paths, u.Path)
+		middleware.SetDestination(r.Context(), davPath(u.Path))
+	}
+	for _, p := range paths {
+		if !identity.AllowsPath(davPath(p)) {
+			respond.WithError(w, r, respond.CodeForbidden, "Forbidden")
+			return
+		}
+	}
+
+	// downloads and uploads of large files can take longer than the server's write timeout
+	h.dav.ServeHTTP(newProgressWriter(w, downloadWriteTimeout), r)
+}
+
+// davPath maps a request path below DAVPrefix to the path of the file as the rest of the API names it
+func davPath(requestPath string) string {
+	return path.Clean("/" + strings.TrimPrefix(requestPath, DAVPrefix))
+}
+
+// davFileSystem confines WebDAV to the identity's subtree and, unless writable, to reading.
+// DAVHandler already rejects requests outside of these limits, this guards against anything slipping through.
+type davFileSystem struct {
+	dir      webdav.Dir
+	writable bool
+}
+
+// allowed reports whether the request's identity may access name, a path relative to the root directory
+func (f davFileSystem) allowed(ctx context.Context, name string) bool {
+	identity, ok := middleware.IdentityFromContext(ctx)
+	return ok && identity.AllowsPath(path.Clean("/"+name))
+}
+
+func (f davFileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	if !f.writable || !f.allowed(ctx, name) {
+		return os.ErrPermission
+	}
+	return f.dir.Mkdir(ctx, name, perm)
+}
+
+func (f davFileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if !f.allowed(ctx, name) {
+		return nil, os.ErrPermission
+	}
+	if !f.writable && flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, os.ErrPermission
+	}
+	return f.dir.OpenFile(ctx, name, flag, perm)
+}
+
+func (f davFileSystem) RemoveAll(ctx context.Context, name string) error {
+	if !f.writable || !f.allowed(ctx, name) {
+		return os.ErrPermission
+	}
+	return f.dir.RemoveAll(ctx, name)
+}
+
+func (f davFileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	if !f.writable || !f.allowed(ctx, oldName) || !f.allowed(ctx, newName) {
+		return os.ErrPermission
+	}
+	return f.dir.Rename(ctx, oldName, newName)
+}
+
+func (f davFileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	if !f.allowed(ctx, name) {
+		return nil, os.ErrPermission
+	}
+	return f.dir.Stat(ctx, name)
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/webdav"
+
+	"github.com/josepheid/file-explorer/api/internal/audit"
+	"github.com/josepheid/file-explorer/api/internal/middleware"
+	"github.com/josepheid/file-explorer/api/internal/tokens"
+)
+
+func TestDAVHandler(t *testing.T) {
+	rootDir, cleanup := setupTestDirectory(t)
+	defer cleanup()
+
+	session := middleware.Identity{UserID: "testuser", Method: middleware.MethodBasic}
+	readToken := middleware.Identity{UserID: "testuser", Method: middleware.MethodToken, Scopes: []string{tokens.ScopeRead}}
+	restricted := middleware.Identity{UserID: "testuser", Method: middleware.MethodToken, Scopes: []string{tokens.ScopeWrite}, Path: "/dir1/subdir"}
+
+	tests := []struct {
+		name        string
+		writable    bool
+		identity    *middleware.Identity
+		method      string
+		path        string
+		body        string
+		destination string
+		wantStatus  int
+	}{
+		{name: "list directory", identity: &session, method: "PROPFIND", path: "/dav/dir1/", wantStatus: http.StatusMultiStatus},
+		{name: "download file", identity: &session, method: http.MethodGet, path: "/dav/dir1/file1.txt", wantStatus: http.StatusOK},
+		{name: "not found", identity: &session, method: http.MethodGet, path: "/dav/missing.txt", wantStatus: http.StatusNotFound},
+		{name: "not logged in", method: http.MethodGet, path: "/dav/dir1/file1.txt", wantStatus: http.StatusUnauthorized},
+		{name: "read-only upload", identity: &session, method: http.MethodPut, path: "/dav/new.txt", body: "new", wantStatus: http.StatusMethodNotAllowed},
+		{name: "read-only delete", identity: &session, method: http.MethodDelete, path: "/dav/dir1/file1.txt", wantStatus: http.StatusMethodNotAllowed},
+		{name: "upload", writable: true, identity: &session, method: http.MethodPut, path: "/dav/dir1/new.txt", body: "new", wantStatus: http.StatusCreated},
+		{name: "upload with read scope", writable: true, identity: &readToken, method: http.MethodPut, path: "/dav/dir1/new.txt", body: "new", wantStatus: http.StatusForbidden},
+		{name: "restricted inside subtree", identity: &restricted, method: "PROPFIND", path: "/dav/dir1/subdir/", wantStatus: http.StatusMultiStatus},
+		{name: "restricted outside subtree", identity: &restricted, method: http.MethodGet, path: "/dav/dir1/file1.txt", wantStatus: http.StatusForbidden},
+		{name: "restricted move out of subtree", writable: true, identity: &restricted, method: "MOVE", path: "/dav/dir1/subdir/file3.txt", destination: "/dav/file3.txt", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewDAVHandler(rootDir, tt.writable)
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.method == "PROPFIND" {
+				req.Header.Set("Depth", "1")
+			}
+			if tt.destination != "" {
+				req.Header.Set("Destination", "https://example.com"+tt.destination)
+			}
+			if tt.identity != nil {
+				req = req.WithContext(middleware.WithIdentity(req.Context(), *tt.identity))
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+			if tt.name == "list directory" && (!strings.Contains(rr.Body.String(), "file2.txt") || !strings.Contains(rr.Body.String(), "subdir")) {
+				t.Errorf("expected the listing to include the directory's contents, got %s", rr.Body.String())
+			}
+		})
+	}
+
+	if data, err := os.ReadFile(filepath.Join(rootDir, "dir1/new.txt")); err != nil || string(data) != "new" {
+		t.Errorf("expected the uploaded file, got %q, %v", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(rootDir, "new.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected no file uploaded while read-only, got %v", err)
+	}
+}
+
+func TestDAVHandlerAudit(t *testing.T) {
+	rootDir, cleanup := setupTestDirectory(t)
+	defer cleanup()
+
+	auditLog, err := audit.New(filepath.Join(t.TempDir(), "audit.log"), 1<<20, 1)
+	if err != nil {
+		t.Fatalf("audit.New() error = %v", err)
+	}
+	defer auditLog.Close()
+	handler := middleware.Audit(auditLog, "dav")(NewDAVHandler(rootDir, true))
+	identity := middleware.Identity{UserID: "testuser", Method: middleware.MethodBasic}
+
+	tests := []struct {
+		name            string
+		method          string
+		path            string
+		destination     string
+		wantPath        string
+		wantDestination string
+	}{
+		{name: "upload", method: http.MethodPut, path: "/dav/dir1/new.txt", wantPath: "/dir1/new.txt"},
+		{name: "move", method: "MOVE", path: "/dav/dir1/new.txt", destination: "/dav/dir1/subdir/moved.txt", wantPath: "/dir1/new.txt", wantDestination: "/dir1/subdir/moved.txt"},
+		{name: "delete", method: http.MethodDelete, path: "/dav/dir1/subdir/moved.txt", wantPath: "/dir1/subdir/moved.txt"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader("new"))
+		if tt.destination != "" {
+			req.Header.Set("Destination", "https://example.com"+tt.destination)
+		}
+		req = req.WithContext(middleware.WithIdentity(req.Context(), identity))
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		events, err := auditLog.Query(audit.Filter{Limit: 1})
+		if err != nil {
+			t.Fatalf("Query() error = %v", err)
+		}
+		if len(events) != 1 || events[0].Method != tt.method || events[0].Outcome != audit.OutcomeSuccess {
+			t.Fatalf("%s: unexpected events %+v", tt.name, events)
+		}
+		if events[0].Path != tt.wantPath || events[0].Destination != tt.wantDestination {
+			t.Errorf("%s: audited path %q to %q, want %q to %q", tt.name, events[0].Path, events[0].Destination, tt.wantPath, tt.wantDestination)
+		}
+	}
+}
+
+func TestDAVFileSystem(t *testing.T) {
+	rootDir, cleanup := setupTestDirectory(t)
+	defer cleanup()
+
+	ctx := middleware.WithIdentity(context.Background(), middleware.Identity{UserID: "testuser", Path: "/dir1"})
+	readOnly := davFileSystem{dir: webdav.Dir(rootDir)}
+
+	if _, err := readOnly.Stat(ctx, "/dir1/file1.txt"); err != nil {
+		t.Errorf("Stat() error = %v", err)
+	}
+	if _, err := readOnly.Stat(ctx, "/empty"); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("Stat() error = %v outside the identity's subtree, want os.ErrPermission", err)
+	}
+	if _, err := readOnly.Stat(context.Background(), "/dir1"); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("Stat() error = %v without an identity, want os.ErrPermission", err)
+	}
+	if _, err := readOnly.OpenFile(ctx, "/dir1/file1.txt", os.O_RDWR, 0); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("OpenFile() error = %v for writing while read-only, want os.ErrPermission", err)
+	}
+	if err := readOnly.Mkdir(ctx, "/dir1/new", 0755); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("Mkdir() error = %v while read-only, want os.ErrPermission", err)
+	}
+	if err := readOnly.RemoveAll(ctx, "/dir1/file1.txt"); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("RemoveAll() error = %v while read-only, want os.ErrPermission", err)
+	}
+
+	writable := davFileSystem{dir: webdav.Dir(rootDir), writable: true}
+	if err := writable.Rename(ctx, "/dir1/file1.txt", "/empty/file1.txt"); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("Rename() error = %v out of the identity's subtree, want os.ErrPermission", err)
+	}
+	if err := writable.Mkdir(ctx, "/dir1/new", 0755); err != nil {
+		t.Errorf("Mkdir() error = %v", err)
+	}
+}
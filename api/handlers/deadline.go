@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// resultWriteTimeout bounds writing the response of a request whose computation outlived the server's write timeout
+const resultWriteTimeout = 30 * time.Second
+
+// liftWriteDeadline lifts the server's write timeout while a response is computed, as hashing a large file or tree
+// can take longer than it allows. Nothing is written meanwhile and the request's context still ends the computation
+// if the client goes away. The returned func puts a deadline back in place for writing the result.
+// Writers without deadlines, e.g. in tests, are left alone.
+func liftWriteDeadline(w http.ResponseWriter) (restore func()) {
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+	return func() {
+		rc.SetWriteDeadline(time.Now().Add(resultWriteTimeout))
+	}
+}
+
+// downloadWriteTimeout is how long a download may stall before it is cut off, it replaces the server's write
+// timeout so large files can take as long as they need while the client keeps reading
+const downloadWriteTimeout = time.Minute
+
+// progressWriter extends the write deadline before every write, for responses such as downloads that are written
+// by something else, e.g. http.ServeContent, and can take longer than the server's write timeout
+type progressWriter struct {
+	http.ResponseWriter
+	rc      *http.ResponseController
+	timeout time.Duration
+}
+
+// newProgressWriter wraps w so every write may take up to timeout
+func newProgressWriter(w http.ResponseWriter, timeout time.Duration) *progressWriter {
+	return &progressWriter{ResponseWriter: w, rc: http.NewResponseController(w), timeout: timeout}
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	if err := w.rc.SetWriteDeadline(time.Now().Add(w.timeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return 0, err
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *progressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
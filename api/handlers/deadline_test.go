@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// startSlowServer serves handler with a write timeout far shorter than the handler takes
+func startSlowServer(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(handler)
+	srv.Config.WriteTimeout = 50 * time.Millisecond
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestLiftWriteDeadline(t *testing.T) {
+	srv := startSlowServer(t, func(w http.ResponseWriter, r *http.Request) {
+		restore := liftWriteDeadline(w)
+		time.Sleep(200 * time.Millisecond)
+		restore()
+		w.Write([]byte("done"))
+	})
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("GET error = %v, want the response written after the write timeout", err)
+	}
+	defer resp.Body.Close()
+	if body, err := io.ReadAll(resp.Body); err != nil || string(body) != "done" {
+		t.Errorf("body = %q, %v, want done", body, err)
+	}
+}
+
+func TestProgressWriter(t *testing.T) {
+	srv := startSlowServer(t, func(w http.ResponseWriter, r *http.Request) {
+		pw := newProgressWriter(w, time.Second)
+		for i := 0; i < 5; i++ {
+			time.Sleep(30 * time.Millisecond)
+			if _, err := pw.Write([]byte("chunk")); err != nil {
+				return
+			}
+			http.NewResponseController(pw).Flush()
+		}
+	})
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("GET error = %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil || len(body) != 25 {
+		t.Errorf("read %d bytes, %v, want the whole response written past the write timeout", len(body), err)
+	}
+}
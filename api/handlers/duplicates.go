@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/josepheid/file-explorer/api/internal/duplicates"
+	"github.com/josepheid/file-explorer/api/internal/middleware"
+	"github.com/josepheid/file-explorer/api/internal/respond"
+)
+
+// DuplicatesHandler finds files with the same content below a directory
+type DuplicatesHandler struct {
+	rootDir    string
+	duplicates *duplicates.Manager
+}
+
+// NewDuplicatesHandler creates a new DuplicatesHandler, it takes the root directory and a duplicates manager as parameters
+func NewDuplicatesHandler(rootDir string, duplicates *duplicates.Manager) *DuplicatesHandler {
+	return &DuplicatesHandler{rootDir: rootDir, duplicates: duplicates}
+}
+
+// ServeHTTP handles duplicates requests. GET starts a search of path, or reports on the one already started with the
+// same minSize query parameter: 202 with its progress while it runs, then 200 with the groups of duplicates.
+// Only files the user may access are included. refresh=true discards a finished search and starts over.
+// DELETE cancels the user's searches of path.
+func (h *DuplicatesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		respond.WithError(w, r, respond.CodeMethodNotAllowed, "Method not allowed, method: "+r.Method)
+		return
+	}
+
+	identity, ok := middleware.IdentityFromContext(r.Context())
+	if !ok {
+		respond.WithError(w, r, respond.CodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	query := r.URL.Query()
+	minSize := int64(duplicates.DefaultMinSize)
+	if value := query.Get("minSize"); value != "" {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 {
+			respondInvalidParameter(w, r, "minSize", "Invalid minSize, expected a size in bytes")
+			return
+		}
+		minSize = n
+	}
+
+	cleanPath, absPath, err := resolvePath(r, h.rootDir, query.Get("path"))
+	if err != nil {
+		respondPathError(w, r, err)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		if !h.duplicates.Cancel(identity.UserID, cleanPath) {
+			respond.WithError(w, r, respond.CodeJobNotFound, "No search running")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	info, err := os.Stat(absPath)
+	if err != nil {
+		respondStatError(w, r, cleanPath, err)
+		return
+	}
+	if !info.IsDir() {
+		respond.WithError(w, r, respond.CodeNotADirectory, "Path is not a directory")
+		return
+	}
+
+	opts := duplicates.Options{Path: cleanPath, AbsPath: absPath, MinSize: minSize, Allow: identity.AllowsPath}
+	job, err := h.duplicates.Run(identity.UserID, opts, query.Get("refresh") == "true")
+	if err != nil {
+		respondError(w, r, err, "failed to start duplicates search", slog.String("path", cleanPath))
+		return
+	}
+
+	status := http.StatusOK
+	if job.Status == duplicates.StatusRunning {
+		status = http.StatusAccepted
+	}
+	respond.WithJSON(w, job, status)
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/josepheid/file-explorer/api/internal/checksum"
+	"github.com/josepheid/file-explorer/api/internal/duplicates"
+	"github.com/josepheid/file-explorer/api/internal/middleware"
+)
+
+func TestDuplicatesHandler(t *testing.T) {
+	rootDir, cleanup := setupTestDirectory(t)
+	defer cleanup()
+
+	// a copy of file1.txt, which is 100 zero bytes
+	if err := os.WriteFile(filepath.Join(rootDir, "dir1/subdir/copy.txt"), make([]byte, 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := duplicates.New(checksum.New())
+	defer manager.Close()
+	handler := NewDuplicatesHandler(rootDir, manager)
+	identity := middleware.Identity{UserID: "testuser", Method: middleware.MethodSession}
+
+	serve := func(method, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/v1/duplicates"+query, nil)
+		req = req.WithContext(middleware.WithIdentity(req.Context(), identity))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// poll until the search is done
+	var job duplicates.Job
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rr := serve(http.MethodGet, "?path=/dir1")
+		if rr.Code != http.StatusOK && rr.Code != http.StatusAccepted {
+			t.Fatalf("unexpected status %d: %s", rr.Code, rr.Body.String())
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&job); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if rr.Code == http.StatusOK {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("search did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if job.Status != duplicates.StatusDone || job.Report == nil || len(job.Report.Groups) != 1 {
+		t.Fatalf("unexpected job %+v", job)
+	}
+	group := job.Report.Groups[0]
+	if group.Size != 100 || len(group.Paths) != 2 || group.Paths[0] != "/dir1/file1.txt" || group.Paths[1] != "/dir1/subdir/copy.txt" {
+		t.Errorf("unexpected group %+v", group)
+	}
+
+	// nothing is left to cancel
+	if rr := serve(http.MethodDelete, "?path=/dir1"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d cancelling a finished search, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestDuplicatesHandlerValidation(t *testing.T) {
+	rootDir, cleanup := setupTestDirectory(t)
+	defer cleanup()
+
+	manager := duplicates.New(checksum.New())
+	defer manager.Close()
+	handler := NewDuplicatesHandler(rootDir, manager)
+
+	session := middleware.Identity{UserID: "testuser", Method: middleware.MethodSession}
+	restricted := middleware.Identity{UserID: "testuser", Method: middleware.MethodToken, Path: "/empty"}
+
+	tests := []struct {
+		name       string
+		method     string
+		query      string
+		identity   *middleware.Identity
+		wantStatus int
+	}{
+		{name: "wrong method", method: http.MethodPost, identity: &session, wantStatus: http.StatusMethodNotAllowed},
+		{name: "not logged in", method: http.MethodGet, wantStatus: http.StatusUnauthorized},
+		{name: "negative minSize", method: http.MethodGet, query: "?minSize=-1", identity: &session, wantStatus: http.StatusBadRequest},
+		{name: "minSize not a number", method: http.MethodGet, query: "?minSize=big", identity: &session, wantStatus: http.StatusBadRequest},
+		{name: "path traversal", method: http.MethodGet, query: "?path=../etc", identity: &session, wantStatus: http.StatusBadRequest},
+		{name: "not found", method: http.MethodGet, query: "?path=/missing", identity: &session, wantStatus: http.StatusNotFound},
+		{name: "not a directory", method: http.MethodGet, query: "?path=/dir1/file1.txt", identity: &session, wantStatus: http.StatusBadRequest},
+		{name: "outside restricted path", method: http.MethodGet, query: "?path=/dir1", identity: &restricted, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/v1/duplicates"+tt.query, nil)
+			if tt.identity != nil {
+				req = req.WithContext(middleware.WithIdentity(req.Context(), *tt.identity))
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rr.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+
+	"github.com/josepheid/file-explorer/api/internal/checksum"
+	"github.com/josepheid/file-explorer/api/internal/duplicates"
+	"github.com/josepheid/file-explorer/api/internal/middleware"
+	"github.com/josepheid/file-explorer/api/internal/preview"
+	"github.com/josepheid/file-explorer/api/internal/respond"
+	"github.com/josepheid/file-explorer/api/internal/shares"
+	"github.com/josepheid/file-explorer/api/internal/thumbnail"
+	"github.com/josepheid/file-explorer/api/internal/tokens"
+	"github.com/josepheid/file-explorer/api/internal/totp"
+	"github.com/josepheid/file-explorer/api/internal/usage"
+)
+
+// errorCodes maps the errors handlers get from resolving paths, the filesystem and the services to the code and
+// message they are reported with. The first entry matching with errors.Is applies.
+var errorCodes = []struct {
+	err     error
+	code    respond.Code
+	message string
+}{
+	{errInvalidPath, respond.CodeInvalidPath, "Invalid path"},
+	{errForbiddenPath, respond.CodeForbidden, "Forbidden"},
+	{fs.ErrNotExist, respond.CodePathNotFound, "Path not found"},
+
+	{checksum.ErrNotRegular, respond.CodeNotAFile, "Path is not a file"},
+	{preview.ErrNotRegular, respond.CodeNotAFile, "Path is not a file"},
+	{preview.ErrInvalidOptions, respond.CodeInvalidParameter, "Invalid preview options"},
+	{thumbnail.ErrUnsupported, respond.CodeUnsupportedFile, "Path is not a supported image"},
+	{thumbnail.ErrTooLarge, respond.CodeFileTooLarge, "Image too large for a thumbnail"},
+
+	{usage.ErrBusy, respond.CodeTooManyRequests, "Too many analyses running, try again later"},
+	{usage.ErrClosed, respond.CodeUnavailable, "Server shutting down"},
+	{duplicates.ErrBusy, respond.CodeTooManyRequests, "Too many searches running, try again later"},
+	{duplicates.ErrClosed, respond.CodeUnavailable, "Server shutting down"},
+
+	{shares.ErrPasswordRequired, respond.CodePasswordRequired, "Password required"},
+	{shares.ErrWrongPassword, respond.CodePasswordRequired, "Password required"},
+	{shares.ErrLimitReached, respond.CodeDownloadLimit, "Download limit reached"},
+	{shares.ErrNotFound, respond.CodeShareNotFound, "Share not found"},
+	{shares.ErrPasswordTooLong, respond.CodeInvalidBody, "Password must be at most 72 bytes"},
+
+	{tokens.ErrNotFound, respond.CodeTokenNotFound, "Token not found"},
+	{tokens.ErrInvalidScope, respond.CodeInvalidBody, "Invalid scope"},
+	{tokens.ErrInvalidPath, respond.CodeInvalidBody, "Path restriction must be an absolute path"},
+
+	{totp.ErrInvalidCode, respond.CodeInvalidCode, "Invalid code"},
+	{totp.ErrInvalidChallenge, respond.CodeInvalidCode, "Invalid code"},
+	{totp.ErrLocked, respond.CodeTooManyRequests, "Too many wrong codes, try again later"},
+	{totp.ErrNotEnrolled, respond.CodeTOTPNotEnrolled, "Not enrolled in two-factor authentication"},
+	{totp.ErrAlreadyEnabled, respond.CodeTOTPAlreadyEnabled, "Two-factor authentication is already enabled"},
+}
+
+// respondError writes the response for err with the code and message errorCodes maps it to.
+// Other errors are logged with msg and attrs and reported as internal errors, without their text as it could
+// reveal details of the server such as paths. Nothing is written if the client went away.
+func respondError(w http.ResponseWriter, r *http.Request, err error, msg string, attrs ...any) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	for _, e := range errorCodes {
+		if errors.Is(err, e.err) {
+			respond.WithError(w, r, e.code, e.message)
+			return
+		}
+	}
+
+	middleware.LoggerFromContext(r.Context()).Error(msg, append(attrs, slog.Any("error", err))...)
+	respond.WithError(w, r, respond.CodeInternal, "Internal server error")
+}
+
+// respondInvalidParameter writes the response for an invalid query parameter, naming it in the details
+func respondInvalidParameter(w http.ResponseWriter, r *http.Request, parameter, msg string) {
+	respond.WithErrorDetails(w, r, respond.CodeInvalidParameter, msg, map[string]any{"parameter": parameter})
+}
+
+// respondInvalidField writes the response for an invalid field of the request body, naming it in the details
+func respondInvalidField(w http.ResponseWriter, r *http.Request, field, msg string) {
+	respond.WithErrorDetails(w, r, respond.CodeInvalidBody, msg, map[string]any{"field": field})
+}
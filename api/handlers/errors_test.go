@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/josepheid/file-explorer/api/internal/middleware"
+	"github.com/josepheid/file-explorer/api/internal/respond"
+	"github.com/josepheid/file-explorer/api/internal/shares"
+	"github.com/josepheid/file-explorer/api/internal/usage"
+)
+
+func TestRespondError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   respond.Code
+		wantLogged bool
+	}{
+		{
+			name:       "not found",
+			err:        fmt.Errorf("open /srv/files/a.txt: %w", fs.ErrNotExist),
+			wantStatus: http.StatusNotFound,
+			wantCode:   respond.CodePathNotFound,
+		},
+		{
+			name:       "invalid path",
+			err:        errInvalidPath,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   respond.CodeInvalidPath,
+		},
+		{
+			name:       "wrapped service error",
+			err:        fmt.Errorf("starting analysis: %w", usage.ErrBusy),
+			wantStatus: http.StatusTooManyRequests,
+			wantCode:   respond.CodeTooManyRequests,
+		},
+		{
+			name:       "share limit",
+			err:        shares.ErrLimitReached,
+			wantStatus: http.StatusGone,
+			wantCode:   respond.CodeDownloadLimit,
+		},
+		{
+			name:       "unknown error",
+			err:        errors.New("read /srv/files/secret: input/output error"),
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   respond.CodeInternal,
+			wantLogged: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			logger := slog.New(slog.NewTextHandler(&logs, nil))
+			handler := middleware.Logging(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				respondError(w, r, tt.err, "failed to browse")
+			}))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/browse", nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			var resp respond.Error
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode error: %v", err)
+			}
+			if resp.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", resp.Code, tt.wantCode)
+			}
+			if strings.Contains(resp.Message, "/srv/files") {
+				t.Errorf("message %q reveals the error", resp.Message)
+			}
+			if logged := strings.Contains(logs.String(), "failed to browse"); logged != tt.wantLogged {
+				t.Errorf("logged = %v, want %v", logged, tt.wantLogged)
+			}
+		})
+	}
+}
+
+func TestRespondErrorCanceled(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/browse", nil)
+	rec := httptest.NewRecorder()
+
+	respondError(rec, req, fmt.Errorf("walking: %w", context.Canceled), "failed to browse")
+
+	if rec.Body.Len() != 0 {
+		t.Errorf("body = %q, want nothing written for a client that went away", rec.Body.String())
+	}
+}
+
+func TestRespondInvalidParameter(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/browse", nil)
+	req.Header.Set("Accept", respond.ProblemContentType)
+	rec := httptest.NewRecorder()
+
+	respondInvalidParameter(rec, req, "size", "Invalid size, expected recursive")
+
+	if got := rec.Header().Get("Content-Type"); got != respond.ProblemContentType {
+		t.Errorf("Content-Type = %q, want %q", got, respond.ProblemContentType)
+	}
+	var problem respond.Problem
+	if err := json.NewDecoder(rec.Body).Decode(&problem); err != nil {
+		t.Fatalf("failed to decode problem: %v", err)
+	}
+	if problem.Status != http.StatusBadRequest || problem.Code != respond.CodeInvalidParameter || problem.Details["parameter"] != "size" {
+		t.Errorf("problem = %+v, want an invalid size parameter", problem)
+	}
+}
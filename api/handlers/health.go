@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/josepheid/file-explorer/api/internal/health"
+	"github.com/josepheid/file-explorer/api/internal/respond"
+)
+
+// HealthResponse represents the response body for the liveness probe
+type HealthResponse struct {
+	Status string `json:"status"`
+}
+
+// HealthHandler reports that the process is alive and serving requests
+type HealthHandler struct{}
+
+// NewHealthHandler creates a new HealthHandler
+func NewHealthHandler() *HealthHandler {
+	return &HealthHandler{}
+}
+
+// ServeHTTP handles the liveness probe
+func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		respond.WithError(w, r, respond.CodeMethodNotAllowed, "Method not allowed, method: "+r.Method)
+		return
+	}
+
+	respond.WithJSON(w, HealthResponse{Status: health.StatusOK}, http.StatusOK)
+}
+
+// ReadyHandler reports whether the server's dependencies are usable
+type ReadyHandler struct {
+	checker *health.Checker
+}
+
+// NewReadyHandler creates a new ReadyHandler, it takes the checker running the readiness checks as a parameter
+func NewReadyHandler(checker *health.Checker) *ReadyHandler {
+	return &ReadyHandler{checker: checker}
+}
+
+// ServeHTTP handles the readiness probe, it responds 200 if every check passed and 503 otherwise,
+// with the outcome of each check in the body
+func (h *ReadyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		respond.WithError(w, r, respond.CodeMethodNotAllowed, "Method not allowed, method: "+r.Method)
+		return
+	}
+
+	report := h.checker.Run(r.Context())
+
+	status := http.StatusOK
+	if report.Status != health.StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	respond.WithJSON(w, report, status)
+}
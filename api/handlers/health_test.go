@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/josepheid/file-explorer/api/internal/health"
+)
+
+func TestHealthHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		wantStatus int
+	}{
+		{name: "get", method: http.MethodGet, wantStatus: http.StatusOK},
+		{name: "head", method: http.MethodHead, wantStatus: http.StatusOK},
+		{name: "wrong method", method: http.MethodPost, wantStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			NewHealthHandler().ServeHTTP(rr, httptest.NewRequest(tt.method, "/healthz", nil))
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestReadyHandler(t *testing.T) {
+	passing := health.Check{Name: "root", Func: func(ctx context.Context) error { return nil }}
+	failing := health.Check{Name: "certificate", Func: func(ctx context.Context) error { return errors.New("not loaded") }}
+
+	tests := []struct {
+		name       string
+		checks     []health.Check
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "ready", checks: []health.Check{passing}, wantStatus: http.StatusOK, wantBody: health.StatusOK},
+		{name: "not ready", checks: []health.Check{passing, failing}, wantStatus: http.StatusServiceUnavailable, wantBody: health.StatusFail},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			NewReadyHandler(health.NewChecker(tt.checks...)).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, rr.Code)
+			}
+
+			var report health.Report
+			if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if report.Status != tt.wantBody {
+				t.Errorf("expected status %q, got %q", tt.wantBody, report.Status)
+			}
+			if len(report.Checks) != len(tt.checks) {
+				t.Errorf("expected %d checks, got %d", len(tt.checks), len(report.Checks))
+			}
+		})
+	}
+}
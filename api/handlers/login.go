@@ -2,24 +2,31 @@ package handlers
 
 import (
 	"encoding/json"
+	"log/slog"
 	"net/http"
 
 	"github.com/josepheid/file-explorer/api/internal/auth"
+	"github.com/josepheid/file-explorer/api/internal/metrics"
+	"github.com/josepheid/file-explorer/api/internal/middleware"
 	"github.com/josepheid/file-explorer/api/internal/respond"
 	"github.com/josepheid/file-explorer/api/internal/sessions"
+	"github.com/josepheid/file-explorer/api/internal/totp"
 )
 
 // LoginHandler defines the login handler and the dependencies it needs
 type LoginHandler struct {
-	auth     *auth.Service
+	auth     auth.Authenticator
 	sessions *sessions.Service
+	totp     *totp.Service
 }
 
-// NewLoginHandler creates a new LoginHandler, it takes an auth service and a sessions service as parameters
-func NewLoginHandler(auth *auth.Service, sessions *sessions.Service) *LoginHandler {
+// NewLoginHandler creates a new LoginHandler, it takes an authenticator (e.g. an auth service or a chain of them),
+// a sessions service and a TOTP service as parameters
+func NewLoginHandler(auth auth.Authenticator, sessions *sessions.Service, totp *totp.Service) *LoginHandler {
 	return &LoginHandler{
 		auth:     auth,
 		sessions: sessions,
+		totp:     totp,
 	}
 }
 
@@ -29,38 +36,77 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
+// TOTPRequiredResponse is returned instead of a session when the user has two-factor authentication enabled,
+// the challenge must be sent to the TOTP login endpoint along with a code
+type TOTPRequiredResponse struct {
+	TOTPRequired bool   `json:"totpRequired"`
+	Challenge    string `json:"challenge"`
+}
+
 // ServeHTTP handles the login request
 func (h *LoginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		respond.WithError(w, "Method not allowed, method: "+r.Method, http.StatusMethodNotAllowed)
+		respond.WithError(w, r, respond.CodeMethodNotAllowed, "Method not allowed, method: "+r.Method)
 		return
 	}
 
 	var req LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respond.WithError(w, "Invalid request body, error: "+err.Error(), http.StatusBadRequest)
+		respond.WithError(w, r, respond.CodeInvalidBody, "Invalid request body, error: "+err.Error())
 		return
 	}
 
 	if req.Username == "" || req.Password == "" {
-		respond.WithError(w, "Username and password are required", http.StatusBadRequest)
+		respond.WithError(w, r, respond.CodeInvalidBody, "Username and password are required")
+		return
+	}
+
+	// Record who the login attempt was for, whether or not it succeeds
+	middleware.SetUser(r.Context(), req.Username)
+
+	// Validate credentials, directory backed authenticators also return the user's email and groups
+	var profile auth.Profile
+	var err error
+	if pa, ok := h.auth.(auth.ProfileAuthenticator); ok {
+		profile, err = pa.Authenticate(req.Username, req.Password)
+	} else {
+		err = h.auth.ValidateCredentials(req.Username, req.Password)
+	}
+	if err != nil {
+		middleware.LoggerFromContext(r.Context()).Info("login failed", slog.String("user", req.Username), slog.Any("error", err))
+		metrics.FromContext(r.Context()).LoginFailed(metrics.LoginPassword)
+		respond.WithError(w, r, respond.CodeInvalidCredentials, "Invalid credentials")
 		return
 	}
 
-	// Validate credentials
-	if err := h.auth.ValidateCredentials(req.Username, req.Password); err != nil {
-		respond.WithError(w, "Invalid credentials, error: "+err.Error(), http.StatusUnauthorized)
+	// Users with two-factor authentication only get a session once their code is verified
+	if h.totp.Enabled(req.Username) {
+		challenge, err := h.totp.NewChallenge(req.Username, profile.Email, profile.Groups)
+		if err != nil {
+			middleware.LoggerFromContext(r.Context()).Error("failed to create login challenge", slog.Any("error", err))
+			respond.WithError(w, r, respond.CodeInternal, "Failed to create login challenge")
+			return
+		}
+		respond.WithJSON(w, TOTPRequiredResponse{TOTPRequired: true, Challenge: challenge}, http.StatusAccepted)
 		return
 	}
 
 	// Create new session
-	session, err := h.sessions.Create(req.Username)
+	session, err := h.sessions.CreateWithClaims(req.Username, profile.Email, profile.Groups)
 	if err != nil {
-		respond.WithError(w, "Failed to create session, error: "+err.Error(), http.StatusInternalServerError)
+		middleware.LoggerFromContext(r.Context()).Error("failed to create session", slog.Any("error", err))
+		respond.WithError(w, r, respond.CodeInternal, "Failed to create session")
 		return
 	}
 
-	// Set session cookie
+	setSessionCookie(w, session)
+
+	// Return success response
+	respond.WithJSON(w, nil, http.StatusOK)
+}
+
+// setSessionCookie sets the cookie identifying session on the response
+func setSessionCookie(w http.ResponseWriter, session sessions.Session) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     "session_id",
 		Value:    session.ID,
@@ -70,7 +116,4 @@ func (h *LoginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		SameSite: http.SameSiteStrictMode,
 		MaxAge:   86400, // 24 hours
 	})
-
-	// Return success response
-	respond.WithJSON(w, nil, http.StatusOK)
 }
@@ -8,7 +8,9 @@ import (
 	"testing"
 
 	"github.com/josepheid/file-explorer/api/internal/auth"
+	"github.com/josepheid/file-explorer/api/internal/respond"
 	"github.com/josepheid/file-explorer/api/internal/sessions"
+	"github.com/josepheid/file-explorer/api/internal/totp"
 )
 
 func TestLoginHandler(t *testing.T) {
@@ -17,6 +19,7 @@ func TestLoginHandler(t *testing.T) {
 		request    LoginRequest
 		method     string
 		wantStatus int
+		wantCode   respond.Code
 		wantCookie bool
 	}{
 		{
@@ -37,6 +40,7 @@ func TestLoginHandler(t *testing.T) {
 			},
 			method:     http.MethodPost,
 			wantStatus: http.StatusUnauthorized,
+			wantCode:   respond.CodeInvalidCredentials,
 			wantCookie: false,
 		},
 		{
@@ -47,6 +51,7 @@ func TestLoginHandler(t *testing.T) {
 			},
 			method:     http.MethodPost,
 			wantStatus: http.StatusUnauthorized,
+			wantCode:   respond.CodeInvalidCredentials,
 			wantCookie: false,
 		},
 		{
@@ -54,6 +59,7 @@ func TestLoginHandler(t *testing.T) {
 			request:    LoginRequest{},
 			method:     http.MethodPost,
 			wantStatus: http.StatusBadRequest,
+			wantCode:   respond.CodeInvalidBody,
 			wantCookie: false,
 		},
 		{
@@ -64,6 +70,7 @@ func TestLoginHandler(t *testing.T) {
 			},
 			method:     http.MethodGet,
 			wantStatus: http.StatusMethodNotAllowed,
+			wantCode:   respond.CodeMethodNotAllowed,
 			wantCookie: false,
 		},
 	}
@@ -73,7 +80,7 @@ func TestLoginHandler(t *testing.T) {
 			// Create handler with mock services
 			auth := auth.New()
 			sessions := sessions.New()
-			handler := NewLoginHandler(auth, sessions)
+			handler := NewLoginHandler(auth, sessions, totp.New("test"))
 
 			// Create request
 			body, _ := json.Marshal(tt.request)
@@ -87,6 +94,19 @@ func TestLoginHandler(t *testing.T) {
 			if rec.Code != tt.wantStatus {
 				t.Errorf("want status %d, got %d", tt.wantStatus, rec.Code)
 			}
+			if tt.wantCode != "" {
+				var resp respond.Error
+				if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+					t.Fatalf("failed to decode error: %v", err)
+				}
+				if resp.Code != tt.wantCode {
+					t.Errorf("want code %q, got %q", tt.wantCode, resp.Code)
+				}
+				// the reason credentials were rejected is not revealed
+				if tt.wantCode == respond.CodeInvalidCredentials && resp.Message != "Invalid credentials" {
+					t.Errorf("want message %q, got %q", "Invalid credentials", resp.Message)
+				}
+			}
 
 			// Check cookie
 			cookies := rec.Result().Cookies()
@@ -105,3 +125,37 @@ func TestLoginHandler(t *testing.T) {
 		})
 	}
 }
+
+type stubProfileAuthenticator struct{}
+
+func (stubProfileAuthenticator) ValidateCredentials(username, password string) error {
+	_, err := stubProfileAuthenticator{}.Authenticate(username, password)
+	return err
+}
+
+func (stubProfileAuthenticator) Authenticate(username, password string) (auth.Profile, error) {
+	if username != "jane" || password != "janepass" {
+		return auth.Profile{}, auth.ErrInvalidCredentials
+	}
+	return auth.Profile{Email: "jane@example.com", Groups: []string{"engineering"}}, nil
+}
+
+func TestLoginHandlerProfile(t *testing.T) {
+	sessionService := sessions.New()
+	handler := NewLoginHandler(auth.Chain{auth.New(), stubProfileAuthenticator{}}, sessionService, totp.New("test"))
+
+	body, _ := json.Marshal(LoginRequest{Username: "jane", Password: "janepass"})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/login", bytes.NewBuffer(body))
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("want status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	session := sessionService.Get(rec.Result().Cookies()[0].Value)
+	if session.Email != "jane@example.com" || len(session.Groups) != 1 || session.Groups[0] != "engineering" {
+		t.Errorf("session does not carry the user's profile: %+v", session)
+	}
+}
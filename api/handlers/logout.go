@@ -3,6 +3,7 @@ package handlers
 import (
 	"net/http"
 
+	"github.com/josepheid/file-explorer/api/internal/middleware"
 	"github.com/josepheid/file-explorer/api/internal/respond"
 	"github.com/josepheid/file-explorer/api/internal/sessions"
 )
@@ -22,7 +23,7 @@ func NewLogoutHandler(sessions *sessions.Service) *LogoutHandler {
 // ServeHTTP handles the logout request
 func (h *LogoutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		respond.WithError(w, "Method not allowed, method: "+r.Method, http.StatusMethodNotAllowed)
+		respond.WithError(w, r, respond.CodeMethodNotAllowed, "Method not allowed, method: "+r.Method)
 		return
 	}
 
@@ -34,6 +35,7 @@ func (h *LogoutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Delete session
+	middleware.SetUser(r.Context(), h.sessions.Get(cookie.Value).UserID)
 	h.sessions.Delete(cookie.Value)
 
 	// Invalidate cookie
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/josepheid/file-explorer/api/internal/metrics"
+	"github.com/josepheid/file-explorer/api/internal/middleware"
+	"github.com/josepheid/file-explorer/api/internal/oidc"
+	"github.com/josepheid/file-explorer/api/internal/respond"
+	"github.com/josepheid/file-explorer/api/internal/sessions"
+)
+
+// oidcStateCookie binds a pending single sign-on login to the browser that started it
+const oidcStateCookie = "oidc_state"
+
+// OIDCLoginHandler starts a single sign-on login by redirecting to the identity provider
+type OIDCLoginHandler struct {
+	oidc *oidc.Service
+}
+
+// NewOIDCLoginHandler creates a new OIDCLoginHandler, it takes an oidc service as a parameter
+func NewOIDCLoginHandler(oidc *oidc.Service) *OIDCLoginHandler {
+	return &OIDCLoginHandler{oidc: oidc}
+}
+
+// ServeHTTP handles the login request, the optional redirect query parameter is where the user
+// is sent once logged in
+func (h *OIDCLoginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respond.WithError(w, r, respond.CodeMethodNotAllowed, "Method not allowed, method: "+r.Method)
+		return
+	}
+
+	redirect := r.URL.Query().Get("redirect")
+	if !isLocalRedirect(redirect) {
+		redirect = "/"
+	}
+
+	url, state, err := h.oidc.AuthCodeURL(r.Context(), redirect)
+	if err != nil {
+		middleware.LoggerFromContext(r.Context()).Error("identity provider unavailable", slog.Any("error", err))
+		respond.WithError(w, r, respond.CodeIdentityProvider, "Identity provider unavailable")
+		return
+	}
+
+	// Lax rather than Strict, the cookie has to be sent when the provider redirects back to the callback
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/v1/oidc",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   600, // 10 minutes
+	})
+
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// OIDCCallbackHandler completes a single sign-on login and creates a session
+type OIDCCallbackHandler struct {
+	oidc     *oidc.Service
+	sessions *sessions.Service
+}
+
+// NewOIDCCallbackHandler creates a new OIDCCallbackHandler, it takes an oidc service and a sessions service as parameters
+func NewOIDCCallbackHandler(oidc *oidc.Service, sessions *sessions.Service) *OIDCCallbackHandler {
+	return &OIDCCallbackHandler{
+		oidc:     oidc,
+		sessions: sessions,
+	}
+}
+
+// ServeHTTP handles the redirect back from the identity provider
+func (h *OIDCCallbackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respond.WithError(w, r, respond.CodeMethodNotAllowed, "Method not allowed, method: "+r.Method)
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("error") != "" {
+		middleware.LoggerFromContext(r.Context()).Info("login failed at identity provider", slog.String("error", query.Get("error")))
+		metrics.FromContext(r.Context()).LoginFailed(metrics.LoginOIDC)
+		respond.WithError(w, r, respond.CodeLoginFailed, "Login failed at identity provider")
+		return
+	}
+
+	// The state must match the one issued to this browser, this prevents login CSRF
+	cookie, err := r.Cookie(oidcStateCookie)
+	state := query.Get("state")
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		respond.WithError(w, r, respond.CodeInvalidState, "Invalid login state")
+		return
+	}
+
+	// The state cookie is single use
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    "",
+		Path:     "/api/v1/oidc",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   -1,
+	})
+
+	claims, redirect, err := h.oidc.Exchange(r.Context(), state, query.Get("code"))
+	if err != nil {
+		middleware.LoggerFromContext(r.Context()).Info("single sign-on login failed", slog.Any("error", err))
+		metrics.FromContext(r.Context()).LoginFailed(metrics.LoginOIDC)
+		respond.WithError(w, r, respond.CodeInvalidCredentials, "Invalid credentials")
+		return
+	}
+	middleware.SetUser(r.Context(), claims.Username)
+
+	session, err := h.sessions.CreateWithClaims(claims.Username, claims.Email, claims.Groups)
+	if err != nil {
+		middleware.LoggerFromContext(r.Context()).Error("failed to create session", slog.Any("error", err))
+		respond.WithError(w, r, respond.CodeInternal, "Failed to create session")
+		return
+	}
+
+	setSessionCookie(w, session)
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+// isLocalRedirect reports whether redirect is a path on this server,
+// protocol relative URLs such as //evil.example are rejected to prevent open redirects
+func isLocalRedirect(redirect string) bool {
+	return strings.HasPrefix(redirect, "/") &&
+		!strings.HasPrefix(redirect, "//") &&
+		!strings.HasPrefix(redirect, "/\\")
+}
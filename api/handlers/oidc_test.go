@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/josepheid/file-explorer/api/internal/oidc"
+	"github.com/josepheid/file-explorer/api/internal/oidc/oidctest"
+	"github.com/josepheid/file-explorer/api/internal/sessions"
+)
+
+func TestOIDCLoginFlow(t *testing.T) {
+	provider := oidctest.NewProvider(t, "file-explorer")
+	provider.Claims["email"] = "jane@example.com"
+	provider.Claims["groups"] = []string{"engineering"}
+
+	sso := oidc.New(oidc.Config{
+		Issuer:      provider.Issuer(),
+		ClientID:    "file-explorer",
+		RedirectURL: "https://localhost:8080/api/v1/oidc/callback",
+	})
+	sessionService := sessions.New()
+	login := NewOIDCLoginHandler(sso)
+	callback := NewOIDCCallbackHandler(sso, sessionService)
+
+	// start the login, the user should be sent to the provider
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/oidc/login?redirect=//evil.example", nil)
+	rec := httptest.NewRecorder()
+	login.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusFound {
+		t.Fatalf("want status %d, got %d", http.StatusFound, rec.Code)
+	}
+	stateCookie := rec.Result().Cookies()[0]
+	if stateCookie.Name != oidcStateCookie {
+		t.Fatalf("want %s cookie, got %s", oidcStateCookie, stateCookie.Name)
+	}
+
+	// the provider logs the user in and redirects back to the callback
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("authorization request failed: %v", err)
+	}
+	resp.Body.Close()
+	callbackURL, _ := url.Parse(resp.Header.Get("Location"))
+
+	tests := []struct {
+		name         string
+		query        string
+		cookie       *http.Cookie
+		wantStatus   int
+		wantSession  bool
+		wantRedirect string
+	}{
+		{
+			name:       "missing state cookie",
+			query:      callbackURL.RawQuery,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "state mismatch",
+			query:      callbackURL.RawQuery,
+			cookie:     &http.Cookie{Name: oidcStateCookie, Value: "forged"},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "provider error",
+			query:      "error=access_denied&state=" + stateCookie.Value,
+			cookie:     stateCookie,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:         "successful login",
+			query:        callbackURL.RawQuery,
+			cookie:       stateCookie,
+			wantStatus:   http.StatusFound,
+			wantSession:  true,
+			wantRedirect: "/",
+		},
+		{
+			name:       "replayed callback",
+			query:      callbackURL.RawQuery,
+			cookie:     stateCookie,
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/oidc/callback?"+tt.query, nil)
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+			rec := httptest.NewRecorder()
+			callback.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("want status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if !tt.wantSession {
+				return
+			}
+
+			if location := rec.Header().Get("Location"); location != tt.wantRedirect {
+				t.Errorf("want redirect %q, got %q", tt.wantRedirect, location)
+			}
+
+			var session sessions.Session
+			for _, cookie := range rec.Result().Cookies() {
+				if cookie.Name == "session_id" {
+					session = sessionService.Get(cookie.Value)
+				}
+			}
+			if session.ID == "" {
+				t.Fatal("want session cookie for a valid session")
+			}
+			if session.UserID != "user-1" || session.Email != "jane@example.com" || len(session.Groups) != 1 {
+				t.Errorf("session does not carry ID token claims: %+v", session)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOpenAPIHandler(t *testing.T) {
+	spec := []byte(`{"openapi":"3.1.0"}`)
+	tests := []struct {
+		name       string
+		method     string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "get", method: http.MethodGet, wantStatus: http.StatusOK, wantBody: string(spec)},
+		{name: "head", method: http.MethodHead, wantStatus: http.StatusOK},
+		{name: "wrong method", method: http.MethodPost, wantStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(NewOpenAPIHandler(spec))
+			defer server.Close()
+
+			req, _ := http.NewRequest(tt.method, server.URL+"/api/v1/openapi.json", nil)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, resp.StatusCode)
+			}
+			if tt.wantStatus == http.StatusOK && string(body) != tt.wantBody {
+				t.Errorf("expected body %q, got %q", tt.wantBody, body)
+			}
+			if tt.wantStatus == http.StatusOK && resp.Header.Get("Content-Type") != "application/json" {
+				t.Errorf("expected JSON content type, got %q", resp.Header.Get("Content-Type"))
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/josepheid/file-explorer/api/internal/middleware"
+)
+
+var (
+	errInvalidPath   = errors.New("invalid path")
+	errForbiddenPath = errors.New("path not allowed")
+)
+
+// resolvePath validates a path given by a client and maps it onto the filesystem below rootDir,
+// returning the cleaned path as the client sees it and the absolute filesystem path.
+// It fails with errInvalidPath for malformed paths or paths escaping the root,
+// and with errForbiddenPath if the caller is restricted to a subtree (e.g. a path restricted token) not containing it.
+func resolvePath(r *http.Request, rootDir, requestPath string) (cleanPath, absPath string, err error) {
+	if requestPath == "" {
+		requestPath = "/"
+	}
+
+	// Clean and validate the path format
+	cleanPath = filepath.Clean(requestPath)
+	if !strings.HasPrefix(cleanPath, "/") {
+		return "", "", errInvalidPath
+	}
+
+	if identity, ok := middleware.IdentityFromContext(r.Context()); ok && !identity.AllowsPath(cleanPath) {
+		return "", "", errForbiddenPath
+	}
+
+	absRootDir, err := filepath.Abs(rootDir)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Construct and validate the full filesystem path
+	absPath, err = filepath.Abs(filepath.Join(absRootDir, cleanPath))
+	if err != nil {
+		return "", "", err
+	}
+
+	// Validate that the requested path is within the root directory
+	// This needs to happen before we check if the path exists
+	if !isSubpath(absRootDir, absPath) {
+		return "", "", errInvalidPath
+	}
+
+	return cleanPath, absPath, nil
+}
+
+// respondPathError writes the response for an error returned by resolvePath
+func respondPathError(w http.ResponseWriter, r *http.Request, err error) {
+	respondError(w, r, err, "failed to resolve path")
+}
+
+// respondStatError writes the response for an error from os.Stat
+func respondStatError(w http.ResponseWriter, r *http.Request, cleanPath string, err error) {
+	respondError(w, r, err, "failed to stat path", slog.String("path", cleanPath))
+}
+
+// isSubpath checks if childPath is a subpath of parentPath
+func isSubpath(parentPath, childPath string) bool {
+	relativePath, err := filepath.Rel(parentPath, childPath)
+	if err != nil {
+		return false
+	}
+	return !strings.HasPrefix(relativePath, ".."+string(filepath.Separator)) && relativePath != ".."
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/josepheid/file-explorer/api/internal/preview"
+	"github.com/josepheid/file-explorer/api/internal/respond"
+)
+
+// PreviewHandler returns part of a text file for display
+type PreviewHandler struct {
+	rootDir string
+}
+
+// NewPreviewHandler creates a new PreviewHandler, it takes the root directory as a parameter
+func NewPreviewHandler(rootDir string) *PreviewHandler {
+	return &PreviewHandler{rootDir: rootDir}
+}
+
+// PreviewResponse represents the response body for the preview request
+type PreviewResponse struct {
+	Name string `json:"name"`
+	preview.Preview
+}
+
+// ServeHTTP handles the preview request. Besides path it accepts the optional query parameters
+// mode (head or tail), kb (the size of the preview in KB), lines (a range such as 10-20, or 10- for
+// everything from line 10) and highlight (false to skip syntax highlighting).
+func (h *PreviewHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respond.WithError(w, r, respond.CodeMethodNotAllowed, "Method not allowed, method: "+r.Method)
+		return
+	}
+
+	query := r.URL.Query()
+	opts := preview.Options{
+		Mode:      query.Get("mode"),
+		Highlight: query.Get("highlight") != "false",
+	}
+
+	if kb := query.Get("kb"); kb != "" {
+		n, err := strconv.ParseInt(kb, 10, 64)
+		if err != nil || n <= 0 || n > preview.MaxLimit>>10 {
+			respondInvalidParameter(w, r, "kb", "Invalid kb, expected 1 to "+strconv.Itoa(preview.MaxLimit>>10))
+			return
+		}
+		opts.Limit = n << 10
+	}
+
+	if lines := query.Get("lines"); lines != "" {
+		var ok bool
+		opts.FromLine, opts.ToLine, ok = parseLineRange(lines)
+		if !ok {
+			respondInvalidParameter(w, r, "lines", "Invalid lines, expected a range such as 10-20")
+			return
+		}
+	}
+
+	cleanPath, absPath, err := resolvePath(r, h.rootDir, query.Get("path"))
+	if err != nil {
+		respondPathError(w, r, err)
+		return
+	}
+
+	p, err := preview.File(absPath, opts)
+	if err != nil {
+		respondError(w, r, err, "failed to preview file", slog.String("path", cleanPath))
+		return
+	}
+
+	respond.WithJSON(w, PreviewResponse{Name: filepath.Base(cleanPath), Preview: p}, http.StatusOK)
+}
+
+// parseLineRange parses "from-to" or "from-", lines are numbered from 1
+func parseLineRange(s string) (from, to int, ok bool) {
+	fromText, toText, found := strings.Cut(s, "-")
+	if !found {
+		return 0, 0, false
+	}
+
+	from, err := strconv.Atoi(fromText)
+	if err != nil || from < 1 {
+		return 0, 0, false
+	}
+	if toText == "" {
+		return from, 0, true
+	}
+	to, err = strconv.Atoi(toText)
+	if err != nil || to < from {
+		return 0, 0, false
+	}
+	return from, to, true
+}
+
+// PreviewStyleHandler serves the stylesheet for highlighted previews
+type PreviewStyleHandler struct{}
+
+// NewPreviewStyleHandler creates a new PreviewStyleHandler
+func NewPreviewStyleHandler() *PreviewStyleHandler {
+	return &PreviewStyleHandler{}
+}
+
+// ServeHTTP handles the stylesheet request, the optional style query parameter names a chroma style
+func (h *PreviewStyleHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respond.WithError(w, r, respond.CodeMethodNotAllowed, "Method not allowed, method: "+r.Method)
+		return
+	}
+
+	style := r.URL.Query().Get("style")
+	if style == "" {
+		style = preview.DefaultStyle
+	}
+
+	var css bytes.Buffer
+	if err := preview.CSS(&css, style); err != nil {
+		respondInvalidParameter(w, r, "style", "Unknown style "+style)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/css; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write(css.Bytes())
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/josepheid/file-explorer/api/internal/middleware"
+)
+
+func TestPreviewHandler(t *testing.T) {
+	rootDir, cleanup := setupTestDirectory(t)
+	defer cleanup()
+
+	source := "package main\n\nfunc main() {\n\tprintln(\"hello\")\n}\n"
+	if err := os.WriteFile(filepath.Join(rootDir, "dir1", "main.go"), []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		check      func(t *testing.T, resp PreviewResponse)
+	}{
+		{
+			name:       "highlighted source",
+			query:      "?path=/dir1/main.go",
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, resp PreviewResponse) {
+				if resp.Name != "main.go" || resp.Content != source || resp.Language != "Go" || resp.HTML == "" {
+					t.Errorf("unexpected preview %+v", resp)
+				}
+				if resp.StartLine != 1 || resp.EndLine != 5 || resp.Truncated {
+					t.Errorf("unexpected lines %d-%d, truncated %v", resp.StartLine, resp.EndLine, resp.Truncated)
+				}
+			},
+		},
+		{
+			name:       "line range without highlighting",
+			query:      "?path=/dir1/main.go&lines=3-4&highlight=false",
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, resp PreviewResponse) {
+				if resp.Content != "func main() {\n\tprintln(\"hello\")\n" || resp.HTML != "" {
+					t.Errorf("unexpected preview %+v", resp)
+				}
+				if resp.StartLine != 3 || resp.EndLine != 4 || !resp.Truncated {
+					t.Errorf("unexpected lines %d-%d, truncated %v", resp.StartLine, resp.EndLine, resp.Truncated)
+				}
+			},
+		},
+		{
+			name:       "tail",
+			query:      "?path=/dir1/main.go&mode=tail&kb=1",
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, resp PreviewResponse) {
+				if resp.Content != source || resp.Offset != 0 {
+					t.Errorf("unexpected preview %+v", resp)
+				}
+			},
+		},
+		{
+			name:       "binary",
+			query:      "?path=/dir1/file1.txt",
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, resp PreviewResponse) {
+				if !resp.Binary || resp.Content != "" || resp.Size != 100 {
+					t.Errorf("unexpected preview %+v", resp)
+				}
+			},
+		},
+		{name: "directory", query: "?path=/dir1", wantStatus: http.StatusBadRequest},
+		{name: "not found", query: "?path=/dir1/missing.txt", wantStatus: http.StatusNotFound},
+		{name: "path traversal", query: "?path=../etc/passwd", wantStatus: http.StatusBadRequest},
+		{name: "unknown mode", query: "?path=/dir1/main.go&mode=middle", wantStatus: http.StatusBadRequest},
+		{name: "size too large", query: "?path=/dir1/main.go&kb=2048", wantStatus: http.StatusBadRequest},
+		{name: "size not a number", query: "?path=/dir1/main.go&kb=lots", wantStatus: http.StatusBadRequest},
+		{name: "backwards line range", query: "?path=/dir1/main.go&lines=4-3", wantStatus: http.StatusBadRequest},
+		{name: "line range without dash", query: "?path=/dir1/main.go&lines=4", wantStatus: http.StatusBadRequest},
+	}
+
+	handler := NewPreviewHandler(rootDir)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/preview"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+			if tt.check == nil {
+				return
+			}
+
+			var resp PreviewResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			tt.check(t, resp)
+		})
+	}
+}
+
+func TestPreviewHandlerPathRestriction(t *testing.T) {
+	rootDir, cleanup := setupTestDirectory(t)
+	defer cleanup()
+
+	handler := NewPreviewHandler(rootDir)
+	identity := middleware.Identity{UserID: "testuser", Method: middleware.MethodToken, Path: "/dir1/subdir"}
+
+	tests := []struct {
+		path       string
+		wantStatus int
+	}{
+		{path: "/dir1/subdir/file3.txt", wantStatus: http.StatusOK},
+		{path: "/dir1/file1.txt", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/preview?path="+tt.path, nil)
+			req = req.WithContext(middleware.WithIdentity(req.Context(), identity))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestPreviewStyleHandler(t *testing.T) {
+	handler := NewPreviewStyleHandler()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/preview/style.css?style=monokai", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/css") {
+		t.Errorf("expected text/css, got %q", ct)
+	}
+	if !strings.Contains(rr.Body.String(), ".chroma") {
+		t.Error("expected chroma classes in stylesheet")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/preview/style.css?style=nope", nil)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for unknown style, got %d", rr.Code)
+	}
+}
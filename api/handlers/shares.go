@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/josepheid/file-explorer/api/internal/middleware"
+	"github.com/josepheid/file-explorer/api/internal/respond"
+	"github.com/josepheid/file-explorer/api/internal/shares"
+)
+
+// CreateShareHandler creates share links for the logged-in user
+type CreateShareHandler struct {
+	rootDir string
+	shares  *shares.Service
+}
+
+// NewCreateShareHandler creates a new CreateShareHandler, it takes the root directory and a shares service as parameters
+func NewCreateShareHandler(rootDir string, shares *shares.Service) *CreateShareHandler {
+	return &CreateShareHandler{rootDir: rootDir, shares: shares}
+}
+
+// CreateShareRequest represents the request body for creating a share
+type CreateShareRequest struct {
+	Path string `json:"path"`
+	// ExpiresAt defaults to a week from now
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+	MaxDownloads int        `json:"maxDownloads,omitempty"`
+	Password     string     `json:"password,omitempty"`
+}
+
+// CreateShareResponse represents the response body for a created share.
+// Secret and URL are only returned once and cannot be retrieved afterwards.
+type CreateShareResponse struct {
+	shares.Share
+	Secret string `json:"token"`
+	// URL is the public link, relative to the server
+	URL string `json:"url"`
+}
+
+// ServeHTTP handles the create share request
+func (h *CreateShareHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respond.WithError(w, r, respond.CodeMethodNotAllowed, "Method not allowed, method: "+r.Method)
+		return
+	}
+
+	identity, ok := middleware.IdentityFromContext(r.Context())
+	if !ok {
+		respond.WithError(w, r, respond.CodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req CreateShareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respond.WithError(w, r, respond.CodeInvalidBody, "Invalid request body, error: "+err.Error())
+		return
+	}
+
+	var expiresAt time.Time
+	if req.ExpiresAt != nil {
+		expiresAt = *req.ExpiresAt
+		if expiresAt.Before(time.Now()) {
+			respondInvalidField(w, r, "expiresAt", "Expiry must be in the future")
+			return
+		}
+		if expiresAt.After(time.Now().Add(shares.MaxTTL)) {
+			respondInvalidField(w, r, "expiresAt", "Expiry must be within 90 days")
+			return
+		}
+	}
+	if req.MaxDownloads < 0 {
+		respondInvalidField(w, r, "maxDownloads", "Max downloads cannot be negative")
+		return
+	}
+
+	// a share can never reach further than the identity creating it
+	cleanPath, absPath, err := resolvePath(r, h.rootDir, req.Path)
+	if err != nil {
+		respondPathError(w, r, err)
+		return
+	}
+
+	info, err := os.Stat(absPath)
+	if err != nil {
+		respondStatError(w, r, cleanPath, err)
+		return
+	}
+	if !info.IsDir() && !info.Mode().IsRegular() {
+		respond.WithError(w, r, respond.CodeUnsupportedFile, "Path is not a file or directory")
+		return
+	}
+
+	share, secret, err := h.shares.Create(identity.UserID, shares.Options{
+		Path:         cleanPath,
+		Dir:          info.IsDir(),
+		ExpiresAt:    expiresAt,
+		MaxDownloads: req.MaxDownloads,
+		Password:     req.Password,
+	})
+	if err != nil {
+		respondError(w, r, err, "failed to create share", slog.String("path", cleanPath))
+		return
+	}
+
+	respond.WithJSON(w, CreateShareResponse{Share: share, Secret: secret, URL: "/api/v1/shared/" + secret}, http.StatusCreated)
+}
+
+// ListSharesHandler lists the logged-in user's shares
+type ListSharesHandler struct {
+	shares *shares.Service
+}
+
+// NewListSharesHandler creates a new ListSharesHandler, it takes a shares service as a parameter
+func NewListSharesHandler(shares *shares.Service) *ListSharesHandler {
+	return &ListSharesHandler{shares: shares}
+}
+
+// ServeHTTP handles the list shares request
+func (h *ListSharesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respond.WithError(w, r, respond.CodeMethodNotAllowed, "Method not allowed, method: "+r.Method)
+		return
+	}
+
+	identity, ok := middleware.IdentityFromContext(r.Context())
+	if !ok {
+		respond.WithError(w, r, respond.CodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	respond.WithJSON(w, h.shares.List(identity.UserID), http.StatusOK)
+}
+
+// RevokeShareHandler revokes one of the logged-in user's shares
+type RevokeShareHandler struct {
+	shares *shares.Service
+}
+
+// NewRevokeShareHandler creates a new RevokeShareHandler, it takes a shares service as a parameter
+func NewRevokeShareHandler(shares *shares.Service) *RevokeShareHandler {
+	return &RevokeShareHandler{shares: shares}
+}
+
+// ServeHTTP handles the revoke share request, the share ID is taken from the {id} path wildcard
+func (h *RevokeShareHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		respond.WithError(w, r, respond.CodeMethodNotAllowed, "Method not allowed, method: "+r.Method)
+		return
+	}
+
+	identity, ok := middleware.IdentityFromContext(r.Context())
+	if !ok {
+		respond.WithError(w, r, respond.CodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := h.shares.Revoke(identity.UserID, r.PathValue("id")); err != nil {
+		respondError(w, r, err, "failed to revoke share")
+		return
+	}
+
+	respond.WithJSON(w, nil, http.StatusOK)
+}
+
+// SharedListing represents the response body for a directory opened through a share
+type SharedListing struct {
+	Name string `json:"name"`
+	// Path is relative to the shared directory
+	Path     string     `json:"path"`
+	Contents []FileInfo `json:"contents"`
+}
+
+// SharedHandler serves files and directories through share links, without a login
+type SharedHandler struct {
+	rootDir string
+	shares  *shares.Service
+}
+
+// NewSharedHandler creates a new SharedHandler, it takes the root directory and a shares service as parameters
+func NewSharedHandler(rootDir string, shares *shares.Service) *SharedHandler {
+	return &SharedHandler{rootDir: rootDir, shares: shares}
+}
+
+// ServeHTTP handles a request for a share, the secret is taken from the {token} path wildcard.
+// A shared file is downloaded. A shared directory is listed, and the path query parameter, relative to it,
+// names a subdirectory to list or a file to download. The password of a protected share is taken from
+// basic auth with any username, so browsers prompt for it.
+func (h *SharedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		respond.WithError(w, r, respond.CodeMethodNotAllowed, "Method not allowed, method: "+r.Method)
+		return
+	}
+
+	_, password, _ := r.BasicAuth()
+	share, err := h.shares.Open(r.PathValue("token"), password)
+	if err != nil {
+		if errors.Is(err, shares.ErrPasswordRequired) || errors.Is(err, shares.ErrWrongPassword) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="Shared link", charset="UTF-8"`)
+		}
+		respondError(w, r, err, "failed to open share")
+		return
+	}
+
+	// the path is cleaned as an absolute path first so it cannot climb out of the share
+	rel := path.Clean("/" + r.URL.Query().Get("path"))
+	requested := path.Join(share.Path, rel)
+	// the path parameter is relative to the share, the audit log records the file served
+	middleware.SetPath(r.Context(), requested)
+	if !share.Dir && rel != "/" {
+		respond.WithError(w, r, respond.CodePathNotFound, "Path not found")
+		return
+	}
+
+	cleanPath, absPath, err := resolvePath(r, h.rootDir, requested)
+	if err != nil {
+		respondPathError(w, r, err)
+		return
+	}
+
+	info, err := os.Stat(absPath)
+	if err != nil {
+		respondStatError(w, r, cleanPath, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+
+	if info.IsDir() {
+		entries, err := os.ReadDir(absPath)
+		if err != nil {
+			middleware.LoggerFromContext(r.Context()).Error("failed to read directory", slog.String("path", cleanPath), slog.Any("error", err))
+			respond.WithError(w, r, respond.CodeInternal, "Error reading directory")
+			return
+		}
+
+		listing := SharedListing{Name: info.Name(), Path: rel, Contents: make([]FileInfo, 0, len(entries))}
+		for _, entry := range entries {
+			entryInfo, err := entry.Info()
+			if err != nil {
+				continue // Skip entries we can't read
+			}
+			fileType := "file"
+			if entryInfo.IsDir() {
+				fileType = "dir"
+			}
+			listing.Contents = append(listing.Contents, FileInfo{Name: entryInfo.Name(), Type: fileType, Size: entryInfo.Size()})
+		}
+		respond.WithJSON(w, listing, http.StatusOK)
+		return
+	}
+
+	if !info.Mode().IsRegular() {
+		respond.WithError(w, r, respond.CodeNotAFile, "Path is not a file")
+		return
+	}
+
+	f, err := os.Open(absPath)
+	if err != nil {
+		respondStatError(w, r, cleanPath, err)
+		return
+	}
+	defer f.Close()
+
+	if countsAsDownload(r, info.ModTime()) {
+		if err := h.shares.Download(share.ID); err != nil {
+			respondError(w, r, err, "failed to count share download", slog.String("share", share.ID))
+			return
+		}
+	}
+
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": info.Name()}))
+	http.ServeContent(newProgressWriter(w, downloadWriteTimeout), r, info.Name(), info.ModTime(), f)
+}
+
+// countsAsDownload reports whether a request for a shared file uses up one of the share's downloads.
+// HEAD requests transfer nothing, and a single range starting past the beginning of the file resumes or continues a
+// download that was already counted. Suffix ranges, several ranges, and ranges http.ServeContent ignores for a stale
+// If-Range count as they can return the whole file, e.g. ServeContent sends all of it for "bytes=1-,0-".
+func countsAsDownload(r *http.Request, modTime time.Time) bool {
+	if r.Method == http.MethodHead {
+		return false
+	}
+	ranges, ok := strings.CutPrefix(r.Header.Get("Range"), "bytes=")
+	if !ok {
+		return true
+	}
+	if ifRange := r.Header.Get("If-Range"); ifRange != "" && ifRange != modTime.UTC().Format(http.TimeFormat) {
+		return true
+	}
+	if strings.Contains(ranges, ",") {
+		return true
+	}
+	start, _, _ := strings.Cut(strings.TrimSpace(ranges), "-")
+	offset, err := strconv.ParseInt(start, 10, 64)
+	return err != nil || offset == 0
+}
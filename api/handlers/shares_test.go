@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/josepheid/file-explorer/api/internal/audit"
+	"github.com/josepheid/file-explorer/api/internal/middleware"
+	"github.com/josepheid/file-explorer/api/internal/shares"
+	"github.com/josepheid/file-explorer/api/internal/tokens"
+)
+
+func TestCreateShareHandler(t *testing.T) {
+	rootDir, cleanup := setupTestDirectory(t)
+	defer cleanup()
+
+	past := time.Now().Add(-time.Hour)
+	tooLate := time.Now().Add(shares.MaxTTL + time.Hour)
+
+	session := middleware.Identity{UserID: "testuser", Method: middleware.MethodSession}
+	restricted := middleware.Identity{UserID: "testuser", Method: middleware.MethodToken, Scopes: []string{tokens.ScopeWrite}, Path: "/empty"}
+
+	tests := []struct {
+		name       string
+		identity   *middleware.Identity
+		request    CreateShareRequest
+		wantStatus int
+		wantDir    bool
+	}{
+		{name: "file", identity: &session, request: CreateShareRequest{Path: "/dir1/file1.txt", MaxDownloads: 3}, wantStatus: http.StatusCreated},
+		{name: "directory", identity: &session, request: CreateShareRequest{Path: "/dir1", Password: "secret"}, wantStatus: http.StatusCreated, wantDir: true},
+		{name: "not logged in", request: CreateShareRequest{Path: "/dir1"}, wantStatus: http.StatusUnauthorized},
+		{name: "expiry in the past", identity: &session, request: CreateShareRequest{Path: "/dir1", ExpiresAt: &past}, wantStatus: http.StatusBadRequest},
+		{name: "expiry too far away", identity: &session, request: CreateShareRequest{Path: "/dir1", ExpiresAt: &tooLate}, wantStatus: http.StatusBadRequest},
+		{name: "negative max downloads", identity: &session, request: CreateShareRequest{Path: "/dir1", MaxDownloads: -1}, wantStatus: http.StatusBadRequest},
+		{name: "not found", identity: &session, request: CreateShareRequest{Path: "/missing"}, wantStatus: http.StatusNotFound},
+		{name: "outside restricted path", identity: &restricted, request: CreateShareRequest{Path: "/dir1"}, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewCreateShareHandler(rootDir, shares.New())
+
+			body, _ := json.Marshal(tt.request)
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/shares", bytes.NewReader(body))
+			if tt.identity != nil {
+				req = req.WithContext(middleware.WithIdentity(req.Context(), *tt.identity))
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+			if tt.wantStatus != http.StatusCreated {
+				return
+			}
+
+			var resp CreateShareResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if resp.Secret == "" || resp.URL != "/api/v1/shared/"+resp.Secret {
+				t.Errorf("unexpected secret %q and URL %q", resp.Secret, resp.URL)
+			}
+			if resp.Path != tt.request.Path || resp.Dir != tt.wantDir || resp.PasswordProtected != (tt.request.Password != "") {
+				t.Errorf("unexpected share %+v", resp.Share)
+			}
+		})
+	}
+}
+
+func TestListAndRevokeShareHandlers(t *testing.T) {
+	service := shares.New()
+	share, _, err := service.Create("testuser", shares.Options{Path: "/dir1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.Create("otheruser", shares.Options{Path: "/dir1"})
+
+	ctx := middleware.WithIdentity(context.Background(), middleware.Identity{UserID: "testuser", Method: middleware.MethodSession})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/shares", nil).WithContext(ctx)
+	rr := httptest.NewRecorder()
+	NewListSharesHandler(service).ServeHTTP(rr, req)
+
+	var list []shares.Share
+	if err := json.NewDecoder(rr.Body).Decode(&list); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if rr.Code != http.StatusOK || len(list) != 1 || list[0].ID != share.ID {
+		t.Fatalf("unexpected list %d %+v", rr.Code, list)
+	}
+
+	revoke := func(id string) int {
+		req := httptest.NewRequest(http.MethodDelete, "/api/v1/shares/"+id, nil).WithContext(ctx)
+		req.SetPathValue("id", id)
+		rr := httptest.NewRecorder()
+		NewRevokeShareHandler(service).ServeHTTP(rr, req)
+		return rr.Code
+	}
+	if code := revoke(share.ID); code != http.StatusOK {
+		t.Errorf("expected status %d revoking, got %d", http.StatusOK, code)
+	}
+	if code := revoke(share.ID); code != http.StatusNotFound {
+		t.Errorf("expected status %d revoking twice, got %d", http.StatusNotFound, code)
+	}
+}
+
+func TestSharedHandler(t *testing.T) {
+	rootDir, cleanup := setupTestDirectory(t)
+	defer cleanup()
+
+	auditLog, err := audit.New(filepath.Join(t.TempDir(), "audit.log"), 1<<20, 1)
+	if err != nil {
+		t.Fatalf("audit.New() error = %v", err)
+	}
+	defer auditLog.Close()
+
+	service := shares.New()
+	handler := middleware.Audit(auditLog, "share.open")(NewSharedHandler(rootDir, service))
+
+	_, fileSecret, _ := service.Create("testuser", shares.Options{Path: "/dir1/file1.txt", MaxDownloads: 1})
+	_, dirSecret, _ := service.Create("testuser", shares.Options{Path: "/dir1/subdir", Dir: true, Password: "secret"})
+
+	serve := func(secret, query, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/shared/"+secret+query, nil)
+		req.SetPathValue("token", secret)
+		if password != "" {
+			req.SetBasicAuth("", password)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// a shared file is downloaded, once
+	rr := serve(fileSecret, "", "")
+	if rr.Code != http.StatusOK || rr.Body.Len() != 100 {
+		t.Fatalf("unexpected download %d with %d bytes", rr.Code, rr.Body.Len())
+	}
+	if cd := rr.Header().Get("Content-Disposition"); cd != "attachment; filename=file1.txt" {
+		t.Errorf("unexpected Content-Disposition %q", cd)
+	}
+	if rr := serve(fileSecret, "", ""); rr.Code != http.StatusGone {
+		t.Errorf("expected status %d after the last download, got %d", http.StatusGone, rr.Code)
+	}
+
+	// a protected directory needs its password
+	rr = serve(dirSecret, "", "")
+	if rr.Code != http.StatusUnauthorized || rr.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("expected a basic auth challenge, got %d %v", rr.Code, rr.Header())
+	}
+	if rr := serve(dirSecret, "", "wrong"); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d with the wrong password, got %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	rr = serve(dirSecret, "", "secret")
+	var listing SharedListing
+	if err := json.NewDecoder(rr.Body).Decode(&listing); err != nil {
+		t.Fatalf("failed to decode listing: %v", err)
+	}
+	if rr.Code != http.StatusOK || listing.Path != "/" || len(listing.Contents) != 1 || listing.Contents[0].Name != "file3.txt" {
+		t.Errorf("unexpected listing %d %+v", rr.Code, listing)
+	}
+
+	// files below the directory can be downloaded, but nothing outside it
+	if rr := serve(dirSecret, "?path=/file3.txt", "secret"); rr.Code != http.StatusOK || rr.Body.Len() != 300 {
+		t.Errorf("unexpected download %d with %d bytes", rr.Code, rr.Body.Len())
+	}
+	// the audit log names the file served rather than the path relative to the share
+	if events, err := auditLog.Query(audit.Filter{Limit: 1}); err != nil || len(events) != 1 || events[0].Path != "/dir1/subdir/file3.txt" {
+		t.Errorf("unexpected audit events %+v, %v", events, err)
+	}
+	if rr := serve(dirSecret, "?path=../file1.txt", "secret"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d climbing out of the share, got %d", http.StatusNotFound, rr.Code)
+	}
+
+	if rr := serve("fs_unknown", "", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for an unknown share, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestSharedHandlerRanges(t *testing.T) {
+	rootDir, cleanup := setupTestDirectory(t)
+	defer cleanup()
+
+	service := shares.New()
+	handler := NewSharedHandler(rootDir, service)
+	share, secret, _ := service.Create("testuser", shares.Options{Path: "/dir1/file1.txt", MaxDownloads: 3})
+
+	tests := []struct {
+		name          string
+		rangeHeader   string
+		ifRange       string
+		wantStatus    int
+		wantDownloads int
+	}{
+		{name: "start of the file", rangeHeader: "bytes=0-49", wantStatus: http.StatusPartialContent, wantDownloads: 1},
+		{name: "resumed", rangeHeader: "bytes=50-", wantStatus: http.StatusPartialContent, wantDownloads: 1},
+		{name: "resumed again", rangeHeader: "bytes=50-99", wantStatus: http.StatusPartialContent, wantDownloads: 1},
+		{name: "stale If-Range", rangeHeader: "bytes=50-", ifRange: `"etag"`, wantStatus: http.StatusOK, wantDownloads: 2},
+		{name: "overlapping ranges", rangeHeader: "bytes=1-,0-", wantStatus: http.StatusOK, wantDownloads: 3},
+		{name: "limit reached", rangeHeader: "bytes=50-", wantStatus: http.StatusGone, wantDownloads: 3},
+		{name: "limit reached with overlapping ranges", rangeHeader: "bytes=1-,0-", wantStatus: http.StatusGone, wantDownloads: 3},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/shared/"+secret, nil)
+		req.SetPathValue("token", secret)
+		req.Header.Set("Range", tt.rangeHeader)
+		if tt.ifRange != "" {
+			req.Header.Set("If-Range", tt.ifRange)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.name, rr.Code, tt.wantStatus)
+		}
+		for _, s := range service.List("testuser") {
+			if s.ID == share.ID && s.Downloads != tt.wantDownloads {
+				t.Errorf("%s: downloads = %d, want %d", tt.name, s.Downloads, tt.wantDownloads)
+			}
+		}
+	}
+}
+
+func TestCountsAsDownload(t *testing.T) {
+	modTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		method      string
+		rangeHeader string
+		ifRange     string
+		want        bool
+	}{
+		{method: http.MethodGet, want: true},
+		{method: http.MethodHead, want: false},
+		{method: http.MethodGet, rangeHeader: "bytes=0-", want: true},
+		{method: http.MethodGet, rangeHeader: "bytes=0-9,20-29", want: true},
+		{method: http.MethodGet, rangeHeader: "bytes=1-,0-", want: true},
+		{method: http.MethodGet, rangeHeader: "bytes=10-19,30-39", want: true},
+		{method: http.MethodGet, rangeHeader: "bytes=10-", want: false},
+		{method: http.MethodGet, rangeHeader: "bytes=-10", want: true},
+		{method: http.MethodGet, rangeHeader: "bytes=10-", ifRange: modTime.Format(http.TimeFormat), want: false},
+		{method: http.MethodGet, rangeHeader: "bytes=10-", ifRange: "Fri, 01 Mar 2024 11:00:00 GMT", want: true},
+		{method: http.MethodGet, rangeHeader: "items=10-", want: true},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/api/v1/shared/fs_secret", nil)
+		if tt.rangeHeader != "" {
+			req.Header.Set("Range", tt.rangeHeader)
+		}
+		if tt.ifRange != "" {
+			req.Header.Set("If-Range", tt.ifRange)
+		}
+		if got := countsAsDownload(req, modTime); got != tt.want {
+			t.Errorf("countsAsDownload(%s, Range %q, If-Range %q) = %v, want %v", tt.method, tt.rangeHeader, tt.ifRange, got, tt.want)
+		}
+	}
+}
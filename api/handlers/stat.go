@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/josepheid/file-explorer/api/internal/fileinfo"
+	"github.com/josepheid/file-explorer/api/internal/respond"
+)
+
+type StatHandler struct {
+	rootDir string
+}
+
+func NewStatHandler(rootDir string) *StatHandler {
+	return &StatHandler{rootDir: rootDir}
+}
+
+// StatResponse is the metadata of a single file, directory or symlink. Fields the platform or filesystem does
+// not record are left out.
+type StatResponse struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	// Type is file, dir or symlink, symlinks are not followed
+	Type string `json:"type"`
+	Size int64  `json:"size"`
+	// Mode is the file mode as ls shows it, e.g. -rw-r--r--, and Permissions its permission bits in octal
+	Mode        string     `json:"mode"`
+	Permissions string     `json:"permissions"`
+	ModifiedAt  time.Time  `json:"modifiedAt"`
+	AccessedAt  *time.Time `json:"accessedAt,omitempty"`
+	ChangedAt   *time.Time `json:"changedAt,omitempty"`
+	// CreatedAt is the birth time, which few filesystems record
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+	Owner     *Owner     `json:"owner,omitempty"`
+	// SymlinkTarget is the path a symlink points to, it is left out for targets outside the root directory
+	SymlinkTarget string `json:"symlinkTarget,omitempty"`
+	// MIMEType is only set for regular files
+	MIMEType string `json:"mimeType,omitempty"`
+	// Xattrs holds the extended attributes by name, their values are base64 encoded as they may be binary
+	Xattrs map[string][]byte `json:"xattrs,omitempty"`
+}
+
+// Owner is the user and group owning a file, the names are left out for IDs without an account
+type Owner struct {
+	UID   int    `json:"uid"`
+	GID   int    `json:"gid"`
+	User  string `json:"user,omitempty"`
+	Group string `json:"group,omitempty"`
+}
+
+// ServeHTTP handles the stat request for the entry at path
+func (h *StatHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respond.WithError(w, r, respond.CodeMethodNotAllowed, "Method not allowed, method: "+r.Method)
+		return
+	}
+
+	cleanPath, absPath, err := resolvePath(r, h.rootDir, r.URL.Query().Get("path"))
+	if err != nil {
+		respondPathError(w, r, err)
+		return
+	}
+
+	info, err := fileinfo.Lstat(absPath)
+	if err != nil {
+		respondStatError(w, r, cleanPath, err)
+		return
+	}
+
+	resp := StatResponse{
+		Name:        filepath.Base(cleanPath),
+		Path:        cleanPath,
+		Type:        "file",
+		Size:        info.Size,
+		Mode:        info.Mode.String(),
+		Permissions: fmt.Sprintf("%04o", info.Mode.Perm()),
+		ModifiedAt:  info.ModTime,
+		AccessedAt:  optionalTime(info.AccessTime),
+		ChangedAt:   optionalTime(info.ChangeTime),
+		CreatedAt:   optionalTime(info.BirthTime),
+		Xattrs:      info.Xattrs,
+	}
+	if info.Owner != nil {
+		resp.Owner = &Owner{UID: info.Owner.UID, GID: info.Owner.GID, User: info.Owner.User, Group: info.Owner.Group}
+	}
+
+	switch {
+	case info.Mode.IsDir():
+		resp.Type = "dir"
+	case info.Mode&os.ModeSymlink != 0:
+		resp.Type = "symlink"
+		resp.SymlinkTarget = h.symlinkTarget(absPath)
+	case info.Mode.IsRegular():
+		resp.MIMEType = fileinfo.MIMEType(absPath)
+	}
+
+	respond.WithJSON(w, resp, http.StatusOK)
+}
+
+// symlinkTarget returns the path the symlink at absPath points to as the client sees it,
+// or "" if it cannot be read or points outside the root directory
+func (h *StatHandler) symlinkTarget(absPath string) string {
+	target, err := os.Readlink(absPath)
+	if err != nil {
+		return ""
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(absPath), target)
+	}
+
+	absRootDir, err := filepath.Abs(h.rootDir)
+	if err != nil || !isSubpath(absRootDir, target) {
+		return ""
+	}
+	rel, err := filepath.Rel(absRootDir, target)
+	if err != nil {
+		return ""
+	}
+	return path.Join("/", filepath.ToSlash(rel))
+}
+
+// optionalTime returns nil for the zero time, so it is left out of responses
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/josepheid/file-explorer/api/internal/middleware"
+	"github.com/josepheid/file-explorer/api/internal/respond"
+)
+
+func TestStatHandler(t *testing.T) {
+	rootDir, cleanup := setupTestDirectory(t)
+	defer cleanup()
+
+	// set the modes explicitly as they are masked by the umask on creation
+	if err := os.Chmod(filepath.Join(rootDir, "dir1/file1.txt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(rootDir, "dir1/subdir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(rootDir, "dir1/file1.txt"), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("file1.txt", filepath.Join(rootDir, "dir1/link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/etc/passwd", filepath.Join(rootDir, "dir1/outside")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		wantCode   respond.Code
+		check      func(t *testing.T, resp StatResponse)
+	}{
+		{
+			name:       "file",
+			method:     http.MethodGet,
+			path:       "/dir1/file1.txt",
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, resp StatResponse) {
+				if resp.Name != "file1.txt" || resp.Path != "/dir1/file1.txt" || resp.Type != "file" || resp.Size != 100 {
+					t.Errorf("got %+v, want file1.txt of 100 bytes", resp)
+				}
+				if resp.Mode != "-rw-r--r--" || resp.Permissions != "0644" {
+					t.Errorf("mode = %s %s, want -rw-r--r-- 0644", resp.Mode, resp.Permissions)
+				}
+				if !resp.ModifiedAt.Equal(modTime) {
+					t.Errorf("modifiedAt = %v, want %v", resp.ModifiedAt, modTime)
+				}
+				if resp.MIMEType != "text/plain; charset=utf-8" {
+					t.Errorf("mimeType = %q, want text/plain", resp.MIMEType)
+				}
+				if runtime.GOOS == "linux" {
+					if resp.AccessedAt == nil || resp.ChangedAt == nil {
+						t.Errorf("accessedAt = %v, changedAt = %v, want both set", resp.AccessedAt, resp.ChangedAt)
+					}
+					if resp.Owner == nil || resp.Owner.UID != os.Getuid() {
+						t.Errorf("owner = %+v, want the user running the test", resp.Owner)
+					}
+				}
+			},
+		},
+		{
+			name:       "directory",
+			method:     http.MethodGet,
+			path:       "/dir1/subdir",
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, resp StatResponse) {
+				if resp.Type != "dir" || resp.Mode != "drwxr-xr-x" || resp.MIMEType != "" {
+					t.Errorf("got %+v, want a directory without a MIME type", resp)
+				}
+			},
+		},
+		{
+			name:       "root",
+			method:     http.MethodGet,
+			path:       "",
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, resp StatResponse) {
+				if resp.Path != "/" || resp.Type != "dir" {
+					t.Errorf("got %+v, want the root directory", resp)
+				}
+			},
+		},
+		{
+			name:       "symlink",
+			method:     http.MethodGet,
+			path:       "/dir1/link",
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, resp StatResponse) {
+				if resp.Type != "symlink" || resp.SymlinkTarget != "/dir1/file1.txt" {
+					t.Errorf("got %+v, want a symlink to /dir1/file1.txt", resp)
+				}
+			},
+		},
+		{
+			name:       "symlink outside root",
+			method:     http.MethodGet,
+			path:       "/dir1/outside",
+			wantStatus: http.StatusOK,
+			check: func(t *testing.T, resp StatResponse) {
+				if resp.Type != "symlink" || resp.SymlinkTarget != "" {
+					t.Errorf("got %+v, want a symlink without its target", resp)
+				}
+			},
+		},
+		{
+			name:       "not found",
+			method:     http.MethodGet,
+			path:       "/dir1/missing.txt",
+			wantStatus: http.StatusNotFound,
+			wantCode:   respond.CodePathNotFound,
+		},
+		{
+			name:       "path traversal",
+			method:     http.MethodGet,
+			path:       "../../etc/passwd",
+			wantStatus: http.StatusBadRequest,
+			wantCode:   respond.CodeInvalidPath,
+		},
+		{
+			name:       "wrong method",
+			method:     http.MethodPost,
+			path:       "/dir1/file1.txt",
+			wantStatus: http.StatusMethodNotAllowed,
+			wantCode:   respond.CodeMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewStatHandler(rootDir)
+			req := httptest.NewRequest(tt.method, "/api/v1/stat?path="+tt.path, nil)
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantCode != "" {
+				var resp respond.Error
+				if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+					t.Fatalf("failed to decode error: %v", err)
+				}
+				if resp.Code != tt.wantCode {
+					t.Errorf("code = %q, want %q", resp.Code, tt.wantCode)
+				}
+				return
+			}
+
+			var resp StatResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			tt.check(t, resp)
+		})
+	}
+}
+
+func TestStatHandlerPathRestriction(t *testing.T) {
+	rootDir, cleanup := setupTestDirectory(t)
+	defer cleanup()
+
+	identity := middleware.Identity{UserID: "testuser", Method: middleware.MethodToken, Path: "/dir1"}
+	handler := NewStatHandler(rootDir)
+
+	for path, want := range map[string]int{
+		"/dir1/file1.txt":  http.StatusOK,
+		"/empty":           http.StatusForbidden,
+		"/dir1/../empty":   http.StatusForbidden,
+		"/dir1/subdir/../": http.StatusOK,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/stat?path="+path, nil)
+		req = req.WithContext(middleware.WithIdentity(req.Context(), identity))
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+
+		if w.Code != want {
+			t.Errorf("stat %s status = %d, want %d", path, w.Code, want)
+		}
+	}
+}
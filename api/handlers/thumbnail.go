@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/josepheid/file-explorer/api/internal/middleware"
+	"github.com/josepheid/file-explorer/api/internal/respond"
+	"github.com/josepheid/file-explorer/api/internal/thumbnail"
+)
+
+// ThumbnailHandler serves scaled down previews of images
+type ThumbnailHandler struct {
+	rootDir    string
+	thumbnails *thumbnail.Service
+}
+
+// NewThumbnailHandler creates a new ThumbnailHandler, it takes the root directory and a thumbnail service as parameters
+func NewThumbnailHandler(rootDir string, thumbnails *thumbnail.Service) *ThumbnailHandler {
+	return &ThumbnailHandler{rootDir: rootDir, thumbnails: thumbnails}
+}
+
+// ServeHTTP handles the thumbnail request for the image at path, the optional size query parameter
+// is the length of the thumbnail's longer side in pixels
+func (h *ThumbnailHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respond.WithError(w, r, respond.CodeMethodNotAllowed, "Method not allowed, method: "+r.Method)
+		return
+	}
+
+	size := thumbnail.DefaultSize
+	if s := r.URL.Query().Get("size"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < thumbnail.MinSize || n > thumbnail.MaxSize {
+			respondInvalidParameter(w, r, "size", "Invalid size, expected "+strconv.Itoa(thumbnail.MinSize)+" to "+strconv.Itoa(thumbnail.MaxSize))
+			return
+		}
+		size = n
+	}
+
+	cleanPath, absPath, err := resolvePath(r, h.rootDir, r.URL.Query().Get("path"))
+	if err != nil {
+		respondPathError(w, r, err)
+		return
+	}
+
+	info, err := os.Stat(absPath)
+	if err != nil {
+		respondStatError(w, r, cleanPath, err)
+		return
+	}
+	if !info.Mode().IsRegular() || !thumbnail.Supported(info.Name()) {
+		respond.WithError(w, r, respond.CodeUnsupportedFile, "Path is not a supported image")
+		return
+	}
+
+	cached, err := h.thumbnails.Get(r.Context(), absPath, info, size)
+	if err != nil {
+		respondError(w, r, err, "failed to generate thumbnail", slog.String("path", cleanPath))
+		return
+	}
+
+	f, err := os.Open(cached)
+	if err != nil {
+		middleware.LoggerFromContext(r.Context()).Error("failed to open thumbnail", slog.String("path", cleanPath), slog.Any("error", err))
+		respond.WithError(w, r, respond.CodeInternal, "Internal server error")
+		return
+	}
+	defer f.Close()
+
+	// the image's modification time lets browsers revalidate with If-Modified-Since
+	w.Header().Set("Content-Type", thumbnail.ContentType(cached))
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+// thumbnailURL links to the thumbnail of the image at cleanPath, the modification time busts browser caches when it changes
+func thumbnailURL(cleanPath string, info os.FileInfo) string {
+	query := url.Values{
+		"path": {cleanPath},
+		"v":    {strconv.FormatInt(info.ModTime().Unix(), 10)},
+	}
+	return "/api/v1/thumbnail?" + query.Encode()
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"encoding/json"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/josepheid/file-explorer/api/internal/middleware"
+	"github.com/josepheid/file-explorer/api/internal/thumbnail"
+)
+
+// writeTestImage writes a w x h PNG to path below rootDir
+func writeTestImage(t *testing.T, rootDir, path string, w, h int) {
+	t.Helper()
+
+	f, err := os.Create(filepath.Join(rootDir, path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := png.Encode(f, image.NewGray(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestThumbnailHandler(t *testing.T, rootDir string) *ThumbnailHandler {
+	t.Helper()
+
+	thumbnails, err := thumbnail.New(t.TempDir(), 1)
+	if err != nil {
+		t.Fatalf("thumbnail.New() error = %v", err)
+	}
+	return NewThumbnailHandler(rootDir, thumbnails)
+}
+
+func TestThumbnailHandler(t *testing.T) {
+	rootDir, cleanup := setupTestDirectory(t)
+	defer cleanup()
+
+	writeTestImage(t, rootDir, "dir1/screenshot.png", 800, 400)
+	if err := os.WriteFile(filepath.Join(rootDir, "dir1", "broken.png"), []byte("not an image"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantWidth  int
+	}{
+		{name: "default size", query: "?path=/dir1/screenshot.png", wantStatus: http.StatusOK, wantWidth: thumbnail.DefaultSize},
+		{name: "custom size", query: "?path=/dir1/screenshot.png&size=100", wantStatus: http.StatusOK, wantWidth: 100},
+		{name: "size too small", query: "?path=/dir1/screenshot.png&size=1", wantStatus: http.StatusBadRequest},
+		{name: "size not a number", query: "?path=/dir1/screenshot.png&size=big", wantStatus: http.StatusBadRequest},
+		{name: "not an image", query: "?path=/dir1/file1.txt", wantStatus: http.StatusBadRequest},
+		{name: "broken image", query: "?path=/dir1/broken.png", wantStatus: http.StatusBadRequest},
+		{name: "directory", query: "?path=/dir1", wantStatus: http.StatusBadRequest},
+		{name: "not found", query: "?path=/dir1/missing.png", wantStatus: http.StatusNotFound},
+		{name: "path traversal", query: "?path=../etc/passwd", wantStatus: http.StatusBadRequest},
+	}
+
+	handler := newTestThumbnailHandler(t, rootDir)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/thumbnail"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			if ct := rr.Header().Get("Content-Type"); ct != "image/jpeg" {
+				t.Errorf("expected image/jpeg, got %q", ct)
+			}
+			if rr.Header().Get("Last-Modified") == "" {
+				t.Error("expected Last-Modified header")
+			}
+			cfg, _, err := image.DecodeConfig(rr.Body)
+			if err != nil {
+				t.Fatalf("invalid thumbnail: %v", err)
+			}
+			if cfg.Width != tt.wantWidth || cfg.Height != tt.wantWidth/2 {
+				t.Errorf("thumbnail is %dx%d, want %dx%d", cfg.Width, cfg.Height, tt.wantWidth, tt.wantWidth/2)
+			}
+		})
+	}
+}
+
+func TestThumbnailHandlerPathRestriction(t *testing.T) {
+	rootDir, cleanup := setupTestDirectory(t)
+	defer cleanup()
+
+	writeTestImage(t, rootDir, "dir1/screenshot.png", 10, 10)
+	identity := middleware.Identity{UserID: "testuser", Method: middleware.MethodToken, Path: "/empty"}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/thumbnail?path=/dir1/screenshot.png", nil)
+	req = req.WithContext(middleware.WithIdentity(req.Context(), identity))
+	rr := httptest.NewRecorder()
+	newTestThumbnailHandler(t, rootDir).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected status %d, got %d", http.StatusForbidden, rr.Code)
+	}
+}
+
+func TestBrowseHandlerThumbnails(t *testing.T) {
+	rootDir, cleanup := setupTestDirectory(t)
+	defer cleanup()
+
+	writeTestImage(t, rootDir, "dir1/screen shot.png", 10, 10)
+
+	for _, query := range []string{"?path=/dir1", "?path=/dir1&thumbnails=true"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/browse"+query, nil)
+		rr := httptest.NewRecorder()
+		NewBrowseHandler(rootDir).ServeHTTP(rr, req)
+
+		var resp BrowseResponse
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+
+		withThumbnails := query != "?path=/dir1"
+		for _, entry := range resp.Contents {
+			switch {
+			case entry.Name == "screen shot.png" && withThumbnails:
+				if entry.Thumbnail == "" {
+					t.Error("expected a thumbnail URL for the image")
+				}
+				u, err := http.NewRequest(http.MethodGet, entry.Thumbnail, nil)
+				if err != nil {
+					t.Fatalf("invalid thumbnail URL %q: %v", entry.Thumbnail, err)
+				}
+				if u.URL.Path != "/api/v1/thumbnail" || u.URL.Query().Get("path") != "/dir1/screen shot.png" || u.URL.Query().Get("v") == "" {
+					t.Errorf("unexpected thumbnail URL %q", entry.Thumbnail)
+				}
+			case entry.Thumbnail != "":
+				t.Errorf("unexpected thumbnail URL for %s with %s", entry.Name, query)
+			}
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/josepheid/file-explorer/api/internal/middleware"
+	"github.com/josepheid/file-explorer/api/internal/respond"
+	"github.com/josepheid/file-explorer/api/internal/tokens"
+)
+
+// CreateTokenHandler issues personal access tokens for the logged-in user
+type CreateTokenHandler struct {
+	tokens *tokens.Service
+}
+
+// NewCreateTokenHandler creates a new CreateTokenHandler, it takes a tokens service as a parameter
+func NewCreateTokenHandler(tokens *tokens.Service) *CreateTokenHandler {
+	return &CreateTokenHandler{tokens: tokens}
+}
+
+// CreateTokenRequest represents the request body for creating a token
+type CreateTokenRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	Path      string     `json:"path,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// CreateTokenResponse represents the response body for a created token.
+// Secret is only returned once and cannot be retrieved afterwards.
+type CreateTokenResponse struct {
+	tokens.Token
+	Secret string `json:"token"`
+}
+
+// ServeHTTP handles the create token request
+func (h *CreateTokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respond.WithError(w, r, respond.CodeMethodNotAllowed, "Method not allowed, method: "+r.Method)
+		return
+	}
+
+	identity, ok := middleware.IdentityFromContext(r.Context())
+	if !ok {
+		respond.WithError(w, r, respond.CodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req CreateTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respond.WithError(w, r, respond.CodeInvalidBody, "Invalid request body, error: "+err.Error())
+		return
+	}
+
+	if req.Name == "" {
+		respondInvalidField(w, r, "name", "Name is required")
+		return
+	}
+
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		respondInvalidField(w, r, "expiresAt", "Expiry must be in the future")
+		return
+	}
+
+	// A token can never grant more than the identity creating it
+	for _, scope := range req.Scopes {
+		if !identity.HasScope(scope) {
+			respond.WithErrorDetails(w, r, respond.CodeForbidden, "Cannot grant scope "+scope, map[string]any{"scope": scope})
+			return
+		}
+	}
+	if req.Path == "" {
+		req.Path = identity.Path
+	} else {
+		// the path is cleaned before it is checked, so ".." cannot climb out of the identity's own restriction
+		if !strings.HasPrefix(req.Path, "/") {
+			respondInvalidField(w, r, "path", "Path restriction must be an absolute path")
+			return
+		}
+		req.Path = path.Clean(req.Path)
+	}
+	if !identity.AllowsPath(req.Path) {
+		respond.WithErrorDetails(w, r, respond.CodeForbidden, "Cannot grant access to path "+req.Path, map[string]any{"path": req.Path})
+		return
+	}
+
+	token, secret, err := h.tokens.Create(identity.UserID, req.Name, req.Scopes, req.Path, req.ExpiresAt)
+	if err != nil {
+		respondError(w, r, err, "failed to create token")
+		return
+	}
+
+	respond.WithJSON(w, CreateTokenResponse{Token: token, Secret: secret}, http.StatusCreated)
+}
+
+// ListTokensHandler lists the logged-in user's personal access tokens
+type ListTokensHandler struct {
+	tokens *tokens.Service
+}
+
+// NewListTokensHandler creates a new ListTokensHandler, it takes a tokens service as a parameter
+func NewListTokensHandler(tokens *tokens.Service) *ListTokensHandler {
+	return &ListTokensHandler{tokens: tokens}
+}
+
+// ServeHTTP handles the list tokens request
+func (h *ListTokensHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respond.WithError(w, r, respond.CodeMethodNotAllowed, "Method not allowed, method: "+r.Method)
+		return
+	}
+
+	identity, ok := middleware.IdentityFromContext(r.Context())
+	if !ok {
+		respond.WithError(w, r, respond.CodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	respond.WithJSON(w, h.tokens.List(identity.UserID), http.StatusOK)
+}
+
+// RevokeTokenHandler revokes one of the logged-in user's personal access tokens
+type RevokeTokenHandler struct {
+	tokens *tokens.Service
+}
+
+// NewRevokeTokenHandler creates a new RevokeTokenHandler, it takes a tokens service as a parameter
+func NewRevokeTokenHandler(tokens *tokens.Service) *RevokeTokenHandler {
+	return &RevokeTokenHandler{tokens: tokens}
+}
+
+// ServeHTTP handles the revoke token request, the token ID is taken from the {id} path wildcard
+func (h *RevokeTokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		respond.WithError(w, r, respond.CodeMethodNotAllowed, "Method not allowed, method: "+r.Method)
+		return
+	}
+
+	identity, ok := middleware.IdentityFromContext(r.Context())
+	if !ok {
+		respond.WithError(w, r, respond.CodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := h.tokens.Revoke(identity.UserID, r.PathValue("id")); err != nil {
+		respondError(w, r, err, "failed to revoke token")
+		return
+	}
+
+	respond.WithJSON(w, nil, http.StatusOK)
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/josepheid/file-explorer/api/internal/middleware"
+	"github.com/josepheid/file-explorer/api/internal/tokens"
+)
+
+func TestCreateTokenHandler(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+
+	session := middleware.Identity{UserID: "testuser", Method: middleware.MethodSession}
+	restricted := middleware.Identity{UserID: "testuser", Method: middleware.MethodToken, Scopes: []string{tokens.ScopeAdmin}, Path: "/builds"}
+
+	tests := []struct {
+		name       string
+		identity   *middleware.Identity
+		request    CreateTokenRequest
+		wantStatus int
+		wantPath   string
+	}{
+		{
+			name:       "valid request",
+			identity:   &session,
+			request:    CreateTokenRequest{Name: "CI", Scopes: []string{tokens.ScopeRead}, Path: "/builds"},
+			wantStatus: http.StatusCreated,
+			wantPath:   "/builds",
+		},
+		{
+			name:       "not logged in",
+			request:    CreateTokenRequest{Name: "CI", Scopes: []string{tokens.ScopeRead}},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "missing name",
+			identity:   &session,
+			request:    CreateTokenRequest{Scopes: []string{tokens.ScopeRead}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown scope",
+			identity:   &session,
+			request:    CreateTokenRequest{Name: "CI", Scopes: []string{"root"}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "expiry in the past",
+			identity:   &session,
+			request:    CreateTokenRequest{Name: "CI", Scopes: []string{tokens.ScopeRead}, ExpiresAt: &past},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "restricted identity cannot grant scope it lacks",
+			identity:   &middleware.Identity{UserID: "testuser", Method: middleware.MethodToken, Scopes: []string{tokens.ScopeRead}},
+			request:    CreateTokenRequest{Name: "CI", Scopes: []string{tokens.ScopeWrite}},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "restricted identity inherits its path",
+			identity:   &restricted,
+			request:    CreateTokenRequest{Name: "CI", Scopes: []string{tokens.ScopeRead}},
+			wantStatus: http.StatusCreated,
+			wantPath:   "/builds",
+		},
+		{
+			name:       "restricted identity cannot widen path",
+			identity:   &restricted,
+			request:    CreateTokenRequest{Name: "CI", Scopes: []string{tokens.ScopeRead}, Path: "/"},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "restricted identity cannot climb out of its path",
+			identity:   &restricted,
+			request:    CreateTokenRequest{Name: "CI", Scopes: []string{tokens.ScopeRead}, Path: "/builds/../secrets"},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "restricted identity can narrow its path",
+			identity:   &restricted,
+			request:    CreateTokenRequest{Name: "CI", Scopes: []string{tokens.ScopeRead}, Path: "/builds/42/../43/"},
+			wantStatus: http.StatusCreated,
+			wantPath:   "/builds/43",
+		},
+		{
+			name:       "relative path",
+			identity:   &session,
+			request:    CreateTokenRequest{Name: "CI", Scopes: []string{tokens.ScopeRead}, Path: "builds"},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := tokens.New()
+			handler := NewCreateTokenHandler(service)
+
+			body, _ := json.Marshal(tt.request)
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/tokens", bytes.NewBuffer(body))
+			if tt.identity != nil {
+				req = req.WithContext(middleware.WithIdentity(req.Context(), *tt.identity))
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("want status %d, got %d", tt.wantStatus, rec.Code)
+			}
+
+			if tt.wantStatus == http.StatusCreated {
+				var response CreateTokenResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+					t.Fatalf("Failed to unmarshal response: %v", err)
+				}
+
+				token, err := service.Validate(response.Secret)
+				if err != nil {
+					t.Fatalf("returned token is not valid: %v", err)
+				}
+				if token.Path != tt.wantPath {
+					t.Errorf("want path %q, got %q", tt.wantPath, token.Path)
+				}
+			}
+		})
+	}
+}
+
+func TestListAndRevokeTokenHandlers(t *testing.T) {
+	service := tokens.New()
+	token, _, _ := service.Create("testuser", "CI", []string{tokens.ScopeRead}, "", nil)
+	service.Create("otheruser", "other", []string{tokens.ScopeRead}, "", nil)
+
+	ctx := middleware.WithIdentity(context.Background(), middleware.Identity{UserID: "testuser", Method: middleware.MethodSession})
+
+	// list only returns the user's own tokens
+	req := httptest.NewRequestWithContext(ctx, http.MethodGet, "/api/v1/tokens", nil)
+	rec := httptest.NewRecorder()
+	NewListTokensHandler(service).ServeHTTP(rec, req)
+
+	var list []tokens.Token
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(list) != 1 || list[0].ID != token.ID {
+		t.Fatalf("expected only the user's token, got %+v", list)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("DELETE /api/v1/tokens/{id}", NewRevokeTokenHandler(service))
+
+	tests := []struct {
+		name       string
+		id         string
+		wantStatus int
+	}{
+		{name: "revoke token", id: token.ID, wantStatus: http.StatusOK},
+		{name: "already revoked", id: token.ID, wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequestWithContext(ctx, http.MethodDelete, "/api/v1/tokens/"+tt.id, nil)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("want status %d, got %d", tt.wantStatus, rec.Code)
+			}
+		})
+	}
+}
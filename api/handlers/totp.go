@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/josepheid/file-explorer/api/internal/metrics"
+	"github.com/josepheid/file-explorer/api/internal/middleware"
+	"github.com/josepheid/file-explorer/api/internal/respond"
+	"github.com/josepheid/file-explorer/api/internal/sessions"
+	"github.com/josepheid/file-explorer/api/internal/totp"
+)
+
+// TOTPCodeRequest represents the request body for confirming or disabling two-factor authentication
+type TOTPCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// TOTPLoginRequest represents the request body for the second login step
+type TOTPLoginRequest struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
+// TOTPLoginHandler completes a login for a user with two-factor authentication enabled
+type TOTPLoginHandler struct {
+	totp     *totp.Service
+	sessions *sessions.Service
+}
+
+// NewTOTPLoginHandler creates a new TOTPLoginHandler, it takes a TOTP service and a sessions service as parameters
+func NewTOTPLoginHandler(totp *totp.Service, sessions *sessions.Service) *TOTPLoginHandler {
+	return &TOTPLoginHandler{
+		totp:     totp,
+		sessions: sessions,
+	}
+}
+
+// ServeHTTP handles the second login step, exchanging a challenge and a code for a session
+func (h *TOTPLoginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respond.WithError(w, r, respond.CodeMethodNotAllowed, "Method not allowed, method: "+r.Method)
+		return
+	}
+
+	var req TOTPLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respond.WithError(w, r, respond.CodeInvalidBody, "Invalid request body, error: "+err.Error())
+		return
+	}
+
+	if req.Challenge == "" || req.Code == "" {
+		respond.WithError(w, r, respond.CodeInvalidBody, "Challenge and code are required")
+		return
+	}
+
+	challenge, err := h.totp.CompleteChallenge(req.Challenge, req.Code)
+	if err != nil {
+		metrics.FromContext(r.Context()).LoginFailed(metrics.LoginTOTP)
+		respondError(w, r, err, "failed to complete login challenge")
+		return
+	}
+	middleware.SetUser(r.Context(), challenge.UserID)
+
+	session, err := h.sessions.CreateWithClaims(challenge.UserID, challenge.Email, challenge.Groups)
+	if err != nil {
+		middleware.LoggerFromContext(r.Context()).Error("failed to create session", slog.Any("error", err))
+		respond.WithError(w, r, respond.CodeInternal, "Failed to create session")
+		return
+	}
+
+	setSessionCookie(w, session)
+
+	respond.WithJSON(w, nil, http.StatusOK)
+}
+
+// TOTPEnrollHandler starts two-factor authentication enrolment for the logged-in user
+type TOTPEnrollHandler struct {
+	totp *totp.Service
+}
+
+// NewTOTPEnrollHandler creates a new TOTPEnrollHandler, it takes a TOTP service as a parameter
+func NewTOTPEnrollHandler(totp *totp.Service) *TOTPEnrollHandler {
+	return &TOTPEnrollHandler{totp: totp}
+}
+
+// ServeHTTP returns a new secret, otpauth URI and recovery codes. They are only shown once.
+func (h *TOTPEnrollHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		respond.WithError(w, r, respond.CodeMethodNotAllowed, "Method not allowed, method: "+r.Method)
+		return
+	}
+
+	identity, ok := middleware.IdentityFromContext(r.Context())
+	if !ok {
+		respond.WithError(w, r, respond.CodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	enrollment, err := h.totp.Enroll(identity.UserID)
+	if err != nil {
+		respondError(w, r, err, "failed to enroll in two-factor authentication")
+		return
+	}
+
+	respond.WithJSON(w, enrollment, http.StatusOK)
+}
+
+// TOTPConfirmHandler enables two-factor authentication once the user proves their authenticator works
+type TOTPConfirmHandler struct {
+	totp *totp.Service
+}
+
+// NewTOTPConfirmHandler creates a new TOTPConfirmHandler, it takes a TOTP service as a parameter
+func NewTOTPConfirmHandler(totp *totp.Service) *TOTPConfirmHandler {
+	return &TOTPConfirmHandler{totp: totp}
+}
+
+// ServeHTTP handles the confirm request
+func (h *TOTPConfirmHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handleTOTPCode(w, r, h.totp.Confirm)
+}
+
+// TOTPDisableHandler turns two-factor authentication off for the logged-in user
+type TOTPDisableHandler struct {
+	totp *totp.Service
+}
+
+// NewTOTPDisableHandler creates a new TOTPDisableHandler, it takes a TOTP service as a parameter
+func NewTOTPDisableHandler(totp *totp.Service) *TOTPDisableHandler {
+	return &TOTPDisableHandler{totp: totp}
+}
+
+// ServeHTTP handles the disable request, it requires a current code or a recovery code
+func (h *TOTPDisableHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handleTOTPCode(w, r, h.totp.Disable)
+}
+
+// handleTOTPCode decodes a TOTPCodeRequest and applies fn to the logged-in user and the code
+func handleTOTPCode(w http.ResponseWriter, r *http.Request, fn func(userID, code string) error) {
+	if r.Method != http.MethodPost {
+		respond.WithError(w, r, respond.CodeMethodNotAllowed, "Method not allowed, method: "+r.Method)
+		return
+	}
+
+	identity, ok := middleware.IdentityFromContext(r.Context())
+	if !ok {
+		respond.WithError(w, r, respond.CodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	var req TOTPCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respond.WithError(w, r, respond.CodeInvalidBody, "Invalid request body, error: "+err.Error())
+		return
+	}
+
+	if req.Code == "" {
+		respondInvalidField(w, r, "code", "Code is required")
+		return
+	}
+
+	if err := fn(identity.UserID, req.Code); err != nil {
+		respondError(w, r, err, "failed to check two-factor authentication code")
+		return
+	}
+
+	respond.WithJSON(w, nil, http.StatusOK)
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/josepheid/file-explorer/api/internal/auth"
+	"github.com/josepheid/file-explorer/api/internal/middleware"
+	"github.com/josepheid/file-explorer/api/internal/sessions"
+	"github.com/josepheid/file-explorer/api/internal/totp"
+)
+
+func TestTOTPLoginFlow(t *testing.T) {
+	totpService := totp.New("test")
+	sessionService := sessions.New()
+	identity := middleware.Identity{UserID: "testuser", Method: middleware.MethodSession}
+
+	post := func(handler http.Handler, body any, withIdentity bool) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBuffer(b))
+		if withIdentity {
+			req = req.WithContext(middleware.WithIdentity(req.Context(), identity))
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// enrol and confirm
+	rec := post(NewTOTPEnrollHandler(totpService), nil, true)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("enroll: want status %d, got %d", http.StatusOK, rec.Code)
+	}
+	var enrollment totp.Enrollment
+	if err := json.Unmarshal(rec.Body.Bytes(), &enrollment); err != nil {
+		t.Fatalf("Failed to unmarshal enrollment: %v", err)
+	}
+
+	if rec := post(NewTOTPConfirmHandler(totpService), TOTPCodeRequest{Code: "000000"}, true); rec.Code != http.StatusUnauthorized {
+		t.Errorf("confirm with wrong code: want status %d, got %d", http.StatusUnauthorized, rec.Code)
+	}
+	code, _ := totp.Code(enrollment.Secret, time.Now())
+	if rec := post(NewTOTPConfirmHandler(totpService), TOTPCodeRequest{Code: code}, true); rec.Code != http.StatusOK {
+		t.Fatalf("confirm: want status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	// the password alone no longer issues a session
+	login := NewLoginHandler(auth.New(), sessionService, totpService)
+	rec = post(login, LoginRequest{Username: "testuser", Password: "password123"}, false)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("login: want status %d, got %d", http.StatusAccepted, rec.Code)
+	}
+	if len(rec.Result().Cookies()) != 0 {
+		t.Fatal("login: want no session cookie before the code is verified")
+	}
+	var required TOTPRequiredResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &required); err != nil || !required.TOTPRequired || required.Challenge == "" {
+		t.Fatalf("login: want a TOTP challenge, got %s", rec.Body.String())
+	}
+
+	tests := []struct {
+		name       string
+		request    TOTPLoginRequest
+		wantStatus int
+		wantCookie bool
+	}{
+		{
+			name:       "missing code",
+			request:    TOTPLoginRequest{Challenge: required.Challenge},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "wrong code",
+			request:    TOTPLoginRequest{Challenge: required.Challenge, Code: "000000"},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "replayed code",
+			request:    TOTPLoginRequest{Challenge: required.Challenge, Code: code},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "recovery code",
+			request:    TOTPLoginRequest{Challenge: required.Challenge, Code: enrollment.RecoveryCodes[0]},
+			wantStatus: http.StatusOK,
+			wantCookie: true,
+		},
+		{
+			name:       "challenge is single use",
+			request:    TOTPLoginRequest{Challenge: required.Challenge, Code: enrollment.RecoveryCodes[1]},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := post(NewTOTPLoginHandler(totpService, sessionService), tt.request, false)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("want status %d, got %d", tt.wantStatus, rec.Code)
+			}
+
+			cookies := rec.Result().Cookies()
+			if hasCookie := len(cookies) > 0; hasCookie != tt.wantCookie {
+				t.Fatalf("want cookie: %v, got cookie: %v", tt.wantCookie, hasCookie)
+			}
+			if tt.wantCookie && sessionService.Get(cookies[0].Value).UserID != "testuser" {
+				t.Error("cookie does not identify a session for testuser")
+			}
+		})
+	}
+
+	// disabling requires a valid code
+	if rec := post(NewTOTPDisableHandler(totpService), TOTPCodeRequest{Code: enrollment.RecoveryCodes[2]}, true); rec.Code != http.StatusOK {
+		t.Fatalf("disable: want status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if rec := post(login, LoginRequest{Username: "testuser", Password: "password123"}, false); rec.Code != http.StatusOK {
+		t.Errorf("login after disable: want status %d, got %d", http.StatusOK, rec.Code)
+	}
+}
+
+func TestTOTPLoginLockout(t *testing.T) {
+	totpService := totp.New("test")
+	enrollment, _ := totpService.Enroll("testuser")
+	code, _ := totp.Code(enrollment.Secret, time.Now())
+	if err := totpService.Confirm("testuser", code); err != nil {
+		t.Fatalf("Confirm() error = %v", err)
+	}
+	handler := NewTOTPLoginHandler(totpService, sessions.New())
+
+	// wrong codes spread over fresh challenges, as a client knowing the password could start, lock the user out
+	var rec *httptest.ResponseRecorder
+	for range 2 {
+		challenge, _ := totpService.NewChallenge("testuser", "", nil)
+		for range 5 {
+			b, _ := json.Marshal(TOTPLoginRequest{Challenge: challenge, Code: "000000"})
+			rec = httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewBuffer(b)))
+		}
+	}
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("want status %d after repeated wrong codes, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+
+	// the lockout also covers disabling, which must not fall back to an invalid code
+	b, _ := json.Marshal(TOTPCodeRequest{Code: enrollment.RecoveryCodes[0]})
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBuffer(b))
+	req = req.WithContext(middleware.WithIdentity(req.Context(), middleware.Identity{UserID: "testuser", Method: middleware.MethodSession}))
+	rec = httptest.NewRecorder()
+	NewTOTPDisableHandler(totpService).ServeHTTP(rec, req)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("disable while locked out: want status %d, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/josepheid/file-explorer/api/internal/middleware"
+	"github.com/josepheid/file-explorer/api/internal/respond"
+	"github.com/josepheid/file-explorer/api/internal/usage"
+)
+
+// UsageHandler analyses what takes up space below a directory
+type UsageHandler struct {
+	rootDir string
+	usage   *usage.Manager
+}
+
+// NewUsageHandler creates a new UsageHandler, it takes the root directory and a usage manager as parameters
+func NewUsageHandler(rootDir string, usage *usage.Manager) *UsageHandler {
+	return &UsageHandler{rootDir: rootDir, usage: usage}
+}
+
+// ServeHTTP handles usage requests. GET starts an analysis of path, or reports on the one already started with the
+// same depth and top query parameters: 202 with its progress while it runs, then 200 with the report.
+// refresh=true discards a finished analysis and starts over. DELETE cancels the user's analyses of path.
+func (h *UsageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		respond.WithError(w, r, respond.CodeMethodNotAllowed, "Method not allowed, method: "+r.Method)
+		return
+	}
+
+	identity, ok := middleware.IdentityFromContext(r.Context())
+	if !ok {
+		respond.WithError(w, r, respond.CodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	query := r.URL.Query()
+	depth, ok := intParam(query.Get("depth"), usage.DefaultDepth, 0, usage.MaxDepth)
+	if !ok {
+		respondInvalidParameter(w, r, "depth", "Invalid depth, expected 0 to "+strconv.Itoa(usage.MaxDepth))
+		return
+	}
+	top, ok := intParam(query.Get("top"), usage.DefaultTop, 0, usage.MaxTop)
+	if !ok {
+		respondInvalidParameter(w, r, "top", "Invalid top, expected 0 to "+strconv.Itoa(usage.MaxTop))
+		return
+	}
+
+	cleanPath, absPath, err := resolvePath(r, h.rootDir, query.Get("path"))
+	if err != nil {
+		respondPathError(w, r, err)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		if !h.usage.Cancel(identity.UserID, cleanPath) {
+			respond.WithError(w, r, respond.CodeJobNotFound, "No analysis running")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	info, err := os.Stat(absPath)
+	if err != nil {
+		respondStatError(w, r, cleanPath, err)
+		return
+	}
+	if !info.IsDir() {
+		respond.WithError(w, r, respond.CodeNotADirectory, "Path is not a directory")
+		return
+	}
+
+	opts := usage.Options{Path: cleanPath, AbsPath: absPath, Depth: depth, Top: top}
+	job, err := h.usage.Run(identity.UserID, opts, query.Get("refresh") == "true")
+	if err != nil {
+		respondError(w, r, err, "failed to start usage analysis", slog.String("path", cleanPath))
+		return
+	}
+
+	status := http.StatusOK
+	if job.Status == usage.StatusRunning {
+		status = http.StatusAccepted
+	}
+	respond.WithJSON(w, job, status)
+}
+
+// intParam parses an optional integer query parameter within [lo, hi], def is used if it is empty
+func intParam(value string, def, lo, hi int) (int, bool) {
+	if value == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < lo || n > hi {
+		return 0, false
+	}
+	return n, true
+}
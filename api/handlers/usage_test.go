@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/josepheid/file-explorer/api/internal/middleware"
+	"github.com/josepheid/file-explorer/api/internal/usage"
+)
+
+func TestUsageHandler(t *testing.T) {
+	rootDir, cleanup := setupTestDirectory(t)
+	defer cleanup()
+
+	manager := usage.New()
+	defer manager.Close()
+	handler := NewUsageHandler(rootDir, manager)
+	identity := middleware.Identity{UserID: "testuser", Method: middleware.MethodSession}
+
+	serve := func(method, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/v1/usage"+query, nil)
+		req = req.WithContext(middleware.WithIdentity(req.Context(), identity))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// poll until the analysis is done
+	var job usage.Job
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rr := serve(http.MethodGet, "?path=/dir1&depth=1&top=2")
+		if rr.Code != http.StatusOK && rr.Code != http.StatusAccepted {
+			t.Fatalf("unexpected status %d: %s", rr.Code, rr.Body.String())
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&job); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if rr.Code == http.StatusOK {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("analysis did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if job.Status != usage.StatusDone || job.Report == nil {
+		t.Fatalf("unexpected job %+v", job)
+	}
+	if job.Report.Tree.Path != "/dir1" || job.Report.Tree.Size != 600 || len(job.Report.Tree.Children) != 1 {
+		t.Errorf("unexpected tree %+v", job.Report.Tree)
+	}
+	if len(job.Report.Largest) != 2 || job.Report.Largest[0].Path != "/dir1/subdir/file3.txt" {
+		t.Errorf("unexpected largest files %+v", job.Report.Largest)
+	}
+
+	// nothing is left to cancel
+	if rr := serve(http.MethodDelete, "?path=/dir1"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d cancelling a finished analysis, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestUsageHandlerValidation(t *testing.T) {
+	rootDir, cleanup := setupTestDirectory(t)
+	defer cleanup()
+
+	manager := usage.New()
+	defer manager.Close()
+	handler := NewUsageHandler(rootDir, manager)
+
+	session := middleware.Identity{UserID: "testuser", Method: middleware.MethodSession}
+	restricted := middleware.Identity{UserID: "testuser", Method: middleware.MethodToken, Path: "/empty"}
+
+	tests := []struct {
+		name       string
+		method     string
+		query      string
+		identity   *middleware.Identity
+		wantStatus int
+	}{
+		{name: "wrong method", method: http.MethodPost, identity: &session, wantStatus: http.StatusMethodNotAllowed},
+		{name: "not logged in", method: http.MethodGet, wantStatus: http.StatusUnauthorized},
+		{name: "depth too deep", method: http.MethodGet, query: "?depth=100", identity: &session, wantStatus: http.StatusBadRequest},
+		{name: "top not a number", method: http.MethodGet, query: "?top=many", identity: &session, wantStatus: http.StatusBadRequest},
+		{name: "path traversal", method: http.MethodGet, query: "?path=../etc", identity: &session, wantStatus: http.StatusBadRequest},
+		{name: "not found", method: http.MethodGet, query: "?path=/missing", identity: &session, wantStatus: http.StatusNotFound},
+		{name: "not a directory", method: http.MethodGet, query: "?path=/dir1/file1.txt", identity: &session, wantStatus: http.StatusBadRequest},
+		{name: "outside restricted path", method: http.MethodGet, query: "?path=/dir1", identity: &restricted, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/v1/usage"+tt.query, nil)
+			if tt.identity != nil {
+				req = req.WithContext(middleware.WithIdentity(req.Context(), *tt.identity))
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rr.Code)
+			}
+		})
+	}
+}
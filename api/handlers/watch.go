@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/josepheid/file-explorer/api/internal/middleware"
+	"github.com/josepheid/file-explorer/api/internal/respond"
+	"github.com/josepheid/file-explorer/api/internal/watch"
+)
+
+const (
+	// maxWatchPaths limits the directories a single stream can watch
+	maxWatchPaths = 16
+	// maxWatchStreams limits the concurrent streams per user
+	maxWatchStreams = 8
+	// watchHeartbeat is how often a comment is sent on idle streams, so proxies keep them open
+	// and disconnected clients are noticed, and how often the caller's credentials are checked again
+	watchHeartbeat = 30 * time.Second
+	// watchWriteTimeout bounds each write to a stream, the server's write timeout does not apply to streams
+	watchWriteTimeout = 10 * time.Second
+)
+
+// WatchHandler streams changes to directories as Server-Sent Events
+type WatchHandler struct {
+	rootDir   string
+	watch     *watch.Service
+	heartbeat time.Duration
+
+	mu      sync.Mutex
+	streams map[string]int
+}
+
+// NewWatchHandler creates a new WatchHandler, it takes the root directory and a watch service as parameters
+func NewWatchHandler(rootDir string, watch *watch.Service) *WatchHandler {
+	return &WatchHandler{
+		rootDir:   rootDir,
+		watch:     watch,
+		heartbeat: watchHeartbeat,
+		streams:   make(map[string]int),
+	}
+}
+
+// ServeHTTP handles the watch request. The directories to watch are given as one or more path query parameters,
+// defaulting to the root. Each change is sent as an event named after its op (create, remove, rename, modify
+// or overflow) with a watch.Event as JSON data. The stream ends when the client disconnects, the server shuts down,
+// or the session or token it was opened with ends, e.g. on logout or revocation.
+func (h *WatchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		respond.WithError(w, r, respond.CodeMethodNotAllowed, "Method not allowed, method: "+r.Method)
+		return
+	}
+
+	identity, ok := middleware.IdentityFromContext(r.Context())
+	if !ok {
+		respond.WithError(w, r, respond.CodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	paths := r.URL.Query()["path"]
+	if len(paths) == 0 {
+		paths = []string{"/"}
+	}
+	if len(paths) > maxWatchPaths {
+		respondInvalidParameter(w, r, "path", fmt.Sprintf("At most %d paths can be watched per stream", maxWatchPaths))
+		return
+	}
+
+	dirs := make([]watch.Dir, 0, len(paths))
+	for _, requestPath := range paths {
+		cleanPath, absPath, err := resolvePath(r, h.rootDir, requestPath)
+		if err != nil {
+			respondPathError(w, r, err)
+			return
+		}
+
+		info, err := os.Stat(absPath)
+		if err != nil {
+			respondStatError(w, r, cleanPath, err)
+			return
+		}
+		if !info.IsDir() {
+			respond.WithError(w, r, respond.CodeNotADirectory, "Path is not a directory")
+			return
+		}
+
+		dirs = append(dirs, watch.Dir{Path: cleanPath, AbsPath: absPath})
+	}
+
+	if !h.acquire(identity.UserID) {
+		respond.WithError(w, r, respond.CodeTooManyRequests, "Too many watch streams")
+		return
+	}
+	defer h.release(identity.UserID)
+
+	sub, err := h.watch.Subscribe(dirs...)
+	if err != nil {
+		middleware.LoggerFromContext(r.Context()).Error("failed to watch directories", slog.Any("error", err))
+		respond.WithError(w, r, respond.CodeUnavailable, "Failed to watch directory")
+		return
+	}
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// stop nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	send := func(msg []byte) error {
+		if err := rc.SetWriteDeadline(time.Now().Add(watchWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		if _, err := w.Write(msg); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	// tell the client how long to wait before reconnecting
+	if err := send([]byte("retry: 5000\n\n")); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if !middleware.StillAuthenticated(r.Context()) {
+				return
+			}
+			if err := send([]byte(": heartbeat\n\n")); err != nil {
+				return
+			}
+		case batch, ok := <-sub.Events():
+			if !ok {
+				// the server is shutting down
+				return
+			}
+			for _, event := range batch {
+				data, err := json.Marshal(event)
+				if err != nil {
+					return
+				}
+				if err := send(fmt.Appendf(nil, "event: %s\ndata: %s\n\n", event.Op, data)); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// acquire reserves one of the user's streams, reporting false if they already have the maximum
+func (h *WatchHandler) acquire(userID string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.streams[userID] >= maxWatchStreams {
+		return false
+	}
+	h.streams[userID]++
+	return true
+}
+
+func (h *WatchHandler) release(userID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.streams[userID]--
+	if h.streams[userID] <= 0 {
+		delete(h.streams, userID)
+	}
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josepheid/file-explorer/api/internal/middleware"
+	"github.com/josepheid/file-explorer/api/internal/sessions"
+	"github.com/josepheid/file-explorer/api/internal/tokens"
+	"github.com/josepheid/file-explorer/api/internal/watch"
+)
+
+func newTestWatchHandler(t *testing.T, rootDir string) *WatchHandler {
+	t.Helper()
+
+	service, err := watch.New(20*time.Millisecond, slog.Default())
+	if err != nil {
+		t.Fatalf("watch.New() error = %v", err)
+	}
+	t.Cleanup(func() { service.Close() })
+
+	return NewWatchHandler(rootDir, service)
+}
+
+func TestWatchHandlerValidation(t *testing.T) {
+	rootDir, cleanup := setupTestDirectory(t)
+	defer cleanup()
+
+	session := middleware.Identity{UserID: "testuser", Method: middleware.MethodSession}
+	restricted := middleware.Identity{UserID: "testuser", Method: middleware.MethodToken, Path: "/dir1"}
+
+	tests := []struct {
+		name       string
+		method     string
+		query      string
+		identity   *middleware.Identity
+		wantStatus int
+	}{
+		{name: "wrong method", method: http.MethodPost, identity: &session, wantStatus: http.StatusMethodNotAllowed},
+		{name: "not logged in", method: http.MethodGet, wantStatus: http.StatusUnauthorized},
+		{name: "path traversal", method: http.MethodGet, query: "?path=../etc", identity: &session, wantStatus: http.StatusBadRequest},
+		{name: "not found", method: http.MethodGet, query: "?path=/missing", identity: &session, wantStatus: http.StatusNotFound},
+		{name: "not a directory", method: http.MethodGet, query: "?path=/dir1/file1.txt", identity: &session, wantStatus: http.StatusBadRequest},
+		{name: "outside restricted path", method: http.MethodGet, query: "?path=/dir1&path=/empty", identity: &restricted, wantStatus: http.StatusForbidden},
+		{name: "too many paths", method: http.MethodGet, query: "?" + strings.Repeat("path=/&", maxWatchPaths+1), identity: &session, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/v1/watch"+tt.query, nil)
+			if tt.identity != nil {
+				req = req.WithContext(middleware.WithIdentity(req.Context(), *tt.identity))
+			}
+			rr := httptest.NewRecorder()
+			newTestWatchHandler(t, rootDir).ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestWatchHandlerStream(t *testing.T) {
+	rootDir, cleanup := setupTestDirectory(t)
+	defer cleanup()
+
+	handler := newTestWatchHandler(t, rootDir)
+	identity := middleware.Identity{UserID: "testuser", Method: middleware.MethodSession}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r.WithContext(middleware.WithIdentity(r.Context(), identity)))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/v1/watch?path=/dir1", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected event stream, got %q", ct)
+	}
+
+	// the stream is open once the retry hint arrives, so the watch is in place
+	lines := bufio.NewScanner(resp.Body)
+	if !lines.Scan() || lines.Text() != "retry: 5000" {
+		t.Fatalf("unexpected first line %q", lines.Text())
+	}
+
+	// the per-user stream limit counts this stream
+	handler.mu.Lock()
+	streams := handler.streams["testuser"]
+	handler.mu.Unlock()
+	if streams != 1 {
+		t.Errorf("expected 1 stream for user, got %d", streams)
+	}
+
+	if err := os.WriteFile(filepath.Join(rootDir, "dir1", "new.txt"), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var eventName string
+	var event watch.Event
+	for lines.Scan() {
+		line := lines.Text()
+		if name, ok := strings.CutPrefix(line, "event: "); ok {
+			eventName = name
+		}
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				t.Fatalf("invalid event data: %v", err)
+			}
+			break
+		}
+	}
+
+	if eventName != watch.OpCreate {
+		t.Errorf("expected create event, got %q", eventName)
+	}
+	if event != (watch.Event{Op: watch.OpCreate, Path: "/dir1", Name: "new.txt"}) {
+		t.Errorf("unexpected event %+v", event)
+	}
+}
+
+func TestWatchHandlerRevokedToken(t *testing.T) {
+	rootDir, cleanup := setupTestDirectory(t)
+	defer cleanup()
+
+	tokenService := tokens.New()
+	token, secret, err := tokenService.Create("testuser", "watch", []string{tokens.ScopeRead}, "", nil)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	handler := newTestWatchHandler(t, rootDir)
+	handler.heartbeat = 20 * time.Millisecond
+	srv := httptest.NewServer(middleware.RequireAuth(sessions.New(), middleware.WithTokens(tokenService))(handler))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/v1/watch?path=/dir1", nil)
+	req.Header.Set("Authorization", "Bearer "+secret)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	lines := bufio.NewScanner(resp.Body)
+	if !lines.Scan() || lines.Text() != "retry: 5000" {
+		t.Fatalf("unexpected first line %q", lines.Text())
+	}
+	if err := tokenService.Revoke("testuser", token.ID); err != nil {
+		t.Fatalf("Revoke() error = %v", err)
+	}
+
+	// the stream ends at the next heartbeat rather than running until the client goes away
+	for lines.Scan() {
+	}
+	if err := lines.Err(); err != nil {
+		t.Errorf("expected the stream to end after the token was revoked, got %v", err)
+	}
+}
+
+func TestWatchHandlerStreamLimit(t *testing.T) {
+	rootDir, cleanup := setupTestDirectory(t)
+	defer cleanup()
+
+	handler := newTestWatchHandler(t, rootDir)
+	handler.streams["testuser"] = maxWatchStreams
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/watch", nil)
+	req = req.WithContext(middleware.WithIdentity(req.Context(), middleware.Identity{UserID: "testuser", Method: middleware.MethodSession}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d, got %d", http.StatusTooManyRequests, rr.Code)
+	}
+}
@@ -0,0 +1,234 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Outcomes recorded on an Event
+const (
+	OutcomeSuccess = "success"
+	OutcomeDenied  = "denied"
+	OutcomeFailure = "failure"
+)
+
+// Event is a single audited action, written as one JSON line. Destination is set for actions that copy or move a
+// file to another path.
+type Event struct {
+	Time        time.Time `json:"time"`
+	Action      string    `json:"action"`
+	UserID      string    `json:"user,omitempty"`
+	ClientIP    string    `json:"clientIp"`
+	Method      string    `json:"method"`
+	Path        string    `json:"path,omitempty"`
+	Destination string    `json:"destination,omitempty"`
+	Outcome     string    `json:"outcome"`
+	Status      int       `json:"status"`
+	LatencyMS   float64   `json:"latencyMs"`
+}
+
+// Filter selects events when querying the log, zero fields match everything
+type Filter struct {
+	// UserID matches events for exactly this user
+	UserID string
+	// PathPrefix matches events for this path and anything below it, as the path or the destination
+	PathPrefix string
+	// From and To bound the event time, inclusive
+	From time.Time
+	To   time.Time
+	// Limit caps the number of events returned, keeping the most recent
+	Limit int
+}
+
+// Log appends events to a JSON lines file, rotating it once it reaches a maximum size.
+// Rotated files are named file.1 (most recent) to file.N.
+type Log struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	file *os.File
+	size int64
+	mu   sync.Mutex
+}
+
+// New opens or creates the audit log at path. Files are rotated when they would exceed maxSize bytes
+// and at most maxBackups rotated files are kept.
+func New(path string, maxSize int64, maxBackups int) (*Log, error) {
+	if maxSize <= 0 {
+		return nil, errors.New("audit: max size must be positive")
+	}
+
+	l := &Log{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Record appends an event to the log
+func (l *Log) Record(e Event) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return errors.New("audit: log is closed")
+	}
+
+	if l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	return err
+}
+
+// Query returns the events matching filter in chronological order, reading rotated files as well
+func (l *Log) Query(filter Filter) ([]Event, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// oldest file first
+	files := []string{}
+	for i := l.maxBackups; i >= 1; i-- {
+		files = append(files, fmt.Sprintf("%s.%d", l.path, i))
+	}
+	files = append(files, l.path)
+
+	events := []Event{}
+	for _, name := range files {
+		matched, err := readEvents(name, filter)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		events = append(events, matched...)
+	}
+
+	if filter.Limit > 0 && len(events) > filter.Limit {
+		events = slices.Clone(events[len(events)-filter.Limit:])
+	}
+
+	return events, nil
+}
+
+// Close flushes and closes the log file
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := errors.Join(l.file.Sync(), l.file.Close())
+	l.file = nil
+	return err
+}
+
+func (l *Log) open() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("audit: failed to open log: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("audit: failed to stat log: %w", err)
+	}
+
+	l.file = file
+	l.size = info.Size()
+	return nil
+}
+
+// rotate shifts file.N-1 to file.N down to file to file.1 and starts a new file, the caller must hold l.mu
+func (l *Log) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("audit: failed to close log for rotation: %w", err)
+	}
+	l.file = nil
+
+	if l.maxBackups > 0 {
+		for i := l.maxBackups - 1; i >= 1; i-- {
+			err := os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("audit: failed to rotate log: %w", err)
+			}
+		}
+		if err := os.Rename(l.path, l.path+".1"); err != nil {
+			return fmt.Errorf("audit: failed to rotate log: %w", err)
+		}
+	} else if err := os.Remove(l.path); err != nil {
+		return fmt.Errorf("audit: failed to rotate log: %w", err)
+	}
+
+	return l.open()
+}
+
+func readEvents(name string, filter Filter) ([]Event, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue // skip a partially written line
+		}
+		if filter.matches(e) {
+			events = append(events, e)
+		}
+	}
+
+	return events, scanner.Err()
+}
+
+func (f Filter) matches(e Event) bool {
+	if f.UserID != "" && e.UserID != f.UserID {
+		return false
+	}
+	if f.PathPrefix != "" && f.PathPrefix != "/" {
+		prefix := path.Clean(f.PathPrefix)
+		if !below(e.Path, prefix) && !below(e.Destination, prefix) {
+			return false
+		}
+	}
+	if !f.From.IsZero() && e.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && e.Time.After(f.To) {
+		return false
+	}
+	return true
+}
+
+// below reports whether p is prefix or anything below it
+func below(p, prefix string) bool {
+	return p == prefix || strings.HasPrefix(p, prefix+"/")
+}
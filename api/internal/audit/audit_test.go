@@ -0,0 +1,103 @@
+package audit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLogQuery(t *testing.T) {
+	l, err := New(filepath.Join(t.TempDir(), "audit.log"), 1<<20, 2)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer l.Close()
+
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	events := []Event{
+		{Time: base, Action: "login", UserID: "alice", Outcome: OutcomeSuccess, Status: 200},
+		{Time: base.Add(time.Minute), Action: "browse", UserID: "alice", Path: "/builds", Outcome: OutcomeSuccess, Status: 200},
+		{Time: base.Add(2 * time.Minute), Action: "browse", UserID: "bob", Path: "/builds/42", Outcome: OutcomeSuccess, Status: 200},
+		{Time: base.Add(3 * time.Minute), Action: "dav", UserID: "bob", Path: "/tmp/43", Destination: "/builds/43", Outcome: OutcomeSuccess, Status: 201},
+		{Time: base.Add(4 * time.Minute), Action: "browse", UserID: "bob", Path: "/buildsx", Outcome: OutcomeDenied, Status: 403},
+	}
+	for _, e := range events {
+		if err := l.Record(e); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		filter  Filter
+		wantLen int
+	}{
+		{name: "everything", filter: Filter{}, wantLen: 5},
+		{name: "by user", filter: Filter{UserID: "bob"}, wantLen: 3},
+		{name: "by path prefix", filter: Filter{PathPrefix: "/builds"}, wantLen: 3},
+		{name: "by destination", filter: Filter{PathPrefix: "/builds/43"}, wantLen: 1},
+		{name: "root prefix", filter: Filter{PathPrefix: "/"}, wantLen: 5},
+		{name: "from", filter: Filter{From: base.Add(2 * time.Minute)}, wantLen: 3},
+		{name: "to", filter: Filter{To: base.Add(time.Minute)}, wantLen: 2},
+		{name: "limit keeps most recent", filter: Filter{Limit: 1}, wantLen: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := l.Query(tt.filter)
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			if len(got) != tt.wantLen {
+				t.Fatalf("Query() returned %d events, want %d", len(got), tt.wantLen)
+			}
+			if tt.filter.Limit == 1 && got[0].Path != "/buildsx" {
+				t.Errorf("Query() with limit returned %q, want most recent event", got[0].Path)
+			}
+		})
+	}
+}
+
+func TestLogRotation(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	l, err := New(logPath, 200, 2)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	for i := range 10 {
+		if err := l.Record(Event{Time: time.Now(), Action: "browse", UserID: fmt.Sprintf("user%d", i)}); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	for _, name := range []string{logPath, logPath + ".1", logPath + ".2"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatalf("expected %s to exist: %v", name, err)
+		}
+		if info.Size() > 200 {
+			t.Errorf("%s is %d bytes, want at most 200", name, info.Size())
+		}
+	}
+	if _, err := os.Stat(logPath + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected at most 2 backups, stat .3 error = %v", err)
+	}
+
+	got, err := l.Query(Filter{})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(got) == 0 || got[len(got)-1].UserID != "user9" {
+		t.Errorf("Query() should end with the most recent event, got %+v", got)
+	}
+
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := l.Record(Event{}); err == nil {
+		t.Error("Record() after Close() should fail")
+	}
+}
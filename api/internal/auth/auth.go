@@ -1,14 +1,24 @@
 package auth
 
 import (
+	"crypto/x509"
+	"errors"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
+// ErrUnknownCertificate is returned when a client certificate does not map to a known user
+var ErrUnknownCertificate = errors.New("auth: certificate does not map to a known user")
+
 // Service handles user authentication operations
 type Service struct {
 	// In a real app, this would be a database
 	// For this challenge, we'll use an in-memory map
 	users map[string]string // username -> hashed password
+	// certUsers maps certificate identities (subject common name or SAN) to usernames
+	certUsers map[string]string
+	// keys maps usernames to the SSH public keys they may log in with, in wire format
+	keys map[string]map[string]bool
 }
 
 // Authenticator defines the interface for authentication operations
@@ -22,7 +32,9 @@ var dummyHash, _ = bcrypt.GenerateFromPassword(make([]byte, 60), bcrypt.DefaultC
 
 func New() *Service {
 	s := &Service{
-		users: make(map[string]string),
+		users:     make(map[string]string),
+		certUsers: make(map[string]string),
+		keys:      make(map[string]map[string]bool),
 	}
 
 	// Add a test user (in production, this would be in a database)
@@ -45,3 +57,45 @@ func (s *Service) ValidateCredentials(username, password string) error {
 	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 	return err
 }
+
+// MapCertificate maps a certificate identity (subject common name, email, DNS or URI SAN) to a username.
+// Certificates whose common name already matches a username do not need an explicit mapping.
+func (s *Service) MapCertificate(identity, username string) {
+	s.certUsers[identity] = username
+}
+
+// UserForCertificate returns the user a verified client certificate belongs to.
+// Explicit mappings are checked first for every identity on the certificate, then the identities themselves are matched against known usernames.
+func (s *Service) UserForCertificate(cert *x509.Certificate) (string, error) {
+	identities := certificateIdentities(cert)
+
+	for _, identity := range identities {
+		if username, ok := s.certUsers[identity]; ok {
+			if _, exists := s.users[username]; exists {
+				return username, nil
+			}
+		}
+	}
+
+	for _, identity := range identities {
+		if _, exists := s.users[identity]; exists {
+			return identity, nil
+		}
+	}
+
+	return "", ErrUnknownCertificate
+}
+
+// certificateIdentities lists the subject common name followed by all SAN values of a certificate
+func certificateIdentities(cert *x509.Certificate) []string {
+	var identities []string
+	if cert.Subject.CommonName != "" {
+		identities = append(identities, cert.Subject.CommonName)
+	}
+	identities = append(identities, cert.EmailAddresses...)
+	identities = append(identities, cert.DNSNames...)
+	for _, uri := range cert.URIs {
+		identities = append(identities, uri.String())
+	}
+	return identities
+}
@@ -1,6 +1,8 @@
 package auth
 
 import (
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"errors"
 	"testing"
 )
@@ -47,3 +49,49 @@ func TestValidateCredentials(t *testing.T) {
 		})
 	}
 }
+
+func TestUserForCertificate(t *testing.T) {
+	service := New()
+	service.MapCertificate("ci.example.com", "testuser")
+	service.MapCertificate("ghost.example.com", "nobody")
+
+	tests := []struct {
+		name        string
+		cert        *x509.Certificate
+		expected    string
+		expectedErr error
+	}{
+		{
+			name:     "common name matches username",
+			cert:     &x509.Certificate{Subject: pkix.Name{CommonName: "testuser"}},
+			expected: "testuser",
+		},
+		{
+			name:     "mapped DNS SAN",
+			cert:     &x509.Certificate{Subject: pkix.Name{CommonName: "ci"}, DNSNames: []string{"ci.example.com"}},
+			expected: "testuser",
+		},
+		{
+			name:        "mapping to unknown user",
+			cert:        &x509.Certificate{DNSNames: []string{"ghost.example.com"}},
+			expectedErr: ErrUnknownCertificate,
+		},
+		{
+			name:        "unknown certificate",
+			cert:        &x509.Certificate{Subject: pkix.Name{CommonName: "stranger"}},
+			expectedErr: ErrUnknownCertificate,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := service.UserForCertificate(tt.cert)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("UserForCertificate() error = %v, want error %v", err, tt.expectedErr)
+			}
+			if user != tt.expected {
+				t.Errorf("UserForCertificate() = %q, want %q", user, tt.expected)
+			}
+		})
+	}
+}
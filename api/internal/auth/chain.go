@@ -0,0 +1,44 @@
+package auth
+
+// Profile holds directory information about an authenticated user
+type Profile struct {
+	Email  string
+	Groups []string
+}
+
+// ProfileAuthenticator is implemented by authenticators that look up information about the user
+// while validating their credentials, e.g. LDAP group membership
+type ProfileAuthenticator interface {
+	Authenticator
+	// Authenticate validates the credentials and returns the user's profile
+	Authenticate(username, password string) (Profile, error)
+}
+
+// Chain tries each authenticator in order and accepts the first that validates the credentials,
+// e.g. local users first, then LDAP
+type Chain []Authenticator
+
+func (c Chain) ValidateCredentials(username, password string) error {
+	_, err := c.Authenticate(username, password)
+	return err
+}
+
+// Authenticate returns the profile from the first authenticator that accepts the credentials.
+// If none do, the error from the last one is returned.
+func (c Chain) Authenticate(username, password string) (Profile, error) {
+	err := ErrInvalidCredentials
+	for _, a := range c {
+		if pa, ok := a.(ProfileAuthenticator); ok {
+			var profile Profile
+			if profile, err = pa.Authenticate(username, password); err == nil {
+				return profile, nil
+			}
+			continue
+		}
+
+		if err = a.ValidateCredentials(username, password); err == nil {
+			return Profile{}, nil
+		}
+	}
+	return Profile{}, err
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/josepheid/file-explorer/api/internal/auth/ldaptest"
+)
+
+func TestChain(t *testing.T) {
+	server := ldaptest.NewServer(t, ldaptest.Entry{
+		DN:         "uid=jane,ou=people,dc=example,dc=com",
+		Password:   "janepass",
+		Attributes: map[string][]string{"mail": {"jane@example.com"}},
+	})
+	directory, err := NewLDAP(LDAPConfig{URL: server.URL(), UserDNTemplate: "uid=%s,ou=people,dc=example,dc=com"})
+	if err != nil {
+		t.Fatalf("NewLDAP() error = %v", err)
+	}
+
+	chain := Chain{New(), directory}
+
+	tests := []struct {
+		name      string
+		username  string
+		password  string
+		wantEmail string
+		wantErr   error
+	}{
+		{
+			name:     "local user",
+			username: "testuser",
+			password: "password123",
+		},
+		{
+			name:      "falls through to LDAP",
+			username:  "jane",
+			password:  "janepass",
+			wantEmail: "jane@example.com",
+		},
+		{
+			name:     "rejected by all",
+			username: "jane",
+			password: "wrong",
+			wantErr:  ErrInvalidCredentials,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile, err := chain.Authenticate(tt.username, tt.password)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Authenticate() error = %v, want error %v", err, tt.wantErr)
+			}
+			if profile.Email != tt.wantEmail {
+				t.Errorf("Authenticate() email = %q, want %q", profile.Email, tt.wantEmail)
+			}
+		})
+	}
+
+	if err := (Chain{}).ValidateCredentials("testuser", "password123"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("empty chain should reject credentials, got %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// AuthorizeKey allows the SSH public key to be used to log in as username, e.g. to the SFTP server.
+// Unlike certificates, the user does not have to be a local user, so directory users can be given keys too.
+func (s *Service) AuthorizeKey(username string, key ssh.PublicKey) {
+	if s.keys[username] == nil {
+		s.keys[username] = make(map[string]bool)
+	}
+	s.keys[username][string(key.Marshal())] = true
+}
+
+// KeyAuthorized reports whether the SSH public key may be used to log in as username
+func (s *Service) KeyAuthorized(username string, key ssh.PublicKey) bool {
+	return s.keys[username][string(key.Marshal())]
+}
+
+// LoadAuthorizedKeys authorizes the keys in dir, which holds one file per user named after the username
+// in the OpenSSH authorized_keys format. Subdirectories and hidden files are skipped.
+func (s *Service) LoadAuthorizedKeys(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read authorized keys: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || entry.Name()[0] == '.' {
+			continue
+		}
+
+		b, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to read authorized keys: %w", err)
+		}
+		for i, line := range bytes.Split(b, []byte("\n")) {
+			line = bytes.TrimSpace(line)
+			if len(line) == 0 || line[0] == '#' {
+				continue
+			}
+			key, _, _, _, err := ssh.ParseAuthorizedKey(line)
+			if err != nil {
+				return fmt.Errorf("invalid authorized key for %s on line %d: %w", entry.Name(), i+1, err)
+			}
+			s.AuthorizeKey(entry.Name(), key)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func newKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestLoadAuthorizedKeys(t *testing.T) {
+	alice, bob, stranger := newKey(t), newKey(t), newKey(t)
+
+	dir := t.TempDir()
+	aliceKeys := "# laptop\n" + string(ssh.MarshalAuthorizedKey(alice)) + "\n" + string(ssh.MarshalAuthorizedKey(bob))
+	if err := os.WriteFile(filepath.Join(dir, "alice"), []byte(aliceKeys), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".hidden"), []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	service := New()
+	if err := service.LoadAuthorizedKeys(dir); err != nil {
+		t.Fatalf("LoadAuthorizedKeys() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		key      ssh.PublicKey
+		expected bool
+	}{
+		{name: "first key", username: "alice", key: alice, expected: true},
+		{name: "second key", username: "alice", key: bob, expected: true},
+		{name: "unknown key", username: "alice", key: stranger, expected: false},
+		{name: "key of another user", username: "bob", key: bob, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := service.KeyAuthorized(tt.username, tt.key); got != tt.expected {
+				t.Errorf("KeyAuthorized() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "mallory"), []byte("ssh-ed25519 garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := New().LoadAuthorizedKeys(dir); err == nil {
+		t.Error("LoadAuthorizedKeys() with an invalid key succeeded")
+	}
+}
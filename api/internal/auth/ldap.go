@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ErrInvalidCredentials is returned by authenticators other than Service when a username or password is wrong
+var ErrInvalidCredentials = errors.New("auth: invalid credentials")
+
+// LDAPConfig holds the directory server settings.
+// Users are located either with UserDNTemplate (bind as user) or by searching BaseDN with UserFilter
+// using the service account BindDN (search then bind).
+type LDAPConfig struct {
+	// URL of the directory server, ldap:// or ldaps://
+	URL string
+	// StartTLS upgrades an ldap:// connection to TLS before any credentials are sent
+	StartTLS bool
+	// TLSConfig is used for ldaps:// and StartTLS, nil uses the system roots
+	TLSConfig *tls.Config
+	// Timeout bounds dialing and each request, defaults to 10 seconds
+	Timeout time.Duration
+
+	// UserDNTemplate builds the user's DN from the username, e.g. "uid=%s,ou=people,dc=example,dc=com"
+	UserDNTemplate string
+
+	// BindDN and BindPassword are the service account used to search for users
+	BindDN       string
+	BindPassword string
+	// BaseDN is where users are searched for
+	BaseDN string
+	// UserFilter finds the user entry, e.g. "(uid=%s)" or "(sAMAccountName=%s)" for Active Directory
+	UserFilter string
+
+	// GroupBaseDN and GroupFilter look up group membership, e.g. "(member=%s)" where %s is the user's DN.
+	// Without a GroupFilter the user entry's memberOf attribute is used instead.
+	GroupBaseDN string
+	GroupFilter string
+	// GroupAttribute names the group in search results, defaults to "cn"
+	GroupAttribute string
+	// EmailAttribute holds the user's email address, defaults to "mail"
+	EmailAttribute string
+}
+
+// LDAP authenticates users against an LDAP or Active Directory server
+type LDAP struct {
+	cfg LDAPConfig
+}
+
+// NewLDAP creates an LDAP authenticator, it does not connect until credentials are validated
+func NewLDAP(cfg LDAPConfig) (*LDAP, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("auth: LDAP URL is required")
+	}
+	if cfg.UserDNTemplate == "" && (cfg.BaseDN == "" || cfg.UserFilter == "") {
+		return nil, errors.New("auth: LDAP needs a user DN template or a base DN and user filter")
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.GroupAttribute == "" {
+		cfg.GroupAttribute = "cn"
+	}
+	if cfg.EmailAttribute == "" {
+		cfg.EmailAttribute = "mail"
+	}
+
+	return &LDAP{cfg: cfg}, nil
+}
+
+func (l *LDAP) ValidateCredentials(username, password string) error {
+	_, err := l.Authenticate(username, password)
+	return err
+}
+
+// Authenticate binds as the user to check the password and returns their email and groups
+func (l *LDAP) Authenticate(username, password string) (Profile, error) {
+	// An empty password would be an unauthenticated bind, which most servers accept
+	if username == "" || password == "" {
+		return Profile{}, ErrInvalidCredentials
+	}
+
+	conn, err := l.dial()
+	if err != nil {
+		return Profile{}, err
+	}
+	defer conn.Close()
+
+	userDN, err := l.findUser(conn, username)
+	if err != nil {
+		return Profile{}, err
+	}
+
+	if err := conn.Bind(userDN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return Profile{}, ErrInvalidCredentials
+		}
+		return Profile{}, fmt.Errorf("auth: LDAP bind failed: %w", err)
+	}
+
+	return l.profile(conn, userDN)
+}
+
+func (l *LDAP) dial() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(l.cfg.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: l.cfg.Timeout}),
+		ldap.DialWithTLSConfig(l.cfg.TLSConfig),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("auth: failed to connect to LDAP server: %w", err)
+	}
+	conn.SetTimeout(l.cfg.Timeout)
+
+	if l.cfg.StartTLS {
+		tlsConfig := l.cfg.TLSConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{ServerName: hostname(l.cfg.URL)}
+		}
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("auth: LDAP StartTLS failed: %w", err)
+		}
+	}
+
+	return conn, nil
+}
+
+// findUser returns the DN of username, either from the template or by searching as the service account
+func (l *LDAP) findUser(conn *ldap.Conn, username string) (string, error) {
+	if l.cfg.UserDNTemplate != "" {
+		return fmt.Sprintf(l.cfg.UserDNTemplate, ldap.EscapeDN(username)), nil
+	}
+
+	if l.cfg.BindDN != "" {
+		if err := conn.Bind(l.cfg.BindDN, l.cfg.BindPassword); err != nil {
+			return "", fmt.Errorf("auth: LDAP service account bind failed: %w", err)
+		}
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		l.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		fmt.Sprintf(l.cfg.UserFilter, ldap.EscapeFilter(username)),
+		[]string{"dn"}, nil,
+	))
+	if err != nil {
+		return "", fmt.Errorf("auth: LDAP user search failed: %w", err)
+	}
+
+	// Unknown and ambiguous users are both treated as a failed login
+	if len(result.Entries) != 1 {
+		return "", ErrInvalidCredentials
+	}
+
+	return result.Entries[0].DN, nil
+}
+
+// profile reads the user's email and groups, bound as the user
+func (l *LDAP) profile(conn *ldap.Conn, userDN string) (Profile, error) {
+	result, err := conn.Search(ldap.NewSearchRequest(
+		userDN, ldap.ScopeBaseObject, ldap.NeverDerefAliases, 1, 0, false,
+		"(objectClass=*)",
+		[]string{l.cfg.EmailAttribute, "memberOf"}, nil,
+	))
+	if err != nil {
+		return Profile{}, fmt.Errorf("auth: failed to read LDAP user entry: %w", err)
+	}
+	if len(result.Entries) == 0 {
+		return Profile{}, errors.New("auth: LDAP user entry not found")
+	}
+	entry := result.Entries[0]
+
+	profile := Profile{Email: entry.GetAttributeValue(l.cfg.EmailAttribute)}
+
+	if l.cfg.GroupFilter == "" {
+		for _, groupDN := range entry.GetAttributeValues("memberOf") {
+			profile.Groups = append(profile.Groups, groupName(groupDN, l.cfg.GroupAttribute))
+		}
+		return profile, nil
+	}
+
+	baseDN := l.cfg.GroupBaseDN
+	if baseDN == "" {
+		baseDN = l.cfg.BaseDN
+	}
+	groups, err := conn.Search(ldap.NewSearchRequest(
+		baseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		fmt.Sprintf(l.cfg.GroupFilter, ldap.EscapeFilter(userDN)),
+		[]string{l.cfg.GroupAttribute}, nil,
+	))
+	if err != nil {
+		return Profile{}, fmt.Errorf("auth: LDAP group search failed: %w", err)
+	}
+	for _, group := range groups.Entries {
+		profile.Groups = append(profile.Groups, group.GetAttributeValue(l.cfg.GroupAttribute))
+	}
+
+	return profile, nil
+}
+
+// groupName returns the value of attribute in the first RDN of groupDN, or the whole DN if it can't be parsed
+func groupName(groupDN, attribute string) string {
+	dn, err := ldap.ParseDN(groupDN)
+	if err != nil || len(dn.RDNs) == 0 {
+		return groupDN
+	}
+	for _, attr := range dn.RDNs[0].Attributes {
+		if strings.EqualFold(attr.Type, attribute) {
+			return attr.Value
+		}
+	}
+	return groupDN
+}
+
+// hostname extracts the host from an LDAP URL for TLS server name verification
+func hostname(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/josepheid/file-explorer/api/internal/auth/ldaptest"
+)
+
+func directory(t *testing.T) *ldaptest.Server {
+	return ldaptest.NewServer(t,
+		ldaptest.Entry{
+			DN:       "cn=reader,dc=example,dc=com",
+			Password: "readerpass",
+		},
+		ldaptest.Entry{
+			DN:       "uid=jane,ou=people,dc=example,dc=com",
+			Password: "janepass",
+			Attributes: map[string][]string{
+				"uid":      {"jane"},
+				"mail":     {"jane@example.com"},
+				"memberOf": {"cn=engineering,ou=groups,dc=example,dc=com"},
+			},
+		},
+		ldaptest.Entry{
+			DN:       "uid=john,ou=people,dc=example,dc=com",
+			Password: "johnpass",
+			Attributes: map[string][]string{
+				"uid":  {"john"},
+				"mail": {"john@example.com"},
+			},
+		},
+		ldaptest.Entry{
+			DN: "cn=ops,ou=groups,dc=example,dc=com",
+			Attributes: map[string][]string{
+				"cn":     {"ops"},
+				"member": {"uid=jane,ou=people,dc=example,dc=com", "uid=john,ou=people,dc=example,dc=com"},
+			},
+		},
+	)
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	server := directory(t)
+
+	bindAsUser := LDAPConfig{
+		URL:            server.URL(),
+		UserDNTemplate: "uid=%s,ou=people,dc=example,dc=com",
+	}
+	searchThenBind := LDAPConfig{
+		URL:          server.URL(),
+		BindDN:       "cn=reader,dc=example,dc=com",
+		BindPassword: "readerpass",
+		BaseDN:       "ou=people,dc=example,dc=com",
+		UserFilter:   "(uid=%s)",
+		GroupBaseDN:  "ou=groups,dc=example,dc=com",
+		GroupFilter:  "(member=%s)",
+	}
+
+	tests := []struct {
+		name        string
+		cfg         LDAPConfig
+		username    string
+		password    string
+		wantProfile Profile
+		wantErr     error
+	}{
+		{
+			name:        "bind as user with memberOf groups",
+			cfg:         bindAsUser,
+			username:    "jane",
+			password:    "janepass",
+			wantProfile: Profile{Email: "jane@example.com", Groups: []string{"engineering"}},
+		},
+		{
+			name:     "bind as user with wrong password",
+			cfg:      bindAsUser,
+			username: "jane",
+			password: "wrong",
+			wantErr:  ErrInvalidCredentials,
+		},
+		{
+			name:     "empty password is never an anonymous bind",
+			cfg:      bindAsUser,
+			username: "jane",
+			password: "",
+			wantErr:  ErrInvalidCredentials,
+		},
+		{
+			name:        "search then bind with group search",
+			cfg:         searchThenBind,
+			username:    "john",
+			password:    "johnpass",
+			wantProfile: Profile{Email: "john@example.com", Groups: []string{"ops"}},
+		},
+		{
+			name:     "search then bind with unknown user",
+			cfg:      searchThenBind,
+			username: "nobody",
+			password: "password",
+			wantErr:  ErrInvalidCredentials,
+		},
+		{
+			name:     "filter injection is escaped",
+			cfg:      searchThenBind,
+			username: "*",
+			password: "janepass",
+			wantErr:  ErrInvalidCredentials,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := NewLDAP(tt.cfg)
+			if err != nil {
+				t.Fatalf("NewLDAP() error = %v", err)
+			}
+
+			profile, err := l.Authenticate(tt.username, tt.password)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Authenticate() error = %v, want error %v", err, tt.wantErr)
+			}
+			if profile.Email != tt.wantProfile.Email || !slices.Equal(profile.Groups, tt.wantProfile.Groups) {
+				t.Errorf("Authenticate() profile = %+v, want %+v", profile, tt.wantProfile)
+			}
+		})
+	}
+}
+
+func TestLDAPStartTLS(t *testing.T) {
+	server := directory(t)
+	server.RequireTLS = true
+	clientTLS := server.EnableStartTLS(t)
+
+	cfg := LDAPConfig{
+		URL:            server.URL(),
+		UserDNTemplate: "uid=%s,ou=people,dc=example,dc=com",
+	}
+
+	t.Run("plain connection is refused", func(t *testing.T) {
+		l, _ := NewLDAP(cfg)
+		if err := l.ValidateCredentials("jane", "janepass"); err == nil {
+			t.Error("expected bind without StartTLS to fail")
+		}
+	})
+
+	t.Run("StartTLS", func(t *testing.T) {
+		withTLS := cfg
+		withTLS.StartTLS = true
+		withTLS.TLSConfig = clientTLS
+		l, _ := NewLDAP(withTLS)
+
+		if err := l.ValidateCredentials("jane", "janepass"); err != nil {
+			t.Errorf("ValidateCredentials() error = %v", err)
+		}
+	})
+}
+
+func TestNewLDAPValidation(t *testing.T) {
+	if _, err := NewLDAP(LDAPConfig{}); err == nil {
+		t.Error("expected error without URL")
+	}
+	if _, err := NewLDAP(LDAPConfig{URL: "ldap://localhost", BaseDN: "dc=example,dc=com"}); err == nil {
+		t.Error("expected error without user filter or DN template")
+	}
+}
@@ -0,0 +1,388 @@
+// Package ldaptest provides an in-process LDAP server for tests.
+//
+// It implements just enough of LDAPv3 to exercise an LDAP client: simple bind,
+// search with equality, presence, and/or/not filters, StartTLS and unbind.
+package ldaptest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+// LDAP protocol operations and result codes used by the server
+const (
+	opBindRequest         = 0
+	opBindResponse        = 1
+	opUnbindRequest       = 2
+	opSearchRequest       = 3
+	opSearchResultEntry   = 4
+	opSearchResultDone    = 5
+	opExtendedRequest     = 23
+	opExtendedResponse    = 24
+	startTLSOID           = "1.3.6.1.4.1.1466.20037"
+	resultSuccess         = 0
+	resultProtocolError   = 2
+	resultConfidentiality = 13
+	resultNoSuchObject    = 32
+	resultInvalidCreds    = 49
+	resultInsufficient    = 50
+)
+
+// Entry is a directory entry, a non-empty Password allows binding as the entry
+type Entry struct {
+	DN         string
+	Password   string
+	Attributes map[string][]string
+}
+
+// Server is an in-process LDAP server listening on localhost
+type Server struct {
+	// Entries is the directory contents
+	Entries []Entry
+	// RequireTLS rejects binds on connections that have not been upgraded with StartTLS
+	RequireTLS bool
+
+	listener  net.Listener
+	tlsConfig *tls.Config
+}
+
+// NewServer starts a server with the given entries, it is closed when the test ends
+func NewServer(t *testing.T, entries ...Entry) *Server {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	s := &Server{Entries: entries, listener: listener}
+	t.Cleanup(func() { listener.Close() })
+
+	go s.serve()
+
+	return s
+}
+
+// URL returns the ldap:// URL of the server
+func (s *Server) URL() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+// EnableStartTLS generates a self-signed certificate for 127.0.0.1 and enables the StartTLS
+// extended operation. It returns a client TLS config trusting the certificate.
+func (s *Server) EnableStartTLS(t *testing.T) *tls.Config {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ldaptest"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	s.tlsConfig = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &tls.Config{RootCAs: pool, ServerName: "127.0.0.1"}
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+// connState tracks what a connection has done so far
+type connState struct {
+	conn     net.Conn
+	boundDN  string
+	upgraded bool
+}
+
+func (s *Server) handle(conn net.Conn) {
+	state := &connState{conn: conn}
+	defer func() { state.conn.Close() }()
+
+	for {
+		packet, err := ber.ReadPacket(state.conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		messageID, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case opBindRequest:
+			s.bind(state, messageID, op)
+		case opSearchRequest:
+			s.search(state, messageID, op)
+		case opExtendedRequest:
+			if !s.extended(state, messageID, op) {
+				return
+			}
+		case opUnbindRequest:
+			return
+		default:
+			return
+		}
+	}
+}
+
+func (s *Server) bind(state *connState, messageID int64, op *ber.Packet) {
+	if len(op.Children) < 3 {
+		writeResult(state.conn, messageID, opBindResponse, resultProtocolError, "malformed bind request")
+		return
+	}
+	dn := value(op.Children[1])
+	password := value(op.Children[2])
+
+	if s.RequireTLS && !state.upgraded {
+		writeResult(state.conn, messageID, opBindResponse, resultConfidentiality, "StartTLS required")
+		return
+	}
+
+	// anonymous bind
+	if dn == "" && password == "" {
+		state.boundDN = ""
+		writeResult(state.conn, messageID, opBindResponse, resultSuccess, "")
+		return
+	}
+
+	entry, ok := s.find(dn)
+	if !ok || entry.Password == "" || entry.Password != password {
+		writeResult(state.conn, messageID, opBindResponse, resultInvalidCreds, "invalid credentials")
+		return
+	}
+
+	state.boundDN = entry.DN
+	writeResult(state.conn, messageID, opBindResponse, resultSuccess, "")
+}
+
+func (s *Server) search(state *connState, messageID int64, op *ber.Packet) {
+	if state.boundDN == "" {
+		writeResult(state.conn, messageID, opSearchResultDone, resultInsufficient, "bind required")
+		return
+	}
+	if len(op.Children) < 8 {
+		writeResult(state.conn, messageID, opSearchResultDone, resultProtocolError, "malformed search request")
+		return
+	}
+
+	baseDN := normalize(value(op.Children[0]))
+	scope, _ := op.Children[1].Value.(int64)
+	filter := op.Children[6]
+
+	var attributes []string
+	for _, attr := range op.Children[7].Children {
+		attributes = append(attributes, value(attr))
+	}
+
+	found := false
+	for _, entry := range s.Entries {
+		dn := normalize(entry.DN)
+		switch scope {
+		case 0: // base object
+			if dn != baseDN {
+				continue
+			}
+		case 1: // single level
+			_, parent, _ := strings.Cut(dn, ",")
+			if parent != baseDN {
+				continue
+			}
+		default: // whole subtree
+			if dn != baseDN && !strings.HasSuffix(dn, ","+baseDN) {
+				continue
+			}
+		}
+		if dn == baseDN {
+			found = true
+		}
+
+		if matches(entry, filter) {
+			writeEntry(state.conn, messageID, entry, attributes)
+		}
+	}
+
+	if scope == 0 && !found {
+		writeResult(state.conn, messageID, opSearchResultDone, resultNoSuchObject, "no such object")
+		return
+	}
+	writeResult(state.conn, messageID, opSearchResultDone, resultSuccess, "")
+}
+
+// extended handles StartTLS, it returns false if the connection should be closed
+func (s *Server) extended(state *connState, messageID int64, op *ber.Packet) bool {
+	if len(op.Children) == 0 || value(op.Children[0]) != startTLSOID || s.tlsConfig == nil || state.upgraded {
+		writeResult(state.conn, messageID, opExtendedResponse, resultProtocolError, "unsupported extended operation")
+		return true
+	}
+
+	writeResult(state.conn, messageID, opExtendedResponse, resultSuccess, "")
+
+	tlsConn := tls.Server(state.conn, s.tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		return false
+	}
+	state.conn = tlsConn
+	state.upgraded = true
+
+	return true
+}
+
+func (s *Server) find(dn string) (Entry, bool) {
+	for _, entry := range s.Entries {
+		if normalize(entry.DN) == normalize(dn) {
+			return entry, true
+		}
+	}
+	return Entry{}, false
+}
+
+// matches evaluates an LDAP filter against an entry
+func matches(entry Entry, filter *ber.Packet) bool {
+	switch filter.Tag {
+	case 0: // and
+		for _, child := range filter.Children {
+			if !matches(entry, child) {
+				return false
+			}
+		}
+		return true
+	case 1: // or
+		for _, child := range filter.Children {
+			if matches(entry, child) {
+				return true
+			}
+		}
+		return false
+	case 2: // not
+		return len(filter.Children) == 1 && !matches(entry, filter.Children[0])
+	case 3: // equality match
+		if len(filter.Children) != 2 {
+			return false
+		}
+		want := value(filter.Children[1])
+		for _, v := range attributeValues(entry, value(filter.Children[0])) {
+			if strings.EqualFold(v, want) {
+				return true
+			}
+		}
+		return false
+	case 7: // present
+		name := filter.Data.String()
+		return strings.EqualFold(name, "objectClass") || len(attributeValues(entry, name)) > 0
+	default:
+		return false
+	}
+}
+
+func attributeValues(entry Entry, name string) []string {
+	for attr, values := range entry.Attributes {
+		if strings.EqualFold(attr, name) {
+			return values
+		}
+	}
+	return nil
+}
+
+func writeEntry(w io.Writer, messageID int64, entry Entry, attributes []string) {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, opSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.DN, "Object Name"))
+
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for name, values := range entry.Attributes {
+		if !wanted(name, attributes) {
+			continue
+		}
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, v := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "Value"))
+		}
+		attr.AppendChild(set)
+		attrs.AppendChild(attr)
+	}
+	op.AppendChild(attrs)
+
+	write(w, messageID, op)
+}
+
+func wanted(name string, attributes []string) bool {
+	if len(attributes) == 0 {
+		return true
+	}
+	for _, attr := range attributes {
+		if attr == "*" || strings.EqualFold(attr, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeResult(w io.Writer, messageID int64, opTag ber.Tag, code int64, message string) {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, opTag, nil, "Result")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "Result Code"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, message, "Diagnostic Message"))
+	write(w, messageID, op)
+}
+
+func write(w io.Writer, messageID int64, op *ber.Packet) {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "Message ID"))
+	packet.AppendChild(op)
+	w.Write(packet.Bytes())
+}
+
+// value returns the string contents of a primitive packet
+func value(p *ber.Packet) string {
+	if s, ok := p.Value.(string); ok {
+		return s
+	}
+	if p.Data != nil {
+		return p.Data.String()
+	}
+	return ""
+}
+
+// normalize makes DNs comparable by lower casing them and removing spaces after separators
+func normalize(dn string) string {
+	parts := strings.Split(dn, ",")
+	for i, part := range parts {
+		parts[i] = strings.ToLower(strings.TrimSpace(part))
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,315 @@
+package checksum
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"lukechampine.com/blake3"
+)
+
+// Supported algorithms
+const (
+	SHA256 = "sha256"
+	SHA1   = "sha1"
+	MD5    = "md5"
+	BLAKE3 = "blake3"
+)
+
+const (
+	// maxEntries bounds the checksums remembered by a Service, the cache is cleared when it is exceeded
+	maxEntries = 100_000
+	// MaxManifestSize bounds the manifests that can be verified
+	MaxManifestSize = 16 << 20
+	// bufferSize is how much of a file is hashed between checks for cancellation
+	bufferSize = 256 << 10
+)
+
+var (
+	// ErrUnknownAlgorithm is returned for algorithms other than those supported
+	ErrUnknownAlgorithm = errors.New("checksum: unknown algorithm")
+	// ErrNotRegular is returned when hashing a directory or other non regular file
+	ErrNotRegular = errors.New("checksum: not a regular file")
+	// ErrInvalidManifest is returned for manifests that are not in the format written by sha256sum and friends
+	ErrInvalidManifest = errors.New("checksum: invalid manifest")
+)
+
+// newHash returns a hash for the named algorithm
+func newHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case SHA256:
+		return sha256.New(), nil
+	case SHA1:
+		return sha1.New(), nil
+	case MD5:
+		return md5.New(), nil
+	case BLAKE3:
+		return blake3.New(32, nil), nil
+	default:
+		return nil, ErrUnknownAlgorithm
+	}
+}
+
+// Valid reports whether algorithm is supported
+func Valid(algorithm string) bool {
+	_, err := newHash(algorithm)
+	return err == nil
+}
+
+// Service computes file checksums, caching them until the file's modification time or size changes
+type Service struct {
+	mu    sync.Mutex
+	cache map[cacheKey]string
+}
+
+type cacheKey struct {
+	path      string
+	modTime   time.Time
+	size      int64
+	algorithm string
+}
+
+// New creates a Service
+func New() *Service {
+	return &Service{cache: make(map[cacheKey]string)}
+}
+
+// File returns the hex encoded checksum of the regular file at path, it stops early with ctx's error if ctx is done
+func (s *Service) File(ctx context.Context, path, algorithm string) (string, error) {
+	h, err := newHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	// opening a FIFO blocks until a writer appears, so anything but a regular file is rejected before opening it
+	if info, err := os.Stat(path); err != nil {
+		return "", err
+	} else if !info.Mode().IsRegular() {
+		return "", ErrNotRegular
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", ErrNotRegular
+	}
+
+	key := cacheKey{path: path, modTime: info.ModTime(), size: info.Size(), algorithm: algorithm}
+	s.mu.Lock()
+	sum, ok := s.cache[key]
+	s.mu.Unlock()
+	if ok {
+		return sum, nil
+	}
+
+	buf := make([]byte, bufferSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		n, err := f.Read(buf)
+		h.Write(buf[:n])
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	sum = hex.EncodeToString(h.Sum(nil))
+
+	s.mu.Lock()
+	if len(s.cache) >= maxEntries {
+		clear(s.cache)
+	}
+	s.cache[key] = sum
+	s.mu.Unlock()
+
+	return sum, nil
+}
+
+// Entry is a line of a manifest, Path is relative to the manifest's directory and uses forward slashes
+type Entry struct {
+	Checksum string
+	Path     string
+}
+
+// Manifest hashes every regular file below dir, in lexical order, calling fn with each entry.
+// Symlinks are not followed. Files that cannot be read are passed to skipped and left out.
+// It stops at the first error returned by fn or when ctx is done.
+func (s *Service) Manifest(ctx context.Context, dir, algorithm string, fn func(Entry) error, skipped func(rel string, err error)) error {
+	if !Valid(algorithm) {
+		return ErrUnknownAlgorithm
+	}
+
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			if p == dir {
+				return err
+			}
+			skipped(relPath(dir, p), err)
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		sum, err := s.File(ctx, p, algorithm)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			skipped(relPath(dir, p), err)
+			return nil
+		}
+		return fn(Entry{Checksum: sum, Path: relPath(dir, p)})
+	})
+}
+
+func relPath(dir, p string) string {
+	rel, err := filepath.Rel(dir, p)
+	if err != nil {
+		return p
+	}
+	return filepath.ToSlash(rel)
+}
+
+// FormatEntry formats e as a manifest line in the format written by sha256sum, including the trailing newline.
+// Like sha256sum, names containing a backslash or newline are escaped and the line is prefixed with a backslash.
+func FormatEntry(e Entry) string {
+	if strings.ContainsAny(e.Path, "\\\n\r") {
+		escaped := strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\r", "\\r").Replace(e.Path)
+		return "\\" + e.Checksum + "  " + escaped + "\n"
+	}
+	return e.Checksum + "  " + e.Path + "\n"
+}
+
+// ParseManifest reads a manifest in the format written by sha256sum, sha1sum, md5sum or b3sum.
+// Blank lines and lines starting with # are ignored. Callers should limit r to MaxManifestSize.
+func ParseManifest(r io.Reader, algorithm string) ([]Entry, error) {
+	h, err := newHash(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	hexLen := h.Size() * 2
+
+	var entries []Entry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 64<<10)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		escaped := strings.HasPrefix(text, "\\")
+		text = strings.TrimPrefix(text, "\\")
+
+		// "<checksum>  <name>" for text mode or "<checksum> *<name>" for binary mode
+		if len(text) < hexLen+2 || text[hexLen] != ' ' || (text[hexLen+1] != ' ' && text[hexLen+1] != '*') {
+			return nil, fmt.Errorf("%w: line %d is not \"<checksum>  <path>\"", ErrInvalidManifest, line)
+		}
+		sum := strings.ToLower(text[:hexLen])
+		if _, err := hex.DecodeString(sum); err != nil {
+			return nil, fmt.Errorf("%w: line %d has an invalid %s checksum", ErrInvalidManifest, line, algorithm)
+		}
+
+		name := text[hexLen+2:]
+		if escaped {
+			name = strings.NewReplacer("\\\\", "\\", "\\n", "\n", "\\r", "\r").Replace(name)
+		}
+		if name == "" {
+			return nil, fmt.Errorf("%w: line %d has no path", ErrInvalidManifest, line)
+		}
+		entries = append(entries, Entry{Checksum: sum, Path: name})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidManifest, err)
+	}
+
+	return entries, nil
+}
+
+// Verification results
+const (
+	StatusOK       = "ok"
+	StatusMismatch = "mismatch"
+	StatusMissing  = "missing"
+	// StatusError means the file could not be read, or its path is not below the directory
+	StatusError = "error"
+)
+
+// Result is the outcome of verifying one manifest entry
+type Result struct {
+	Path     string `json:"path"`
+	Status   string `json:"status"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual,omitempty"`
+}
+
+// Verify checks each entry against the files below dir. Paths in the manifest are relative to dir, paths escaping it
+// fail with StatusError. It stops early with ctx's error if ctx is done.
+func (s *Service) Verify(ctx context.Context, dir, algorithm string, entries []Entry) ([]Result, error) {
+	if !Valid(algorithm) {
+		return nil, ErrUnknownAlgorithm
+	}
+
+	results := make([]Result, 0, len(entries))
+	for _, e := range entries {
+		result := Result{Path: e.Path, Expected: e.Checksum}
+
+		rel := path.Clean(strings.TrimPrefix(e.Path, "./"))
+		if path.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, "../") {
+			result.Status = StatusError
+			results = append(results, result)
+			continue
+		}
+
+		sum, err := s.File(ctx, filepath.Join(dir, filepath.FromSlash(rel)), algorithm)
+		switch {
+		case ctx.Err() != nil:
+			return nil, ctx.Err()
+		case errors.Is(err, fs.ErrNotExist):
+			result.Status = StatusMissing
+		case err != nil:
+			result.Status = StatusError
+		case sum == e.Checksum:
+			result.Status, result.Actual = StatusOK, sum
+		default:
+			result.Status, result.Actual = StatusMismatch, sum
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
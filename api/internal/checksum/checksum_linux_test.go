@@ -0,0 +1,38 @@
+package checksum
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestVerifyFIFO(t *testing.T) {
+	root := writeFiles(t, map[string]string{"ok.txt": "abc"})
+	if err := unix.Mkfifo(filepath.Join(root, "fifo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// opening a FIFO without a writer would block forever
+	done := make(chan []Result, 1)
+	go func() {
+		results, err := New().Verify(context.Background(), root, SHA256, []Entry{
+			{Checksum: abc[SHA256], Path: "fifo"},
+			{Checksum: abc[SHA256], Path: "ok.txt"},
+		})
+		if err != nil {
+			t.Errorf("Verify() error = %v", err)
+		}
+		done <- results
+	}()
+	select {
+	case results := <-done:
+		if len(results) != 2 || results[0].Status != StatusError || results[1].Status != StatusOK {
+			t.Errorf("Verify() = %+v, want the FIFO to fail and the file to match", results)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Verify() blocked on a FIFO")
+	}
+}
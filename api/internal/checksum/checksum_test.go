@@ -0,0 +1,226 @@
+package checksum
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// known checksums of "abc"
+var abc = map[string]string{
+	SHA256: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+	SHA1:   "a9993e364706816aba3e25717850c26c9cd0d89d",
+	MD5:    "900150983cd24fb0d6963f7d28e17f72",
+	BLAKE3: "6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85",
+}
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestFile(t *testing.T) {
+	root := writeFiles(t, map[string]string{"abc.txt": "abc"})
+	path := filepath.Join(root, "abc.txt")
+	s := New()
+
+	for algorithm, want := range abc {
+		got, err := s.File(context.Background(), path, algorithm)
+		if err != nil {
+			t.Fatalf("File(%s) error = %v", algorithm, err)
+		}
+		if got != want {
+			t.Errorf("File(%s) = %s, want %s", algorithm, got, want)
+		}
+	}
+
+	if _, err := s.File(context.Background(), path, "crc32"); !errors.Is(err, ErrUnknownAlgorithm) {
+		t.Errorf("File() error = %v, want ErrUnknownAlgorithm", err)
+	}
+	if _, err := s.File(context.Background(), root, SHA256); !errors.Is(err, ErrNotRegular) {
+		t.Errorf("File() error = %v for a directory, want ErrNotRegular", err)
+	}
+	if _, err := s.File(context.Background(), filepath.Join(root, "missing"), SHA256); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("File() error = %v for a missing file, want os.ErrNotExist", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.File(ctx, filepath.Join(root, "abc.txt"), MD5); !errors.Is(err, context.Canceled) && err != nil {
+		t.Errorf("File() error = %v with a cancelled context", err)
+	}
+}
+
+func TestFileCache(t *testing.T) {
+	root := writeFiles(t, map[string]string{"abc.txt": "abc"})
+	path := filepath.Join(root, "abc.txt")
+	s := New()
+
+	if _, err := s.File(context.Background(), path, SHA256); err != nil {
+		t.Fatalf("File() error = %v", err)
+	}
+
+	// the cached checksum is used while the modification time and size are unchanged
+	info, _ := os.Stat(path)
+	if err := os.WriteFile(path, []byte("xyz"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.File(context.Background(), path, SHA256); got != abc[SHA256] {
+		t.Errorf("File() = %s, want the cached checksum", got)
+	}
+
+	later := info.ModTime().Add(time.Second)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.File(context.Background(), path, SHA256); got == abc[SHA256] {
+		t.Error("File() returned the cached checksum of a modified file")
+	}
+}
+
+func TestManifest(t *testing.T) {
+	root := writeFiles(t, map[string]string{
+		"b.txt":        "abc",
+		"a/one.txt":    "abc",
+		"a/b/deep.txt": "abc",
+		"back\\slash":  "abc",
+	})
+	if err := os.Symlink(filepath.Join(root, "b.txt"), filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	var manifest strings.Builder
+	err := New().Manifest(context.Background(), root, MD5, func(e Entry) error {
+		manifest.WriteString(FormatEntry(e))
+		return nil
+	}, func(rel string, err error) {
+		t.Errorf("unexpected skipped file %s: %v", rel, err)
+	})
+	if err != nil {
+		t.Fatalf("Manifest() error = %v", err)
+	}
+
+	sum := abc[MD5]
+	want := sum + "  a/b/deep.txt\n" +
+		sum + "  a/one.txt\n" +
+		sum + "  b.txt\n" +
+		"\\" + sum + "  back\\\\slash\n"
+	if manifest.String() != want {
+		t.Errorf("Manifest() wrote\n%s\nwant\n%s", manifest.String(), want)
+	}
+
+	// the manifest reads back
+	entries, err := ParseManifest(strings.NewReader(manifest.String()), MD5)
+	if err != nil {
+		t.Fatalf("ParseManifest() error = %v", err)
+	}
+	if len(entries) != 4 || entries[3].Path != "back\\slash" {
+		t.Errorf("unexpected entries %+v", entries)
+	}
+}
+
+func TestParseManifest(t *testing.T) {
+	sum := abc[SHA1]
+
+	tests := []struct {
+		name     string
+		manifest string
+		want     []Entry
+		wantErr  bool
+	}{
+		{
+			name:     "text and binary mode",
+			manifest: "# comment\n" + sum + "  a.txt\r\n\n" + strings.ToUpper(sum) + " *dir/b c.bin\n",
+			want:     []Entry{{Checksum: sum, Path: "a.txt"}, {Checksum: sum, Path: "dir/b c.bin"}},
+		},
+		{
+			name:     "escaped newline",
+			manifest: "\\" + sum + "  two\\nlines\n",
+			want:     []Entry{{Checksum: sum, Path: "two\nlines"}},
+		},
+		{name: "wrong length", manifest: abc[MD5] + "  a.txt\n", wantErr: true},
+		{name: "not hex", manifest: strings.Repeat("z", 40) + "  a.txt\n", wantErr: true},
+		{name: "single space", manifest: sum + " a.txt\n", wantErr: true},
+		{name: "no path", manifest: sum + "  \n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := ParseManifest(strings.NewReader(tt.manifest), SHA1)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidManifest) {
+					t.Errorf("ParseManifest() error = %v, want ErrInvalidManifest", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseManifest() error = %v", err)
+			}
+			if len(entries) != len(tt.want) {
+				t.Fatalf("ParseManifest() = %+v, want %+v", entries, tt.want)
+			}
+			for i := range entries {
+				if entries[i] != tt.want[i] {
+					t.Errorf("entry %d = %+v, want %+v", i, entries[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	root := writeFiles(t, map[string]string{
+		"ok.txt":      "abc",
+		"dir/ok.txt":  "abc",
+		"changed.txt": "abd",
+	})
+	if err := os.Mkdir(filepath.Join(root, "subdir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	sum := abc[SHA256]
+	entries := []Entry{
+		{Checksum: sum, Path: "ok.txt"},
+		{Checksum: sum, Path: "./dir/ok.txt"},
+		{Checksum: sum, Path: "changed.txt"},
+		{Checksum: sum, Path: "missing.txt"},
+		{Checksum: sum, Path: "subdir"},
+		{Checksum: sum, Path: "../outside.txt"},
+		{Checksum: sum, Path: "/etc/passwd"},
+	}
+	want := []string{StatusOK, StatusOK, StatusMismatch, StatusMissing, StatusError, StatusError, StatusError}
+
+	results, err := New().Verify(context.Background(), root, SHA256, entries)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if len(results) != len(want) {
+		t.Fatalf("Verify() = %+v", results)
+	}
+	for i, result := range results {
+		if result.Status != want[i] || result.Path != entries[i].Path || result.Expected != sum {
+			t.Errorf("result %d = %+v, want status %s", i, result, want[i])
+		}
+	}
+	if results[2].Actual == "" || results[2].Actual == sum {
+		t.Errorf("expected the actual checksum of the changed file, got %q", results[2].Actual)
+	}
+}
@@ -0,0 +1,169 @@
+package dirsize
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maxEntries bounds the directories remembered by a Calculator, the cache is cleared when it is exceeded
+	maxEntries = 100_000
+	// maxAge is how long a directory's own entries are trusted for, files changed in place do not change their
+	// directory's modification time so they are only picked up once it passes
+	maxAge = 10 * time.Minute
+)
+
+// Result is the total size of a directory tree
+type Result struct {
+	// Size is the sum of the apparent sizes of the regular files in the tree, symlinks are not followed
+	Size  int64
+	Files int64
+	Dirs  int64
+	// Approximate is set if the walk was cut short by the context or unreadable directories,
+	// the totals then only cover what was reached
+	Approximate bool
+}
+
+// Calculator computes recursive directory sizes, like du. Directories are read concurrently and what each one
+// directly contains is cached until its modification time changes, so repeated walks of a large tree only
+// re-read the directories that changed.
+type Calculator struct {
+	// workers bounds the directories read at once
+	workers chan struct{}
+
+	mu    sync.Mutex
+	cache map[string]entry
+	now   func() time.Time
+}
+
+// entry is what a directory directly contains
+type entry struct {
+	modTime time.Time
+	readAt  time.Time
+	size    int64
+	files   int64
+	subdirs []string
+}
+
+// New creates a Calculator reading up to workers directories at once, 0 means one per CPU
+func New(workers int) *Calculator {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	return &Calculator{
+		workers: make(chan struct{}, workers),
+		cache:   make(map[string]entry),
+		now:     time.Now,
+	}
+}
+
+// Size walks the tree at dir. If ctx is done before the walk completes, the partial totals are returned
+// flagged as approximate.
+func (c *Calculator) Size(ctx context.Context, dir string) Result {
+	w := &walk{calc: c, ctx: ctx}
+	w.dir(filepath.Clean(dir))
+	w.wg.Wait()
+
+	return Result{
+		Size:        w.size.Load(),
+		Files:       w.files.Load(),
+		Dirs:        w.dirs.Load(),
+		Approximate: w.partial.Load(),
+	}
+}
+
+// walk is a single Size call, the totals are updated by every goroutine taking part
+type walk struct {
+	calc *Calculator
+	ctx  context.Context
+	wg   sync.WaitGroup
+
+	size    atomic.Int64
+	files   atomic.Int64
+	dirs    atomic.Int64
+	partial atomic.Bool
+}
+
+// dir adds the tree at path to the totals, subdirectories are handed to other goroutines while workers are free
+// and walked inline otherwise, so the walk never waits on itself
+func (w *walk) dir(path string) {
+	if w.ctx.Err() != nil {
+		w.partial.Store(true)
+		return
+	}
+
+	e, err := w.calc.read(path)
+	if err != nil {
+		// unreadable directories are left out, like du
+		w.partial.Store(true)
+		return
+	}
+	w.size.Add(e.size)
+	w.files.Add(e.files)
+	w.dirs.Add(1)
+
+	for _, sub := range e.subdirs {
+		select {
+		case w.calc.workers <- struct{}{}:
+			w.wg.Add(1)
+			go func() {
+				defer w.wg.Done()
+				defer func() { <-w.calc.workers }()
+				w.dir(sub)
+			}()
+		default:
+			w.dir(sub)
+		}
+	}
+}
+
+// read returns what the directory at path directly contains, from the cache if it has not changed
+func (c *Calculator) read(path string) (entry, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return entry{}, err
+	}
+
+	now := c.now()
+	c.mu.Lock()
+	e, ok := c.cache[path]
+	c.mu.Unlock()
+	if ok && e.modTime.Equal(info.ModTime()) && now.Sub(e.readAt) < maxAge {
+		return e, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return entry{}, err
+	}
+
+	e = entry{modTime: info.ModTime(), readAt: now}
+	for _, de := range entries {
+		switch {
+		case de.IsDir():
+			e.subdirs = append(e.subdirs, filepath.Join(path, de.Name()))
+		case de.Type().IsRegular():
+			fi, err := de.Info()
+			if err != nil {
+				// removed since the directory was read
+				continue
+			}
+			e.size += fi.Size()
+			e.files++
+		}
+	}
+
+	c.mu.Lock()
+	if len(c.cache) >= maxEntries {
+		clear(c.cache)
+	}
+	c.cache[path] = e
+	c.mu.Unlock()
+
+	return e, nil
+}
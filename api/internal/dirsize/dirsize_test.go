@@ -0,0 +1,147 @@
+package dirsize
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// makeTree creates files of the given sizes, creating their directories along the way
+func makeTree(t *testing.T, files map[string]int) string {
+	t.Helper()
+
+	root := t.TempDir()
+	for name, size := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestSize(t *testing.T) {
+	root := makeTree(t, map[string]int{
+		"a.txt":          100,
+		"sub/b.txt":      200,
+		"sub/c.txt":      300,
+		"sub/deep/d.bin": 400,
+		"other/e.txt":    500,
+	})
+	if err := os.Mkdir(filepath.Join(root, "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// symlinks are not followed, so the tree is not counted twice
+	if err := os.Symlink(filepath.Join(root, "sub"), filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	c := New(2)
+	tests := []struct {
+		dir  string
+		want Result
+	}{
+		{dir: root, want: Result{Size: 1500, Files: 5, Dirs: 5}},
+		{dir: filepath.Join(root, "sub"), want: Result{Size: 900, Files: 3, Dirs: 2}},
+		{dir: filepath.Join(root, "empty"), want: Result{Dirs: 1}},
+	}
+
+	for _, tt := range tests {
+		if got := c.Size(context.Background(), tt.dir); got != tt.want {
+			t.Errorf("Size(%s) = %+v, want %+v", tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestSizeCache(t *testing.T) {
+	root := makeTree(t, map[string]int{
+		"a.txt":     100,
+		"sub/b.txt": 200,
+	})
+
+	c := New(1)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	if got := c.Size(context.Background(), root); got.Size != 300 {
+		t.Fatalf("Size() = %d, want 300", got.Size)
+	}
+
+	// a file changed in place keeps its directory's modification time, so the cached size is used
+	sub := filepath.Join(root, "sub")
+	info, err := os.Stat(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sub, "b.txt"), make([]byte, 250), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(sub, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Size(context.Background(), root); got.Size != 300 {
+		t.Errorf("Size() = %d, want cached 300", got.Size)
+	}
+
+	// adding a file changes the directory's modification time
+	later := info.ModTime().Add(time.Second)
+	if err := os.WriteFile(filepath.Join(sub, "c.txt"), make([]byte, 50), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(sub, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Size(context.Background(), root); got.Size != 400 {
+		t.Errorf("Size() = %d, want 400 after adding a file", got.Size)
+	}
+
+	// cached entries expire, picking up the file changed in place
+	if err := os.WriteFile(filepath.Join(sub, "b.txt"), make([]byte, 300), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(sub, later, later); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(maxAge)
+	if got := c.Size(context.Background(), root); got.Size != 450 {
+		t.Errorf("Size() = %d, want 450 after the cache expired", got.Size)
+	}
+}
+
+func TestSizeCancelled(t *testing.T) {
+	root := makeTree(t, map[string]int{"a/b/c.txt": 10})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	got := New(1).Size(ctx, root)
+	if !got.Approximate || got.Size != 0 {
+		t.Errorf("Size() = %+v, want an empty approximate result", got)
+	}
+}
+
+func TestSizeUnreadable(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permissions are not enforced for root")
+	}
+
+	root := makeTree(t, map[string]int{
+		"a.txt":        100,
+		"locked/b.txt": 200,
+	})
+	locked := filepath.Join(root, "locked")
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(locked, 0755)
+
+	got := New(1).Size(context.Background(), root)
+	if !got.Approximate || got.Size != 100 {
+		t.Errorf("Size() = %+v, want 100 flagged approximate", got)
+	}
+}
@@ -0,0 +1,440 @@
+package duplicates
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/josepheid/file-explorer/api/internal/checksum"
+)
+
+const (
+	// DefaultMinSize skips empty files, which are all identical but take up no space
+	DefaultMinSize = 1
+	// maxGroups bounds the groups in a report, those wasting the most space are kept
+	maxGroups = 1000
+	// partialSize is how much of the start of a file is hashed to rule out files that only share a size
+	partialSize = 64 << 10
+	// maxRunning bounds the searches running at once, each reads a whole tree
+	maxRunning = 2
+	// resultTTL is how long a finished search is kept for clients polling it
+	resultTTL = 10 * time.Minute
+)
+
+// Job states
+const (
+	StatusRunning   = "running"
+	StatusDone      = "done"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// Search phases, files are first listed and grouped by size and then hashed
+const (
+	PhaseScanning = "scanning"
+	PhaseHashing  = "hashing"
+)
+
+var (
+	// ErrBusy is returned when too many searches are already running
+	ErrBusy = errors.New("duplicates: too many searches running")
+	// ErrUnreadable fails a search whose directory could not be read
+	ErrUnreadable = errors.New("duplicates: directory could not be read")
+	// ErrClosed is returned when starting a search after the Manager was closed
+	ErrClosed = errors.New("duplicates: manager closed")
+)
+
+// Options describe a search
+type Options struct {
+	// Path is the directory as the client named it, paths in the report are relative to the same root
+	Path string
+	// AbsPath is the directory on the filesystem
+	AbsPath string
+	// MinSize skips smaller files
+	MinSize int64
+	// Allow, if set, is asked about each file by its path as the client would name it.
+	// Files it rejects are left out, e.g. to apply the access rules of the user running the search.
+	Allow func(path string) bool
+}
+
+// Progress counts what a search has done so far
+type Progress struct {
+	Phase string `json:"phase"`
+	// Files and Bytes count the files listed
+	Files int64 `json:"files"`
+	Bytes int64 `json:"bytes"`
+	// Candidates counts the files sharing their size with another, which have to be hashed
+	Candidates int64 `json:"candidates"`
+	// Hashed counts the candidates hashed so far
+	Hashed int64 `json:"hashed"`
+	// Errors counts entries that could not be read, they are left out of the report
+	Errors int64 `json:"errors"`
+}
+
+// Group is a set of files with the same content
+type Group struct {
+	// Checksum is the SHA-256 of the content
+	Checksum string   `json:"checksum"`
+	Size     int64    `json:"size"`
+	Paths    []string `json:"paths"`
+	// Wasted is the space taken up by all but one of the copies
+	Wasted int64 `json:"wasted"`
+}
+
+// Report is the result of a search
+type Report struct {
+	// Groups are ordered by wasted space, largest first
+	Groups []Group `json:"groups"`
+	// Wasted is the total over every group, including any beyond those in Groups
+	Wasted int64 `json:"wasted"`
+}
+
+// Job is a snapshot of a search
+type Job struct {
+	ID         string     `json:"id"`
+	Status     string     `json:"status"`
+	Path       string     `json:"path"`
+	MinSize    int64      `json:"minSize"`
+	Progress   Progress   `json:"progress"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	Report     *Report    `json:"report,omitempty"`
+}
+
+// Manager runs searches in the background, clients start or poll one with Run
+type Manager struct {
+	sums   *checksum.Service
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	jobs    map[jobKey]*job
+	running int
+	closed  bool
+}
+
+type jobKey struct {
+	owner   string
+	path    string
+	minSize int64
+}
+
+// job is a search in progress or finished, its progress is updated without holding the Manager's lock
+type job struct {
+	id      string
+	opts    Options
+	started time.Time
+	cancel  context.CancelFunc
+
+	phase                                  atomic.Value
+	files, bytes, candidates, hashed, errs atomic.Int64
+
+	// set once the search ends, guarded by the Manager's mu
+	status   string
+	finished time.Time
+	err      error
+	report   *Report
+}
+
+// New creates a Manager, file contents are hashed with sums so its cache is shared with checksum requests
+func New(sums *checksum.Service) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{
+		sums:   sums,
+		ctx:    ctx,
+		cancel: cancel,
+		jobs:   make(map[jobKey]*job),
+	}
+}
+
+// Run returns the owner's search with opts, starting it if there is none or refresh is set.
+// Searches by the same owner of the same path and minimum size are shared, so opts.Allow must only depend on the owner.
+func (m *Manager) Run(owner string, opts Options, refresh bool) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return Job{}, ErrClosed
+	}
+	m.expire()
+
+	key := jobKey{owner: owner, path: opts.Path, minSize: opts.MinSize}
+	if j, ok := m.jobs[key]; ok {
+		if !refresh || j.status == StatusRunning {
+			return j.snapshot(), nil
+		}
+	}
+
+	if m.running >= maxRunning {
+		return Job{}, ErrBusy
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return Job{}, err
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	j := &job{
+		id:      hex.EncodeToString(id),
+		opts:    opts,
+		started: time.Now(),
+		cancel:  cancel,
+		status:  StatusRunning,
+	}
+	j.phase.Store(PhaseScanning)
+	m.jobs[key] = j
+	m.running++
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		report, err := j.search(ctx, m.sums)
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.running--
+		j.cancel()
+		j.finished = time.Now()
+		switch {
+		case errors.Is(err, context.Canceled):
+			j.status = StatusCancelled
+		case err != nil:
+			j.status, j.err = StatusFailed, err
+		default:
+			j.status, j.report = StatusDone, report
+		}
+	}()
+
+	return j.snapshot(), nil
+}
+
+// Cancel stops the owner's running searches of path, reporting whether there were any
+func (m *Manager) Cancel(owner, path string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	found := false
+	for key, j := range m.jobs {
+		if key.owner == owner && key.path == path && j.status == StatusRunning {
+			j.cancel()
+			found = true
+		}
+	}
+	return found
+}
+
+// Close cancels every running search and waits for them to stop
+func (m *Manager) Close() {
+	m.mu.Lock()
+	m.closed = true
+	m.mu.Unlock()
+
+	m.cancel()
+	m.wg.Wait()
+}
+
+// expire forgets searches that finished more than resultTTL ago, the caller must hold m.mu
+func (m *Manager) expire() {
+	for key, j := range m.jobs {
+		if j.status != StatusRunning && time.Since(j.finished) > resultTTL {
+			delete(m.jobs, key)
+		}
+	}
+}
+
+// snapshot copies the job's state, the caller must hold the Manager's mu
+func (j *job) snapshot() Job {
+	s := Job{
+		ID:      j.id,
+		Status:  j.status,
+		Path:    j.opts.Path,
+		MinSize: j.opts.MinSize,
+		Progress: Progress{
+			Phase:      j.phase.Load().(string),
+			Files:      j.files.Load(),
+			Bytes:      j.bytes.Load(),
+			Candidates: j.candidates.Load(),
+			Hashed:     j.hashed.Load(),
+			Errors:     j.errs.Load(),
+		},
+		StartedAt: j.started,
+		Report:    j.report,
+	}
+	if !j.finished.IsZero() {
+		finished := j.finished
+		s.FinishedAt = &finished
+	}
+	if j.err != nil {
+		s.Error = j.err.Error()
+	}
+	return s
+}
+
+// file is a candidate duplicate
+type file struct {
+	path    string // as the client names it
+	absPath string
+}
+
+// search groups files by size, then by a hash of their start and finally by a hash of their whole content,
+// so only files that could be duplicates are read in full. Symlinks are not followed.
+func (j *job) search(ctx context.Context, sums *checksum.Service) (*Report, error) {
+	bySize := make(map[int64][]file)
+
+	err := filepath.WalkDir(j.opts.AbsPath, func(p string, d fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			if p == j.opts.AbsPath {
+				// the error names the path on the filesystem, which clients must not see
+				return ErrUnreadable
+			}
+			j.errs.Add(1)
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(j.opts.AbsPath, p)
+		if err != nil {
+			return err
+		}
+		clientPath := path.Join(j.opts.Path, filepath.ToSlash(rel))
+		if j.opts.Allow != nil && !j.opts.Allow(clientPath) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			// removed since its directory was read
+			return nil
+		}
+		j.files.Add(1)
+		j.bytes.Add(info.Size())
+		if info.Size() < j.opts.MinSize {
+			return nil
+		}
+		bySize[info.Size()] = append(bySize[info.Size()], file{path: clientPath, absPath: p})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for size, files := range bySize {
+		if len(files) < 2 {
+			delete(bySize, size)
+			continue
+		}
+		j.candidates.Add(int64(len(files)))
+	}
+	j.phase.Store(PhaseHashing)
+
+	report := &Report{Groups: []Group{}}
+	for size, files := range bySize {
+		// files that differ near the start are told apart without reading them in full
+		byPartial := make(map[string][]file)
+		for _, f := range files {
+			sum, err := partialHash(ctx, f.absPath)
+			if err != nil {
+				if ctxErr := ctx.Err(); ctxErr != nil {
+					return nil, ctxErr
+				}
+				j.errs.Add(1)
+				j.hashed.Add(1)
+				continue
+			}
+			if size <= partialSize {
+				// the whole file was hashed
+				j.hashed.Add(1)
+			}
+			byPartial[sum] = append(byPartial[sum], f)
+		}
+
+		for partial, files := range byPartial {
+			if len(files) < 2 {
+				if size > partialSize {
+					j.hashed.Add(1)
+				}
+				continue
+			}
+
+			byContent := make(map[string][]string)
+			for _, f := range files {
+				sum := partial
+				if size > partialSize {
+					var err error
+					sum, err = sums.File(ctx, f.absPath, checksum.SHA256)
+					j.hashed.Add(1)
+					if err != nil {
+						if ctxErr := ctx.Err(); ctxErr != nil {
+							return nil, ctxErr
+						}
+						j.errs.Add(1)
+						continue
+					}
+				}
+				byContent[sum] = append(byContent[sum], f.path)
+			}
+
+			for sum, paths := range byContent {
+				if len(paths) < 2 {
+					continue
+				}
+				slices.Sort(paths)
+				group := Group{Checksum: sum, Size: size, Paths: paths, Wasted: size * int64(len(paths)-1)}
+				report.Groups = append(report.Groups, group)
+				report.Wasted += group.Wasted
+			}
+		}
+	}
+
+	slices.SortFunc(report.Groups, func(a, b Group) int {
+		return cmp.Or(cmp.Compare(b.Wasted, a.Wasted), cmp.Compare(a.Paths[0], b.Paths[0]))
+	})
+	if len(report.Groups) > maxGroups {
+		report.Groups = report.Groups[:maxGroups]
+	}
+
+	return report, nil
+}
+
+// partialHash is the SHA-256 of the first partialSize bytes of the file at path,
+// for files no larger than that it is the checksum of the whole file
+func partialHash(ctx context.Context, path string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.CopyN(h, f, partialSize); err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
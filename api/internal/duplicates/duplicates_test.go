@@ -0,0 +1,206 @@
+package duplicates
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josepheid/file-explorer/api/internal/checksum"
+)
+
+// makeTree creates files with the given contents, creating their directories along the way
+func makeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// wait polls the search until it is no longer running
+func wait(t *testing.T, m *Manager, owner string, opts Options) Job {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := m.Run(owner, opts, false)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		if job.Status != StatusRunning {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("search did not finish")
+	return Job{}
+}
+
+func TestRun(t *testing.T) {
+	// large files share their start, so only the full hash tells them apart
+	large := strings.Repeat("x", partialSize+10)
+	root := makeTree(t, map[string]string{
+		"a.txt":           "abc",
+		"copies/a.txt":    "abc",
+		"copies/deep/b":   "abc",
+		"other.txt":       "abd",
+		"large/one.bin":   large + "1",
+		"large/two.bin":   large + "1",
+		"large/three.bin": large + "2",
+		"empty/one":       "",
+		"empty/two":       "",
+		"unique-size.txt": "abcdef",
+	})
+
+	m := New(checksum.New())
+	defer m.Close()
+
+	job := wait(t, m, "testuser", Options{Path: "/data", AbsPath: root, MinSize: DefaultMinSize})
+	if job.Status != StatusDone || job.Report == nil || job.FinishedAt == nil {
+		t.Fatalf("unexpected job %+v", job)
+	}
+
+	wantProgress := Progress{Phase: PhaseHashing, Files: 10, Bytes: int64(12 + 3*len(large) + 3 + 6), Candidates: 7, Hashed: 7}
+	if job.Progress != wantProgress {
+		t.Errorf("progress = %+v, want %+v", job.Progress, wantProgress)
+	}
+
+	groups := job.Report.Groups
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 groups, got %+v", groups)
+	}
+	size := int64(len(large) + 1)
+	if groups[0].Size != size || groups[0].Wasted != size || len(groups[0].Paths) != 2 ||
+		groups[0].Paths[0] != "/data/large/one.bin" || groups[0].Paths[1] != "/data/large/two.bin" {
+		t.Errorf("unexpected large group %+v", groups[0])
+	}
+	wantPaths := []string{"/data/a.txt", "/data/copies/a.txt", "/data/copies/deep/b"}
+	if groups[1].Checksum != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" || groups[1].Wasted != 6 ||
+		strings.Join(groups[1].Paths, ",") != strings.Join(wantPaths, ",") {
+		t.Errorf("unexpected small group %+v", groups[1])
+	}
+	if job.Report.Wasted != size+6 {
+		t.Errorf("wasted = %d, want %d", job.Report.Wasted, size+6)
+	}
+}
+
+func TestRunAllow(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"public/a.txt":  "abc",
+		"public/b.txt":  "abc",
+		"private/a.txt": "abc",
+	})
+
+	m := New(checksum.New())
+	defer m.Close()
+
+	allow := func(p string) bool { return !strings.HasPrefix(p, "/private/") }
+	job := wait(t, m, "testuser", Options{Path: "/", AbsPath: root, MinSize: 1, Allow: allow})
+	if job.Status != StatusDone || len(job.Report.Groups) != 1 {
+		t.Fatalf("unexpected job %+v", job)
+	}
+	if paths := job.Report.Groups[0].Paths; len(paths) != 2 || paths[0] != "/public/a.txt" || paths[1] != "/public/b.txt" {
+		t.Errorf("unexpected paths %v", paths)
+	}
+	if job.Progress.Files != 2 {
+		t.Errorf("expected rejected files not to be counted, got %d", job.Progress.Files)
+	}
+}
+
+func TestRunShared(t *testing.T) {
+	root := makeTree(t, map[string]string{"a.txt": "abc"})
+
+	m := New(checksum.New())
+	defer m.Close()
+
+	opts := Options{Path: "/", AbsPath: root, MinSize: 1}
+	first := wait(t, m, "testuser", opts)
+
+	// polling returns the same search
+	again, err := m.Run("testuser", opts, false)
+	if err != nil || again.ID != first.ID {
+		t.Errorf("Run() = %s, %v, want the finished search %s", again.ID, err, first.ID)
+	}
+
+	// other users and other minimum sizes get their own
+	other, err := m.Run("otheruser", opts, false)
+	if err != nil || other.ID == first.ID {
+		t.Errorf("Run() = %s, %v for another user, want a new search", other.ID, err)
+	}
+	larger, err := m.Run("testuser", Options{Path: "/", AbsPath: root, MinSize: 2}, false)
+	if err != nil || larger.ID == first.ID {
+		t.Errorf("Run() = %s, %v with another minimum size, want a new search", larger.ID, err)
+	}
+
+	// refresh starts over, once a slot frees up
+	wait(t, m, "otheruser", opts)
+	wait(t, m, "testuser", Options{Path: "/", AbsPath: root, MinSize: 2})
+	refreshed, err := m.Run("testuser", opts, true)
+	if err != nil || refreshed.ID == first.ID {
+		t.Errorf("Run() = %s, %v with refresh, want a new search", refreshed.ID, err)
+	}
+}
+
+func TestRunFailed(t *testing.T) {
+	m := New(checksum.New())
+	defer m.Close()
+
+	missing := filepath.Join(t.TempDir(), "missing")
+	job := wait(t, m, "testuser", Options{Path: "/missing", AbsPath: missing})
+	if job.Status != StatusFailed || job.Error != ErrUnreadable.Error() {
+		t.Errorf("unexpected job %+v", job)
+	}
+}
+
+func TestCancelAndClose(t *testing.T) {
+	files := make(map[string]string)
+	for i := range 200 {
+		files[filepath.Join("dir", string(rune('a'+i%26)), string(rune('a'+i/26))+".txt")] = "abc"
+	}
+	root := makeTree(t, files)
+
+	m := New(checksum.New())
+	opts := Options{Path: "/", AbsPath: root, MinSize: 1}
+	if _, err := m.Run("testuser", opts, false); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	m.Cancel("testuser", "/")
+
+	job := wait(t, m, "testuser", opts)
+	if job.Status != StatusCancelled && job.Status != StatusDone {
+		t.Errorf("unexpected status %s after cancelling", job.Status)
+	}
+
+	m.Close()
+	if _, err := m.Run("testuser", opts, true); err != ErrClosed {
+		t.Errorf("Run() error = %v after Close, want ErrClosed", err)
+	}
+}
+
+func TestRunBusy(t *testing.T) {
+	m := New(checksum.New())
+	defer m.Close()
+
+	// hold every slot without walking anything
+	m.mu.Lock()
+	m.running = maxRunning
+	m.mu.Unlock()
+
+	if _, err := m.Run("testuser", Options{Path: "/", AbsPath: t.TempDir()}, false); err != ErrBusy {
+		t.Errorf("Run() error = %v, want ErrBusy", err)
+	}
+
+	m.mu.Lock()
+	m.running = 0
+	m.mu.Unlock()
+}
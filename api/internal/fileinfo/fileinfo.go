@@ -0,0 +1,90 @@
+package fileinfo
+
+import (
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// sniffLen is the number of bytes read to detect the type of files without a known extension
+const sniffLen = 512
+
+// Info is the metadata of a single file, directory or symlink
+type Info struct {
+	Name    string
+	Mode    fs.FileMode
+	Size    int64
+	ModTime time.Time
+	// AccessTime, ChangeTime and BirthTime are zero where the platform or filesystem does not record them
+	AccessTime time.Time
+	ChangeTime time.Time
+	BirthTime  time.Time
+	// Owner is nil on platforms without numeric owners
+	Owner *Owner
+	// Xattrs holds the extended attributes the server can read, it is nil where they are not supported
+	Xattrs map[string][]byte
+}
+
+// Owner is the user and group owning a file, the names are empty for IDs without an account
+type Owner struct {
+	UID   int
+	GID   int
+	User  string
+	Group string
+}
+
+// Lstat returns the metadata of the file at path, symlinks are not followed
+func Lstat(path string) (*Info, error) {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &Info{
+		Name:    fi.Name(),
+		Mode:    fi.Mode(),
+		Size:    fi.Size(),
+		ModTime: fi.ModTime(),
+	}
+	addPlatformInfo(path, fi, info)
+	return info, nil
+}
+
+// MIMEType guesses the media type of the regular file at path from its extension, or from its first bytes for
+// extensions without a known type. It returns "" if the file cannot be read.
+func MIMEType(path string) string {
+	if mimeType := mime.TypeByExtension(filepath.Ext(path)); mimeType != "" {
+		return mimeType
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	sniff := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, sniff)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return ""
+	}
+	return http.DetectContentType(sniff[:n])
+}
+
+// lookupOwner returns the owner with the given IDs, along with their names where they have accounts
+func lookupOwner(uid, gid int) *Owner {
+	owner := &Owner{UID: uid, GID: gid}
+	if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+		owner.User = u.Username
+	}
+	if g, err := user.LookupGroupId(strconv.Itoa(gid)); err == nil {
+		owner.Group = g.Name
+	}
+	return owner
+}
@@ -0,0 +1,72 @@
+//go:build linux
+
+package fileinfo
+
+import (
+	"io/fs"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// addPlatformInfo fills in the access, change and birth times, owner and extended attributes of the file at path
+func addPlatformInfo(path string, fi fs.FileInfo, info *Info) {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		info.AccessTime = time.Unix(st.Atim.Unix())
+		info.ChangeTime = time.Unix(st.Ctim.Unix())
+		info.Owner = lookupOwner(int(st.Uid), int(st.Gid))
+	}
+
+	// only statx reports birth times, and only for filesystems that record them
+	var stx unix.Statx_t
+	err := unix.Statx(unix.AT_FDCWD, path, unix.AT_SYMLINK_NOFOLLOW|unix.AT_STATX_SYNC_AS_STAT, unix.STATX_BTIME, &stx)
+	if err == nil && stx.Mask&unix.STATX_BTIME != 0 {
+		info.BirthTime = time.Unix(stx.Btime.Sec, int64(stx.Btime.Nsec))
+	}
+
+	info.Xattrs = xattrs(path)
+}
+
+// xattrs reads the extended attributes of the file at path without following symlinks,
+// attributes that cannot be read, e.g. for lack of permission, are left out
+func xattrs(path string) map[string][]byte {
+	size, err := unix.Llistxattr(path, nil)
+	if err != nil || size == 0 {
+		return nil
+	}
+	list := make([]byte, size)
+	size, err = unix.Llistxattr(path, list)
+	if err != nil {
+		return nil
+	}
+
+	attrs := make(map[string][]byte)
+	for _, name := range strings.Split(string(list[:size]), "\x00") {
+		if name == "" {
+			continue
+		}
+		if value, err := xattr(path, name); err == nil {
+			attrs[name] = value
+		}
+	}
+	if len(attrs) == 0 {
+		return nil
+	}
+	return attrs
+}
+
+// xattr reads the extended attribute name of the file at path without following symlinks
+func xattr(path, name string) ([]byte, error) {
+	size, err := unix.Lgetxattr(path, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	value := make([]byte, size)
+	size, err = unix.Lgetxattr(path, name, value)
+	if err != nil {
+		return nil, err
+	}
+	return value[:size], nil
+}
@@ -0,0 +1,31 @@
+package fileinfo
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestLstatXattrs(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "tagged.txt")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := unix.Setxattr(file, "user.comment", []byte("quarterly report"), 0); err != nil {
+		if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EPERM) {
+			t.Skipf("user extended attributes not supported: %v", err)
+		}
+		t.Fatal(err)
+	}
+
+	info, err := Lstat(file)
+	if err != nil {
+		t.Fatalf("Lstat() error = %v", err)
+	}
+	if got := string(info.Xattrs["user.comment"]); got != "quarterly report" {
+		t.Errorf("Xattrs = %q, want user.comment", info.Xattrs)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package fileinfo
+
+import "io/fs"
+
+// addPlatformInfo does nothing, only the metadata os.Lstat reports on every platform is available
+func addPlatformInfo(path string, fi fs.FileInfo, info *Info) {}
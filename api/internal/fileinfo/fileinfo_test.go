@@ -0,0 +1,101 @@
+package fileinfo
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestLstat(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(file, []byte("hello"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(file, 0640); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(file, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := Lstat(file)
+	if err != nil {
+		t.Fatalf("Lstat() error = %v", err)
+	}
+	if info.Name != "notes.txt" || info.Size != 5 || !info.Mode.IsRegular() || info.Mode.Perm() != 0640 {
+		t.Errorf("Lstat() = %+v, want a regular file of 5 bytes with mode 0640", info)
+	}
+	if !info.ModTime.Equal(modTime) {
+		t.Errorf("ModTime = %v, want %v", info.ModTime, modTime)
+	}
+
+	if runtime.GOOS == "linux" {
+		if !info.AccessTime.Equal(modTime) {
+			t.Errorf("AccessTime = %v, want %v", info.AccessTime, modTime)
+		}
+		if info.ChangeTime.IsZero() {
+			t.Error("ChangeTime is zero")
+		}
+		if info.Owner == nil || info.Owner.UID != os.Getuid() || info.Owner.GID != os.Getgid() {
+			t.Errorf("Owner = %+v, want the user running the test", info.Owner)
+		}
+	}
+}
+
+func TestLstatSymlink(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "docs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink("docs", link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	info, err := Lstat(link)
+	if err != nil {
+		t.Fatalf("Lstat() error = %v", err)
+	}
+	if info.Mode&os.ModeSymlink == 0 {
+		t.Errorf("Mode = %v, want a symlink", info.Mode)
+	}
+
+	if _, err := Lstat(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("Lstat() of a missing file error = %v, want not exist", err)
+	}
+}
+
+func TestMIMEType(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"page.html": []byte("<p>hi</p>"),
+		"image":     []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"),
+		"empty":     nil,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"page.html", "text/html; charset=utf-8"},
+		{"image", "image/png"},
+		{"empty", "text/plain; charset=utf-8"},
+		{"missing", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MIMEType(filepath.Join(dir, tt.name)); got != tt.want {
+				t.Errorf("MIMEType() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
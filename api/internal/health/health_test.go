@@ -0,0 +1,106 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckerRun(t *testing.T) {
+	ok := Check{Name: "ok", Func: func(ctx context.Context) error { return nil }}
+	failing := Check{Name: "failing", Func: func(ctx context.Context) error { return errors.New("broken") }}
+	hanging := Check{Name: "hanging", Func: func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}}
+
+	tests := []struct {
+		name       string
+		checks     []Check
+		wantStatus string
+		wantChecks map[string]string
+	}{
+		{
+			name:       "all passing",
+			checks:     []Check{ok},
+			wantStatus: StatusOK,
+			wantChecks: map[string]string{"ok": StatusOK},
+		},
+		{
+			name:       "one failing",
+			checks:     []Check{ok, failing},
+			wantStatus: StatusFail,
+			wantChecks: map[string]string{"ok": StatusOK, "failing": StatusFail},
+		},
+		{
+			name:       "timeout",
+			checks:     []Check{ok, hanging},
+			wantStatus: StatusFail,
+			wantChecks: map[string]string{"ok": StatusOK, "hanging": StatusFail},
+		},
+		{
+			name:       "no checks",
+			wantStatus: StatusOK,
+			wantChecks: map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := NewChecker(tt.checks...)
+			checker.timeout = 50 * time.Millisecond
+
+			report := checker.Run(context.Background())
+			if report.Status != tt.wantStatus {
+				t.Errorf("Status = %q, want %q", report.Status, tt.wantStatus)
+			}
+			if len(report.Checks) != len(tt.wantChecks) {
+				t.Fatalf("got %d check results, want %d", len(report.Checks), len(tt.wantChecks))
+			}
+			for name, want := range tt.wantChecks {
+				result := report.Checks[name]
+				if result.Status != want {
+					t.Errorf("check %s status = %q, want %q", name, result.Status, want)
+				}
+				if (want == StatusFail) != (result.Error != "") {
+					t.Errorf("check %s error = %q", name, result.Error)
+				}
+			}
+		})
+	}
+}
+
+func TestDirectoryReadable(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file.txt")
+	if err := os.WriteFile(file, []byte("test"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	empty := filepath.Join(dir, "empty")
+	if err := os.Mkdir(empty, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{name: "directory", path: dir},
+		{name: "empty directory", path: empty},
+		{name: "file", path: file, wantErr: true},
+		{name: "missing", path: filepath.Join(dir, "missing"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := DirectoryReadable(tt.path)(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DirectoryReadable() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "file_explorer"
+
+// Login methods used to label login failures
+const (
+	LoginPassword = "password"
+	LoginTOTP     = "totp"
+	LoginOIDC     = "oidc"
+)
+
+// Metrics collects the server's Prometheus metrics in its own registry.
+// All methods are safe to call on a nil *Metrics, so code paths can record metrics unconditionally.
+type Metrics struct {
+	registry       *prometheus.Registry
+	requests       *prometheus.CounterVec
+	duration       *prometheus.HistogramVec
+	bytes          *prometheus.CounterVec
+	loginFailures  *prometheus.CounterVec
+	listingEntries prometheus.Histogram
+}
+
+// New creates the server metrics, activeSessions is called on every scrape to report the number of sessions
+func New(activeSessions func() int) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests handled, by route pattern, method and status code.",
+		}, []string{"route", "method", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency, by route pattern, method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_response_bytes_total",
+			Help:      "Response body bytes served, by route pattern.",
+		}, []string{"route"}),
+		loginFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "login_failures_total",
+			Help:      "Failed login attempts, by login method.",
+		}, []string{"method"}),
+		listingEntries: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "directory_listing_entries",
+			Help:      "Number of entries in directory listings served.",
+			Buckets:   prometheus.ExponentialBuckets(1, 4, 8),
+		}),
+	}
+
+	m.registry.MustRegister(
+		m.requests,
+		m.duration,
+		m.bytes,
+		m.loginFailures,
+		m.listingEntries,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "active_sessions",
+			Help:      "Number of unexpired login sessions.",
+		}, func() float64 { return float64(activeSessions()) }),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	// pre-create the labelled series so they are exported as zero before the first failure
+	for _, method := range []string{LoginPassword, LoginTOTP, LoginOIDC} {
+		m.loginFailures.WithLabelValues(method)
+	}
+
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// ObserveRequest records a completed HTTP request
+func (m *Metrics) ObserveRequest(route, method string, status int, bytes int64, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	code := strconv.Itoa(status)
+	m.requests.WithLabelValues(route, method, code).Inc()
+	m.duration.WithLabelValues(route, method, code).Observe(duration.Seconds())
+	m.bytes.WithLabelValues(route).Add(float64(bytes))
+}
+
+// LoginFailed records a failed login attempt using one of the Login methods
+func (m *Metrics) LoginFailed(method string) {
+	if m == nil {
+		return
+	}
+	m.loginFailures.WithLabelValues(method).Inc()
+}
+
+// ObserveListing records the number of entries in a directory listing
+func (m *Metrics) ObserveListing(entries int) {
+	if m == nil {
+		return
+	}
+	m.listingEntries.Observe(float64(entries))
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying m, so handlers can record metrics through FromContext
+func NewContext(ctx context.Context, m *Metrics) context.Context {
+	return context.WithValue(ctx, contextKey{}, m)
+}
+
+// FromContext returns the metrics stored in ctx, or nil if metrics are disabled
+func FromContext(ctx context.Context) *Metrics {
+	m, _ := ctx.Value(contextKey{}).(*Metrics)
+	return m
+}
@@ -0,0 +1,129 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// scrape fetches the metrics over HTTP and parses them the way a Prometheus server would
+func scrape(t *testing.T, m *Metrics) map[string]*dto.MetricFamily {
+	t.Helper()
+
+	srv := httptest.NewServer(m.Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("scrape failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("scrape returned status %d", resp.StatusCode)
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to parse metrics: %v", err)
+	}
+	return families
+}
+
+// series returns the metric in family name whose labels include all of labels
+func series(t *testing.T, families map[string]*dto.MetricFamily, name string, labels map[string]string) *dto.Metric {
+	t.Helper()
+
+	family, ok := families[name]
+	if !ok {
+		t.Fatalf("metric %s not exported", name)
+	}
+	for _, metric := range family.GetMetric() {
+		matched := 0
+		for _, pair := range metric.GetLabel() {
+			if value, ok := labels[pair.GetName()]; ok && value == pair.GetValue() {
+				matched++
+			}
+		}
+		if matched == len(labels) {
+			return metric
+		}
+	}
+	t.Fatalf("no %s series with labels %v", name, labels)
+	return nil
+}
+
+func TestMetrics(t *testing.T) {
+	sessions := 3
+	m := New(func() int { return sessions })
+
+	m.ObserveRequest("GET /api/v1/browse", "GET", 200, 512, 20*time.Millisecond)
+	m.ObserveRequest("GET /api/v1/browse", "GET", 200, 256, 40*time.Millisecond)
+	m.ObserveRequest("GET /api/v1/browse", "GET", 404, 64, time.Millisecond)
+	m.LoginFailed(LoginPassword)
+	m.LoginFailed(LoginPassword)
+	m.ObserveListing(10)
+
+	families := scrape(t, m)
+
+	requests := series(t, families, "file_explorer_http_requests_total", map[string]string{"route": "GET /api/v1/browse", "status": "200"})
+	if got := requests.GetCounter().GetValue(); got != 2 {
+		t.Errorf("requests = %v, want 2", got)
+	}
+
+	duration := series(t, families, "file_explorer_http_request_duration_seconds", map[string]string{"route": "GET /api/v1/browse", "status": "200"})
+	if got := duration.GetHistogram().GetSampleCount(); got != 2 {
+		t.Errorf("duration samples = %v, want 2", got)
+	}
+
+	bytes := series(t, families, "file_explorer_http_response_bytes_total", map[string]string{"route": "GET /api/v1/browse"})
+	if got := bytes.GetCounter().GetValue(); got != 832 {
+		t.Errorf("bytes = %v, want 832", got)
+	}
+
+	failures := series(t, families, "file_explorer_login_failures_total", map[string]string{"method": LoginPassword})
+	if got := failures.GetCounter().GetValue(); got != 2 {
+		t.Errorf("login failures = %v, want 2", got)
+	}
+	totpFailures := series(t, families, "file_explorer_login_failures_total", map[string]string{"method": LoginTOTP})
+	if got := totpFailures.GetCounter().GetValue(); got != 0 {
+		t.Errorf("totp login failures = %v, want 0", got)
+	}
+
+	listing := series(t, families, "file_explorer_directory_listing_entries", nil)
+	if got := listing.GetHistogram().GetSampleSum(); got != 10 {
+		t.Errorf("listing entries = %v, want 10", got)
+	}
+
+	active := series(t, families, "file_explorer_active_sessions", nil)
+	if got := active.GetGauge().GetValue(); got != 3 {
+		t.Errorf("active sessions = %v, want 3", got)
+	}
+
+	// the gauge is evaluated on every scrape
+	sessions = 1
+	active = series(t, scrape(t, m), "file_explorer_active_sessions", nil)
+	if got := active.GetGauge().GetValue(); got != 1 {
+		t.Errorf("active sessions after logout = %v, want 1", got)
+	}
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+	m.ObserveRequest("/", "GET", 200, 1, time.Millisecond)
+	m.LoginFailed(LoginOIDC)
+	m.ObserveListing(1)
+
+	if got := FromContext(context.Background()); got != nil {
+		t.Errorf("FromContext() = %v, want nil", got)
+	}
+	if got := FromContext(NewContext(context.Background(), m)); got != nil {
+		t.Errorf("FromContext() = %v, want nil", got)
+	}
+}
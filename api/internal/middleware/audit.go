@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/josepheid/file-explorer/api/internal/audit"
+)
+
+// Audit records every request to the wrapped handler in the audit log under the given action.
+// It should wrap RequireAuth so that requests rejected as unauthorized are recorded too.
+// If auditLog is nil requests are not recorded.
+func Audit(auditLog *audit.Log, action string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if auditLog == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			r, info := withRequestInfo(r)
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r)
+
+			requested := info.path
+			if requested == "" {
+				requested = requestedPath(r)
+			}
+			err := auditLog.Record(audit.Event{
+				Time:        start.UTC(),
+				Action:      action,
+				UserID:      info.user,
+				ClientIP:    clientIP(r),
+				Method:      r.Method,
+				Path:        requested,
+				Destination: info.destination,
+				Outcome:     outcome(sw.Status()),
+				Status:      sw.Status(),
+				LatencyMS:   float64(time.Since(start).Microseconds()) / 1000,
+			})
+			if err != nil {
+				LoggerFromContext(r.Context()).Error("failed to record audit event", slog.Any("error", err))
+			}
+		})
+	}
+}
+
+func outcome(status int) string {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return audit.OutcomeDenied
+	case status >= 400:
+		return audit.OutcomeFailure
+	default:
+		return audit.OutcomeSuccess
+	}
+}
+
+// requestedPath returns the file path a request refers to in its path query parameter, if any
+func requestedPath(r *http.Request) string {
+	p := r.URL.Query().Get("path")
+	if p == "" {
+		return ""
+	}
+	return path.Clean("/" + p)
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/josepheid/file-explorer/api/internal/audit"
+	"github.com/josepheid/file-explorer/api/internal/sessions"
+)
+
+func TestAudit(t *testing.T) {
+	auditLog, err := audit.New(filepath.Join(t.TempDir(), "audit.log"), 1<<20, 1)
+	if err != nil {
+		t.Fatalf("audit.New() error = %v", err)
+	}
+	defer auditLog.Close()
+
+	session := sessions.New()
+	s, _ := session.Create("testuser")
+
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := Audit(auditLog, "browse")(RequireAuth(session)(okHandler))
+
+	tests := []struct {
+		name        string
+		cookie      *http.Cookie
+		wantUser    string
+		wantOutcome string
+		wantStatus  int
+	}{
+		{
+			name:        "authenticated",
+			cookie:      &http.Cookie{Name: "session_id", Value: s.ID},
+			wantUser:    "testuser",
+			wantOutcome: audit.OutcomeSuccess,
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "unauthenticated",
+			wantOutcome: audit.OutcomeDenied,
+			wantStatus:  http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/v1/browse?path=builds/../logs", nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			events, err := auditLog.Query(audit.Filter{Limit: 1})
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			if len(events) != 1 {
+				t.Fatalf("expected 1 event, got %d", len(events))
+			}
+			e := events[0]
+			if e.Action != "browse" || e.UserID != tt.wantUser || e.Outcome != tt.wantOutcome || e.Status != tt.wantStatus {
+				t.Errorf("unexpected event %+v", e)
+			}
+			if e.ClientIP != "192.0.2.1" || e.Path != "/logs" || e.Method != "GET" {
+				t.Errorf("unexpected request details %+v", e)
+			}
+		})
+	}
+}
+
+func TestAuditDisabled(t *testing.T) {
+	called := false
+	handler := Audit(nil, "browse")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetUser(r.Context(), "testuser")
+		called = true
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if !called {
+		t.Error("expected wrapped handler to be called")
+	}
+}
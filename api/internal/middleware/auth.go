@@ -1,24 +1,244 @@
 package middleware
 
 import (
+	"context"
+	"crypto/x509"
 	"net/http"
+	"slices"
+	"strings"
 
 	"github.com/josepheid/file-explorer/api/internal/respond"
 	"github.com/josepheid/file-explorer/api/internal/sessions"
+	"github.com/josepheid/file-explorer/api/internal/tokens"
 )
 
-func RequireAuth(ss *sessions.Service) func(http.Handler) http.Handler {
+// Authentication methods recorded on an Identity
+const (
+	MethodSession     = "session"
+	MethodCertificate = "certificate"
+	MethodToken       = "token"
+	MethodBasic       = "basic"
+	// MethodPassword and MethodPublicKey are used by the SFTP server, which does not go through RequireAuth
+	MethodPassword  = "password"
+	MethodPublicKey = "publickey"
+)
+
+// Identity describes the authenticated caller of a request
+type Identity struct {
+	// UserID identifies the authenticated user
+	UserID string
+	// Method is the authentication method that was used, e.g. MethodSession
+	Method string
+	// Scopes limits what the caller may do, nil means unrestricted
+	Scopes []string
+	// Path restricts the caller to a subtree of the root directory, empty means unrestricted
+	Path string
+}
+
+// HasScope reports whether the identity has been granted scope
+func (i Identity) HasScope(scope string) bool {
+	return i.Scopes == nil || tokens.Allows(i.Scopes, scope)
+}
+
+// AllowsPath reports whether the identity may access the cleaned, slash separated path p
+func (i Identity) AllowsPath(p string) bool {
+	if i.Path == "" || i.Path == "/" {
+		return true
+	}
+	return p == i.Path || strings.HasPrefix(p, i.Path+"/")
+}
+
+type identityKey struct{}
+
+// IdentityFromContext returns the identity stored in the context by RequireAuth
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
+
+// WithIdentity returns a copy of ctx carrying the given identity
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+type reauthenticateKey struct{}
+
+// StillAuthenticated reports whether the credentials RequireAuth accepted for a request are still valid, i.e. the
+// session has not been logged out or expired and the token has not been revoked or expired. Long running handlers
+// such as streams call it periodically. It reports true for requests that did not pass through RequireAuth.
+func StillAuthenticated(ctx context.Context) bool {
+	reauthenticate, ok := ctx.Value(reauthenticateKey{}).(func() bool)
+	return !ok || reauthenticate()
+}
+
+// CertificateMapper maps a verified client certificate to a user
+type CertificateMapper interface {
+	UserForCertificate(cert *x509.Certificate) (string, error)
+}
+
+// Option configures the additional authentication methods accepted by RequireAuth
+type Option func(*authConfig)
+
+// CredentialValidator checks a username and password, e.g. an auth.Authenticator
+type CredentialValidator interface {
+	ValidateCredentials(username, password string) error
+}
+
+type authConfig struct {
+	certs        CertificateMapper
+	tokens       *tokens.Service
+	credentials  CredentialValidator
+	secondFactor func(userID string) bool
+	realm        string
+}
+
+// WithClientCertificates makes RequireAuth accept requests that presented a client certificate
+// verified by the TLS layer, as long as the certificate maps to a known user
+func WithClientCertificates(certs CertificateMapper) Option {
+	return func(c *authConfig) {
+		c.certs = certs
+	}
+}
+
+// WithTokens makes RequireAuth accept personal access tokens sent as "Authorization: Bearer <token>"
+func WithTokens(ts *tokens.Service) Option {
+	return func(c *authConfig) {
+		c.tokens = ts
+	}
+}
+
+// WithBasicAuth makes RequireAuth accept "Authorization: Basic" credentials, for clients such as WebDAV file managers
+// that cannot log in first. The password is either the user's password, checked with credentials, or a personal
+// access token if WithTokens is also given, in which case the username is ignored. Users for whom secondFactor
+// reports true have to use a token, since their password alone is not enough to log in.
+// Unauthorized responses carry a Basic challenge for realm so clients prompt for credentials.
+func WithBasicAuth(credentials CredentialValidator, secondFactor func(userID string) bool, realm string) Option {
+	return func(c *authConfig) {
+		c.credentials = credentials
+		c.secondFactor = secondFactor
+		c.realm = realm
+	}
+}
+
+func RequireAuth(ss *sessions.Service, opts ...Option) func(http.Handler) http.Handler {
+	var cfg authConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity, ok := cfg.authenticate(ss, r)
+			if !ok {
+				if cfg.realm != "" {
+					w.Header().Set("WWW-Authenticate", `Basic realm="`+cfg.realm+`", charset="UTF-8"`)
+				}
+				respond.WithError(w, r, respond.CodeUnauthorized, "Unauthorized")
+				return
+			}
+
+			SetUser(r.Context(), identity.UserID)
+			ctx := context.WithValue(WithIdentity(r.Context(), identity), reauthenticateKey{}, func() bool {
+				current, ok := cfg.authenticate(ss, r)
+				return ok && current.UserID == identity.UserID
+			})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// authenticate tries each enabled authentication method in turn.
+// An Authorization header is always authoritative: if one is sent it must hold a valid token or, with basic auth
+// enabled, valid credentials.
+func (c *authConfig) authenticate(ss *sessions.Service, r *http.Request) (Identity, bool) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, secret, _ := strings.Cut(header, " ")
+		if c.credentials != nil && strings.EqualFold(scheme, "Basic") {
+			return c.authenticateBasic(r)
+		}
+		if c.tokens == nil || !strings.EqualFold(scheme, "Bearer") {
+			return Identity{}, false
+		}
+
+		token, err := c.tokens.Validate(strings.TrimSpace(secret))
+		if err != nil {
+			return Identity{}, false
+		}
+		return Identity{UserID: token.UserID, Method: MethodToken, Scopes: token.Scopes, Path: token.Path}, true
+	}
+
+	if cookie, err := r.Cookie("session_id"); err == nil {
+		session := ss.Get(cookie.Value)
+		if session.ID != "" {
+			return Identity{UserID: session.UserID, Method: MethodSession}, true
+		}
+	}
+
+	// Only certificates that were verified against the configured CA bundle are considered
+	if c.certs != nil && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		user, err := c.certs.UserForCertificate(r.TLS.VerifiedChains[0][0])
+		if err == nil {
+			return Identity{UserID: user, Method: MethodCertificate}, true
+		}
+	}
+
+	return Identity{}, false
+}
+
+// authenticateBasic checks the credentials of a request using basic auth
+func (c *authConfig) authenticateBasic(r *http.Request) (Identity, bool) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return Identity{}, false
+	}
+
+	if c.tokens != nil {
+		if token, err := c.tokens.Validate(password); err == nil {
+			return Identity{UserID: token.UserID, Method: MethodToken, Scopes: token.Scopes, Path: token.Path}, true
+		}
+	}
+
+	if c.credentials.ValidateCredentials(username, password) != nil {
+		return Identity{}, false
+	}
+	if c.secondFactor != nil && c.secondFactor(username) {
+		return Identity{}, false
+	}
+	return Identity{UserID: username, Method: MethodBasic}, true
+}
+
+// RequireAdmin rejects requests from users not listed in admins, or using a token without admin scope.
+// It must be used after RequireAuth.
+func RequireAdmin(admins []string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			cookie, err := r.Cookie("session_id")
-			if err != nil {
-				respond.WithError(w, "Unauthorized", http.StatusUnauthorized)
+			identity, ok := IdentityFromContext(r.Context())
+			if !ok {
+				respond.WithError(w, r, respond.CodeUnauthorized, "Unauthorized")
+				return
+			}
+			if !identity.HasScope(tokens.ScopeAdmin) || !slices.Contains(admins, identity.UserID) {
+				respond.WithError(w, r, respond.CodeForbidden, "Forbidden")
 				return
 			}
 
-			session := ss.Get(cookie.Value)
-			if session == (sessions.Session{}) {
-				respond.WithError(w, "Unauthorized", http.StatusUnauthorized)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireScope rejects requests whose identity has not been granted scope.
+// It must be used after RequireAuth.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity, ok := IdentityFromContext(r.Context())
+			if !ok {
+				respond.WithError(w, r, respond.CodeUnauthorized, "Unauthorized")
+				return
+			}
+			if !identity.HasScope(scope) {
+				respond.WithError(w, r, respond.CodeForbidden, "Forbidden")
 				return
 			}
 
@@ -1,11 +1,16 @@
 package middleware
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/josepheid/file-explorer/api/internal/sessions"
+	"github.com/josepheid/file-explorer/api/internal/tokens"
 )
 
 func TestRequireAuth(t *testing.T) {
@@ -58,3 +63,350 @@ func TestRequireAuth(t *testing.T) {
 		})
 	}
 }
+
+func TestStillAuthenticated(t *testing.T) {
+	session := sessions.New()
+	s, _ := session.Create("testuser")
+
+	// the handler stands in for a stream, checking the session again after the user logged out
+	var before, after bool
+	handler := RequireAuth(session)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		before = StillAuthenticated(r.Context())
+		session.Delete(s.ID)
+		after = StillAuthenticated(r.Context())
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: s.ID})
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !before || after {
+		t.Errorf("StillAuthenticated() = %v before and %v after logout, want true then false", before, after)
+	}
+	if !StillAuthenticated(req.Context()) {
+		t.Error("StillAuthenticated() = false for a request RequireAuth did not authenticate")
+	}
+}
+
+type stubCertificateMapper map[string]string
+
+func (m stubCertificateMapper) UserForCertificate(cert *x509.Certificate) (string, error) {
+	user, ok := m[cert.Subject.CommonName]
+	if !ok {
+		return "", errors.New("unknown certificate")
+	}
+	return user, nil
+}
+
+func TestRequireAuthClientCertificate(t *testing.T) {
+	session := sessions.New()
+	certs := stubCertificateMapper{"ci-runner": "testuser"}
+
+	verified := func(cn string) *tls.ConnectionState {
+		return &tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: cn}}}},
+		}
+	}
+
+	tests := []struct {
+		name           string
+		opts           []Option
+		tls            *tls.ConnectionState
+		expectedStatus int
+		expectedUser   string
+	}{
+		{
+			name:           "verified certificate",
+			opts:           []Option{WithClientCertificates(certs)},
+			tls:            verified("ci-runner"),
+			expectedStatus: http.StatusOK,
+			expectedUser:   "testuser",
+		},
+		{
+			name:           "certificate for unknown user",
+			opts:           []Option{WithClientCertificates(certs)},
+			tls:            verified("stranger"),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "unverified certificate",
+			opts:           []Option{WithClientCertificates(certs)},
+			tls:            &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "ci-runner"}}}},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "certificates not enabled",
+			tls:            verified("ci-runner"),
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotUser string
+			testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				identity, _ := IdentityFromContext(r.Context())
+				gotUser = identity.UserID
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.TLS = tt.tls
+
+			rr := httptest.NewRecorder()
+			RequireAuth(session, tt.opts...)(testHandler).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if gotUser != tt.expectedUser {
+				t.Errorf("expected user %q, got %q", tt.expectedUser, gotUser)
+			}
+		})
+	}
+}
+
+func TestRequireAuthBearerToken(t *testing.T) {
+	session := sessions.New()
+	ts := tokens.New()
+	_, secret, err := ts.Create("testuser", "CI", []string{tokens.ScopeRead}, "/builds", nil)
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	valid, _ := session.Create("testuser")
+
+	tests := []struct {
+		name           string
+		header         string
+		cookie         *http.Cookie
+		expectedStatus int
+	}{
+		{
+			name:           "valid token",
+			header:         "Bearer " + secret,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid token",
+			header:         "Bearer fe_invalid",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "invalid token does not fall back to cookie",
+			header:         "Bearer fe_invalid",
+			cookie:         &http.Cookie{Name: "session_id", Value: valid.ID},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "unsupported scheme",
+			header:         "Basic dGVzdHVzZXI6cGFzc3dvcmQxMjM=",
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Identity
+			testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ = IdentityFromContext(r.Context())
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Authorization", tt.header)
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+
+			rr := httptest.NewRecorder()
+			RequireAuth(session, WithTokens(ts))(testHandler).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if rr.Code == http.StatusOK && (got.Method != MethodToken || got.Path != "/builds") {
+				t.Errorf("unexpected identity %+v", got)
+			}
+		})
+	}
+}
+
+// passwords accepts the credentials in the map
+type passwords map[string]string
+
+func (p passwords) ValidateCredentials(username, password string) error {
+	if want, ok := p[username]; !ok || want != password {
+		return errors.New("invalid credentials")
+	}
+	return nil
+}
+
+func TestRequireAuthBasic(t *testing.T) {
+	session := sessions.New()
+	ts := tokens.New()
+	_, secret, err := ts.Create("tokenuser", "DAV", []string{tokens.ScopeRead}, "/builds", nil)
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	credentials := passwords{"testuser": "password123", "totpuser": "password456"}
+	secondFactor := func(userID string) bool { return userID == "totpuser" }
+
+	tests := []struct {
+		name           string
+		username       string
+		password       string
+		expectedStatus int
+		expected       Identity
+	}{
+		{
+			name:           "valid password",
+			username:       "testuser",
+			password:       "password123",
+			expectedStatus: http.StatusOK,
+			expected:       Identity{UserID: "testuser", Method: MethodBasic},
+		},
+		{
+			name:           "wrong password",
+			username:       "testuser",
+			password:       "password124",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "password without second factor",
+			username:       "totpuser",
+			password:       "password456",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "token as password",
+			username:       "anyone",
+			password:       secret,
+			expectedStatus: http.StatusOK,
+			expected:       Identity{UserID: "tokenuser", Method: MethodToken, Scopes: []string{tokens.ScopeRead}, Path: "/builds"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Identity
+			testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ = IdentityFromContext(r.Context())
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest("GET", "/", nil)
+			req.SetBasicAuth(tt.username, tt.password)
+
+			rr := httptest.NewRecorder()
+			RequireAuth(session, WithTokens(ts), WithBasicAuth(credentials, secondFactor, "Files"))(testHandler).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if rr.Code != http.StatusOK {
+				if challenge := rr.Header().Get("WWW-Authenticate"); challenge != `Basic realm="Files", charset="UTF-8"` {
+					t.Errorf("unexpected challenge %q", challenge)
+				}
+				return
+			}
+			if got.UserID != tt.expected.UserID || got.Method != tt.expected.Method || got.Path != tt.expected.Path || len(got.Scopes) != len(tt.expected.Scopes) {
+				t.Errorf("expected identity %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name           string
+		identity       *Identity
+		expectedStatus int
+	}{
+		{
+			name:           "no identity",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "session is unrestricted",
+			identity:       &Identity{UserID: "testuser", Method: MethodSession},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "token with scope",
+			identity:       &Identity{UserID: "testuser", Method: MethodToken, Scopes: []string{tokens.ScopeAdmin}},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "token without scope",
+			identity:       &Identity{UserID: "testuser", Method: MethodToken, Scopes: []string{tokens.ScopeRead}},
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.identity != nil {
+				req = req.WithContext(WithIdentity(req.Context(), *tt.identity))
+			}
+
+			rr := httptest.NewRecorder()
+			RequireScope(tokens.ScopeWrite)(testHandler).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	testHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name           string
+		identity       *Identity
+		expectedStatus int
+	}{
+		{
+			name:           "no identity",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "admin session",
+			identity:       &Identity{UserID: "admin", Method: MethodSession},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "other user",
+			identity:       &Identity{UserID: "testuser", Method: MethodSession},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "admin token without admin scope",
+			identity:       &Identity{UserID: "admin", Method: MethodToken, Scopes: []string{tokens.ScopeRead}},
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.identity != nil {
+				req = req.WithContext(WithIdentity(req.Context(), *tt.identity))
+			}
+
+			rr := httptest.NewRecorder()
+			RequireAdmin([]string{"admin"})(testHandler).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
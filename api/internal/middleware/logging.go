@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// RequestIDHeader carries the request ID, it is propagated from the request or generated,
+// and always set on the response
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds request IDs accepted from clients
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+type loggerKey struct{}
+
+// RequestID assigns every request an ID, reusing a well-formed X-Request-ID header from the client or
+// generating a new one. The ID is set on the response header, where respond.WithError picks it up for error bodies.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// RequestIDFromContext returns the ID assigned by RequestID, if any
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Logging logs every request once it completes with its method, route pattern, status, bytes written,
+// duration and user. Handlers can log with the request's ID attached through LoggerFromContext.
+// It should wrap the router so the matched route pattern is known, and be wrapped by RequestID.
+func Logging(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			reqLogger := logger
+			if id := RequestIDFromContext(r.Context()); id != "" {
+				reqLogger = logger.With(slog.String("request_id", id))
+			}
+			ctx := context.WithValue(r.Context(), loggerKey{}, reqLogger)
+			r, info := withRequestInfo(r.WithContext(ctx))
+
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r)
+
+			level := slog.LevelInfo
+			if sw.Status() >= 500 {
+				level = slog.LevelError
+			}
+			reqLogger.LogAttrs(r.Context(), level, "request",
+				slog.String("method", r.Method),
+				slog.String("route", info.routeOf(r)),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", sw.Status()),
+				slog.Int64("bytes", sw.bytes),
+				slog.Duration("duration", time.Since(start)),
+				slog.String("user", info.user),
+				slog.String("remote_ip", clientIP(r)),
+			)
+		})
+	}
+}
+
+// LoggerFromContext returns the request scoped logger set up by Logging, or the default logger
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		// printable ASCII only, so IDs are safe to echo in headers and logs
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic("failed to generate request ID: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/josepheid/file-explorer/api/internal/respond"
+	"github.com/josepheid/file-explorer/api/internal/sessions"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		wantSame bool
+	}{
+		{name: "generated", header: ""},
+		{name: "propagated", header: "abc-123", wantSame: true},
+		{name: "too long", header: strings.Repeat("a", maxRequestIDLength+1)},
+		{name: "control characters", header: "abc\x01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fromContext string
+			handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fromContext = RequestIDFromContext(r.Context())
+				respond.WithError(w, r, respond.CodePathNotFound, "Path not found")
+			}))
+
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				req.Header.Set(RequestIDHeader, tt.header)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			id := rr.Header().Get(RequestIDHeader)
+			if id == "" || id != fromContext {
+				t.Fatalf("response ID %q does not match context ID %q", id, fromContext)
+			}
+			if tt.wantSame != (id == tt.header) {
+				t.Errorf("unexpected request ID %q for header %q", id, tt.header)
+			}
+
+			var body respond.Error
+			if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+				t.Fatalf("failed to decode error body: %v", err)
+			}
+			if body.RequestID != id {
+				t.Errorf("error body request ID = %q, want %q", body.RequestID, id)
+			}
+		})
+	}
+}
+
+func TestLogging(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	session := sessions.New()
+	s, _ := session.Create("testuser")
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /api/v1/items/{id}", RequireAuth(session)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		LoggerFromContext(r.Context()).Info("handler message")
+		w.Write([]byte("hello"))
+	})))
+	handler := RequestID(Logging(logger)(mux))
+
+	req := httptest.NewRequest("GET", "/api/v1/items/42", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: s.ID})
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 log lines, got %d: %s", len(lines), buf.String())
+	}
+
+	var handlerLine map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &handlerLine); err != nil {
+		t.Fatalf("invalid log line: %v", err)
+	}
+	if handlerLine["request_id"] != "req-1" {
+		t.Errorf("handler log line missing request ID: %s", lines[0])
+	}
+
+	var requestLine map[string]any
+	if err := json.Unmarshal([]byte(lines[1]), &requestLine); err != nil {
+		t.Fatalf("invalid log line: %v", err)
+	}
+	want := map[string]any{
+		"msg":        "request",
+		"request_id": "req-1",
+		"method":     "GET",
+		"route":      "GET /api/v1/items/{id}",
+		"path":       "/api/v1/items/42",
+		"status":     float64(http.StatusOK),
+		"bytes":      float64(5),
+		"user":       "testuser",
+	}
+	for key, value := range want {
+		if requestLine[key] != value {
+			t.Errorf("request log %s = %v, want %v", key, requestLine[key], value)
+		}
+	}
+	if _, ok := requestLine["duration"]; !ok {
+		t.Error("request log is missing duration")
+	}
+}
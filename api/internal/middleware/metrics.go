@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/josepheid/file-explorer/api/internal/metrics"
+)
+
+// Instrument records the count, latency and response size of every request by route pattern,
+// and makes m available to handlers through metrics.FromContext.
+// It should wrap the router so the matched route pattern is known. If m is nil requests are not recorded.
+func Instrument(m *metrics.Metrics) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if m == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			r, info := withRequestInfo(r.WithContext(metrics.NewContext(r.Context(), m)))
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r)
+
+			// requests the router did not match, e.g. CORS preflights, share one series
+			route := info.routeOf(r)
+			if route == "" {
+				route = "unmatched"
+			}
+			m.ObserveRequest(route, r.Method, sw.Status(), sw.bytes, time.Since(start))
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+)
+
+type requestInfoKey struct{}
+
+// requestInfo collects details about a request that are only known once inner handlers have run,
+// it is shared by all the middleware wrapping a request
+type requestInfo struct {
+	user        string
+	route       string
+	path        string
+	destination string
+}
+
+// SetUser reports the user a request acted on behalf of to the logging and audit middleware wrapping it.
+// RequireAuth calls it automatically, handlers that authenticate users themselves (e.g. login) call it directly.
+func SetUser(ctx context.Context, userID string) {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		info.user = userID
+	}
+}
+
+// SetPath reports the file path a request acted on to the audit middleware wrapping it.
+// Handlers that do not take the path from the path query parameter (e.g. WebDAV or share links) call it with the
+// path they resolved.
+func SetPath(ctx context.Context, path string) {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		info.path = path
+	}
+}
+
+// SetDestination reports the path a request copied or moved a file to, to the audit middleware wrapping it
+func SetDestination(ctx context.Context, path string) {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		info.destination = path
+	}
+}
+
+// withRequestInfo makes details set further down the chain visible through the returned pointer,
+// sharing it if an outer middleware already installed one
+func withRequestInfo(r *http.Request) (*http.Request, *requestInfo) {
+	if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+		return r, info
+	}
+	info := &requestInfo{}
+	return r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info)), info
+}
+
+// routeOf returns the route pattern the router matched for r. The router sets the pattern on the request it
+// receives, which is a copy for every middleware that changes the context, so the innermost middleware to see it
+// records it for the outer ones. It must be called after the wrapped handler has returned.
+func (info *requestInfo) routeOf(r *http.Request) string {
+	if r.Pattern != "" {
+		info.route = r.Pattern
+	}
+	return info.route
+}
@@ -0,0 +1,236 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// pendingTTL is how long a user has to complete the login at the identity provider
+const pendingTTL = 10 * time.Minute
+
+var (
+	// ErrUnknownState is returned when the callback state does not match a pending login
+	ErrUnknownState = errors.New("oidc: unknown or expired login state")
+	// ErrMissingClaim is returned when the ID token lacks the claim used as the username
+	ErrMissingClaim = errors.New("oidc: ID token is missing the username claim")
+)
+
+// Config holds the identity provider and client settings
+type Config struct {
+	// Issuer is the provider's issuer URL, used for discovery
+	Issuer string
+	// ClientID and ClientSecret identify this server at the provider, the secret is optional for public clients
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the absolute URL of the callback endpoint
+	RedirectURL string
+	// Scopes requested in addition to "openid", defaults to profile and email
+	Scopes []string
+	// UsernameClaim is the ID token claim used as the session's user ID, defaults to "sub"
+	UsernameClaim string
+	// GroupsClaim is the ID token claim listing the user's groups, defaults to "groups"
+	GroupsClaim string
+}
+
+// Claims are the ID token claims mapped into a session
+type Claims struct {
+	Subject  string
+	Username string
+	Email    string
+	Groups   []string
+}
+
+// pendingLogin holds what is needed to complete a login started with AuthCodeURL
+type pendingLogin struct {
+	verifier  string
+	nonce     string
+	redirect  string
+	expiresAt time.Time
+}
+
+// Service runs the authorization code flow with PKCE against an OpenID Connect provider
+type Service struct {
+	cfg Config
+
+	// the provider is discovered on first use so the server can start while the provider is unavailable
+	providerMu sync.Mutex
+	oauth      *oauth2.Config
+	verifier   *gooidc.IDTokenVerifier
+
+	pending map[string]pendingLogin // state -> pending login
+	mu      sync.Mutex
+}
+
+func New(cfg Config) *Service {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"profile", "email"}
+	}
+	if cfg.UsernameClaim == "" {
+		cfg.UsernameClaim = "sub"
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+
+	return &Service{
+		cfg:     cfg,
+		pending: make(map[string]pendingLogin),
+	}
+}
+
+// AuthCodeURL starts a login and returns the provider URL to send the user to along with the state,
+// which the caller should bind to the browser so the callback can be checked against it.
+// redirect is remembered and returned by Exchange once the login completes.
+func (s *Service) AuthCodeURL(ctx context.Context, redirect string) (string, string, error) {
+	oauth, _, err := s.provider(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	s.mu.Lock()
+	s.removeExpired()
+	s.pending[state] = pendingLogin{
+		verifier:  verifier,
+		nonce:     nonce,
+		redirect:  redirect,
+		expiresAt: time.Now().Add(pendingTTL),
+	}
+	s.mu.Unlock()
+
+	url := oauth.AuthCodeURL(state, gooidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+	return url, state, nil
+}
+
+// Exchange completes the login identified by state: it redeems the code, verifies the ID token
+// and returns its claims along with the redirect passed to AuthCodeURL.
+// Each state can only be used once.
+func (s *Service) Exchange(ctx context.Context, state, code string) (Claims, string, error) {
+	s.mu.Lock()
+	login, exists := s.pending[state]
+	delete(s.pending, state)
+	s.mu.Unlock()
+	if !exists || time.Now().After(login.expiresAt) {
+		return Claims{}, "", ErrUnknownState
+	}
+
+	oauth, verifier, err := s.provider(ctx)
+	if err != nil {
+		return Claims{}, "", err
+	}
+
+	token, err := oauth.Exchange(ctx, code, oauth2.VerifierOption(login.verifier))
+	if err != nil {
+		return Claims{}, "", fmt.Errorf("oidc: failed to exchange code: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return Claims{}, "", errors.New("oidc: token response has no id_token")
+	}
+
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return Claims{}, "", fmt.Errorf("oidc: failed to verify ID token: %w", err)
+	}
+	if idToken.Nonce != login.nonce {
+		return Claims{}, "", errors.New("oidc: ID token nonce mismatch")
+	}
+
+	claims, err := s.mapClaims(idToken)
+	if err != nil {
+		return Claims{}, "", err
+	}
+
+	return claims, login.redirect, nil
+}
+
+// mapClaims extracts the subject, username, email and groups from a verified ID token
+func (s *Service) mapClaims(idToken *gooidc.IDToken) (Claims, error) {
+	var raw map[string]any
+	if err := idToken.Claims(&raw); err != nil {
+		return Claims{}, fmt.Errorf("oidc: failed to parse claims: %w", err)
+	}
+
+	claims := Claims{Subject: idToken.Subject}
+	claims.Username, _ = raw[s.cfg.UsernameClaim].(string)
+	if claims.Username == "" {
+		return Claims{}, ErrMissingClaim
+	}
+	claims.Email, _ = raw["email"].(string)
+
+	// providers send groups either as a list or, when there is only one, as a plain string
+	switch groups := raw[s.cfg.GroupsClaim].(type) {
+	case []any:
+		for _, g := range groups {
+			if name, ok := g.(string); ok {
+				claims.Groups = append(claims.Groups, name)
+			}
+		}
+	case string:
+		claims.Groups = []string{groups}
+	}
+
+	return claims, nil
+}
+
+// provider discovers the provider configuration on first use
+func (s *Service) provider(ctx context.Context) (*oauth2.Config, *gooidc.IDTokenVerifier, error) {
+	s.providerMu.Lock()
+	defer s.providerMu.Unlock()
+
+	if s.oauth != nil {
+		return s.oauth, s.verifier, nil
+	}
+
+	provider, err := gooidc.NewProvider(ctx, s.cfg.Issuer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("oidc: failed to discover provider: %w", err)
+	}
+
+	s.oauth = &oauth2.Config{
+		ClientID:     s.cfg.ClientID,
+		ClientSecret: s.cfg.ClientSecret,
+		RedirectURL:  s.cfg.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       append([]string{gooidc.ScopeOpenID}, s.cfg.Scopes...),
+	}
+	s.verifier = provider.Verifier(&gooidc.Config{ClientID: s.cfg.ClientID})
+
+	return s.oauth, s.verifier, nil
+}
+
+// removeExpired deletes abandoned logins, the caller must hold s.mu
+func (s *Service) removeExpired() {
+	now := time.Now()
+	for state, login := range s.pending {
+		if now.After(login.expiresAt) {
+			delete(s.pending, state)
+		}
+	}
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,141 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/josepheid/file-explorer/api/internal/oidc/oidctest"
+)
+
+// authorize follows the provider's authorization endpoint and returns the code it redirects back with
+func authorize(t *testing.T, authURL string) (code, state string) {
+	t.Helper()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("authorization request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.StatusCode != http.StatusFound {
+		t.Fatalf("expected redirect from provider, got status %d", resp.StatusCode)
+	}
+
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestService(t *testing.T) {
+	provider := oidctest.NewProvider(t, "file-explorer")
+	provider.Claims["email"] = "jane@example.com"
+	provider.Claims["preferred_username"] = "jane"
+	provider.Claims["groups"] = []string{"engineering", "ops"}
+
+	cfg := Config{
+		Issuer:      provider.Issuer(),
+		ClientID:    "file-explorer",
+		RedirectURL: "https://localhost:8080/api/v1/oidc/callback",
+	}
+	ctx := context.Background()
+
+	t.Run("login flow", func(t *testing.T) {
+		service := New(cfg)
+
+		authURL, state, err := service.AuthCodeURL(ctx, "/browse/docs")
+		if err != nil {
+			t.Fatalf("AuthCodeURL() error = %v", err)
+		}
+
+		code, returnedState := authorize(t, authURL)
+		if returnedState != state {
+			t.Fatalf("expected state %q, got %q", state, returnedState)
+		}
+
+		claims, redirect, err := service.Exchange(ctx, state, code)
+		if err != nil {
+			t.Fatalf("Exchange() error = %v", err)
+		}
+
+		if redirect != "/browse/docs" {
+			t.Errorf("expected redirect %q, got %q", "/browse/docs", redirect)
+		}
+		if claims.Subject != "user-1" || claims.Username != "user-1" {
+			t.Errorf("expected subject and username user-1, got %+v", claims)
+		}
+		if claims.Email != "jane@example.com" {
+			t.Errorf("expected email jane@example.com, got %q", claims.Email)
+		}
+		if !slices.Equal(claims.Groups, []string{"engineering", "ops"}) {
+			t.Errorf("expected groups [engineering ops], got %v", claims.Groups)
+		}
+
+		// the state cannot be replayed
+		if _, _, err := service.Exchange(ctx, state, code); !errors.Is(err, ErrUnknownState) {
+			t.Errorf("expected ErrUnknownState on replay, got %v", err)
+		}
+	})
+
+	t.Run("custom username claim", func(t *testing.T) {
+		custom := cfg
+		custom.UsernameClaim = "preferred_username"
+		service := New(custom)
+
+		authURL, state, _ := service.AuthCodeURL(ctx, "/")
+		code, _ := authorize(t, authURL)
+
+		claims, _, err := service.Exchange(ctx, state, code)
+		if err != nil {
+			t.Fatalf("Exchange() error = %v", err)
+		}
+		if claims.Username != "jane" {
+			t.Errorf("expected username jane, got %q", claims.Username)
+		}
+	})
+
+	t.Run("missing username claim", func(t *testing.T) {
+		custom := cfg
+		custom.UsernameClaim = "upn"
+		service := New(custom)
+
+		authURL, state, _ := service.AuthCodeURL(ctx, "/")
+		code, _ := authorize(t, authURL)
+
+		if _, _, err := service.Exchange(ctx, state, code); !errors.Is(err, ErrMissingClaim) {
+			t.Errorf("expected ErrMissingClaim, got %v", err)
+		}
+	})
+
+	t.Run("unknown state", func(t *testing.T) {
+		service := New(cfg)
+		if _, _, err := service.Exchange(ctx, "forged", "code"); !errors.Is(err, ErrUnknownState) {
+			t.Errorf("expected ErrUnknownState, got %v", err)
+		}
+	})
+
+	t.Run("code from another login", func(t *testing.T) {
+		service := New(cfg)
+
+		authURL, _, _ := service.AuthCodeURL(ctx, "/")
+		code, _ := authorize(t, authURL)
+
+		// a second login has its own PKCE verifier, so the first login's code is rejected
+		_, otherState, _ := service.AuthCodeURL(ctx, "/")
+		if _, _, err := service.Exchange(ctx, otherState, code); err == nil {
+			t.Error("expected exchange with mismatched verifier to fail")
+		}
+	})
+
+	t.Run("provider unavailable", func(t *testing.T) {
+		service := New(Config{Issuer: "http://127.0.0.1:0", ClientID: "file-explorer"})
+		if _, _, err := service.AuthCodeURL(ctx, "/"); err == nil {
+			t.Error("expected discovery error")
+		}
+	})
+}
@@ -0,0 +1,354 @@
+package preview
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/transform"
+)
+
+// Modes selecting which end of a file is previewed
+const (
+	ModeHead = "head"
+	ModeTail = "tail"
+)
+
+const (
+	// DefaultLimit is how many bytes are previewed when no limit is given
+	DefaultLimit = 64 << 10
+	// MaxLimit is the largest preview that can be requested
+	MaxLimit = 1 << 20
+	// maxHighlight bounds the content that is syntax highlighted, larger previews are returned as plain text
+	maxHighlight = 256 << 10
+	// sniffLength is how much of a file is inspected to detect binary content and its charset
+	sniffLength = 8 << 10
+	// DefaultStyle is the highlighting style served by CSS if none is given
+	DefaultStyle = "github"
+)
+
+var (
+	// ErrNotRegular is returned when previewing a directory or other non regular file
+	ErrNotRegular = errors.New("preview: not a regular file")
+	// ErrInvalidOptions is returned for out of range limits and line ranges
+	ErrInvalidOptions = errors.New("preview: invalid options")
+)
+
+// Options select the part of a file to preview
+type Options struct {
+	// Mode is ModeHead (the default) or ModeTail, it is ignored when a line range is given
+	Mode string
+	// Limit is the maximum number of bytes read, defaults to DefaultLimit
+	Limit int64
+	// FromLine and ToLine select an inclusive, 1-based range of lines, ToLine 0 means up to Limit
+	FromLine int
+	ToLine   int
+	// Highlight enables syntax highlighting to HTML
+	Highlight bool
+}
+
+// Preview is the previewed part of a file
+type Preview struct {
+	Size     int64  `json:"size"`
+	MIMEType string `json:"mimeType"`
+	// Binary is set for files that are not text, they have no content
+	Binary  bool   `json:"binary"`
+	Charset string `json:"charset,omitempty"`
+	// Offset is the position in the file where the content starts
+	Offset int64 `json:"offset"`
+	// Truncated is set if the file continues beyond the content in either direction
+	Truncated bool `json:"truncated"`
+	// StartLine and EndLine number the lines of the content, they are unknown (0) for tails
+	StartLine int `json:"startLine,omitempty"`
+	EndLine   int `json:"endLine,omitempty"`
+	// Content is the text converted to UTF-8
+	Content string `json:"content,omitempty"`
+	// Language and HTML are set if the content was highlighted, the HTML uses the classes from CSS
+	Language string `json:"language,omitempty"`
+	HTML     string `json:"html,omitempty"`
+}
+
+// File previews the text file at path
+func File(path string, opts Options) (Preview, error) {
+	if opts.Mode == "" {
+		opts.Mode = ModeHead
+	}
+	if opts.Limit == 0 {
+		opts.Limit = DefaultLimit
+	}
+	if opts.Mode != ModeHead && opts.Mode != ModeTail || opts.Limit < 0 || opts.Limit > MaxLimit ||
+		opts.FromLine < 0 || opts.ToLine < 0 || (opts.ToLine > 0 && opts.ToLine < opts.FromLine) {
+		return Preview{}, ErrInvalidOptions
+	}
+
+	// opening a FIFO blocks until a writer appears, so anything but a regular file is rejected before opening it
+	if info, err := os.Stat(path); err != nil {
+		return Preview{}, err
+	} else if !info.Mode().IsRegular() {
+		return Preview{}, ErrNotRegular
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return Preview{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return Preview{}, err
+	}
+	if !info.Mode().IsRegular() {
+		return Preview{}, ErrNotRegular
+	}
+
+	sniff := make([]byte, min(sniffLength, info.Size()))
+	if _, err := io.ReadFull(f, sniff); err != nil {
+		return Preview{}, err
+	}
+
+	p := Preview{Size: info.Size(), MIMEType: http.DetectContentType(sniff)}
+	if isBinary(sniff) {
+		p.Binary = true
+		return p, nil
+	}
+
+	p.Charset = detectCharset(sniff, int64(len(sniff)) < p.Size)
+
+	var raw []byte
+	switch {
+	case opts.FromLine > 0:
+		raw, err = readLines(f, &p, opts)
+	case opts.Mode == ModeTail:
+		raw, err = readTail(f, &p, opts.Limit)
+	default:
+		raw, err = readHead(f, &p, opts.Limit)
+	}
+	if err != nil {
+		return Preview{}, err
+	}
+
+	p.Content, err = decode(raw, p.Charset)
+	if err != nil {
+		return Preview{}, err
+	}
+
+	if opts.Highlight && len(p.Content) <= maxHighlight {
+		p.Language, p.HTML, err = highlight(filepath.Base(path), p.Content, p.StartLine)
+		if err != nil {
+			return Preview{}, err
+		}
+	}
+
+	return p, nil
+}
+
+// CSS writes the stylesheet for highlighted HTML in the named chroma style, e.g. "github" or "monokai"
+func CSS(w io.Writer, style string) error {
+	s, ok := styles.Registry[style]
+	if !ok {
+		return fmt.Errorf("%w: unknown style %q", ErrInvalidOptions, style)
+	}
+	return formatter(0).WriteCSS(w, s)
+}
+
+// isBinary reports whether sniffed content looks like something other than text, files with a UTF-16 byte order
+// mark are text even though they contain NUL bytes
+func isBinary(sniff []byte) bool {
+	if bytes.HasPrefix(sniff, []byte{0xff, 0xfe}) || bytes.HasPrefix(sniff, []byte{0xfe, 0xff}) {
+		return false
+	}
+	return bytes.IndexByte(sniff, 0) >= 0
+}
+
+// detectCharset names the charset of sniffed text, partial is set if the file continues beyond it
+func detectCharset(sniff []byte, partial bool) string {
+	valid := sniff
+	if partial {
+		// the sniffed content may end part way through a character
+		for i := len(valid) - 1; i >= 0 && i >= len(valid)-utf8.UTFMax; i-- {
+			if utf8.RuneStart(valid[i]) {
+				if !utf8.FullRune(valid[i:]) {
+					valid = valid[:i]
+				}
+				break
+			}
+		}
+	}
+	if utf8.Valid(valid) && !bytes.HasPrefix(sniff, []byte{0xff, 0xfe}) && !bytes.HasPrefix(sniff, []byte{0xfe, 0xff}) {
+		return "utf-8"
+	}
+
+	// byte order marks, then a guess, leaving out the sniffed MIME type as it always claims utf-8 for text
+	_, name, _ := charset.DetermineEncoding(sniff, "")
+	return name
+}
+
+// readHead reads up to limit bytes from the start, ending at the last complete line if the file is cut short
+func readHead(f *os.File, p *Preview, limit int64) ([]byte, error) {
+	buf := make([]byte, min(limit, p.Size))
+	if _, err := f.ReadAt(buf, 0); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	if int64(len(buf)) < p.Size {
+		p.Truncated = true
+		if i := bytes.LastIndexByte(buf, '\n'); i >= 0 {
+			buf = buf[:i+1]
+		}
+	}
+
+	p.StartLine = 1
+	p.EndLine = countLines(buf)
+	return buf, nil
+}
+
+// readTail reads up to limit bytes from the end, starting at the first complete line if the file is cut short
+func readTail(f *os.File, p *Preview, limit int64) ([]byte, error) {
+	offset := max(p.Size-limit, 0)
+	buf := make([]byte, p.Size-offset)
+	if _, err := f.ReadAt(buf, offset); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	if offset > 0 {
+		p.Truncated = true
+		if i := bytes.IndexByte(buf, '\n'); i >= 0 && i < len(buf)-1 {
+			buf = buf[i+1:]
+			offset += int64(i + 1)
+		}
+	}
+
+	p.Offset = offset
+	return buf, nil
+}
+
+// readLines reads the requested range of lines, stopping early at the last complete line within the limit
+func readLines(f *os.File, p *Preview, opts Options) ([]byte, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(f)
+	var buf bytes.Buffer
+	var offset int64
+	line := 1
+	for {
+		// long lines arrive in several chunks, only the last ends with a newline
+		chunk, err := r.ReadSlice('\n')
+		if err != nil && !errors.Is(err, bufio.ErrBufferFull) && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+
+		if len(chunk) > 0 {
+			if opts.ToLine > 0 && line > opts.ToLine {
+				p.Truncated = true
+				break
+			}
+			if line >= opts.FromLine {
+				if buf.Len() == 0 {
+					p.StartLine = line
+					p.Offset = offset
+				}
+				if int64(buf.Len()+len(chunk)) > opts.Limit {
+					// a single line longer than the limit is cut short rather than dropped
+					p.Truncated = true
+					if i := bytes.LastIndexByte(buf.Bytes(), '\n'); i >= 0 {
+						buf.Truncate(i + 1)
+					} else {
+						buf.Write(chunk[:opts.Limit-int64(buf.Len())])
+					}
+					break
+				}
+				buf.Write(chunk)
+			}
+			offset += int64(len(chunk))
+			if chunk[len(chunk)-1] == '\n' {
+				line++
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+	}
+
+	if buf.Len() == 0 {
+		p.StartLine = 0
+		p.Offset = 0
+		return nil, nil
+	}
+	p.Truncated = p.Truncated || p.StartLine > 1
+	p.EndLine = p.StartLine + countLines(buf.Bytes()) - 1
+	return buf.Bytes(), nil
+}
+
+func countLines(b []byte) int {
+	n := bytes.Count(b, []byte{'\n'})
+	if len(b) > 0 && b[len(b)-1] != '\n' {
+		n++
+	}
+	return n
+}
+
+// decode converts raw text in the named charset to UTF-8
+func decode(raw []byte, name string) (string, error) {
+	if strings.EqualFold(name, "utf-8") {
+		// drop a byte order mark and replace anything cut mid character
+		return strings.ToValidUTF8(string(bytes.TrimPrefix(raw, []byte("\xef\xbb\xbf"))), string(utf8.RuneError)), nil
+	}
+
+	enc, _ := charset.Lookup(name)
+	if enc == nil {
+		return strings.ToValidUTF8(string(raw), string(utf8.RuneError)), nil
+	}
+	out, _, err := transform.Bytes(enc.NewDecoder(), raw)
+	if err != nil {
+		return "", fmt.Errorf("preview: failed to decode %s: %w", name, err)
+	}
+	return strings.TrimPrefix(string(out), "\ufeff"), nil
+}
+
+// highlight renders content as HTML, picking the language from the file name or, failing that, the content
+func highlight(name, content string, startLine int) (string, string, error) {
+	lexer := lexers.Match(name)
+	if lexer == nil {
+		lexer = lexers.Analyse(content)
+	}
+	if lexer == nil {
+		return "", "", nil
+	}
+	lexer = chroma.Coalesce(lexer)
+
+	iterator, err := lexer.Tokenise(nil, content)
+	if err != nil {
+		return "", "", fmt.Errorf("preview: failed to highlight: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := formatter(startLine).Format(&buf, styles.Get(DefaultStyle), iterator); err != nil {
+		return "", "", fmt.Errorf("preview: failed to highlight: %w", err)
+	}
+	return lexer.Config().Name, buf.String(), nil
+}
+
+// formatter renders HTML with CSS classes, numbering lines from startLine if it is known
+func formatter(startLine int) *html.Formatter {
+	opts := []html.Option{html.WithClasses(true), html.TabWidth(4)}
+	if startLine > 0 {
+		opts = append(opts, html.WithLineNumbers(true), html.BaseLineNumber(startLine))
+	}
+	return html.New(opts...)
+}
@@ -0,0 +1,275 @@
+package preview
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// numberedLines returns n lines "line 1\n" to "line n\n"
+func numberedLines(n int) []byte {
+	var b bytes.Buffer
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, "line %d\n", i)
+	}
+	return b.Bytes()
+}
+
+func TestFileHeadAndTail(t *testing.T) {
+	path := writeFile(t, "app.log", numberedLines(1000))
+
+	tests := []struct {
+		name          string
+		opts          Options
+		wantPrefix    string
+		wantSuffix    string
+		wantTruncated bool
+		wantStart     int
+		wantOffset    bool
+	}{
+		{
+			name:       "whole file",
+			opts:       Options{Limit: MaxLimit},
+			wantPrefix: "line 1\n",
+			wantSuffix: "line 1000\n",
+			wantStart:  1,
+		},
+		{
+			name:          "head ends at a complete line",
+			opts:          Options{Limit: 100},
+			wantPrefix:    "line 1\n",
+			wantSuffix:    "\n",
+			wantTruncated: true,
+			wantStart:     1,
+		},
+		{
+			name:          "tail starts at a complete line",
+			opts:          Options{Mode: ModeTail, Limit: 100},
+			wantPrefix:    "line ",
+			wantSuffix:    "line 1000\n",
+			wantTruncated: true,
+			wantOffset:    true,
+		},
+		{
+			name:          "line range",
+			opts:          Options{FromLine: 10, ToLine: 12},
+			wantPrefix:    "line 10\n",
+			wantSuffix:    "line 12\n",
+			wantTruncated: true,
+			wantStart:     10,
+			wantOffset:    true,
+		},
+		{
+			name:          "line range to end",
+			opts:          Options{FromLine: 999},
+			wantPrefix:    "line 999\n",
+			wantSuffix:    "line 1000\n",
+			wantTruncated: true,
+			wantStart:     999,
+			wantOffset:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := File(path, tt.opts)
+			if err != nil {
+				t.Fatalf("File() error = %v", err)
+			}
+
+			if p.Binary || p.Charset != "utf-8" || !strings.HasPrefix(p.MIMEType, "text/plain") {
+				t.Errorf("unexpected detection: binary %v, charset %q, MIME type %q", p.Binary, p.Charset, p.MIMEType)
+			}
+			if !strings.HasPrefix(p.Content, tt.wantPrefix) || !strings.HasSuffix(p.Content, tt.wantSuffix) {
+				t.Errorf("unexpected content %q...%q", p.Content[:min(20, len(p.Content))], p.Content[max(0, len(p.Content)-20):])
+			}
+			if !strings.HasPrefix(p.Content, "line ") {
+				t.Errorf("content does not start at a line: %q", p.Content[:10])
+			}
+			if p.Truncated != tt.wantTruncated {
+				t.Errorf("Truncated = %v, want %v", p.Truncated, tt.wantTruncated)
+			}
+			if p.StartLine != tt.wantStart {
+				t.Errorf("StartLine = %d, want %d", p.StartLine, tt.wantStart)
+			}
+			if p.StartLine > 0 && p.EndLine != p.StartLine+strings.Count(p.Content, "\n")-1 {
+				t.Errorf("EndLine = %d does not match content from line %d", p.EndLine, p.StartLine)
+			}
+			if (p.Offset > 0) != tt.wantOffset {
+				t.Errorf("Offset = %d", p.Offset)
+			}
+			if p.Size != 8893 {
+				t.Errorf("Size = %d, want 8893", p.Size)
+			}
+		})
+	}
+}
+
+func TestFileLineRangeLimit(t *testing.T) {
+	path := writeFile(t, "app.log", numberedLines(100))
+
+	p, err := File(path, Options{FromLine: 5, Limit: 20})
+	if err != nil {
+		t.Fatalf("File() error = %v", err)
+	}
+	if p.Content != "line 5\nline 6\n" || p.StartLine != 5 || p.EndLine != 6 || !p.Truncated {
+		t.Errorf("unexpected preview %+v", p)
+	}
+
+	// a line longer than the limit is cut
+	long := writeFile(t, "min.js", []byte(strings.Repeat("a", 100)+"\n"))
+	p, err = File(long, Options{FromLine: 1, Limit: 10})
+	if err != nil {
+		t.Fatalf("File() error = %v", err)
+	}
+	if p.Content != strings.Repeat("a", 10) || !p.Truncated {
+		t.Errorf("unexpected preview of long line %+v", p)
+	}
+
+	// a range past the end is empty
+	p, err = File(path, Options{FromLine: 500})
+	if err != nil {
+		t.Fatalf("File() error = %v", err)
+	}
+	if p.Content != "" || p.StartLine != 0 {
+		t.Errorf("unexpected preview past the end %+v", p)
+	}
+}
+
+func TestFileDetection(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        []byte
+		wantBinary  bool
+		wantCharset string
+		wantContent string
+	}{
+		{
+			name:        "utf-8 with byte order mark",
+			data:        []byte("\xef\xbb\xbfhéllo\n"),
+			wantCharset: "utf-8",
+			wantContent: "héllo\n",
+		},
+		{
+			name:        "latin-1",
+			data:        []byte("caf\xe9\n"),
+			wantCharset: "windows-1252",
+			wantContent: "café\n",
+		},
+		{
+			name:        "utf-16",
+			data:        []byte("\xff\xfeh\x00i\x00\n\x00"),
+			wantCharset: "utf-16le",
+			wantContent: "hi\n",
+		},
+		{
+			name:       "binary",
+			data:       []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"),
+			wantBinary: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := File(writeFile(t, "file", tt.data), Options{})
+			if err != nil {
+				t.Fatalf("File() error = %v", err)
+			}
+
+			if p.Binary != tt.wantBinary {
+				t.Errorf("Binary = %v, want %v", p.Binary, tt.wantBinary)
+			}
+			if p.Charset != tt.wantCharset {
+				t.Errorf("Charset = %q, want %q", p.Charset, tt.wantCharset)
+			}
+			if p.Content != tt.wantContent {
+				t.Errorf("Content = %q, want %q", p.Content, tt.wantContent)
+			}
+		})
+	}
+}
+
+func TestFileHighlight(t *testing.T) {
+	path := writeFile(t, "main.go", []byte("package main\n\nfunc main() {}\n"))
+
+	p, err := File(path, Options{Highlight: true})
+	if err != nil {
+		t.Fatalf("File() error = %v", err)
+	}
+	if p.Language != "Go" {
+		t.Errorf("Language = %q, want Go", p.Language)
+	}
+	if !strings.Contains(p.HTML, `class="chroma"`) || !strings.Contains(p.HTML, `<span class="kn">package</span>`) {
+		t.Errorf("unexpected HTML %s", p.HTML)
+	}
+
+	// plain text has nothing to highlight
+	p, err = File(writeFile(t, "notes", []byte("just some notes\n")), Options{Highlight: true})
+	if err != nil {
+		t.Fatalf("File() error = %v", err)
+	}
+	if p.HTML != "" && p.Language != "plaintext" {
+		t.Errorf("unexpected highlighting as %q", p.Language)
+	}
+
+	var css bytes.Buffer
+	if err := CSS(&css, DefaultStyle); err != nil {
+		t.Fatalf("CSS() error = %v", err)
+	}
+	if !strings.Contains(css.String(), ".chroma .kn") {
+		t.Error("stylesheet is missing token classes")
+	}
+	if err := CSS(&css, "no-such-style"); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("CSS() error = %v, want ErrInvalidOptions", err)
+	}
+}
+
+func TestFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, "file", []byte("text"))
+
+	tests := []struct {
+		name    string
+		path    string
+		opts    Options
+		wantErr error
+	}{
+		{name: "directory", path: dir, wantErr: ErrNotRegular},
+		{name: "missing", path: filepath.Join(dir, "missing"), wantErr: os.ErrNotExist},
+		{name: "unknown mode", path: path, opts: Options{Mode: "middle"}, wantErr: ErrInvalidOptions},
+		{name: "limit too large", path: path, opts: Options{Limit: MaxLimit + 1}, wantErr: ErrInvalidOptions},
+		{name: "backwards range", path: path, opts: Options{FromLine: 5, ToLine: 2}, wantErr: ErrInvalidOptions},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := File(tt.path, tt.opts); !errors.Is(err, tt.wantErr) {
+				t.Errorf("File() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDetectCharset(t *testing.T) {
+	// a multi-byte character cut off by the sniff is still utf-8
+	if got := detectCharset([]byte("caf\xc3"), true); got != "utf-8" {
+		t.Errorf("detectCharset() = %q, want utf-8", got)
+	}
+	if got := detectCharset([]byte("caf\xc3"), false); got == "utf-8" {
+		t.Errorf("detectCharset() = utf-8 for invalid text")
+	}
+}
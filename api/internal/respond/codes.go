@@ -0,0 +1,105 @@
+package respond
+
+import "net/http"
+
+// Code identifies the kind of an error response. Codes are stable, unlike messages which may be reworded.
+type Code string
+
+const (
+	// CodeBadRequest is a malformed request not covered by a more specific code
+	CodeBadRequest Code = "bad_request"
+	// CodeInvalidBody is a request body that cannot be decoded or has an invalid field, named in the details
+	CodeInvalidBody Code = "invalid_body"
+	// CodeInvalidParameter is an invalid query parameter, named in the details
+	CodeInvalidParameter Code = "invalid_parameter"
+	CodeInvalidPath      Code = "invalid_path"
+	CodeNotADirectory    Code = "not_a_directory"
+	CodeNotAFile         Code = "not_a_file"
+	// CodeUnsupportedFile is a file of a type the request cannot handle, e.g. a thumbnail of a text file
+	CodeUnsupportedFile Code = "unsupported_file"
+	CodeFileTooLarge    Code = "file_too_large"
+	CodeInvalidManifest Code = "invalid_manifest"
+	// CodeInvalidState is a single sign-on callback that does not match the login it claims to complete
+	CodeInvalidState Code = "invalid_state"
+
+	// CodeUnauthorized is a request without a valid session, token or client certificate
+	CodeUnauthorized       Code = "unauthorized"
+	CodeInvalidCredentials Code = "invalid_credentials"
+	// CodeInvalidCode is a wrong or expired two-factor authentication code or challenge
+	CodeInvalidCode      Code = "invalid_code"
+	CodePasswordRequired Code = "password_required"
+	// CodeLoginFailed is a login the identity provider rejected
+	CodeLoginFailed Code = "login_failed"
+
+	// CodeForbidden is a request the credentials are not allowed to make, e.g. a token without the scope
+	CodeForbidden Code = "forbidden"
+
+	CodePathNotFound  Code = "path_not_found"
+	CodeShareNotFound Code = "share_not_found"
+	CodeTokenNotFound Code = "token_not_found"
+	// CodeJobNotFound is a request to cancel a background job that is not running
+	CodeJobNotFound Code = "job_not_found"
+	// CodeWebDAVDisabled is a WebDAV request to a server that does not serve WebDAV
+	CodeWebDAVDisabled Code = "webdav_disabled"
+
+	CodeMethodNotAllowed   Code = "method_not_allowed"
+	CodeTOTPAlreadyEnabled Code = "totp_already_enabled"
+	CodeTOTPNotEnrolled    Code = "totp_not_enrolled"
+	CodeDownloadLimit      Code = "download_limit_reached"
+	CodeRequestTooLarge    Code = "request_too_large"
+	CodeTooManyRequests    Code = "too_many_requests"
+
+	// CodeInternal is a failure on the server, the request ID identifies it in the logs
+	CodeInternal Code = "internal_error"
+	// CodeIdentityProvider is an identity provider that cannot be reached
+	CodeIdentityProvider Code = "identity_provider_unavailable"
+	// CodeUnavailable is a request the server cannot serve right now, e.g. while shutting down
+	CodeUnavailable Code = "unavailable"
+)
+
+// statuses maps every code to the status it is sent with
+var statuses = map[Code]int{
+	CodeBadRequest:       http.StatusBadRequest,
+	CodeInvalidBody:      http.StatusBadRequest,
+	CodeInvalidParameter: http.StatusBadRequest,
+	CodeInvalidPath:      http.StatusBadRequest,
+	CodeNotADirectory:    http.StatusBadRequest,
+	CodeNotAFile:         http.StatusBadRequest,
+	CodeUnsupportedFile:  http.StatusBadRequest,
+	CodeFileTooLarge:     http.StatusBadRequest,
+	CodeInvalidManifest:  http.StatusBadRequest,
+	CodeInvalidState:     http.StatusBadRequest,
+
+	CodeUnauthorized:       http.StatusUnauthorized,
+	CodeInvalidCredentials: http.StatusUnauthorized,
+	CodeInvalidCode:        http.StatusUnauthorized,
+	CodePasswordRequired:   http.StatusUnauthorized,
+	CodeLoginFailed:        http.StatusUnauthorized,
+
+	CodeForbidden: http.StatusForbidden,
+
+	CodePathNotFound:   http.StatusNotFound,
+	CodeShareNotFound:  http.StatusNotFound,
+	CodeTokenNotFound:  http.StatusNotFound,
+	CodeJobNotFound:    http.StatusNotFound,
+	CodeWebDAVDisabled: http.StatusNotFound,
+
+	CodeMethodNotAllowed:   http.StatusMethodNotAllowed,
+	CodeTOTPAlreadyEnabled: http.StatusConflict,
+	CodeTOTPNotEnrolled:    http.StatusConflict,
+	CodeDownloadLimit:      http.StatusGone,
+	CodeRequestTooLarge:    http.StatusRequestEntityTooLarge,
+	CodeTooManyRequests:    http.StatusTooManyRequests,
+
+	CodeInternal:         http.StatusInternalServerError,
+	CodeIdentityProvider: http.StatusBadGateway,
+	CodeUnavailable:      http.StatusServiceUnavailable,
+}
+
+// Status returns the HTTP status errors with the code are sent with, unknown codes are internal errors
+func (c Code) Status() int {
+	if status, ok := statuses[c]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
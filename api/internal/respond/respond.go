@@ -2,28 +2,93 @@ package respond
 
 import (
 	"encoding/json"
+	"mime"
 	"net/http"
+	"strings"
 )
 
+// ProblemContentType is the media type of RFC 7807 problem details, clients that accept it get errors in that format
+const ProblemContentType = "application/problem+json"
+
+// ProblemTypePrefix prefixes the code of an error to form the type URI of its problem details
+const ProblemTypePrefix = "urn:file-explorer:error:"
+
 // Error represents an error response
 type Error struct {
+	// Code identifies the kind of error, clients should match on it rather than the message
+	Code       Code   `json:"code"`
 	Message    string `json:"message"`
 	StatusCode int    `json:"statusCode"`
+	// Details holds further information for some codes, e.g. the parameter that was invalid
+	Details map[string]any `json:"details,omitempty"`
+	// RequestID identifies the request in the server logs, it is copied from the X-Request-ID response header
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// Problem represents an error response in the format of RFC 7807, with the fields of Error as extension members
+type Problem struct {
+	Type      string         `json:"type"`
+	Title     string         `json:"title"`
+	Status    int            `json:"status"`
+	Detail    string         `json:"detail"`
+	Code      Code           `json:"code"`
+	Details   map[string]any `json:"details,omitempty"`
+	RequestID string         `json:"requestId,omitempty"`
 }
 
-func WithError(w http.ResponseWriter, msg string, status int) {
+// WithError writes an error response with code, the status is the one the code maps to
+func WithError(w http.ResponseWriter, r *http.Request, code Code, msg string) {
+	WithErrorDetails(w, r, code, msg, nil)
+}
+
+// WithErrorDetails writes an error response like WithError, with details for the client
+func WithErrorDetails(w http.ResponseWriter, r *http.Request, code Code, msg string, details map[string]any) {
+	status := code.Status()
+	requestID := w.Header().Get("X-Request-ID")
+
+	if acceptsProblem(r) {
+		w.Header().Set("Content-Type", ProblemContentType)
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(Problem{
+			Type:      ProblemTypePrefix + string(code),
+			Title:     http.StatusText(status),
+			Status:    status,
+			Detail:    msg,
+			Code:      code,
+			Details:   details,
+			RequestID: requestID,
+		})
+		return
+	}
+
 	w.Header().Add("Content-Type", "application/json")
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(Error{
+		Code:       code,
 		Message:    msg,
 		StatusCode: status,
+		Details:    details,
+		RequestID:  requestID,
 	})
 }
 
+// acceptsProblem reports whether the client asked for problem details in its Accept header
+func acceptsProblem(r *http.Request) bool {
+	if r == nil {
+		return false
+	}
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept)); err == nil && mediaType == ProblemContentType {
+			return true
+		}
+	}
+	return false
+}
+
 func WithJSON(w http.ResponseWriter, v any, status int) {
 	w.Header().Add("Content-Type", "application/json")
 	w.WriteHeader(status)
 	if err := json.NewEncoder(w).Encode(v); err != nil {
-		WithError(w, "failed to encode", http.StatusInternalServerError)
+		WithError(w, nil, CodeInternal, "failed to encode")
 	}
 }
@@ -0,0 +1,108 @@
+package respond
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestWithError(t *testing.T) {
+	tests := []struct {
+		name            string
+		accept          string
+		wantContentType string
+	}{
+		{name: "no accept header", wantContentType: "application/json"},
+		{name: "json", accept: "application/json", wantContentType: "application/json"},
+		{name: "problem details", accept: "application/problem+json", wantContentType: ProblemContentType},
+		{name: "problem details among others", accept: "application/json;q=0.9, application/problem+json", wantContentType: ProblemContentType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/browse", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			rec.Header().Set("X-Request-ID", "abc123")
+
+			WithErrorDetails(rec, req, CodeInvalidParameter, "Invalid size", map[string]any{"parameter": "size"})
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantContentType)
+			}
+
+			if tt.wantContentType == ProblemContentType {
+				var problem Problem
+				if err := json.NewDecoder(rec.Body).Decode(&problem); err != nil {
+					t.Fatalf("failed to decode problem: %v", err)
+				}
+				want := Problem{
+					Type:      "urn:file-explorer:error:invalid_parameter",
+					Title:     "Bad Request",
+					Status:    http.StatusBadRequest,
+					Detail:    "Invalid size",
+					Code:      CodeInvalidParameter,
+					RequestID: "abc123",
+				}
+				want.Details = map[string]any{"parameter": "size"}
+				if !reflect.DeepEqual(problem, want) {
+					t.Errorf("problem = %+v, want %+v", problem, want)
+				}
+				return
+			}
+
+			var resp Error
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode error: %v", err)
+			}
+			if resp.Code != CodeInvalidParameter || resp.Message != "Invalid size" || resp.StatusCode != http.StatusBadRequest || resp.RequestID != "abc123" {
+				t.Errorf("error = %+v, want the code, message, status and request ID", resp)
+			}
+			if resp.Details["parameter"] != "size" {
+				t.Errorf("details = %v, want the parameter", resp.Details)
+			}
+		})
+	}
+}
+
+func TestWithErrorWithoutDetails(t *testing.T) {
+	rec := httptest.NewRecorder()
+	WithError(rec, nil, CodePathNotFound, "Path not found")
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	var body map[string]any
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode error: %v", err)
+	}
+	if body["code"] != "path_not_found" {
+		t.Errorf("code = %v, want path_not_found", body["code"])
+	}
+	for _, field := range []string{"details", "requestId"} {
+		if _, ok := body[field]; ok {
+			t.Errorf("%s is set, want it left out when empty", field)
+		}
+	}
+}
+
+func TestCodeStatus(t *testing.T) {
+	for code, status := range statuses {
+		if http.StatusText(status) == "" || status < 400 {
+			t.Errorf("%s maps to %d, want an error status", code, status)
+		}
+	}
+	if got := Code("no_such_code").Status(); got != http.StatusInternalServerError {
+		t.Errorf("unknown code status = %d, want %d", got, http.StatusInternalServerError)
+	}
+	if got := CodeInvalidCredentials.Status(); got != http.StatusUnauthorized {
+		t.Errorf("invalid_credentials status = %d, want %d", got, http.StatusUnauthorized)
+	}
+}
@@ -13,6 +13,10 @@ type Session struct {
 	ID string
 	// UserID identifies the user this session belongs to
 	UserID string
+	// Email is the user's email address, if known (e.g. from an OpenID Connect ID token)
+	Email string
+	// Groups lists the groups the user belongs to, if known
+	Groups []string
 	// CreatedAt indicates when the session was created
 	CreatedAt time.Time
 	// ExpiresAt indicates when the session expires
@@ -32,6 +36,11 @@ func New() *Service {
 }
 
 func (s *Service) Create(userID string) (Session, error) {
+	return s.CreateWithClaims(userID, "", nil)
+}
+
+// CreateWithClaims creates a session carrying the email and groups asserted by an identity provider
+func (s *Service) CreateWithClaims(userID, email string, groups []string) (Session, error) {
 	// Generate random session ID
 	b := make([]byte, 256)
 	if _, err := rand.Read(b); err != nil {
@@ -42,6 +51,8 @@ func (s *Service) Create(userID string) (Session, error) {
 	session := Session{
 		ID:        sessionID,
 		UserID:    userID,
+		Email:     email,
+		Groups:    groups,
 		CreatedAt: time.Now(),
 		ExpiresAt: time.Now().Add(24 * time.Hour),
 	}
@@ -75,3 +86,18 @@ func (s *Service) Delete(sessionID string) {
 	delete(s.sessions, sessionID)
 	s.mu.Unlock()
 }
+
+// Count returns the number of unexpired sessions
+func (s *Service) Count() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	count := 0
+	for _, session := range s.sessions {
+		if now.Before(session.ExpiresAt) {
+			count++
+		}
+	}
+	return count
+}
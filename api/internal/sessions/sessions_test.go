@@ -33,7 +33,7 @@ func TestSessionService(t *testing.T) {
 		}
 
 		got := service.Get(session.ID)
-		if got == (Session{}) {
+		if got.ID == "" {
 			t.Fatal("Expected to get session, got nil")
 		}
 
@@ -54,7 +54,7 @@ func TestSessionService(t *testing.T) {
 		service.sessions[session.ID].ExpiresAt = time.Now().Add(-time.Hour)
 
 		got := service.Get(session.ID)
-		if got != (Session{}) {
+		if got.ID != "" {
 			t.Error("Expected nil for expired session, got session")
 		}
 	})
@@ -68,8 +68,32 @@ func TestSessionService(t *testing.T) {
 
 		service.Delete(session.ID)
 
-		if got := service.Get(session.ID); got != (Session{}) {
+		if got := service.Get(session.ID); got.ID != "" {
 			t.Error("Expected nil after deletion, got session")
 		}
 	})
 }
+
+func TestSessionCount(t *testing.T) {
+	service := New()
+	if got := service.Count(); got != 0 {
+		t.Fatalf("Count() = %d, want 0", got)
+	}
+
+	first, _ := service.Create("testuser")
+	service.Create("otheruser")
+	expired, _ := service.Create("expireduser")
+
+	service.mu.Lock()
+	service.sessions[expired.ID].ExpiresAt = time.Now().Add(-time.Minute)
+	service.mu.Unlock()
+
+	if got := service.Count(); got != 2 {
+		t.Errorf("Count() = %d, want 2", got)
+	}
+
+	service.Delete(first.ID)
+	if got := service.Count(); got != 1 {
+		t.Errorf("Count() after Delete() = %d, want 1", got)
+	}
+}
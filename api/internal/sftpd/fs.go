@@ -0,0 +1,365 @@
+package sftpd
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+
+	"github.com/josepheid/file-explorer/api/internal/audit"
+	"github.com/josepheid/file-explorer/api/internal/middleware"
+	"github.com/josepheid/file-explorer/api/internal/tokens"
+)
+
+// SFTP status codes, recorded as the status of audit events
+const (
+	statusOK               = 0
+	statusNoSuchFile       = 2
+	statusPermissionDenied = 3
+	statusFailure          = 4
+	statusOpUnsupported    = 8
+)
+
+var (
+	// errForbidden is returned for paths outside the identity's subtree and changes it has no scope for
+	errForbidden = os.ErrPermission
+	// errIsDir is returned when opening a directory as a file
+	errIsDir = errors.New("sftpd: is a directory")
+)
+
+// fileSystem handles the SFTP requests of one session, confining them to the root directory
+// and to what the session's identity is allowed to do
+type fileSystem struct {
+	server   *Server
+	identity middleware.Identity
+	clientIP string
+}
+
+// resolve maps a path as the client names it to the file in the root directory, checking the identity may access it.
+// Clients name paths relative to the root, so cleaning them as absolute paths keeps them inside it.
+func (f *fileSystem) resolve(p string) (cleanPath, absPath string, err error) {
+	cleanPath = path.Clean("/" + p)
+	if !f.identity.AllowsPath(cleanPath) {
+		return cleanPath, "", errForbidden
+	}
+	return cleanPath, filepath.Join(f.server.cfg.Root, filepath.FromSlash(cleanPath)), nil
+}
+
+// resolveWrite is resolve for requests that change cleanPath, which also need a writable server and write scope.
+// The root itself can never be removed or renamed.
+func (f *fileSystem) resolveWrite(p string) (cleanPath, absPath string, err error) {
+	cleanPath, absPath, err = f.resolve(p)
+	if err != nil {
+		return cleanPath, "", err
+	}
+	if !f.server.cfg.Writable || !f.identity.HasScope(tokens.ScopeWrite) {
+		return cleanPath, "", errForbidden
+	}
+	return cleanPath, absPath, nil
+}
+
+// Fileread opens a file for reading
+func (f *fileSystem) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	start := time.Now()
+	cleanPath, absPath, err := f.resolve(r.Filepath)
+	if err != nil {
+		return nil, f.done("get", cleanPath, start, err)
+	}
+
+	file, err := openFile(absPath, os.O_RDONLY)
+	if err != nil {
+		return nil, f.done("get", cleanPath, start, err)
+	}
+	return file, f.done("get", cleanPath, start, nil)
+}
+
+// Filewrite opens a file for writing, creating it unless the client asked for an existing file
+func (f *fileSystem) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	return f.openWrite(r, os.O_WRONLY)
+}
+
+// OpenFile opens a file for reading and writing, creating it unless the client asked for an existing file
+func (f *fileSystem) OpenFile(r *sftp.Request) (sftp.WriterAtReaderAt, error) {
+	return f.openWrite(r, os.O_RDWR)
+}
+
+func (f *fileSystem) openWrite(r *sftp.Request, flag int) (*file, error) {
+	start := time.Now()
+	cleanPath, absPath, err := f.resolveWrite(r.Filepath)
+	if err != nil {
+		return nil, f.done("put", cleanPath, start, err)
+	}
+
+	pflags := r.Pflags()
+	if pflags.Creat {
+		flag |= os.O_CREATE
+	}
+	if pflags.Trunc {
+		flag |= os.O_TRUNC
+	}
+	if pflags.Excl {
+		flag |= os.O_EXCL
+	}
+	if pflags.Append {
+		flag |= os.O_APPEND
+	}
+
+	file, err := openFile(absPath, flag)
+	if err != nil {
+		return nil, f.done("put", cleanPath, start, err)
+	}
+	return file, f.done("put", cleanPath, start, nil)
+}
+
+// Filecmd handles requests that change files without transferring data. Links are not supported,
+// as they could point outside the root.
+func (f *fileSystem) Filecmd(r *sftp.Request) error {
+	start := time.Now()
+	action := strings.ToLower(r.Method)
+
+	cleanPath, absPath, err := f.resolveWrite(r.Filepath)
+	if err != nil {
+		return f.done(action, cleanPath, start, err)
+	}
+
+	switch r.Method {
+	case "Mkdir":
+		err = os.Mkdir(absPath, 0777)
+	case "Rmdir", "Remove":
+		err = f.remove(cleanPath, absPath, r.Method == "Rmdir")
+	case "Rename", "PosixRename":
+		err = f.rename(cleanPath, absPath, r.Target, r.Method == "PosixRename")
+	case "Setstat":
+		err = setstat(absPath, r)
+	default:
+		err = sftp.ErrSSHFxOpUnsupported
+	}
+
+	return f.done(action, cleanPath, start, err)
+}
+
+// remove deletes a file or, if dir is set, an empty directory
+func (f *fileSystem) remove(cleanPath, absPath string, dir bool) error {
+	if cleanPath == "/" {
+		return errForbidden
+	}
+
+	info, err := os.Lstat(absPath)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() != dir {
+		return sftp.ErrSSHFxFailure
+	}
+	return os.Remove(absPath)
+}
+
+// rename moves cleanPath to target. Plain SFTP renames fail if target exists, the POSIX extension replaces it.
+func (f *fileSystem) rename(cleanPath, absPath, target string, replace bool) error {
+	if cleanPath == "/" {
+		return errForbidden
+	}
+
+	targetPath, targetAbsPath, err := f.resolveWrite(target)
+	if err != nil {
+		return err
+	}
+	if targetPath == "/" {
+		return errForbidden
+	}
+
+	if !replace {
+		if _, err := os.Lstat(targetAbsPath); err == nil {
+			return sftp.ErrSSHFxFailure
+		}
+	}
+	return os.Rename(absPath, targetAbsPath)
+}
+
+// setstat applies the size, permissions and times of a request, ownership is left alone
+func setstat(absPath string, r *sftp.Request) error {
+	flags := r.AttrFlags()
+	attrs := r.Attributes()
+
+	if flags.Size {
+		if err := os.Truncate(absPath, int64(attrs.Size)); err != nil {
+			return err
+		}
+	}
+	if flags.Permissions {
+		if err := os.Chmod(absPath, attrs.FileMode().Perm()); err != nil {
+			return err
+		}
+	}
+	if flags.Acmodtime {
+		if err := os.Chtimes(absPath, attrs.AccessTime(), attrs.ModTime()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Filelist lists directories and stats files. Only listings are audited, clients stat files all the time.
+func (f *fileSystem) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	start := time.Now()
+	cleanPath, absPath, err := f.resolve(r.Filepath)
+
+	switch r.Method {
+	case "List":
+		if err != nil {
+			return nil, f.done("list", cleanPath, start, err)
+		}
+		entries, err := os.ReadDir(absPath)
+		if err != nil {
+			return nil, f.done("list", cleanPath, start, err)
+		}
+
+		infos := make(listerAt, 0, len(entries))
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil {
+				continue // Skip entries we can't read
+			}
+			infos = append(infos, info)
+		}
+		return infos, f.done("list", cleanPath, start, nil)
+	case "Stat", "Lstat":
+		if err != nil {
+			return nil, f.status(err)
+		}
+		stat := os.Stat
+		if r.Method == "Lstat" {
+			stat = os.Lstat
+		}
+		info, err := stat(absPath)
+		if err != nil {
+			return nil, f.status(err)
+		}
+		return listerAt{info}, nil
+	default:
+		return nil, sftp.ErrSSHFxOpUnsupported
+	}
+}
+
+// done records a request in the audit log and returns err as the client should see it
+func (f *fileSystem) done(action, cleanPath string, start time.Time, err error) error {
+	status, code := f.status(err), statusCode(err)
+
+	outcome := audit.OutcomeSuccess
+	switch code {
+	case statusOK:
+	case statusPermissionDenied:
+		outcome = audit.OutcomeDenied
+	default:
+		outcome = audit.OutcomeFailure
+	}
+
+	f.server.record(audit.Event{
+		Action:    "sftp." + action,
+		UserID:    f.identity.UserID,
+		ClientIP:  f.clientIP,
+		Path:      cleanPath,
+		Outcome:   outcome,
+		Status:    code,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	})
+	return status
+}
+
+// status maps err to an SFTP status error. The errors of the os package name files by their path on the
+// filesystem, which clients must not see, so they are never passed on.
+func (f *fileSystem) status(err error) error {
+	switch statusCode(err) {
+	case statusOK:
+		return nil
+	case statusNoSuchFile:
+		return sftp.ErrSSHFxNoSuchFile
+	case statusPermissionDenied:
+		return sftp.ErrSSHFxPermissionDenied
+	case statusOpUnsupported:
+		return sftp.ErrSSHFxOpUnsupported
+	default:
+		if !errors.Is(err, sftp.ErrSSHFxFailure) && !errors.Is(err, errIsDir) && !errors.Is(err, os.ErrExist) {
+			f.server.cfg.Logger.Warn("sftp request failed", slog.String("user", f.identity.UserID), slog.Any("error", err))
+		}
+		return sftp.ErrSSHFxFailure
+	}
+}
+
+// statusCode returns the SFTP status code for err
+func statusCode(err error) int {
+	switch {
+	case err == nil:
+		return statusOK
+	case errors.Is(err, os.ErrNotExist):
+		return statusNoSuchFile
+	case errors.Is(err, os.ErrPermission):
+		return statusPermissionDenied
+	case errors.Is(err, sftp.ErrSSHFxOpUnsupported):
+		return statusOpUnsupported
+	default:
+		return statusFailure
+	}
+}
+
+// file is an open file whose errors do not reveal its path on the filesystem
+type file struct {
+	*os.File
+}
+
+// openFile opens the regular file at absPath
+func openFile(absPath string, flag int) (*file, error) {
+	f, err := os.OpenFile(absPath, flag, 0666)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, errIsDir
+	}
+	return &file{File: f}, nil
+}
+
+func (f *file) ReadAt(b []byte, off int64) (int, error) {
+	n, err := f.File.ReadAt(b, off)
+	return n, unwrapPathError(err)
+}
+
+func (f *file) WriteAt(b []byte, off int64) (int, error) {
+	n, err := f.File.WriteAt(b, off)
+	return n, unwrapPathError(err)
+}
+
+// unwrapPathError drops the path from an *os.PathError
+func unwrapPathError(err error) error {
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err
+	}
+	return err
+}
+
+// listerAt serves a fixed list of files to the SFTP server
+type listerAt []os.FileInfo
+
+func (l listerAt) ListAt(ls []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+	n := copy(ls, l[offset:])
+	if n < len(ls) {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,317 @@
+package sftpd
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/josepheid/file-explorer/api/internal/audit"
+	"github.com/josepheid/file-explorer/api/internal/middleware"
+	"github.com/josepheid/file-explorer/api/internal/tokens"
+)
+
+// ErrServerClosed is returned by Serve once Close has been called
+var ErrServerClosed = errors.New("sftpd: server closed")
+
+// errDenied is returned to clients for any failed login, so they cannot tell why it failed
+var errDenied = errors.New("sftpd: access denied")
+
+// Keys of the ssh.Permissions extensions the identity of a connection is carried in
+const (
+	extUser   = "user"
+	extMethod = "method"
+	extScopes = "scopes"
+	extPath   = "path"
+)
+
+// Config configures a Server
+type Config struct {
+	// Root is the directory served, paths are confined to it like those of the HTTP API
+	Root string
+	// HostKey identifies the server to clients
+	HostKey ssh.Signer
+	// Credentials checks passwords, e.g. an auth.Authenticator. Without it passwords are only accepted as tokens.
+	Credentials middleware.CredentialValidator
+	// SecondFactor, if set, reports whether a user has a second factor enabled.
+	// Such users cannot log in with their password, as SFTP has no way to ask for the code.
+	SecondFactor func(userID string) bool
+	// Keys, if set, reports whether a public key may be used to log in as a user
+	Keys func(username string, key ssh.PublicKey) bool
+	// Tokens, if set, accepts personal access tokens as passwords, with any username.
+	// The token's scopes and path apply as they do over HTTP.
+	Tokens *tokens.Service
+	// Writable allows clients with write scope to change files, otherwise the root is served read-only
+	Writable bool
+	// AuditLog, if set, records logins and file operations alongside the HTTP API's requests
+	AuditLog *audit.Log
+	// Logger defaults to slog.Default()
+	Logger *slog.Logger
+}
+
+// Server serves the root directory over SFTP. Logins use the same users, tokens and access rules as the HTTP API.
+type Server struct {
+	cfg    Config
+	config *ssh.ServerConfig
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// New creates a Server, it takes the configuration as a parameter
+func New(cfg Config) *Server {
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+
+	s := &Server{
+		cfg:       cfg,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+	s.config = &ssh.ServerConfig{
+		PasswordCallback: s.checkPassword,
+		ServerVersion:    "SSH-2.0-FileExplorer",
+	}
+	if cfg.Keys != nil {
+		s.config.PublicKeyCallback = s.checkKey
+	}
+	s.config.AddHostKey(cfg.HostKey)
+
+	return s
+}
+
+// Serve accepts connections on ln until Close is called, when it returns ErrServerClosed
+func (s *Server) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		ln.Close()
+		return ErrServerClosed
+	}
+	s.listeners[ln] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			delete(s.listeners, ln)
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return ErrServerClosed
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			s.handleConn(conn)
+
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// Close stops accepting connections and ends open sessions, including transfers in progress,
+// then waits for them to finish
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	var err error
+	for ln := range s.listeners {
+		err = errors.Join(err, ln.Close())
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+// handleConn performs the SSH handshake and serves the connection's sessions
+func (s *Server) handleConn(conn net.Conn) {
+	defer conn.Close()
+
+	sshConn, chans, reqs, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		s.cfg.Logger.Debug("sftp handshake failed", slog.String("remote", conn.RemoteAddr().String()), slog.Any("error", err))
+		return
+	}
+	defer sshConn.Close()
+
+	identity := identityFromPermissions(sshConn.Permissions)
+	clientIP := clientIP(conn.RemoteAddr())
+	s.record(audit.Event{Action: "sftp.login", UserID: identity.UserID, ClientIP: clientIP, Outcome: audit.OutcomeSuccess})
+
+	go ssh.DiscardRequests(reqs)
+
+	var sessions sync.WaitGroup
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only session channels are supported")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			s.cfg.Logger.Warn("failed to accept sftp session", slog.Any("error", err))
+			continue
+		}
+
+		sessions.Add(1)
+		go func() {
+			defer sessions.Done()
+			s.serveSession(channel, requests, &fileSystem{server: s, identity: identity, clientIP: clientIP})
+		}()
+	}
+	sessions.Wait()
+}
+
+// serveSession runs the SFTP subsystem on a session channel, anything else such as a shell is refused
+func (s *Server) serveSession(channel ssh.Channel, requests <-chan *ssh.Request, fs *fileSystem) {
+	defer channel.Close()
+
+	for req := range requests {
+		// the payload of a subsystem request is the subsystem's name as an SSH string
+		if req.Type != "subsystem" || len(req.Payload) < 4 || string(req.Payload[4:]) != "sftp" {
+			req.Reply(false, nil)
+			continue
+		}
+		req.Reply(true, nil)
+
+		// clients with a restricted path start in their own directory, as they cannot list the root
+		start := "/"
+		if fs.identity.Path != "" {
+			start = fs.identity.Path
+		}
+		server := sftp.NewRequestServer(channel, sftp.Handlers{FileGet: fs, FilePut: fs, FileCmd: fs, FileList: fs}, sftp.WithStartDirectory(start))
+		if err := server.Serve(); err != nil && !errors.Is(err, io.EOF) {
+			s.cfg.Logger.Warn("sftp session ended", slog.String("user", fs.identity.UserID), slog.Any("error", err))
+		}
+		server.Close()
+		return
+	}
+}
+
+// checkPassword authenticates a password login, accepting a token in place of the password
+func (s *Server) checkPassword(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+	if s.cfg.Tokens != nil {
+		if token, err := s.cfg.Tokens.Validate(string(password)); err == nil {
+			return permissions(middleware.Identity{UserID: token.UserID, Method: middleware.MethodToken, Scopes: token.Scopes, Path: token.Path}), nil
+		}
+	}
+
+	if s.cfg.Credentials == nil || s.cfg.Credentials.ValidateCredentials(conn.User(), string(password)) != nil ||
+		(s.cfg.SecondFactor != nil && s.cfg.SecondFactor(conn.User())) {
+		s.record(audit.Event{Action: "sftp.login", UserID: conn.User(), ClientIP: clientIP(conn.RemoteAddr()), Outcome: audit.OutcomeDenied, Status: statusPermissionDenied})
+		return nil, errDenied
+	}
+
+	return permissions(middleware.Identity{UserID: conn.User(), Method: middleware.MethodPassword}), nil
+}
+
+// checkKey authenticates a public key login. Clients offer keys before proving they hold them,
+// so rejected keys are not audited, only the login once it has succeeded.
+func (s *Server) checkKey(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	if !s.cfg.Keys(conn.User(), key) {
+		return nil, errDenied
+	}
+	return permissions(middleware.Identity{UserID: conn.User(), Method: middleware.MethodPublicKey}), nil
+}
+
+// record writes e to the audit log, if there is one
+func (s *Server) record(e audit.Event) {
+	if s.cfg.AuditLog == nil {
+		return
+	}
+	e.Time = time.Now().UTC()
+	e.Method = "SFTP"
+	if err := s.cfg.AuditLog.Record(e); err != nil {
+		s.cfg.Logger.Error("failed to record audit event", slog.String("action", e.Action), slog.Any("error", err))
+	}
+}
+
+// permissions carries identity through the handshake to the connection
+func permissions(identity middleware.Identity) *ssh.Permissions {
+	ext := map[string]string{
+		extUser:   identity.UserID,
+		extMethod: identity.Method,
+		extPath:   identity.Path,
+	}
+	if identity.Scopes != nil {
+		ext[extScopes] = strings.Join(identity.Scopes, ",")
+	}
+	return &ssh.Permissions{Extensions: ext}
+}
+
+// identityFromPermissions recovers the identity stored by permissions
+func identityFromPermissions(p *ssh.Permissions) middleware.Identity {
+	identity := middleware.Identity{
+		UserID: p.Extensions[extUser],
+		Method: p.Extensions[extMethod],
+		Path:   p.Extensions[extPath],
+	}
+	if scopes, ok := p.Extensions[extScopes]; ok {
+		identity.Scopes = strings.Split(scopes, ",")
+	}
+	return identity
+}
+
+// clientIP returns the host part of addr
+func clientIP(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// LoadHostKey reads a PEM encoded private key to identify the server with, e.g. one created by ssh-keygen
+func LoadHostKey(path string) (ssh.Signer, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SFTP host key: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(pem)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SFTP host key: %w", err)
+	}
+	return signer, nil
+}
+
+// GenerateHostKey creates a new ed25519 host key, it only lives as long as the process
+func GenerateHostKey() (ssh.Signer, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.NewSignerFromKey(key)
+}
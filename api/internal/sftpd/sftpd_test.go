@@ -0,0 +1,312 @@
+package sftpd
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/josepheid/file-explorer/api/internal/audit"
+	"github.com/josepheid/file-explorer/api/internal/tokens"
+)
+
+type passwords map[string]string
+
+func (p passwords) ValidateCredentials(username, password string) error {
+	if want, ok := p[username]; !ok || want != password {
+		return errors.New("invalid credentials")
+	}
+	return nil
+}
+
+func newSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+type testServer struct {
+	addr   string
+	root   string
+	tokens *tokens.Service
+	audit  *audit.Log
+	key    ssh.Signer
+}
+
+// startServer serves a root directory holding docs/readme.txt and private/secret.txt
+func startServer(t *testing.T, writable bool) *testServer {
+	t.Helper()
+
+	root := t.TempDir()
+	for name, content := range map[string]string{"docs/readme.txt": "hello", "private/secret.txt": "secret"} {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	auditLog, err := audit.New(filepath.Join(t.TempDir(), "audit.log"), 1<<20, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { auditLog.Close() })
+
+	ts := &testServer{root: root, tokens: tokens.New(), audit: auditLog, key: newSigner(t)}
+	server := New(Config{
+		Root:         root,
+		HostKey:      newSigner(t),
+		Credentials:  passwords{"alice": "secret", "bob": "secret"},
+		SecondFactor: func(userID string) bool { return userID == "bob" },
+		Keys: func(username string, key ssh.PublicKey) bool {
+			return username == "alice" && string(key.Marshal()) == string(ts.key.PublicKey().Marshal())
+		},
+		Tokens:   ts.tokens,
+		Writable: writable,
+		AuditLog: auditLog,
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.addr = ln.Addr().String()
+
+	done := make(chan error, 1)
+	go func() { done <- server.Serve(ln) }()
+	t.Cleanup(func() {
+		server.Close()
+		if err := <-done; !errors.Is(err, ErrServerClosed) {
+			t.Errorf("Serve() error = %v, want ErrServerClosed", err)
+		}
+	})
+
+	return ts
+}
+
+func (ts *testServer) dial(user string, auth ssh.AuthMethod) (*sftp.Client, error) {
+	conn, err := ssh.Dial("tcp", ts.addr, &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+func (ts *testServer) mustDial(t *testing.T, user string, auth ssh.AuthMethod) *sftp.Client {
+	t.Helper()
+	client, err := ts.dial(user, auth)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func readFile(client *sftp.Client, p string) (string, error) {
+	f, err := client.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	return string(b), err
+}
+
+func TestServerLogin(t *testing.T) {
+	ts := startServer(t, false)
+	_, readToken, err := ts.tokens.Create("alice", "ci", []string{tokens.ScopeRead}, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		user    string
+		auth    ssh.AuthMethod
+		wantErr bool
+	}{
+		{name: "password", user: "alice", auth: ssh.Password("secret")},
+		{name: "token as password", user: "anyone", auth: ssh.Password(readToken)},
+		{name: "authorized key", user: "alice", auth: ssh.PublicKeys(ts.key)},
+		{name: "wrong password", user: "alice", auth: ssh.Password("wrong"), wantErr: true},
+		{name: "second factor enabled", user: "bob", auth: ssh.Password("secret"), wantErr: true},
+		{name: "key of another user", user: "bob", auth: ssh.PublicKeys(ts.key), wantErr: true},
+		{name: "unknown key", user: "alice", auth: ssh.PublicKeys(newSigner(t)), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := ts.dial(tt.user, tt.auth)
+			if tt.wantErr {
+				if err == nil {
+					client.Close()
+					t.Fatal("login succeeded, want it to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("login failed: %v", err)
+			}
+			defer client.Close()
+
+			if got, err := readFile(client, "/docs/readme.txt"); err != nil || got != "hello" {
+				t.Errorf("read = %q, %v, want %q", got, err, "hello")
+			}
+		})
+	}
+
+	events, err := ts.audit.Query(audit.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logins := map[string]int{}
+	for _, e := range events {
+		if e.Action == "sftp.login" {
+			logins[e.Outcome]++
+		}
+	}
+	if logins[audit.OutcomeSuccess] != 3 || logins[audit.OutcomeDenied] != 2 {
+		t.Errorf("audited logins = %v, want 3 successful and 2 denied", logins)
+	}
+}
+
+func TestServerReadOnly(t *testing.T) {
+	ts := startServer(t, false)
+	client := ts.mustDial(t, "alice", ssh.Password("secret"))
+
+	entries, err := client.ReadDir("/")
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("ReadDir() returned %d entries, want 2", len(entries))
+	}
+
+	// paths are confined to the root however they are written
+	if got, err := readFile(client, "/../../docs/readme.txt"); err != nil || got != "hello" {
+		t.Errorf("read = %q, %v, want %q", got, err, "hello")
+	}
+
+	if _, err := client.Create("/new.txt"); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("Create() error = %v, want permission denied", err)
+	}
+	if err := client.Mkdir("/new"); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("Mkdir() error = %v, want permission denied", err)
+	}
+	if err := client.Remove("/docs/readme.txt"); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("Remove() error = %v, want permission denied", err)
+	}
+
+	events, err := ts.audit.Query(audit.Filter{PathPrefix: "/new.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Action != "sftp.put" || events[0].Outcome != audit.OutcomeDenied || events[0].UserID != "alice" {
+		t.Errorf("audited events = %+v, want one denied sftp.put by alice", events)
+	}
+}
+
+func TestServerWritable(t *testing.T) {
+	ts := startServer(t, true)
+	client := ts.mustDial(t, "alice", ssh.Password("secret"))
+
+	f, err := client.Create("/docs/new.txt")
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if _, err := f.Write([]byte("written")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	f.Close()
+	if b, err := os.ReadFile(filepath.Join(ts.root, "docs", "new.txt")); err != nil || string(b) != "written" {
+		t.Errorf("file = %q, %v, want %q", b, err, "written")
+	}
+
+	if err := client.Mkdir("/archive"); err != nil {
+		t.Fatalf("Mkdir() error = %v", err)
+	}
+	if err := client.Rename("/docs/new.txt", "/archive/new.txt"); err != nil {
+		t.Fatalf("Rename() error = %v", err)
+	}
+	if err := client.Rename("/archive/new.txt", "/docs/readme.txt"); err == nil {
+		t.Error("Rename() over an existing file succeeded")
+	}
+	if err := client.Remove("/archive/new.txt"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if err := client.RemoveDirectory("/archive"); err != nil {
+		t.Fatalf("RemoveDirectory() error = %v", err)
+	}
+	if err := client.Symlink("/private/secret.txt", "/docs/link"); err == nil {
+		t.Error("Symlink() succeeded")
+	}
+
+	// errors never reveal where the root is on the filesystem
+	_, err = client.Open("/missing.txt")
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Open() error = %v, want not exist", err)
+	}
+	if err != nil && strings.Contains(err.Error(), ts.root) {
+		t.Errorf("Open() error %q reveals the root directory", err)
+	}
+}
+
+func TestServerTokenRestrictions(t *testing.T) {
+	ts := startServer(t, true)
+	_, readToken, err := ts.tokens.Create("alice", "read", []string{tokens.ScopeRead}, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, docsToken, err := ts.tokens.Create("alice", "docs", []string{tokens.ScopeWrite}, "/docs", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader := ts.mustDial(t, "alice", ssh.Password(readToken))
+	if _, err := reader.Create("/docs/new.txt"); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("Create() with a read token error = %v, want permission denied", err)
+	}
+
+	docs := ts.mustDial(t, "alice", ssh.Password(docsToken))
+	if wd, err := docs.Getwd(); err != nil || wd != "/docs" {
+		t.Errorf("Getwd() = %q, %v, want /docs", wd, err)
+	}
+	if got, err := readFile(docs, "readme.txt"); err != nil || got != "hello" {
+		t.Errorf("read = %q, %v, want %q", got, err, "hello")
+	}
+	if _, err := readFile(docs, "/private/secret.txt"); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("read outside the token's path error = %v, want permission denied", err)
+	}
+	if _, err := docs.ReadDir("/"); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("ReadDir() of the root error = %v, want permission denied", err)
+	}
+	if err := docs.Rename("/docs/readme.txt", "/private/readme.txt"); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("Rename() out of the token's path error = %v, want permission denied", err)
+	}
+}
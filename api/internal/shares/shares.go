@@ -0,0 +1,243 @@
+package shares
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// DefaultTTL is how long a share lasts when no expiry is given
+	DefaultTTL = 7 * 24 * time.Hour
+	// MaxTTL bounds how far in the future a share can expire
+	MaxTTL = 90 * 24 * time.Hour
+	// maxPasswordLength is the longest password bcrypt can hash
+	maxPasswordLength = 72
+)
+
+// prefix makes share secrets easy to recognise, e.g. by secret scanners
+const prefix = "fs_"
+
+var (
+	// ErrNotFound is returned for shares that are unknown, revoked or expired
+	ErrNotFound = errors.New("shares: share not found")
+	// ErrPasswordRequired is returned when opening a password protected share without a password
+	ErrPasswordRequired = errors.New("shares: password required")
+	// ErrWrongPassword is returned when opening a share with the wrong password
+	ErrWrongPassword = errors.New("shares: wrong password")
+	// ErrLimitReached is returned when a share has been downloaded as often as it allows
+	ErrLimitReached = errors.New("shares: download limit reached")
+	// ErrInvalidPath is returned when creating a share of a path that is not absolute
+	ErrInvalidPath = errors.New("shares: path must be an absolute path")
+	// ErrPasswordTooLong is returned when creating a share with a password longer than 72 bytes
+	ErrPasswordTooLong = errors.New("shares: password must be at most 72 bytes")
+)
+
+// Share represents a link giving anyone who has it access to a file or directory, the secret itself is never stored
+type Share struct {
+	// ID uniquely identifies the share and is safe to display
+	ID string `json:"id"`
+	// UserID identifies the user who created the share
+	UserID string `json:"-"`
+	// Path is the shared file or directory
+	Path string `json:"path"`
+	// Dir is set if Path is a directory, everything below it is shared
+	Dir       bool      `json:"dir"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// MaxDownloads limits how often files can be downloaded through the share, 0 means no limit
+	MaxDownloads int `json:"maxDownloads,omitempty"`
+	// Downloads counts the files downloaded through the share
+	Downloads int `json:"downloads"`
+	// PasswordProtected is set if the share can only be opened with a password
+	PasswordProtected bool `json:"passwordProtected"`
+
+	hash         string
+	passwordHash []byte
+}
+
+// Options describe a new share
+type Options struct {
+	Path string
+	Dir  bool
+	// ExpiresAt is when the share stops working, the zero time means DefaultTTL from now
+	ExpiresAt    time.Time
+	MaxDownloads int
+	// Password, if set, has to be given to open the share
+	Password string
+}
+
+// Service manages share links including creation, validation, and revocation
+type Service struct {
+	shares map[string]*Share // hash -> share
+	mu     sync.RWMutex
+}
+
+func New() *Service {
+	return &Service{
+		shares: make(map[string]*Share),
+	}
+}
+
+// Create issues a new share for userID and returns it along with its secret.
+// The secret is only available at creation time.
+func (s *Service) Create(userID string, opts Options) (Share, string, error) {
+	if !strings.HasPrefix(opts.Path, "/") {
+		return Share{}, "", ErrInvalidPath
+	}
+	if len(opts.Password) > maxPasswordLength {
+		return Share{}, "", ErrPasswordTooLong
+	}
+
+	share := Share{
+		UserID:            userID,
+		Path:              path.Clean(opts.Path),
+		Dir:               opts.Dir,
+		CreatedAt:         time.Now(),
+		ExpiresAt:         opts.ExpiresAt,
+		MaxDownloads:      opts.MaxDownloads,
+		PasswordProtected: opts.Password != "",
+	}
+	if share.ExpiresAt.IsZero() {
+		share.ExpiresAt = share.CreatedAt.Add(DefaultTTL)
+	}
+	if opts.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(opts.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return Share{}, "", err
+		}
+		share.passwordHash = hash
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return Share{}, "", err
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return Share{}, "", err
+	}
+	secret := prefix + base64.RawURLEncoding.EncodeToString(b)
+	share.ID = hex.EncodeToString(id)
+	share.hash = hashSecret(secret)
+
+	s.mu.Lock()
+	s.expire()
+	s.shares[share.hash] = &share
+	s.mu.Unlock()
+
+	return share, secret, nil
+}
+
+// Open returns the share matching secret, checking password if the share is protected by one.
+// It fails with ErrNotFound if the share is unknown or expired, and ErrLimitReached if it has no downloads left.
+func (s *Service) Open(secret, password string) (Share, error) {
+	if !strings.HasPrefix(secret, prefix) {
+		return Share{}, ErrNotFound
+	}
+
+	// shares are looked up by the hash of the secret so the secret is never compared directly
+	s.mu.RLock()
+	share, exists := s.shares[hashSecret(secret)]
+	var snapshot Share
+	if exists {
+		snapshot = *share
+	}
+	s.mu.RUnlock()
+	if !exists || time.Now().After(snapshot.ExpiresAt) {
+		return Share{}, ErrNotFound
+	}
+
+	if snapshot.PasswordProtected {
+		if password == "" {
+			return Share{}, ErrPasswordRequired
+		}
+		if bcrypt.CompareHashAndPassword(snapshot.passwordHash, []byte(password)) != nil {
+			return Share{}, ErrWrongPassword
+		}
+	}
+
+	if snapshot.MaxDownloads > 0 && snapshot.Downloads >= snapshot.MaxDownloads {
+		return Share{}, ErrLimitReached
+	}
+
+	return snapshot, nil
+}
+
+// Download counts a download through the share with the given ID, failing with ErrLimitReached if it has none left
+// and ErrNotFound if it was revoked in the meantime
+func (s *Service) Download(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, share := range s.shares {
+		if share.ID != id {
+			continue
+		}
+		if share.MaxDownloads > 0 && share.Downloads >= share.MaxDownloads {
+			return ErrLimitReached
+		}
+		share.Downloads++
+		return nil
+	}
+
+	return ErrNotFound
+}
+
+// List returns the unexpired shares created by userID, oldest first
+func (s *Service) List(userID string) []Share {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	list := make([]Share, 0)
+	for _, share := range s.shares {
+		if share.UserID == userID && !now.After(share.ExpiresAt) {
+			list = append(list, *share)
+		}
+	}
+	slices.SortFunc(list, func(a, b Share) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	return list
+}
+
+// Revoke deletes the share with the given ID if it was created by userID
+func (s *Service) Revoke(userID, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, share := range s.shares {
+		if share.ID == id && share.UserID == userID {
+			delete(s.shares, hash)
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+// expire forgets expired shares, the caller must hold s.mu
+func (s *Service) expire() {
+	now := time.Now()
+	for hash, share := range s.shares {
+		if now.After(share.ExpiresAt) {
+			delete(s.shares, hash)
+		}
+	}
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
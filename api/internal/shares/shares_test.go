@@ -0,0 +1,125 @@
+package shares
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShareService(t *testing.T) {
+	service := New()
+
+	t.Run("create and open share", func(t *testing.T) {
+		share, secret, err := service.Create("testuser", Options{Path: "/docs/../docs/report.pdf"})
+		if err != nil {
+			t.Fatalf("Failed to create share: %v", err)
+		}
+
+		if secret == "" || share.ID == "" {
+			t.Fatal("Share secret and ID should not be empty")
+		}
+		if share.Path != "/docs/report.pdf" {
+			t.Errorf("Expected path %q, got %q", "/docs/report.pdf", share.Path)
+		}
+		if want := share.CreatedAt.Add(DefaultTTL); !share.ExpiresAt.Equal(want) {
+			t.Errorf("Expected default expiry %v, got %v", want, share.ExpiresAt)
+		}
+
+		got, err := service.Open(secret, "")
+		if err != nil {
+			t.Fatalf("Failed to open share: %v", err)
+		}
+		if got.UserID != "testuser" || got.ID != share.ID {
+			t.Errorf("Opened share does not match, got %+v", got)
+		}
+	})
+
+	t.Run("unknown and expired shares", func(t *testing.T) {
+		if _, err := service.Open("fs_unknown", ""); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound, got %v", err)
+		}
+
+		_, secret, err := service.Create("testuser", Options{Path: "/docs", ExpiresAt: time.Now().Add(-time.Hour)})
+		if err != nil {
+			t.Fatalf("Failed to create share: %v", err)
+		}
+		if _, err := service.Open(secret, ""); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound for an expired share, got %v", err)
+		}
+	})
+
+	t.Run("password", func(t *testing.T) {
+		share, secret, err := service.Create("testuser", Options{Path: "/docs", Password: "hunter2"})
+		if err != nil {
+			t.Fatalf("Failed to create share: %v", err)
+		}
+		if !share.PasswordProtected {
+			t.Error("Expected the share to be password protected")
+		}
+
+		if _, err := service.Open(secret, ""); !errors.Is(err, ErrPasswordRequired) {
+			t.Errorf("Expected ErrPasswordRequired, got %v", err)
+		}
+		if _, err := service.Open(secret, "hunter3"); !errors.Is(err, ErrWrongPassword) {
+			t.Errorf("Expected ErrWrongPassword, got %v", err)
+		}
+		if _, err := service.Open(secret, "hunter2"); err != nil {
+			t.Errorf("Failed to open share with its password: %v", err)
+		}
+	})
+
+	t.Run("download limit", func(t *testing.T) {
+		share, secret, err := service.Create("testuser", Options{Path: "/docs/report.pdf", MaxDownloads: 2})
+		if err != nil {
+			t.Fatalf("Failed to create share: %v", err)
+		}
+
+		for range 2 {
+			if err := service.Download(share.ID); err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+		}
+		if err := service.Download(share.ID); !errors.Is(err, ErrLimitReached) {
+			t.Errorf("Expected ErrLimitReached, got %v", err)
+		}
+		if _, err := service.Open(secret, ""); !errors.Is(err, ErrLimitReached) {
+			t.Errorf("Expected ErrLimitReached opening a used up share, got %v", err)
+		}
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		if _, _, err := service.Create("testuser", Options{Path: "docs"}); !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("Expected ErrInvalidPath, got %v", err)
+		}
+		if _, _, err := service.Create("testuser", Options{Path: "/docs", Password: strings.Repeat("x", 73)}); !errors.Is(err, ErrPasswordTooLong) {
+			t.Errorf("Expected ErrPasswordTooLong, got %v", err)
+		}
+	})
+
+	t.Run("list and revoke", func(t *testing.T) {
+		service := New()
+		first, secret, _ := service.Create("testuser", Options{Path: "/a"})
+		second, _, _ := service.Create("testuser", Options{Path: "/b"})
+		service.Create("otheruser", Options{Path: "/c"})
+		service.Create("testuser", Options{Path: "/d", ExpiresAt: time.Now().Add(-time.Hour)})
+
+		list := service.List("testuser")
+		if len(list) != 2 || list[0].ID != first.ID || list[1].ID != second.ID {
+			t.Fatalf("Expected the unexpired shares oldest first, got %+v", list)
+		}
+
+		if err := service.Revoke("otheruser", first.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound revoking another user's share, got %v", err)
+		}
+		if err := service.Revoke("testuser", first.ID); err != nil {
+			t.Fatalf("Failed to revoke share: %v", err)
+		}
+		if _, err := service.Open(secret, ""); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound for a revoked share, got %v", err)
+		}
+		if err := service.Download(first.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound downloading through a revoked share, got %v", err)
+		}
+	})
+}
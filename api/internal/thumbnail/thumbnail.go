@@ -0,0 +1,281 @@
+package thumbnail
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+const (
+	// DefaultSize is the length of the longer side of a thumbnail in pixels when no size is given
+	DefaultSize = 256
+	// MinSize and MaxSize bound the sizes that can be requested
+	MinSize = 16
+	MaxSize = 1024
+	// maxPixels refuses images that would take too much memory to decode, e.g. crafted decompression bombs
+	maxPixels = 64 << 20
+	// jpegQuality is used for thumbnails of opaque images
+	jpegQuality = 80
+)
+
+var (
+	// ErrUnsupported is returned for files that are not JPEG, PNG, GIF or WebP images
+	ErrUnsupported = errors.New("thumbnail: unsupported image")
+	// ErrTooLarge is returned for images with more than maxPixels pixels
+	ErrTooLarge = errors.New("thumbnail: image too large")
+)
+
+// decoders by file extension, the extension only selects the decoder so a misnamed file fails to decode
+var decoders = map[string]func(*os.File) (image.Image, error){
+	".jpg":  func(f *os.File) (image.Image, error) { return jpeg.Decode(f) },
+	".jpeg": func(f *os.File) (image.Image, error) { return jpeg.Decode(f) },
+	".png":  func(f *os.File) (image.Image, error) { return png.Decode(f) },
+	// only the first frame of an animation is used
+	".gif":  func(f *os.File) (image.Image, error) { return gif.Decode(f) },
+	".webp": func(f *os.File) (image.Image, error) { return webp.Decode(f) },
+}
+
+var configDecoders = map[string]func(*os.File) (image.Config, error){
+	".jpg":  func(f *os.File) (image.Config, error) { return jpeg.DecodeConfig(f) },
+	".jpeg": func(f *os.File) (image.Config, error) { return jpeg.DecodeConfig(f) },
+	".png":  func(f *os.File) (image.Config, error) { return png.DecodeConfig(f) },
+	".gif":  func(f *os.File) (image.Config, error) { return gif.DecodeConfig(f) },
+	".webp": func(f *os.File) (image.Config, error) { return webp.DecodeConfig(f) },
+}
+
+// Supported reports whether thumbnails can be generated for the file name, judging by its extension
+func Supported(name string) bool {
+	_, ok := decoders[strings.ToLower(filepath.Ext(name))]
+	return ok
+}
+
+// Service generates thumbnails and caches them on disk. Entries are keyed by the image's path,
+// modification time and size, so a changed image gets a new thumbnail; stale entries are left behind
+// and the cache directory can be cleared at any time.
+type Service struct {
+	dir string
+	// workers bounds concurrent generation, decoding large images is expensive in both CPU and memory
+	workers chan struct{}
+
+	mu       sync.Mutex
+	inflight map[string]*call
+}
+
+// call is a thumbnail being generated, concurrent requests for the same thumbnail wait for it
+type call struct {
+	done chan struct{}
+	path string
+	err  error
+}
+
+// New creates a Service caching thumbnails in dir, generating at most workers at a time
+func New(dir string, workers int) (*Service, error) {
+	if workers < 1 {
+		return nil, fmt.Errorf("thumbnail: workers must be positive")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("thumbnail: failed to create cache directory: %w", err)
+	}
+
+	// partial files are left behind if the process stopped mid-write
+	if tmp, err := filepath.Glob(filepath.Join(dir, "*.tmp")); err == nil {
+		for _, name := range tmp {
+			os.Remove(name)
+		}
+	}
+
+	return &Service{
+		dir:      dir,
+		workers:  make(chan struct{}, workers),
+		inflight: make(map[string]*call),
+	}, nil
+}
+
+// Get returns the path of the cached thumbnail for the image at path, generating it if needed.
+// info describes the image, size is the length of the thumbnail's longer side.
+// The thumbnail is a PNG if the image has transparency and a JPEG otherwise, ContentType tells them apart.
+func (s *Service) Get(ctx context.Context, path string, info fs.FileInfo, size int) (string, error) {
+	if size < MinSize || size > MaxSize {
+		return "", fmt.Errorf("thumbnail: size %d out of range", size)
+	}
+	if !Supported(path) {
+		return "", ErrUnsupported
+	}
+
+	key := cacheKey(path, info, size)
+	if cached, ok := s.lookup(key); ok {
+		return cached, nil
+	}
+
+	s.mu.Lock()
+	c, ok := s.inflight[key]
+	if !ok {
+		c = &call{done: make(chan struct{})}
+		s.inflight[key] = c
+		go s.generate(c, key, path, size)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.path, c.err
+	case <-ctx.Done():
+		// generation carries on so the next request finds the thumbnail cached
+		return "", ctx.Err()
+	}
+}
+
+// ContentType returns the content type of a thumbnail returned by Get
+func ContentType(path string) string {
+	if filepath.Ext(path) == ".png" {
+		return "image/png"
+	}
+	return "image/jpeg"
+}
+
+func (s *Service) generate(c *call, key, path string, size int) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.inflight, key)
+		s.mu.Unlock()
+		close(c.done)
+	}()
+
+	s.workers <- struct{}{}
+	defer func() { <-s.workers }()
+
+	c.path, c.err = s.create(key, path, size)
+}
+
+// lookup returns the cached thumbnail for key, if there is one
+func (s *Service) lookup(key string) (string, bool) {
+	for _, ext := range []string{".jpg", ".png"} {
+		cached := filepath.Join(s.dir, key+ext)
+		if _, err := os.Stat(cached); err == nil {
+			return cached, true
+		}
+	}
+	return "", false
+}
+
+// create decodes the image, scales it down and writes the thumbnail to the cache
+func (s *Service) create(key, path string, size int) (string, error) {
+	img, err := decode(path)
+	if err != nil {
+		return "", err
+	}
+	thumb := scale(img, size)
+
+	ext := ".jpg"
+	if !opaque(thumb) {
+		ext = ".png"
+	}
+
+	// write to a temporary file first, so a thumbnail is never seen half written
+	tmp, err := os.CreateTemp(s.dir, key+"-*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("thumbnail: failed to create cache entry: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if ext == ".png" {
+		err = png.Encode(tmp, thumb)
+	} else {
+		err = jpeg.Encode(tmp, thumb, &jpeg.Options{Quality: jpegQuality})
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("thumbnail: failed to write cache entry: %w", err)
+	}
+
+	cached := filepath.Join(s.dir, key+ext)
+	if err := os.Rename(tmp.Name(), cached); err != nil {
+		return "", fmt.Errorf("thumbnail: failed to write cache entry: %w", err)
+	}
+	return cached, nil
+}
+
+// decode reads the image at path, checking its dimensions before decoding the pixels
+func decode(path string) (image.Image, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cfg, err := configDecoders[ext](f)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, ErrUnsupported
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxPixels {
+		return nil, ErrTooLarge
+	}
+
+	if _, err := f.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	img, err := decoders[ext](f)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	return img, nil
+}
+
+// scale fits img within size x size, keeping its aspect ratio. Images that already fit are not enlarged.
+func scale(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > size || h > size {
+		if w >= h {
+			w, h = size, max(1, h*size/w)
+		} else {
+			w, h = max(1, w*size/h), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.BiLinear.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+func opaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// cacheKey identifies a thumbnail of a version of an image
+func cacheKey(path string, info fs.FileInfo, size int) string {
+	h := sha256.New()
+	h.Write([]byte(path))
+	h.Write([]byte{0})
+	h.Write(strconv.AppendInt(nil, info.ModTime().UnixNano(), 10))
+	h.Write([]byte{0})
+	h.Write(strconv.AppendInt(nil, info.Size(), 10))
+	h.Write([]byte{0})
+	h.Write(strconv.AppendInt(nil, int64(size), 10))
+	return hex.EncodeToString(h.Sum(nil))
+}
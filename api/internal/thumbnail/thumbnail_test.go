@@ -0,0 +1,263 @@
+package thumbnail
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// writeImage encodes a w x h image in the format given by the extension of name
+func writeImage(t *testing.T, dir, name string, w, h int, transparent bool) string {
+	t.Helper()
+
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{R: uint8(x), G: uint8(y), B: 128, A: 255}
+			if transparent && x < w/2 {
+				c.A = 0
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	path := filepath.Join(dir, name)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	switch filepath.Ext(name) {
+	case ".png":
+		err = png.Encode(f, img)
+	case ".gif":
+		err = gif.Encode(f, img, nil)
+	default:
+		err = jpeg.Encode(f, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func get(t *testing.T, s *Service, path string, size int) (string, error) {
+	t.Helper()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.Get(context.Background(), path, info, size)
+}
+
+func decodeThumbnail(t *testing.T, path string) (image.Config, string) {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	cfg, format, err := image.DecodeConfig(f)
+	if err != nil {
+		t.Fatalf("invalid thumbnail: %v", err)
+	}
+	return cfg, format
+}
+
+func TestGet(t *testing.T) {
+	images := t.TempDir()
+	s, err := New(t.TempDir(), 2)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		w, h       int
+		alpha      bool
+		size       int
+		wantW      int
+		wantH      int
+		wantFormat string
+	}{
+		{name: "landscape.jpg", w: 400, h: 200, size: 100, wantW: 100, wantH: 50, wantFormat: "jpeg"},
+		{name: "portrait.JPEG", w: 200, h: 400, size: 100, wantW: 50, wantH: 100, wantFormat: "jpeg"},
+		{name: "screenshot.png", w: 300, h: 300, size: 64, wantW: 64, wantH: 64, wantFormat: "jpeg"},
+		{name: "logo.png", w: 300, h: 150, alpha: true, size: 64, wantW: 64, wantH: 32, wantFormat: "png"},
+		{name: "animation.gif", w: 128, h: 64, size: 32, wantW: 32, wantH: 16, wantFormat: "jpeg"},
+		{name: "icon.png", w: 20, h: 10, size: 256, wantW: 20, wantH: 10, wantFormat: "jpeg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeImage(t, images, tt.name, tt.w, tt.h, tt.alpha)
+
+			cached, err := get(t, s, path, tt.size)
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+
+			cfg, format := decodeThumbnail(t, cached)
+			if cfg.Width != tt.wantW || cfg.Height != tt.wantH {
+				t.Errorf("thumbnail is %dx%d, want %dx%d", cfg.Width, cfg.Height, tt.wantW, tt.wantH)
+			}
+			if format != tt.wantFormat || ContentType(cached) != "image/"+tt.wantFormat {
+				t.Errorf("thumbnail format %s with content type %s, want %s", format, ContentType(cached), tt.wantFormat)
+			}
+		})
+	}
+}
+
+func TestGetCache(t *testing.T) {
+	images := t.TempDir()
+	cacheDir := t.TempDir()
+	s, err := New(cacheDir, 1)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	path := writeImage(t, images, "photo.jpg", 100, 100, false)
+	first, err := get(t, s, path, 32)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+
+	// the same image and size is served from the cache, even by a new service
+	s, err = New(cacheDir, 1)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if again, err := get(t, s, path, 32); err != nil || again != first {
+		t.Errorf("Get() = %s, %v, want cached %s", again, err, first)
+	}
+
+	// a different size is a different thumbnail
+	if other, err := get(t, s, path, 64); err != nil || other == first {
+		t.Errorf("Get() = %s, %v, want a new thumbnail", other, err)
+	}
+
+	// replacing the image invalidates the thumbnail
+	writeImage(t, images, "photo.jpg", 200, 100, false)
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	updated, err := get(t, s, path, 32)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if updated == first {
+		t.Fatal("expected a new thumbnail for the changed image")
+	}
+	if cfg, _ := decodeThumbnail(t, updated); cfg.Width != 32 || cfg.Height != 16 {
+		t.Errorf("thumbnail is %dx%d, want 32x16", cfg.Width, cfg.Height)
+	}
+}
+
+func TestGetConcurrent(t *testing.T) {
+	images := t.TempDir()
+	s, err := New(t.TempDir(), 2)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	path := writeImage(t, images, "photo.png", 500, 500, false)
+
+	var wg sync.WaitGroup
+	results := make([]string, 10)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cached, err := get(t, s, path, 128)
+			if err != nil {
+				t.Errorf("Get() error = %v", err)
+			}
+			results[i] = cached
+		}()
+	}
+	wg.Wait()
+
+	for _, cached := range results {
+		if cached != results[0] {
+			t.Errorf("concurrent requests got different thumbnails %s and %s", cached, results[0])
+		}
+	}
+	if entries, _ := os.ReadDir(s.dir); len(entries) != 1 {
+		t.Errorf("expected one cache entry, got %d", len(entries))
+	}
+}
+
+func TestGetErrors(t *testing.T) {
+	images := t.TempDir()
+	s, err := New(t.TempDir(), 1)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	text := filepath.Join(images, "notes.txt")
+	fake := filepath.Join(images, "fake.png")
+	for _, path := range []string{text, fake} {
+		if err := os.WriteFile(path, []byte("not an image"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	valid := writeImage(t, images, "photo.jpg", 10, 10, false)
+
+	if _, err := get(t, s, text, DefaultSize); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Get() error = %v for a text file, want ErrUnsupported", err)
+	}
+	if _, err := get(t, s, fake, DefaultSize); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Get() error = %v for a misnamed file, want ErrUnsupported", err)
+	}
+	if _, err := get(t, s, valid, MaxSize+1); err == nil {
+		t.Error("Get() succeeded with a size out of range")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	info, _ := os.Stat(valid)
+	if _, err := s.Get(ctx, valid, info, DefaultSize); err != nil && !errors.Is(err, context.Canceled) {
+		t.Errorf("Get() error = %v with a cancelled context", err)
+	}
+}
+
+func TestDecodeTooLarge(t *testing.T) {
+	// a tiny PNG claiming enormous dimensions is refused before its pixels are decoded
+	ihdr := []byte("IHDR\x00\x01\x00\x00\x00\x01\x00\x00\x08\x02\x00\x00\x00")
+	buf := append([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\r"), ihdr...)
+	buf = binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(ihdr))
+	path := filepath.Join(t.TempDir(), "bomb.png")
+	if err := os.WriteFile(path, buf, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := decode(path); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("decode() error = %v, want ErrTooLarge", err)
+	}
+}
+
+func TestSupported(t *testing.T) {
+	for name, want := range map[string]bool{
+		"a.jpg": true, "a.JPG": true, "a.jpeg": true, "a.png": true, "a.gif": true, "a.webp": true,
+		"a.svg": false, "a.txt": false, "jpg": false,
+	} {
+		if got := Supported(name); got != want {
+			t.Errorf("Supported(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
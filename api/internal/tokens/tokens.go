@@ -0,0 +1,201 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scopes that can be granted to a token, each scope includes the ones before it
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+)
+
+// prefix makes tokens easy to recognise, e.g. by secret scanners
+const prefix = "fe_"
+
+var (
+	// ErrInvalidToken is returned when a token is unknown, revoked or expired
+	ErrInvalidToken = errors.New("tokens: invalid token")
+	// ErrNotFound is returned when revoking a token that does not exist for the user
+	ErrNotFound = errors.New("tokens: token not found")
+	// ErrInvalidScope is returned when creating a token with an unknown scope
+	ErrInvalidScope = errors.New("tokens: invalid scope")
+	// ErrInvalidPath is returned when creating a token with a path restriction that is not absolute
+	ErrInvalidPath = errors.New("tokens: path restriction must be an absolute path")
+)
+
+// Token represents a personal access token, the secret itself is never stored
+type Token struct {
+	// ID uniquely identifies the token and is safe to display
+	ID string `json:"id"`
+	// UserID identifies the user this token belongs to
+	UserID string `json:"-"`
+	// Name is a human readable label, e.g. "CI"
+	Name string `json:"name"`
+	// Scopes lists the granted scopes
+	Scopes []string `json:"scopes"`
+	// Path restricts the token to a subtree of the root directory, empty means unrestricted
+	Path string `json:"path,omitempty"`
+	// CreatedAt indicates when the token was created
+	CreatedAt time.Time `json:"createdAt"`
+	// ExpiresAt indicates when the token expires, nil means it never expires
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+
+	hash string
+}
+
+// Service manages personal access tokens including creation, validation, and revocation
+type Service struct {
+	tokens map[string]*Token // hash -> token
+	mu     sync.RWMutex
+}
+
+func New() *Service {
+	return &Service{
+		tokens: make(map[string]*Token),
+	}
+}
+
+// Create issues a new token for userID and returns it along with its secret.
+// The secret is only available at creation time.
+func (s *Service) Create(userID, name string, scopes []string, tokenPath string, expiresAt *time.Time) (Token, string, error) {
+	if len(scopes) == 0 {
+		return Token{}, "", ErrInvalidScope
+	}
+	for _, scope := range scopes {
+		if scopeLevel(scope) < 0 {
+			return Token{}, "", ErrInvalidScope
+		}
+	}
+
+	if tokenPath != "" {
+		if !strings.HasPrefix(tokenPath, "/") {
+			return Token{}, "", ErrInvalidPath
+		}
+		tokenPath = path.Clean(tokenPath)
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return Token{}, "", err
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return Token{}, "", err
+	}
+	secret := prefix + base64.RawURLEncoding.EncodeToString(b)
+
+	token := Token{
+		ID:        hex.EncodeToString(id),
+		UserID:    userID,
+		Name:      name,
+		Scopes:    slices.Clone(scopes),
+		Path:      tokenPath,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+		hash:      hashSecret(secret),
+	}
+
+	s.mu.Lock()
+	s.tokens[token.hash] = &token
+	s.mu.Unlock()
+
+	return token, secret, nil
+}
+
+// Validate returns the token matching secret, or ErrInvalidToken if it is unknown or expired
+func (s *Service) Validate(secret string) (Token, error) {
+	if !strings.HasPrefix(secret, prefix) {
+		return Token{}, ErrInvalidToken
+	}
+
+	// tokens are looked up by the hash of the secret so the secret is never compared directly
+	s.mu.RLock()
+	token, exists := s.tokens[hashSecret(secret)]
+	s.mu.RUnlock()
+	if !exists {
+		return Token{}, ErrInvalidToken
+	}
+
+	if token.ExpiresAt != nil && time.Now().After(*token.ExpiresAt) {
+		return Token{}, ErrInvalidToken
+	}
+
+	return *token, nil
+}
+
+// List returns the tokens belonging to userID, oldest first
+func (s *Service) List(userID string) []Token {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]Token, 0)
+	for _, token := range s.tokens {
+		if token.UserID == userID {
+			list = append(list, *token)
+		}
+	}
+	slices.SortFunc(list, func(a, b Token) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	return list
+}
+
+// Revoke deletes the token with the given ID if it belongs to userID
+func (s *Service) Revoke(userID, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, token := range s.tokens {
+		if token.ID == id && token.UserID == userID {
+			delete(s.tokens, hash)
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+// Allows reports whether the granted scopes include scope, taking into account that
+// write implies read and admin implies write
+func Allows(granted []string, scope string) bool {
+	want := scopeLevel(scope)
+	if want < 0 {
+		return false
+	}
+	for _, g := range granted {
+		if scopeLevel(g) >= want {
+			return true
+		}
+	}
+	return false
+}
+
+func scopeLevel(scope string) int {
+	switch scope {
+	case ScopeRead:
+		return 0
+	case ScopeWrite:
+		return 1
+	case ScopeAdmin:
+		return 2
+	default:
+		return -1
+	}
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
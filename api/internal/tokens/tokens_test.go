@@ -0,0 +1,107 @@
+package tokens
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTokenService(t *testing.T) {
+	service := New()
+
+	t.Run("create and validate token", func(t *testing.T) {
+		token, secret, err := service.Create("testuser", "CI", []string{ScopeRead}, "/builds/../builds", nil)
+		if err != nil {
+			t.Fatalf("Failed to create token: %v", err)
+		}
+
+		if secret == "" || token.ID == "" {
+			t.Fatal("Token secret and ID should not be empty")
+		}
+
+		if token.Path != "/builds" {
+			t.Errorf("Expected path %q, got %q", "/builds", token.Path)
+		}
+
+		got, err := service.Validate(secret)
+		if err != nil {
+			t.Fatalf("Failed to validate token: %v", err)
+		}
+		if got.UserID != "testuser" || got.ID != token.ID {
+			t.Errorf("Validated token does not match, got %+v", got)
+		}
+	})
+
+	t.Run("unknown token", func(t *testing.T) {
+		if _, err := service.Validate("fe_unknown"); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Expected ErrInvalidToken, got %v", err)
+		}
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		expired := time.Now().Add(-time.Hour)
+		_, secret, err := service.Create("testuser", "old", []string{ScopeRead}, "", &expired)
+		if err != nil {
+			t.Fatalf("Failed to create token: %v", err)
+		}
+
+		if _, err := service.Validate(secret); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Expected ErrInvalidToken, got %v", err)
+		}
+	})
+
+	t.Run("invalid scope and path", func(t *testing.T) {
+		if _, _, err := service.Create("testuser", "bad", []string{"root"}, "", nil); !errors.Is(err, ErrInvalidScope) {
+			t.Errorf("Expected ErrInvalidScope, got %v", err)
+		}
+		if _, _, err := service.Create("testuser", "bad", nil, "", nil); !errors.Is(err, ErrInvalidScope) {
+			t.Errorf("Expected ErrInvalidScope for no scopes, got %v", err)
+		}
+		if _, _, err := service.Create("testuser", "bad", []string{ScopeRead}, "builds", nil); !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("Expected ErrInvalidPath, got %v", err)
+		}
+	})
+
+	t.Run("list and revoke tokens", func(t *testing.T) {
+		service := New()
+		token, secret, _ := service.Create("alice", "one", []string{ScopeRead}, "", nil)
+		service.Create("bob", "two", []string{ScopeRead}, "", nil)
+
+		if list := service.List("alice"); len(list) != 1 || list[0].ID != token.ID {
+			t.Fatalf("Expected alice to have 1 token, got %+v", list)
+		}
+
+		if err := service.Revoke("bob", token.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound revoking another user's token, got %v", err)
+		}
+
+		if err := service.Revoke("alice", token.ID); err != nil {
+			t.Fatalf("Failed to revoke token: %v", err)
+		}
+
+		if _, err := service.Validate(secret); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Expected revoked token to be invalid, got %v", err)
+		}
+	})
+}
+
+func TestAllows(t *testing.T) {
+	tests := []struct {
+		granted []string
+		scope   string
+		want    bool
+	}{
+		{[]string{ScopeRead}, ScopeRead, true},
+		{[]string{ScopeRead}, ScopeWrite, false},
+		{[]string{ScopeWrite}, ScopeRead, true},
+		{[]string{ScopeAdmin}, ScopeWrite, true},
+		{[]string{ScopeWrite}, ScopeAdmin, false},
+		{[]string{ScopeAdmin}, "unknown", false},
+	}
+
+	for _, tt := range tests {
+		if got := Allows(tt.granted, tt.scope); got != tt.want {
+			t.Errorf("Allows(%v, %q) = %v, want %v", tt.granted, tt.scope, got, tt.want)
+		}
+	}
+}
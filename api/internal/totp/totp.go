@@ -0,0 +1,354 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// period is the TOTP time step in seconds
+	period = 30
+	// digits is the length of a code
+	digits = 6
+	// skew is how many time steps either side of now are accepted to allow for clock drift
+	skew = 1
+	// recoveryCodeCount is how many single use recovery codes are issued on enrolment
+	recoveryCodeCount = 10
+	// challengeTTL is how long a user has to enter their code after entering their password
+	challengeTTL = 5 * time.Minute
+	// maxAttempts is how many wrong codes are allowed per challenge
+	maxAttempts = 5
+	// maxFailures is how many wrong codes in a row are allowed per user, across challenges, before they are locked out
+	maxFailures = 10
+	// lockout is how long a user is locked out after maxFailures wrong codes, so codes cannot be guessed by starting
+	// new challenges with a known password
+	lockout = 15 * time.Minute
+)
+
+var (
+	// ErrInvalidCode is returned when a code is wrong, expired or has already been used
+	ErrInvalidCode = errors.New("totp: invalid code")
+	// ErrNotEnrolled is returned when confirming or verifying for a user without an enrolment
+	ErrNotEnrolled = errors.New("totp: user is not enrolled")
+	// ErrAlreadyEnabled is returned when enrolling a user that already has TOTP enabled
+	ErrAlreadyEnabled = errors.New("totp: already enabled")
+	// ErrInvalidChallenge is returned when a login challenge is unknown, expired or used up
+	ErrInvalidChallenge = errors.New("totp: invalid or expired login challenge")
+	// ErrLocked is returned for a user who entered too many wrong codes, until their lockout has passed
+	ErrLocked = errors.New("totp: too many wrong codes, try again later")
+)
+
+// Enrollment is returned when a user starts enrolling, it is only shown once
+type Enrollment struct {
+	// Secret is the base32 encoded shared secret, for manual entry into an authenticator app
+	Secret string `json:"secret"`
+	// URI is the otpauth:// URI, usually rendered as a QR code
+	URI string `json:"uri"`
+	// RecoveryCodes can each be used once instead of a code if the authenticator is lost
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// Challenge is a login that has passed the password check and is waiting for a code
+type Challenge struct {
+	UserID string
+	Email  string
+	Groups []string
+
+	expiresAt time.Time
+	attempts  int
+}
+
+type user struct {
+	secret        []byte
+	enabled       bool
+	lastStep      int64     // most recent time step used, codes for it and earlier are rejected
+	recoveryCodes []string  // sha256 hashes of unused recovery codes
+	failures      int       // wrong codes in a row
+	lockedUntil   time.Time // codes are rejected until then
+}
+
+// Service manages per-user TOTP enrolment and verification (RFC 6238) along with pending login challenges
+type Service struct {
+	issuer     string
+	users      map[string]*user
+	challenges map[string]*Challenge
+	mu         sync.Mutex
+
+	// now is overridden in tests
+	now func() time.Time
+}
+
+// New creates a TOTP service, issuer is shown in authenticator apps next to the username
+func New(issuer string) *Service {
+	return &Service{
+		issuer:     issuer,
+		users:      make(map[string]*user),
+		challenges: make(map[string]*Challenge),
+		now:        time.Now,
+	}
+}
+
+// Enroll generates a new secret and recovery codes for userID.
+// TOTP is not required at login until the enrolment is confirmed with a valid code.
+func (s *Service) Enroll(userID string) (Enrollment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u, exists := s.users[userID]; exists && u.enabled {
+		return Enrollment{}, ErrAlreadyEnabled
+	}
+
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return Enrollment{}, err
+	}
+
+	u := &user{secret: secret}
+	enrollment := Enrollment{
+		Secret: base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret),
+	}
+
+	for range recoveryCodeCount {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return Enrollment{}, err
+		}
+		code := hex.EncodeToString(b)
+		code = code[:5] + "-" + code[5:]
+		enrollment.RecoveryCodes = append(enrollment.RecoveryCodes, code)
+		u.recoveryCodes = append(u.recoveryCodes, hashCode(code))
+	}
+
+	label := url.PathEscape(s.issuer + ":" + userID)
+	params := url.Values{}
+	params.Set("secret", enrollment.Secret)
+	params.Set("issuer", s.issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(digits))
+	params.Set("period", fmt.Sprint(period))
+	enrollment.URI = "otpauth://totp/" + label + "?" + params.Encode()
+
+	s.users[userID] = u
+
+	return enrollment, nil
+}
+
+// Confirm enables TOTP for userID once they prove their authenticator produces valid codes
+func (s *Service) Confirm(userID, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, exists := s.users[userID]
+	if !exists {
+		return ErrNotEnrolled
+	}
+	if u.enabled {
+		return ErrAlreadyEnabled
+	}
+
+	if err := s.verifyCode(u, code); err != nil {
+		return err
+	}
+	u.enabled = true
+
+	return nil
+}
+
+// Disable turns TOTP off for userID, it requires a valid code or recovery code
+func (s *Service) Disable(userID, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, exists := s.users[userID]
+	if !exists || !u.enabled {
+		return ErrNotEnrolled
+	}
+
+	if err := s.verify(u, code); err != nil {
+		return err
+	}
+	delete(s.users, userID)
+
+	return nil
+}
+
+// Enabled reports whether userID must enter a code to log in
+func (s *Service) Enabled(userID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, exists := s.users[userID]
+	return exists && u.enabled
+}
+
+// Verify checks a code or recovery code for userID. Each code and recovery code can only be used once.
+func (s *Service) Verify(userID, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, exists := s.users[userID]
+	if !exists || !u.enabled {
+		return ErrNotEnrolled
+	}
+
+	return s.verify(u, code)
+}
+
+// NewChallenge records a login that passed the password check and returns the token the client
+// must send back with the code
+func (s *Service) NewChallenge(userID, email string, groups []string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// drop abandoned challenges
+	now := s.now()
+	for t, c := range s.challenges {
+		if now.After(c.expiresAt) {
+			delete(s.challenges, t)
+		}
+	}
+
+	s.challenges[token] = &Challenge{
+		UserID:    userID,
+		Email:     email,
+		Groups:    groups,
+		expiresAt: now.Add(challengeTTL),
+	}
+
+	return token, nil
+}
+
+// CompleteChallenge verifies the code for the challenge's user and returns the challenge.
+// A challenge is removed once it succeeds, expires, has had too many wrong codes or its user is locked out.
+func (s *Service) CompleteChallenge(token, code string) (Challenge, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, exists := s.challenges[token]
+	if !exists || s.now().After(c.expiresAt) {
+		delete(s.challenges, token)
+		return Challenge{}, ErrInvalidChallenge
+	}
+
+	u, exists := s.users[c.UserID]
+	if !exists || !u.enabled {
+		delete(s.challenges, token)
+		return Challenge{}, ErrInvalidChallenge
+	}
+
+	if err := s.verify(u, code); err != nil {
+		c.attempts++
+		if c.attempts >= maxAttempts || errors.Is(err, ErrLocked) {
+			delete(s.challenges, token)
+		}
+		return Challenge{}, err
+	}
+
+	delete(s.challenges, token)
+	return *c, nil
+}
+
+// verify accepts either a TOTP code or an unused recovery code, the caller must hold s.mu.
+// After maxFailures wrong codes in a row every code is rejected with ErrLocked until the lockout has passed.
+func (s *Service) verify(u *user, code string) error {
+	now := s.now()
+	if now.Before(u.lockedUntil) {
+		return ErrLocked
+	}
+
+	err := s.verifyCodeOrRecovery(u, strings.TrimSpace(code))
+	if err == nil {
+		u.failures = 0
+		return nil
+	}
+	u.failures++
+	if u.failures >= maxFailures {
+		u.failures = 0
+		u.lockedUntil = now.Add(lockout)
+		return ErrLocked
+	}
+	return err
+}
+
+// verifyCodeOrRecovery checks code as a TOTP code if it has the length of one and as a recovery code otherwise,
+// the caller must hold s.mu
+func (s *Service) verifyCodeOrRecovery(u *user, code string) error {
+	if len(code) == digits {
+		return s.verifyCode(u, code)
+	}
+
+	hash := hashCode(strings.ToLower(code))
+	for i, recovery := range u.recoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(recovery), []byte(hash)) == 1 {
+			u.recoveryCodes = append(u.recoveryCodes[:i], u.recoveryCodes[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrInvalidCode
+}
+
+// verifyCode checks a TOTP code within the allowed clock skew, rejecting codes from time steps
+// that have already been used so an intercepted code can't be replayed. The caller must hold s.mu.
+func (s *Service) verifyCode(u *user, code string) error {
+	current := s.now().Unix() / period
+	for step := current - skew; step <= current+skew; step++ {
+		if step <= u.lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(generate(u.secret, step)), []byte(code)) == 1 {
+			u.lastStep = step
+			return nil
+		}
+	}
+	return ErrInvalidCode
+}
+
+// Code returns the code for secret at time t, it is exported for tests and tooling
+func Code(secret string, t time.Time) (string, error) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	return generate(key, t.Unix()/period), nil
+}
+
+// generate computes the HOTP value (RFC 4226) for the given counter
+func generate(secret []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", digits, value%1_000_000)
+}
+
+func hashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
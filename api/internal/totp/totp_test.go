@@ -0,0 +1,191 @@
+package totp
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerate(t *testing.T) {
+	// RFC 6238 appendix B test vectors for SHA1, truncated to 6 digits
+	secret := []byte("12345678901234567890")
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		if got := generate(secret, tt.unix/period); got != tt.want {
+			t.Errorf("generate(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestService(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	service := New("File Explorer")
+	service.now = func() time.Time { return now }
+
+	enrollment, err := service.Enroll("testuser")
+	if err != nil {
+		t.Fatalf("Enroll() error = %v", err)
+	}
+
+	t.Run("otpauth URI", func(t *testing.T) {
+		uri, err := url.Parse(enrollment.URI)
+		if err != nil {
+			t.Fatalf("invalid URI: %v", err)
+		}
+		if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/File Explorer:testuser" {
+			t.Errorf("unexpected URI %s", enrollment.URI)
+		}
+		if uri.Query().Get("secret") != enrollment.Secret {
+			t.Errorf("URI secret does not match enrollment secret")
+		}
+		if len(enrollment.RecoveryCodes) != recoveryCodeCount {
+			t.Errorf("expected %d recovery codes, got %d", recoveryCodeCount, len(enrollment.RecoveryCodes))
+		}
+	})
+
+	t.Run("not enabled until confirmed", func(t *testing.T) {
+		if service.Enabled("testuser") {
+			t.Fatal("TOTP should not be enabled before confirmation")
+		}
+		if err := service.Confirm("testuser", "000000"); !errors.Is(err, ErrInvalidCode) {
+			t.Errorf("expected ErrInvalidCode, got %v", err)
+		}
+
+		code, _ := Code(enrollment.Secret, now)
+		if err := service.Confirm("testuser", code); err != nil {
+			t.Fatalf("Confirm() error = %v", err)
+		}
+		if !service.Enabled("testuser") {
+			t.Fatal("TOTP should be enabled after confirmation")
+		}
+		if _, err := service.Enroll("testuser"); !errors.Is(err, ErrAlreadyEnabled) {
+			t.Errorf("expected ErrAlreadyEnabled, got %v", err)
+		}
+	})
+
+	t.Run("codes cannot be replayed", func(t *testing.T) {
+		// the current code was used to confirm
+		code, _ := Code(enrollment.Secret, now)
+		if err := service.Verify("testuser", code); !errors.Is(err, ErrInvalidCode) {
+			t.Errorf("expected replayed code to be rejected, got %v", err)
+		}
+
+		// the next time step is accepted once, allowing for clock skew
+		next, _ := Code(enrollment.Secret, now.Add(period*time.Second))
+		if err := service.Verify("testuser", next); err != nil {
+			t.Errorf("expected code within skew to be accepted, got %v", err)
+		}
+		if err := service.Verify("testuser", next); !errors.Is(err, ErrInvalidCode) {
+			t.Errorf("expected replayed code to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("codes outside the skew are rejected", func(t *testing.T) {
+		late, _ := Code(enrollment.Secret, now.Add(5*period*time.Second))
+		if err := service.Verify("testuser", late); !errors.Is(err, ErrInvalidCode) {
+			t.Errorf("expected ErrInvalidCode, got %v", err)
+		}
+	})
+
+	t.Run("recovery codes are single use", func(t *testing.T) {
+		recovery := strings.ToUpper(enrollment.RecoveryCodes[0])
+		if err := service.Verify("testuser", recovery); err != nil {
+			t.Fatalf("expected recovery code to be accepted, got %v", err)
+		}
+		if err := service.Verify("testuser", recovery); !errors.Is(err, ErrInvalidCode) {
+			t.Errorf("expected used recovery code to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("login challenge", func(t *testing.T) {
+		token, err := service.NewChallenge("testuser", "test@example.com", nil)
+		if err != nil {
+			t.Fatalf("NewChallenge() error = %v", err)
+		}
+
+		for range maxAttempts {
+			if _, err := service.CompleteChallenge(token, "000000"); err == nil {
+				t.Fatal("expected wrong code to fail")
+			}
+		}
+
+		// too many wrong codes discard the challenge, even a correct code no longer works
+		if _, err := service.CompleteChallenge(token, enrollment.RecoveryCodes[1]); !errors.Is(err, ErrInvalidChallenge) {
+			t.Errorf("expected ErrInvalidChallenge, got %v", err)
+		}
+
+		token, _ = service.NewChallenge("testuser", "test@example.com", nil)
+		challenge, err := service.CompleteChallenge(token, enrollment.RecoveryCodes[1])
+		if err != nil {
+			t.Fatalf("CompleteChallenge() error = %v", err)
+		}
+		if challenge.UserID != "testuser" || challenge.Email != "test@example.com" {
+			t.Errorf("unexpected challenge %+v", challenge)
+		}
+		if _, err := service.CompleteChallenge(token, enrollment.RecoveryCodes[2]); !errors.Is(err, ErrInvalidChallenge) {
+			t.Errorf("expected completed challenge to be discarded, got %v", err)
+		}
+	})
+
+	t.Run("wrong codes are counted across challenges", func(t *testing.T) {
+		// a fresh challenge per password login must not reset the count
+		var err error
+		for failures := 0; failures < maxFailures; failures += maxAttempts {
+			token, _ := service.NewChallenge("testuser", "", nil)
+			for range maxAttempts {
+				_, err = service.CompleteChallenge(token, "000000")
+			}
+		}
+		if !errors.Is(err, ErrLocked) {
+			t.Fatalf("expected the last wrong code to lock the user out, got %v", err)
+		}
+
+		// even a correct code is rejected while locked out, and the challenge is discarded
+		token, _ := service.NewChallenge("testuser", "", nil)
+		if _, err := service.CompleteChallenge(token, enrollment.RecoveryCodes[2]); !errors.Is(err, ErrLocked) {
+			t.Errorf("expected ErrLocked, got %v", err)
+		}
+		if _, err := service.CompleteChallenge(token, enrollment.RecoveryCodes[2]); !errors.Is(err, ErrInvalidChallenge) {
+			t.Errorf("expected ErrInvalidChallenge, got %v", err)
+		}
+
+		now = now.Add(lockout)
+		token, _ = service.NewChallenge("testuser", "", nil)
+		if _, err := service.CompleteChallenge(token, enrollment.RecoveryCodes[2]); err != nil {
+			t.Fatalf("expected a correct code to be accepted after the lockout, got %v", err)
+		}
+	})
+
+	t.Run("expired challenge", func(t *testing.T) {
+		token, _ := service.NewChallenge("testuser", "", nil)
+		now = now.Add(challengeTTL + time.Second)
+
+		if _, err := service.CompleteChallenge(token, enrollment.RecoveryCodes[3]); !errors.Is(err, ErrInvalidChallenge) {
+			t.Errorf("expected ErrInvalidChallenge, got %v", err)
+		}
+	})
+
+	t.Run("disable", func(t *testing.T) {
+		if err := service.Disable("testuser", "000000"); !errors.Is(err, ErrInvalidCode) {
+			t.Errorf("expected ErrInvalidCode, got %v", err)
+		}
+		if err := service.Disable("testuser", enrollment.RecoveryCodes[4]); err != nil {
+			t.Fatalf("Disable() error = %v", err)
+		}
+		if service.Enabled("testuser") {
+			t.Error("TOTP should be disabled")
+		}
+	})
+}
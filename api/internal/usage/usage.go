@@ -0,0 +1,437 @@
+package usage
+
+import (
+	"cmp"
+	"container/heap"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultDepth and MaxDepth bound the levels of directories in a report's tree
+	DefaultDepth = 2
+	MaxDepth     = 6
+	// DefaultTop and MaxTop bound the largest files in a report
+	DefaultTop = 20
+	MaxTop     = 200
+	// maxChildren keeps the largest subdirectories of each tree node, the rest only count towards its size
+	maxChildren = 100
+	// maxExtensions keeps the extensions taking up the most space
+	maxExtensions = 100
+	// maxRunning bounds the analyses running at once, each walks a whole tree
+	maxRunning = 4
+	// resultTTL is how long a finished analysis is kept for clients polling it
+	resultTTL = 10 * time.Minute
+)
+
+// Job states
+const (
+	StatusRunning   = "running"
+	StatusDone      = "done"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+var (
+	// ErrBusy is returned when too many analyses are already running
+	ErrBusy = errors.New("usage: too many analyses running")
+	// ErrUnreadable fails an analysis whose directory could not be read
+	ErrUnreadable = errors.New("usage: directory could not be read")
+	// ErrClosed is returned when starting an analysis after the Manager was closed
+	ErrClosed = errors.New("usage: manager closed")
+)
+
+// Options describe an analysis, analyses with the same options for the same user are shared
+type Options struct {
+	// Path is the directory as the client named it, paths in the report are relative to the same root
+	Path string
+	// AbsPath is the directory on the filesystem
+	AbsPath string
+	// Depth is the number of directory levels in the report's tree
+	Depth int
+	// Top is the number of largest files reported
+	Top int
+}
+
+// Progress counts what an analysis has walked so far
+type Progress struct {
+	Files int64 `json:"files"`
+	Dirs  int64 `json:"dirs"`
+	Bytes int64 `json:"bytes"`
+	// Errors counts entries that could not be read, they are left out of the report
+	Errors int64 `json:"errors"`
+}
+
+// Node is a directory in the report's tree. Size and Files cover everything below it,
+// including what is below the tree's depth and subdirectories beyond the largest kept as Children.
+type Node struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	Files    int64  `json:"files"`
+	Children []Node `json:"children,omitempty"`
+}
+
+// File is one of the largest files
+type File struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// Extension totals the files with an extension, Ext is empty for files without one
+type Extension struct {
+	Ext   string `json:"ext"`
+	Files int64  `json:"files"`
+	Size  int64  `json:"size"`
+}
+
+// Report is the result of an analysis
+type Report struct {
+	Tree       Node        `json:"tree"`
+	Largest    []File      `json:"largest"`
+	Extensions []Extension `json:"extensions"`
+}
+
+// Job is a snapshot of an analysis
+type Job struct {
+	ID         string     `json:"id"`
+	Status     string     `json:"status"`
+	Path       string     `json:"path"`
+	Depth      int        `json:"depth"`
+	Top        int        `json:"top"`
+	Progress   Progress   `json:"progress"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	Report     *Report    `json:"report,omitempty"`
+}
+
+// Manager runs analyses in the background, clients start or poll one with Run
+type Manager struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	jobs    map[jobKey]*job
+	running int
+	closed  bool
+}
+
+type jobKey struct {
+	owner string
+	opts  Options
+}
+
+// job is an analysis in progress or finished, its progress is updated without holding the Manager's lock
+type job struct {
+	id      string
+	opts    Options
+	started time.Time
+	cancel  context.CancelFunc
+
+	files, dirs, bytes, errs atomic.Int64
+
+	// set once the analysis ends, guarded by the Manager's mu
+	status   string
+	finished time.Time
+	err      error
+	report   *Report
+}
+
+// New creates a Manager
+func New() *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{
+		ctx:    ctx,
+		cancel: cancel,
+		jobs:   make(map[jobKey]*job),
+	}
+}
+
+// Run returns the owner's analysis with opts, starting it if there is none or refresh is set.
+// A finished analysis is kept for a while so clients can poll until it is done and then fetch the report.
+func (m *Manager) Run(owner string, opts Options, refresh bool) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return Job{}, ErrClosed
+	}
+	m.expire()
+
+	key := jobKey{owner: owner, opts: opts}
+	if j, ok := m.jobs[key]; ok {
+		if !refresh || j.status == StatusRunning {
+			return j.snapshot(), nil
+		}
+	}
+
+	if m.running >= maxRunning {
+		return Job{}, ErrBusy
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return Job{}, err
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	j := &job{
+		id:      hex.EncodeToString(id),
+		opts:    opts,
+		started: time.Now(),
+		cancel:  cancel,
+		status:  StatusRunning,
+	}
+	m.jobs[key] = j
+	m.running++
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		report, err := j.analyse(ctx)
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.running--
+		j.cancel()
+		j.finished = time.Now()
+		switch {
+		case errors.Is(err, context.Canceled):
+			j.status = StatusCancelled
+		case err != nil:
+			j.status, j.err = StatusFailed, err
+		default:
+			j.status, j.report = StatusDone, report
+		}
+	}()
+
+	return j.snapshot(), nil
+}
+
+// Cancel stops the owner's running analyses of path, reporting whether there were any
+func (m *Manager) Cancel(owner, path string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	found := false
+	for key, j := range m.jobs {
+		if key.owner == owner && key.opts.Path == path && j.status == StatusRunning {
+			j.cancel()
+			found = true
+		}
+	}
+	return found
+}
+
+// Close cancels every running analysis and waits for them to stop
+func (m *Manager) Close() {
+	m.mu.Lock()
+	m.closed = true
+	m.mu.Unlock()
+
+	m.cancel()
+	m.wg.Wait()
+}
+
+// expire forgets analyses that finished more than resultTTL ago, the caller must hold m.mu
+func (m *Manager) expire() {
+	for key, j := range m.jobs {
+		if j.status != StatusRunning && time.Since(j.finished) > resultTTL {
+			delete(m.jobs, key)
+		}
+	}
+}
+
+// snapshot copies the job's state, the caller must hold the Manager's mu
+func (j *job) snapshot() Job {
+	s := Job{
+		ID:     j.id,
+		Status: j.status,
+		Path:   j.opts.Path,
+		Depth:  j.opts.Depth,
+		Top:    j.opts.Top,
+		Progress: Progress{
+			Files:  j.files.Load(),
+			Dirs:   j.dirs.Load(),
+			Bytes:  j.bytes.Load(),
+			Errors: j.errs.Load(),
+		},
+		StartedAt: j.started,
+		Report:    j.report,
+	}
+	if !j.finished.IsZero() {
+		finished := j.finished
+		s.FinishedAt = &finished
+	}
+	if j.err != nil {
+		s.Error = j.err.Error()
+	}
+	return s
+}
+
+// analyse walks the tree, symlinks are not followed
+func (j *job) analyse(ctx context.Context) (*Report, error) {
+	root := &treeNode{name: path.Base(j.opts.Path), path: j.opts.Path}
+	largest := &fileHeap{}
+	extensions := make(map[string]*Extension)
+
+	err := filepath.WalkDir(j.opts.AbsPath, func(p string, d fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			if p == j.opts.AbsPath {
+				// the error names the path on the filesystem, which clients must not see
+				return ErrUnreadable
+			}
+			// unreadable entries are skipped, like du
+			j.errs.Add(1)
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			j.dirs.Add(1)
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			// removed since its directory was read
+			return nil
+		}
+		size := info.Size()
+		j.files.Add(1)
+		j.bytes.Add(size)
+
+		rel, err := filepath.Rel(j.opts.AbsPath, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		root.add(strings.Split(path.Dir(rel), "/"), size, j.opts.Depth)
+
+		if j.opts.Top > 0 {
+			file := File{Path: path.Join(j.opts.Path, rel), Size: size}
+			if largest.Len() < j.opts.Top {
+				heap.Push(largest, file)
+			} else if size > (*largest)[0].Size {
+				(*largest)[0] = file
+				heap.Fix(largest, 0)
+			}
+		}
+
+		ext := strings.ToLower(path.Ext(d.Name()))
+		e, ok := extensions[ext]
+		if !ok {
+			e = &Extension{Ext: ext}
+			extensions[ext] = e
+		}
+		e.Files++
+		e.Size += size
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		Tree:       root.node(),
+		Largest:    []File(*largest),
+		Extensions: make([]Extension, 0, len(extensions)),
+	}
+	slices.SortFunc(report.Largest, func(a, b File) int {
+		return cmp.Or(cmp.Compare(b.Size, a.Size), cmp.Compare(a.Path, b.Path))
+	})
+	for _, e := range extensions {
+		report.Extensions = append(report.Extensions, *e)
+	}
+	slices.SortFunc(report.Extensions, func(a, b Extension) int {
+		return cmp.Or(cmp.Compare(b.Size, a.Size), cmp.Compare(a.Ext, b.Ext))
+	})
+	if len(report.Extensions) > maxExtensions {
+		report.Extensions = report.Extensions[:maxExtensions]
+	}
+	if report.Largest == nil {
+		report.Largest = []File{}
+	}
+
+	return report, nil
+}
+
+// treeNode accumulates the sizes of a directory while walking
+type treeNode struct {
+	name     string
+	path     string
+	size     int64
+	files    int64
+	children map[string]*treeNode
+}
+
+// add counts a file in the directory dirs below n (e.g. ["a", "b"] for a/b/file, or ["."] for a file in n),
+// creating nodes down to depth levels
+func (n *treeNode) add(dirs []string, size int64, depth int) {
+	n.size += size
+	n.files++
+
+	if len(dirs) == 0 || dirs[0] == "." || depth == 0 {
+		return
+	}
+	child, ok := n.children[dirs[0]]
+	if !ok {
+		if n.children == nil {
+			n.children = make(map[string]*treeNode)
+		}
+		child = &treeNode{name: dirs[0], path: path.Join(n.path, dirs[0])}
+		n.children[dirs[0]] = child
+	}
+	child.add(dirs[1:], size, depth-1)
+}
+
+// node converts the accumulated tree, keeping the largest children of each directory
+func (n *treeNode) node() Node {
+	out := Node{Name: n.name, Path: n.path, Size: n.size, Files: n.files}
+	for _, child := range n.children {
+		out.Children = append(out.Children, child.node())
+	}
+	slices.SortFunc(out.Children, func(a, b Node) int {
+		return cmp.Or(cmp.Compare(b.Size, a.Size), cmp.Compare(a.Name, b.Name))
+	})
+	if len(out.Children) > maxChildren {
+		out.Children = out.Children[:maxChildren]
+	}
+	return out
+}
+
+// fileHeap is a min-heap of files by size, holding the largest seen so far
+type fileHeap []File
+
+func (h fileHeap) Len() int           { return len(h) }
+func (h fileHeap) Less(i, j int) bool { return h[i].Size < h[j].Size }
+func (h fileHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *fileHeap) Push(x any)        { *h = append(*h, x.(File)) }
+func (h *fileHeap) Pop() any {
+	old := *h
+	f := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return f
+}
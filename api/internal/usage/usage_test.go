@@ -0,0 +1,209 @@
+package usage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// makeTree creates files of the given sizes, creating their directories along the way
+func makeTree(t *testing.T, files map[string]int) string {
+	t.Helper()
+
+	root := t.TempDir()
+	for name, size := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// wait polls the analysis until it is no longer running
+func wait(t *testing.T, m *Manager, owner string, opts Options) Job {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := m.Run(owner, opts, false)
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		if job.Status != StatusRunning {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("analysis did not finish")
+	return Job{}
+}
+
+func TestRun(t *testing.T) {
+	root := makeTree(t, map[string]int{
+		"readme.md":               10,
+		"logs/app.log":            500,
+		"logs/old/app.1.LOG":      300,
+		"logs/old/deeper/app.log": 200,
+		"images/a.png":            400,
+		"images/b.png":            100,
+		"Makefile":                20,
+	})
+
+	m := New()
+	defer m.Close()
+
+	opts := Options{Path: "/data", AbsPath: root, Depth: 2, Top: 3}
+	job := wait(t, m, "testuser", opts)
+	if job.Status != StatusDone || job.Report == nil {
+		t.Fatalf("unexpected job %+v", job)
+	}
+	if job.Progress != (Progress{Files: 7, Dirs: 5, Bytes: 1530}) {
+		t.Errorf("unexpected progress %+v", job.Progress)
+	}
+	if job.FinishedAt == nil || job.Path != "/data" {
+		t.Errorf("unexpected job %+v", job)
+	}
+
+	tree := job.Report.Tree
+	if tree.Name != "data" || tree.Path != "/data" || tree.Size != 1530 || tree.Files != 7 {
+		t.Errorf("unexpected root %+v", tree)
+	}
+	if len(tree.Children) != 2 {
+		t.Fatalf("expected 2 children, got %+v", tree.Children)
+	}
+
+	// children are ordered largest first, and include everything below the depth
+	logs := tree.Children[0]
+	if logs.Path != "/data/logs" || logs.Size != 1000 || logs.Files != 3 {
+		t.Errorf("unexpected logs node %+v", logs)
+	}
+	if len(logs.Children) != 1 || logs.Children[0].Path != "/data/logs/old" || logs.Children[0].Size != 500 {
+		t.Errorf("unexpected logs children %+v", logs.Children)
+	}
+	if len(logs.Children[0].Children) != 0 {
+		t.Errorf("expected the tree to stop at depth 2, got %+v", logs.Children[0].Children)
+	}
+	if images := tree.Children[1]; images.Path != "/data/images" || images.Size != 500 {
+		t.Errorf("unexpected images node %+v", images)
+	}
+
+	wantLargest := []File{
+		{Path: "/data/logs/app.log", Size: 500},
+		{Path: "/data/images/a.png", Size: 400},
+		{Path: "/data/logs/old/app.1.LOG", Size: 300},
+	}
+	if len(job.Report.Largest) != len(wantLargest) {
+		t.Fatalf("unexpected largest files %+v", job.Report.Largest)
+	}
+	for i, want := range wantLargest {
+		if job.Report.Largest[i] != want {
+			t.Errorf("largest[%d] = %+v, want %+v", i, job.Report.Largest[i], want)
+		}
+	}
+
+	wantExtensions := []Extension{
+		{Ext: ".log", Files: 3, Size: 1000},
+		{Ext: ".png", Files: 2, Size: 500},
+		{Ext: "", Files: 1, Size: 20},
+		{Ext: ".md", Files: 1, Size: 10},
+	}
+	if len(job.Report.Extensions) != len(wantExtensions) {
+		t.Fatalf("unexpected extensions %+v", job.Report.Extensions)
+	}
+	for i, want := range wantExtensions {
+		if job.Report.Extensions[i] != want {
+			t.Errorf("extensions[%d] = %+v, want %+v", i, job.Report.Extensions[i], want)
+		}
+	}
+}
+
+func TestRunShared(t *testing.T) {
+	root := makeTree(t, map[string]int{"a.txt": 10})
+
+	m := New()
+	defer m.Close()
+
+	opts := Options{Path: "/", AbsPath: root, Depth: 1, Top: 1}
+	first := wait(t, m, "testuser", opts)
+
+	// polling returns the same analysis
+	again, err := m.Run("testuser", opts, false)
+	if err != nil || again.ID != first.ID {
+		t.Errorf("Run() = %s, %v, want the finished analysis %s", again.ID, err, first.ID)
+	}
+
+	// other users and other options get their own
+	other, err := m.Run("otheruser", opts, false)
+	if err != nil || other.ID == first.ID {
+		t.Errorf("Run() = %s, %v for another user, want a new analysis", other.ID, err)
+	}
+	deeper, err := m.Run("testuser", Options{Path: "/", AbsPath: root, Depth: 2, Top: 1}, false)
+	if err != nil || deeper.ID == first.ID {
+		t.Errorf("Run() = %s, %v with other options, want a new analysis", deeper.ID, err)
+	}
+
+	// refresh starts over
+	refreshed, err := m.Run("testuser", opts, true)
+	if err != nil || refreshed.ID == first.ID {
+		t.Errorf("Run() = %s, %v with refresh, want a new analysis", refreshed.ID, err)
+	}
+}
+
+func TestRunFailed(t *testing.T) {
+	m := New()
+	defer m.Close()
+
+	missing := filepath.Join(t.TempDir(), "missing")
+	job := wait(t, m, "testuser", Options{Path: "/missing", AbsPath: missing, Depth: 1})
+	if job.Status != StatusFailed || job.Error != ErrUnreadable.Error() {
+		t.Errorf("unexpected job %+v", job)
+	}
+}
+
+func TestCancelAndClose(t *testing.T) {
+	files := make(map[string]int)
+	for i := range 200 {
+		files[filepath.Join("dir", string(rune('a'+i%26)), string(rune('a'+i/26))+".txt")] = 1
+	}
+	root := makeTree(t, files)
+
+	m := New()
+	opts := Options{Path: "/", AbsPath: root, Depth: 1}
+	if _, err := m.Run("testuser", opts, false); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	m.Cancel("testuser", "/")
+
+	job := wait(t, m, "testuser", opts)
+	if job.Status != StatusCancelled && job.Status != StatusDone {
+		t.Errorf("unexpected status %s after cancelling", job.Status)
+	}
+
+	m.Close()
+	if _, err := m.Run("testuser", opts, true); err != ErrClosed {
+		t.Errorf("Run() error = %v after Close, want ErrClosed", err)
+	}
+}
+
+func TestRunBusy(t *testing.T) {
+	m := New()
+	defer m.Close()
+
+	// hold every slot without walking anything
+	m.mu.Lock()
+	m.running = maxRunning
+	m.mu.Unlock()
+
+	if _, err := m.Run("testuser", Options{Path: "/", AbsPath: t.TempDir()}, false); err != ErrBusy {
+		t.Errorf("Run() error = %v, want ErrBusy", err)
+	}
+
+	m.mu.Lock()
+	m.running = 0
+	m.mu.Unlock()
+}
@@ -0,0 +1,373 @@
+package watch
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Ops reported in events
+const (
+	OpCreate = "create"
+	OpRemove = "remove"
+	OpRename = "rename"
+	OpModify = "modify"
+	// OpOverflow means events were lost, e.g. because the client fell behind, and the listing should be reloaded
+	OpOverflow = "overflow"
+)
+
+// DefaultDebounce is how long events are collected before being delivered, so a burst of writes
+// to a file is reported once
+const DefaultDebounce = 250 * time.Millisecond
+
+// maxPending bounds the changes collected for a subscription between deliveries,
+// beyond it they are replaced by a single overflow event per directory
+const maxPending = 1000
+
+// ErrClosed is returned when subscribing to a closed Service
+var ErrClosed = errors.New("watch: service closed")
+
+// Event describes a change in a watched directory
+type Event struct {
+	Op string `json:"op"`
+	// Path is the watched directory, as the client named it
+	Path string `json:"path"`
+	// Name is the entry in Path that changed, it is empty if the directory itself was removed or renamed
+	Name string `json:"name,omitempty"`
+}
+
+// Dir is a directory to subscribe to
+type Dir struct {
+	// Path is the directory as the client named it, it is reported back in events
+	Path string
+	// AbsPath is the directory on the filesystem
+	AbsPath string
+}
+
+// Service watches directories with inotify (or the platform equivalent) on behalf of subscribers,
+// each directory is watched once no matter how many subscribers it has
+type Service struct {
+	watcher  *fsnotify.Watcher
+	debounce time.Duration
+	logger   *slog.Logger
+
+	mu     sync.Mutex
+	dirs   map[string]map[*Subscription]string // absolute path -> subscribers -> path as they named it
+	subs   map[*Subscription]struct{}
+	closed bool
+	done   chan struct{}
+}
+
+// New starts a Service delivering events after collecting them for debounce
+func New(debounce time.Duration, logger *slog.Logger) (*Service, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("watch: failed to create watcher: %w", err)
+	}
+
+	s := &Service{
+		watcher:  watcher,
+		debounce: debounce,
+		logger:   logger,
+		dirs:     make(map[string]map[*Subscription]string),
+		subs:     make(map[*Subscription]struct{}),
+		done:     make(chan struct{}),
+	}
+	go s.run()
+
+	return s, nil
+}
+
+// Subscribe starts watching dirs, events are delivered in batches on the subscription's Events channel.
+// The subscription must be closed when no longer needed.
+func (s *Service) Subscribe(dirs ...Dir) (*Subscription, error) {
+	sub := &Subscription{
+		service: s,
+		events:  make(chan []Event, 16),
+		pending: make(map[pendingKey]*pendingEvent),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, ErrClosed
+	}
+
+	for _, dir := range dirs {
+		abs := filepath.Clean(dir.AbsPath)
+		if _, ok := s.dirs[abs]; !ok {
+			if err := s.watcher.Add(abs); err != nil {
+				s.unsubscribe(sub)
+				return nil, fmt.Errorf("watch: failed to watch %s: %w", dir.Path, err)
+			}
+			s.dirs[abs] = make(map[*Subscription]string)
+		}
+		s.dirs[abs][sub] = dir.Path
+		sub.dirs = append(sub.dirs, abs)
+	}
+	s.subs[sub] = struct{}{}
+
+	return sub, nil
+}
+
+// Close stops watching and ends every subscription, closing their Events channels
+func (s *Service) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	for sub := range s.subs {
+		s.unsubscribe(sub)
+	}
+	s.mu.Unlock()
+
+	err := s.watcher.Close()
+	<-s.done
+	return err
+}
+
+// unsubscribe removes sub from every directory, the caller must hold s.mu
+func (s *Service) unsubscribe(sub *Subscription) {
+	for _, abs := range sub.dirs {
+		delete(s.dirs[abs], sub)
+		if len(s.dirs[abs]) == 0 {
+			delete(s.dirs, abs)
+			// the watch is already gone if the directory was removed
+			_ = s.watcher.Remove(abs)
+		}
+	}
+	sub.dirs = nil
+
+	if _, ok := s.subs[sub]; ok {
+		delete(s.subs, sub)
+		sub.close()
+	}
+}
+
+func (s *Service) run() {
+	defer close(s.done)
+
+	for {
+		select {
+		case event, ok := <-s.watcher.Events:
+			if !ok {
+				return
+			}
+			s.dispatch(event)
+		case err, ok := <-s.watcher.Errors:
+			if !ok {
+				return
+			}
+			s.logger.Warn("directory watcher error", slog.Any("error", err))
+			s.overflowAll()
+		}
+	}
+}
+
+func (s *Service) dispatch(event fsnotify.Event) {
+	op := opOf(event.Op)
+	if op == "" {
+		return
+	}
+
+	name := filepath.Clean(event.Name)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// a change to an entry, reported to subscribers of its parent directory
+	for sub, path := range s.dirs[filepath.Dir(name)] {
+		sub.add(Event{Op: op, Path: path, Name: filepath.Base(name)})
+	}
+
+	// the watched directory itself went away
+	if op == OpRemove || op == OpRename {
+		for sub, path := range s.dirs[name] {
+			sub.add(Event{Op: op, Path: path})
+		}
+	}
+}
+
+func (s *Service) overflowAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, subs := range s.dirs {
+		for sub, path := range subs {
+			sub.add(Event{Op: OpOverflow, Path: path})
+		}
+	}
+}
+
+func opOf(op fsnotify.Op) string {
+	switch {
+	case op.Has(fsnotify.Create):
+		return OpCreate
+	case op.Has(fsnotify.Remove):
+		return OpRemove
+	case op.Has(fsnotify.Rename):
+		return OpRename
+	case op.Has(fsnotify.Write):
+		return OpModify
+	default:
+		// permission changes are not shown in listings
+		return ""
+	}
+}
+
+type pendingKey struct {
+	path string
+	name string
+}
+
+// pendingEvent tracks the first and latest op for an entry within a debounce window
+type pendingEvent struct {
+	first string
+	last  string
+	order int
+}
+
+// Subscription receives the events for a set of directories
+type Subscription struct {
+	service *Service
+	events  chan []Event
+	dirs    []string
+
+	mu       sync.Mutex
+	pending  map[pendingKey]*pendingEvent
+	overflow map[string]bool
+	order    int
+	timer    *time.Timer
+	closed   bool
+}
+
+// Events delivers batches of events, it is closed when the subscription or the service is closed
+func (sub *Subscription) Events() <-chan []Event {
+	return sub.events
+}
+
+// Close ends the subscription
+func (sub *Subscription) Close() {
+	sub.service.mu.Lock()
+	defer sub.service.mu.Unlock()
+
+	sub.service.unsubscribe(sub)
+}
+
+// add collects an event to be delivered once the debounce window ends
+func (sub *Subscription) add(e Event) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	if sub.closed {
+		return
+	}
+
+	if e.Op == OpOverflow || len(sub.pending) >= maxPending {
+		if sub.overflow == nil {
+			sub.overflow = make(map[string]bool)
+		}
+		sub.overflow[e.Path] = true
+	} else {
+		key := pendingKey{path: e.Path, name: e.Name}
+		if p, ok := sub.pending[key]; ok {
+			p.last = e.Op
+		} else {
+			sub.order++
+			sub.pending[key] = &pendingEvent{first: e.Op, last: e.Op, order: sub.order}
+		}
+	}
+
+	if sub.timer == nil {
+		sub.timer = time.AfterFunc(sub.service.debounce, sub.flush)
+	}
+}
+
+// flush delivers the collected events as one batch, if the client has fallen behind they are kept for the next attempt
+func (sub *Subscription) flush() {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	sub.timer = nil
+	if sub.closed {
+		return
+	}
+
+	batch := sub.batch()
+	if len(batch) == 0 {
+		return
+	}
+
+	select {
+	case sub.events <- batch:
+		clear(sub.pending)
+		sub.overflow = nil
+	default:
+		sub.timer = time.AfterFunc(sub.service.debounce, sub.flush)
+	}
+}
+
+// batch builds the events to deliver, merging the ops seen for each entry, the caller must hold sub.mu
+func (sub *Subscription) batch() []Event {
+	type ordered struct {
+		event Event
+		order int
+	}
+
+	var events []ordered
+	for key, p := range sub.pending {
+		if sub.overflow[key.path] {
+			continue
+		}
+
+		op := p.last
+		switch {
+		case p.first == OpCreate && (p.last == OpRemove || p.last == OpRename):
+			// created and gone again within the window
+			continue
+		case p.first == OpCreate:
+			// a new file being written is still just new
+			op = OpCreate
+		}
+		events = append(events, ordered{event: Event{Op: op, Path: key.path, Name: key.name}, order: p.order})
+	}
+	for path := range sub.overflow {
+		events = append(events, ordered{event: Event{Op: OpOverflow, Path: path}})
+	}
+
+	// deliver in the order entries first changed, overflows first as they supersede the rest
+	slices.SortFunc(events, func(a, b ordered) int {
+		return cmp.Compare(a.order, b.order)
+	})
+
+	batch := make([]Event, len(events))
+	for i, e := range events {
+		batch[i] = e.event
+	}
+	return batch
+}
+
+// close stops delivery and closes the Events channel, the caller must hold the service's mu
+func (sub *Subscription) close() {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	if sub.timer != nil {
+		sub.timer.Stop()
+	}
+	close(sub.events)
+}
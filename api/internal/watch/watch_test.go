@@ -0,0 +1,227 @@
+package watch
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+
+	s, err := New(50*time.Millisecond, slog.Default())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// next waits for the next batch of events
+func next(t *testing.T, sub *Subscription) []Event {
+	t.Helper()
+
+	select {
+	case batch, ok := <-sub.Events():
+		if !ok {
+			t.Fatal("events channel closed")
+		}
+		return batch
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for events")
+		return nil
+	}
+}
+
+func TestSubscriptionEvents(t *testing.T) {
+	s := newTestService(t)
+	dir := t.TempDir()
+
+	sub, err := s.Subscribe(Dir{Path: "/builds", AbsPath: dir})
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	defer sub.Close()
+
+	file := filepath.Join(dir, "output.log")
+
+	// creating and writing a file in one burst is reported once, as a create
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 5 {
+		f.WriteString("line\n")
+	}
+	f.Close()
+
+	batch := next(t, sub)
+	if len(batch) != 1 || batch[0] != (Event{Op: OpCreate, Path: "/builds", Name: "output.log"}) {
+		t.Fatalf("unexpected batch %+v", batch)
+	}
+
+	if err := os.WriteFile(file, []byte("more"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	batch = next(t, sub)
+	if len(batch) != 1 || batch[0].Op != OpModify {
+		t.Fatalf("expected a modify event, got %+v", batch)
+	}
+
+	if err := os.Rename(file, filepath.Join(dir, "renamed.log")); err != nil {
+		t.Fatal(err)
+	}
+	batch = next(t, sub)
+	want := map[Event]bool{
+		{Op: OpRename, Path: "/builds", Name: "output.log"}:  true,
+		{Op: OpCreate, Path: "/builds", Name: "renamed.log"}: true,
+	}
+	if len(batch) != len(want) {
+		t.Fatalf("unexpected rename batch %+v", batch)
+	}
+	for _, e := range batch {
+		if !want[e] {
+			t.Errorf("unexpected event %+v", e)
+		}
+	}
+
+	if err := os.Remove(filepath.Join(dir, "renamed.log")); err != nil {
+		t.Fatal(err)
+	}
+	batch = next(t, sub)
+	if len(batch) != 1 || batch[0] != (Event{Op: OpRemove, Path: "/builds", Name: "renamed.log"}) {
+		t.Fatalf("unexpected batch %+v", batch)
+	}
+}
+
+func TestSubscriptionCreatedAndRemoved(t *testing.T) {
+	s := newTestService(t)
+	dir := t.TempDir()
+
+	sub, err := s.Subscribe(Dir{Path: "/", AbsPath: dir})
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	defer sub.Close()
+
+	// a temporary file that comes and goes within the debounce window is not reported
+	tmp := filepath.Join(dir, "tmp")
+	if err := os.WriteFile(tmp, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(tmp); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "kept"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	batch := next(t, sub)
+	if len(batch) != 1 || batch[0].Name != "kept" {
+		t.Fatalf("unexpected batch %+v", batch)
+	}
+}
+
+func TestSubscriptionDirectoryRemoved(t *testing.T) {
+	s := newTestService(t)
+	dir := filepath.Join(t.TempDir(), "watched")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	sub, err := s.Subscribe(Dir{Path: "/watched", AbsPath: dir})
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	defer sub.Close()
+
+	if err := os.Remove(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	batch := next(t, sub)
+	found := false
+	for _, e := range batch {
+		if e == (Event{Op: OpRemove, Path: "/watched"}) {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected the directory's own removal, got %+v", batch)
+	}
+}
+
+func TestSharedWatches(t *testing.T) {
+	s := newTestService(t)
+	dir := t.TempDir()
+
+	first, err := s.Subscribe(Dir{Path: "/", AbsPath: dir})
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	second, err := s.Subscribe(Dir{Path: "/", AbsPath: dir})
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	defer second.Close()
+
+	first.Close()
+	if _, ok := <-first.Events(); ok {
+		t.Error("expected closed subscription's channel to be closed")
+	}
+
+	// the directory is still watched for the remaining subscriber
+	if err := os.WriteFile(filepath.Join(dir, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if batch := next(t, second); len(batch) != 1 {
+		t.Errorf("unexpected batch %+v", batch)
+	}
+
+	second.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.dirs) != 0 {
+		t.Errorf("expected no watched directories, got %d", len(s.dirs))
+	}
+}
+
+func TestServiceClose(t *testing.T) {
+	s := newTestService(t)
+	dir := t.TempDir()
+
+	sub, err := s.Subscribe(Dir{Path: "/", AbsPath: dir})
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, ok := <-sub.Events(); ok {
+		t.Error("expected subscription to be closed")
+	}
+	sub.Close()
+
+	if _, err := s.Subscribe(Dir{Path: "/", AbsPath: dir}); err != ErrClosed {
+		t.Errorf("Subscribe() after Close() error = %v, want ErrClosed", err)
+	}
+}
+
+func TestSubscribeMissingDirectory(t *testing.T) {
+	s := newTestService(t)
+	dir := t.TempDir()
+
+	_, err := s.Subscribe(Dir{Path: "/", AbsPath: dir}, Dir{Path: "/missing", AbsPath: filepath.Join(dir, "missing")})
+	if err == nil {
+		t.Fatal("expected error watching a missing directory")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.dirs) != 0 {
+		t.Errorf("expected failed subscription to release its watches, got %d", len(s.dirs))
+	}
+}
@@ -0,0 +1,9 @@
+package api
+
+import _ "embed"
+
+// openAPISpec is the OpenAPI specification of the routes registered by NewServer,
+// TestOpenAPISpec fails if they drift apart
+//
+//go:embed openapi.json
+var openAPISpec []byte
@@ -0,0 +1,443 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/josepheid/file-explorer/api/handlers"
+	"github.com/josepheid/file-explorer/api/internal/audit"
+	"github.com/josepheid/file-explorer/api/internal/checksum"
+	"github.com/josepheid/file-explorer/api/internal/duplicates"
+	"github.com/josepheid/file-explorer/api/internal/health"
+	"github.com/josepheid/file-explorer/api/internal/respond"
+	"github.com/josepheid/file-explorer/api/internal/shares"
+	"github.com/josepheid/file-explorer/api/internal/tokens"
+	"github.com/josepheid/file-explorer/api/internal/totp"
+	"github.com/josepheid/file-explorer/api/internal/usage"
+	"github.com/josepheid/file-explorer/api/internal/watch"
+)
+
+// specSchemas maps every schema in openapi.json to the Go type it describes
+var specSchemas = map[string]reflect.Type{
+	"Error":                reflect.TypeFor[respond.Error](),
+	"ErrorCode":            reflect.TypeFor[respond.Code](),
+	"Problem":              reflect.TypeFor[respond.Problem](),
+	"HealthResponse":       reflect.TypeFor[handlers.HealthResponse](),
+	"HealthReport":         reflect.TypeFor[health.Report](),
+	"CheckResult":          reflect.TypeFor[health.CheckResult](),
+	"LoginRequest":         reflect.TypeFor[handlers.LoginRequest](),
+	"TOTPRequiredResponse": reflect.TypeFor[handlers.TOTPRequiredResponse](),
+	"TOTPLoginRequest":     reflect.TypeFor[handlers.TOTPLoginRequest](),
+	"TOTPCodeRequest":      reflect.TypeFor[handlers.TOTPCodeRequest](),
+	"TOTPEnrollment":       reflect.TypeFor[totp.Enrollment](),
+	"FileInfo":             reflect.TypeFor[handlers.FileInfo](),
+	"BrowseResponse":       reflect.TypeFor[handlers.BrowseResponse](),
+	"StatResponse":         reflect.TypeFor[handlers.StatResponse](),
+	"Owner":                reflect.TypeFor[handlers.Owner](),
+	"PreviewResponse":      reflect.TypeFor[handlers.PreviewResponse](),
+	"ChecksumAlgorithm":    reflect.TypeFor[string](),
+	"ChecksumResponse":     reflect.TypeFor[handlers.ChecksumResponse](),
+	"VerifyResponse":       reflect.TypeFor[handlers.VerifyResponse](),
+	"ChecksumResult":       reflect.TypeFor[checksum.Result](),
+	"JobStatus":            reflect.TypeFor[string](),
+	"UsageJob":             reflect.TypeFor[usage.Job](),
+	"UsageProgress":        reflect.TypeFor[usage.Progress](),
+	"UsageReport":          reflect.TypeFor[usage.Report](),
+	"UsageNode":            reflect.TypeFor[usage.Node](),
+	"UsageFile":            reflect.TypeFor[usage.File](),
+	"UsageExtension":       reflect.TypeFor[usage.Extension](),
+	"DuplicatesJob":        reflect.TypeFor[duplicates.Job](),
+	"DuplicatesProgress":   reflect.TypeFor[duplicates.Progress](),
+	"DuplicatesReport":     reflect.TypeFor[duplicates.Report](),
+	"DuplicateGroup":       reflect.TypeFor[duplicates.Group](),
+	"CreateShareRequest":   reflect.TypeFor[handlers.CreateShareRequest](),
+	"Share":                reflect.TypeFor[shares.Share](),
+	"CreateShareResponse":  reflect.TypeFor[handlers.CreateShareResponse](),
+	"SharedListing":        reflect.TypeFor[handlers.SharedListing](),
+	"Scope":                reflect.TypeFor[string](),
+	"CreateTokenRequest":   reflect.TypeFor[handlers.CreateTokenRequest](),
+	"Token":                reflect.TypeFor[tokens.Token](),
+	"CreateTokenResponse":  reflect.TypeFor[handlers.CreateTokenResponse](),
+	"AuditResponse":        reflect.TypeFor[handlers.AuditResponse](),
+	"AuditEvent":           reflect.TypeFor[audit.Event](),
+	"WatchEvent":           reflect.TypeFor[watch.Event](),
+}
+
+// unspecifiedRoutes are the patterns api.go registers that deliberately have no operation in openapi.json
+var unspecifiedRoutes = map[string]string{
+	handlers.DAVPrefix + "/": "WebDAV, served alongside the API",
+	"/assets/":               "web app",
+	"/favicon.ico":           "web app",
+	"/":                      "web app",
+}
+
+// routeConstants resolves the constants api.go builds route patterns from
+var routeConstants = map[string]string{
+	"handlers.DAVPrefix": handlers.DAVPrefix,
+}
+
+// registeredRoutes returns every pattern api.go registers on the mux, including those only registered for
+// optional features. Patterns built from constants are resolved, anything else fails the test.
+func registeredRoutes(t *testing.T) []string {
+	t.Helper()
+	f, err := parser.ParseFile(token.NewFileSet(), "api.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var routes []string
+	ast.Inspect(f, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || sel.Sel.Name != "Handle" {
+			return true
+		}
+		if x, ok := sel.X.(*ast.Ident); !ok || x.Name != "mux" {
+			return true
+		}
+		pattern, ok := routePattern(call.Args[0])
+		if !ok {
+			t.Errorf("cannot resolve the route pattern %s in api.go", types.ExprString(call.Args[0]))
+			return true
+		}
+		if !slices.Contains(routes, pattern) {
+			routes = append(routes, pattern)
+		}
+		return true
+	})
+	return routes
+}
+
+// routePattern evaluates a pattern made of string literals and routeConstants joined with +
+func routePattern(expr ast.Expr) (string, bool) {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		if e.Kind != token.STRING {
+			return "", false
+		}
+		pattern, err := strconv.Unquote(e.Value)
+		return pattern, err == nil
+	case *ast.SelectorExpr:
+		value, ok := routeConstants[types.ExprString(e)]
+		return value, ok
+	case *ast.BinaryExpr:
+		if e.Op != token.ADD {
+			return "", false
+		}
+		x, ok := routePattern(e.X)
+		if !ok {
+			return "", false
+		}
+		y, ok := routePattern(e.Y)
+		return x + y, ok
+	}
+	return "", false
+}
+
+// errorCodes returns the value of every Code constant the respond package declares
+func errorCodes(t *testing.T) []string {
+	t.Helper()
+	f, err := parser.ParseFile(token.NewFileSet(), "internal/respond/codes.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var codes []string
+	ast.Inspect(f, func(n ast.Node) bool {
+		spec, ok := n.(*ast.ValueSpec)
+		if !ok || len(spec.Values) != 1 {
+			return true
+		}
+		if typ, ok := spec.Type.(*ast.Ident); !ok || typ.Name != "Code" {
+			return true
+		}
+		if lit, ok := spec.Values[0].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+			code, _ := strconv.Unquote(lit.Value)
+			codes = append(codes, code)
+		}
+		return true
+	})
+	return codes
+}
+
+// specOperations returns the method and path of every operation in the spec
+func specOperations(spec map[string]any) []string {
+	var ops []string
+	for p, item := range spec["paths"].(map[string]any) {
+		for method := range item.(map[string]any) {
+			ops = append(ops, strings.ToUpper(method)+" "+p)
+		}
+	}
+	return ops
+}
+
+var wildcard = regexp.MustCompile(`\{([^}]+)\}`)
+
+func TestOpenAPISpec(t *testing.T) {
+	var spec map[string]any
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+	if v, _ := spec["openapi"].(string); !strings.HasPrefix(v, "3.") {
+		t.Fatalf("openapi = %q, want an OpenAPI 3 document", v)
+	}
+
+	routes := registeredRoutes(t)
+	if len(routes) == 0 {
+		t.Fatal("no routes found in api.go")
+	}
+	ops := specOperations(spec)
+	for _, route := range routes {
+		if _, ok := unspecifiedRoutes[route]; ok {
+			continue
+		}
+		if !strings.Contains(route, " ") {
+			t.Errorf("route %q serves every method, add it to openapi.json or unspecifiedRoutes", route)
+			continue
+		}
+		if !slices.Contains(ops, route) {
+			t.Errorf("route %q is registered but missing from openapi.json", route)
+		}
+	}
+	for _, op := range ops {
+		if !slices.Contains(routes, op) {
+			t.Errorf("operation %q is in openapi.json but no such route is registered", op)
+		}
+	}
+	for pattern := range unspecifiedRoutes {
+		if !slices.Contains(routes, pattern) {
+			t.Errorf("unspecified route %q is no longer registered", pattern)
+		}
+		// a subtree the spec leaves out must not have operations of its own
+		if pattern == "/" || !strings.HasSuffix(pattern, "/") {
+			continue
+		}
+		for _, op := range ops {
+			if _, p, _ := strings.Cut(op, " "); strings.HasPrefix(p, pattern) {
+				t.Errorf("operation %q is in openapi.json but %q is served by an unspecified handler", op, pattern)
+			}
+		}
+	}
+
+	paths := spec["paths"].(map[string]any)
+	for p, item := range paths {
+		var want []string
+		for _, m := range wildcard.FindAllStringSubmatch(p, -1) {
+			want = append(want, m[1])
+		}
+		for method, op := range item.(map[string]any) {
+			var got []string
+			params, _ := op.(map[string]any)["parameters"].([]any)
+			for _, param := range params {
+				param := param.(map[string]any)
+				if param["in"] == "path" {
+					got = append(got, param["name"].(string))
+				}
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("%s %s path parameters = %v, want %v", strings.ToUpper(method), p, got, want)
+			}
+		}
+	}
+
+	components := spec["components"].(map[string]any)
+	schemas := components["schemas"].(map[string]any)
+	for name, typ := range specSchemas {
+		schema, ok := schemas[name].(map[string]any)
+		if !ok {
+			t.Errorf("schema %s is missing from openapi.json", name)
+			continue
+		}
+		checkSchema(t, name, schema, typ, schemas)
+	}
+	for name := range schemas {
+		if _, ok := specSchemas[name]; !ok {
+			t.Errorf("schema %s is not mapped to a Go type in specSchemas", name)
+		}
+	}
+
+	var enum []string
+	for _, code := range schemas["ErrorCode"].(map[string]any)["enum"].([]any) {
+		enum = append(enum, code.(string))
+	}
+	if codes := errorCodes(t); !slices.Equal(enum, codes) {
+		t.Errorf("ErrorCode enumerates %v, want the codes in respond/codes.go: %v", enum, codes)
+	}
+
+	// every reference must point at a component
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			if r, ok := v["$ref"].(string); ok {
+				parts := strings.Split(strings.TrimPrefix(r, "#/components/"), "/")
+				if section, ok := components[parts[0]].(map[string]any); len(parts) != 2 || !ok || section[parts[1]] == nil {
+					t.Errorf("reference %q does not resolve", r)
+				}
+			}
+			for _, child := range v {
+				walk(child)
+			}
+		case []any:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(spec)
+}
+
+// checkSchema reports where schema does not describe the JSON encoding of typ. Nested references to other
+// schemas are only checked to be mapped to the same type, the other schema is checked on its own.
+func checkSchema(t *testing.T, where string, schema map[string]any, typ reflect.Type, schemas map[string]any) {
+	t.Helper()
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ.Kind() == reflect.Interface {
+		// any JSON value
+		return
+	}
+
+	if r, ok := schema["$ref"].(string); ok {
+		name := strings.TrimPrefix(r, "#/components/schemas/")
+		if mapped, ok := specSchemas[name]; !ok || mapped != typ {
+			t.Errorf("%s refers to %s, want a schema for %v", where, name, typ)
+		}
+		return
+	}
+
+	want := ""
+	switch typ.Kind() {
+	case reflect.String:
+		want = "string"
+	case reflect.Bool:
+		want = "boolean"
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint32, reflect.Uint64:
+		want = "integer"
+	case reflect.Float32, reflect.Float64:
+		want = "number"
+	case reflect.Slice:
+		want = "array"
+	case reflect.Map, reflect.Struct:
+		want = "object"
+	}
+	if typ == reflect.TypeFor[[]byte]() {
+		if schema["type"] != "string" || schema["contentEncoding"] != "base64" {
+			t.Errorf("%s is %v %v, want a base64 encoded string", where, schema["type"], schema["contentEncoding"])
+		}
+		return
+	}
+	if typ == reflect.TypeFor[time.Time]() {
+		if schema["type"] != "string" || schema["format"] != "date-time" {
+			t.Errorf("%s is %v %v, want a date-time string", where, schema["type"], schema["format"])
+		}
+		return
+	}
+	if schema["type"] != want {
+		t.Errorf("%s is of type %v, want %s for %v", where, schema["type"], want, typ)
+		return
+	}
+
+	switch typ.Kind() {
+	case reflect.Slice:
+		items, _ := schema["items"].(map[string]any)
+		checkSchema(t, where+"[]", items, typ.Elem(), schemas)
+	case reflect.Map:
+		values, _ := schema["additionalProperties"].(map[string]any)
+		checkSchema(t, where+"{}", values, typ.Elem(), schemas)
+	case reflect.Struct:
+		fields, required := jsonFields(typ)
+		properties, _ := schema["properties"].(map[string]any)
+		var got []string
+		for name := range properties {
+			got = append(got, name)
+		}
+		sort.Strings(got)
+		var names []string
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if !slices.Equal(got, names) {
+			t.Errorf("%s has properties %v, want the fields of %v: %v", where, got, typ, names)
+		}
+
+		var gotRequired []string
+		for _, name := range schema["required"].([]any) {
+			gotRequired = append(gotRequired, name.(string))
+		}
+		sort.Strings(gotRequired)
+		if !slices.Equal(gotRequired, required) {
+			t.Errorf("%s requires %v, want the fields of %v without omitempty: %v", where, gotRequired, typ, required)
+		}
+
+		for name, field := range fields {
+			if property, ok := properties[name].(map[string]any); ok {
+				checkSchema(t, where+"."+name, property, field, schemas)
+			}
+		}
+	}
+}
+
+// jsonFields returns the types of the fields encoding/json writes for typ by name, and the names of those
+// always written, in order. Embedded structs without a name are flattened like encoding/json does.
+func jsonFields(typ reflect.Type) (map[string]reflect.Type, []string) {
+	fields := make(map[string]reflect.Type)
+	var required []string
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			embedded, embeddedRequired := jsonFields(f.Type)
+			for name, t := range embedded {
+				fields[name] = t
+			}
+			required = append(required, embeddedRequired...)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+		if !slices.Contains(strings.Split(opts, ","), "omitempty") {
+			required = append(required, name)
+		}
+	}
+	sort.Strings(required)
+	return fields, required
+}
+
+func TestServerOpenAPI(t *testing.T) {
+	s := newTestServer(t)
+
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rr.Code)
+	}
+	if !bytes.Equal(rr.Body.Bytes(), openAPISpec) {
+		t.Error("served specification differs from openapi.json")
+	}
+}
@@ -0,0 +1,287 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/josepheid/file-explorer/api/internal/auth"
+)
+
+// Option configures optional Server behaviour
+type Option func(*config) error
+
+type config struct {
+	clientCAs       *x509.CertPool
+	clientCertUsers map[string]string
+	oidc            *OIDCConfig
+	ldap            *auth.LDAPConfig
+	auditPath       string
+	auditMaxSize    int64
+	auditMaxBackups int
+	adminUsers      []string
+	logger          *slog.Logger
+	metrics         bool
+	metricsAddr     string
+	certFile        string
+	keyFile         string
+	thumbnailDir    string
+	thumbnailJobs   int
+	davEnabled      bool
+	davWritable     bool
+	sftp            *SFTPConfig
+
+	timeoutsSet       bool
+	readHeaderTimeout time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+}
+
+// OIDCConfig holds the OpenID Connect identity provider and client settings for single sign-on
+type OIDCConfig struct {
+	// Issuer is the provider's issuer URL, used for discovery
+	Issuer string
+	// ClientID and ClientSecret identify this server at the provider, the secret is optional for public clients
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the absolute URL of /api/v1/oidc/callback on this server
+	RedirectURL string
+	// Scopes requested in addition to "openid", defaults to profile and email
+	Scopes []string
+	// UsernameClaim is the ID token claim used as the user ID, defaults to "sub"
+	UsernameClaim string
+	// GroupsClaim is the ID token claim listing the user's groups, defaults to "groups"
+	GroupsClaim string
+}
+
+// WithClientCA enables mutual TLS: client certificates signed by a CA in the PEM bundle at caFile
+// are verified during the handshake and accepted by protected routes in place of a session cookie.
+// Clients without a certificate can still log in with a password.
+func WithClientCA(caFile string) Option {
+	return func(c *config) error {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA bundle: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in client CA bundle %s", caFile)
+		}
+		c.clientCAs = pool
+
+		return nil
+	}
+}
+
+// WithClientCertUser maps a client certificate identity (subject common name or SAN) to a username.
+// Certificates whose common name is already a username do not need a mapping.
+func WithClientCertUser(identity, username string) Option {
+	return func(c *config) error {
+		if c.clientCertUsers == nil {
+			c.clientCertUsers = make(map[string]string)
+		}
+		c.clientCertUsers[identity] = username
+		return nil
+	}
+}
+
+// WithOIDC enables single sign-on through an OpenID Connect provider alongside password login.
+// Users are sent to /api/v1/oidc/login and return to /api/v1/oidc/callback.
+func WithOIDC(oidc OIDCConfig) Option {
+	return func(c *config) error {
+		if oidc.Issuer == "" || oidc.ClientID == "" || oidc.RedirectURL == "" {
+			return fmt.Errorf("OIDC issuer, client ID and redirect URL are required")
+		}
+		c.oidc = &oidc
+		return nil
+	}
+}
+
+// LDAPConfig holds the directory server settings for LDAP or Active Directory logins.
+// Users are located either with UserDNTemplate (bind as user) or by searching BaseDN with UserFilter
+// using the service account BindDN (search then bind).
+type LDAPConfig struct {
+	// URL of the directory server, ldap:// or ldaps://
+	URL string
+	// StartTLS upgrades an ldap:// connection to TLS before any credentials are sent
+	StartTLS bool
+	// CAFile is a PEM bundle used to verify the server certificate instead of the system roots
+	CAFile string
+
+	// UserDNTemplate builds the user's DN from the username, e.g. "uid=%s,ou=people,dc=example,dc=com"
+	UserDNTemplate string
+
+	// BindDN and BindPassword are the service account used to search for users
+	BindDN       string
+	BindPassword string
+	// BaseDN is where users are searched for
+	BaseDN string
+	// UserFilter finds the user entry, e.g. "(uid=%s)" or "(sAMAccountName=%s)" for Active Directory
+	UserFilter string
+
+	// GroupBaseDN and GroupFilter look up group membership, e.g. "(member=%s)" where %s is the user's DN.
+	// Without a GroupFilter the user entry's memberOf attribute is used instead.
+	GroupBaseDN string
+	GroupFilter string
+}
+
+// WithLDAP adds an LDAP directory as a second source of users,
+// logins are checked against local users first and then against the directory
+func WithLDAP(ldap LDAPConfig) Option {
+	return func(c *config) error {
+		cfg := auth.LDAPConfig{
+			URL:            ldap.URL,
+			StartTLS:       ldap.StartTLS,
+			UserDNTemplate: ldap.UserDNTemplate,
+			BindDN:         ldap.BindDN,
+			BindPassword:   ldap.BindPassword,
+			BaseDN:         ldap.BaseDN,
+			UserFilter:     ldap.UserFilter,
+			GroupBaseDN:    ldap.GroupBaseDN,
+			GroupFilter:    ldap.GroupFilter,
+		}
+
+		if ldap.CAFile != "" {
+			pem, err := os.ReadFile(ldap.CAFile)
+			if err != nil {
+				return fmt.Errorf("failed to read LDAP CA bundle: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return fmt.Errorf("no certificates found in LDAP CA bundle %s", ldap.CAFile)
+			}
+			u, err := url.Parse(ldap.URL)
+			if err != nil {
+				return fmt.Errorf("invalid LDAP URL: %w", err)
+			}
+			cfg.TLSConfig = &tls.Config{RootCAs: pool, ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+		}
+
+		c.ldap = &cfg
+		return nil
+	}
+}
+
+// WithAuditLog records logins, logouts and every API request as JSON lines in the file at path.
+// The file is rotated when it would exceed maxSize bytes, keeping maxBackups rotated files.
+// Administrators (see WithAdminUsers) can query it at /api/v1/audit.
+func WithAuditLog(path string, maxSize int64, maxBackups int) Option {
+	return func(c *config) error {
+		if maxSize <= 0 {
+			return fmt.Errorf("audit log max size must be positive")
+		}
+		c.auditPath = path
+		c.auditMaxSize = maxSize
+		c.auditMaxBackups = maxBackups
+		return nil
+	}
+}
+
+// WithAdminUsers sets the users allowed to use administrative endpoints such as the audit log query
+func WithAdminUsers(usernames ...string) Option {
+	return func(c *config) error {
+		c.adminUsers = append(c.adminUsers, usernames...)
+		return nil
+	}
+}
+
+// WithLogger sets the logger requests and errors are logged to, defaults to slog.Default()
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *config) error {
+		c.logger = logger
+		return nil
+	}
+}
+
+// WithMetrics exposes Prometheus metrics at /metrics. If addr is empty they are served on the main listener
+// and require authentication like the rest of the API, e.g. with a read scoped token.
+// Otherwise they are served without authentication over plain HTTP on a separate listener at addr,
+// which should only be reachable by the scraper.
+func WithMetrics(addr string) Option {
+	return func(c *config) error {
+		c.metrics = true
+		c.metricsAddr = addr
+		return nil
+	}
+}
+
+// WithTLSCertificate sets the PEM encoded certificate and key the server is served with,
+// defaults to the development certificate in api/internal/certs
+func WithTLSCertificate(certFile, keyFile string) Option {
+	return func(c *config) error {
+		c.certFile = certFile
+		c.keyFile = keyFile
+		return nil
+	}
+}
+
+// WithTimeouts overrides the connection timeouts, see http.Server for their meaning. A zero duration means no timeout.
+// The write timeout bounds how long a response may take, except for downloads, streams and checksums, which manage
+// their own deadlines.
+func WithTimeouts(readHeader, write, idle time.Duration) Option {
+	return func(c *config) error {
+		c.timeoutsSet = true
+		c.readHeaderTimeout = readHeader
+		c.writeTimeout = write
+		c.idleTimeout = idle
+		return nil
+	}
+}
+
+// WithThumbnails sets the directory image thumbnails are cached in and how many are generated at once.
+// By default they are cached in a new temporary directory that is removed on shutdown, so nothing is kept across
+// restarts, and generated by one worker per CPU.
+func WithThumbnails(cacheDir string, workers int) Option {
+	return func(c *config) error {
+		if workers < 0 {
+			return fmt.Errorf("thumbnail workers must not be negative")
+		}
+		c.thumbnailDir = cacheDir
+		c.thumbnailJobs = workers
+		return nil
+	}
+}
+
+// WithWebDAV sets whether the root directory is served over WebDAV at /dav/ and whether clients may change files
+// through it. By default it is not served, as it is a second way into the files to secure. DAV clients authenticate
+// with basic auth, using their password or a personal access token as the password.
+func WithWebDAV(enabled, writable bool) Option {
+	return func(c *config) error {
+		c.davEnabled = enabled
+		c.davWritable = enabled && writable
+		return nil
+	}
+}
+
+// SFTPConfig holds the settings of the embedded SFTP server
+type SFTPConfig struct {
+	// Addr is the address the SFTP server listens on, e.g. ":2022"
+	Addr string
+	// HostKeyFile is a PEM encoded private key identifying the server. Without one a key is generated at startup,
+	// so clients will see a different host key after every restart.
+	HostKeyFile string
+	// AuthorizedKeysDir holds one file per user, named after the username, in the OpenSSH authorized_keys format.
+	// Without it users can only log in with their password or a personal access token.
+	AuthorizedKeysDir string
+	// Writable allows users with write scope to change files, otherwise the root is served read-only
+	Writable bool
+}
+
+// WithSFTP serves the root directory over SFTP on a separate listener. Users log in as they do to the API,
+// with their password, a personal access token as the password or an authorized public key, and the same
+// access rules apply. Users with two-factor authentication enabled need a token or a key.
+// Logins and file operations are recorded in the audit log, if one is configured.
+func WithSFTP(sftp SFTPConfig) Option {
+	return func(c *config) error {
+		if sftp.Addr == "" {
+			return fmt.Errorf("SFTP address is required")
+		}
+		c.sftp = &sftp
+		return nil
+	}
+}
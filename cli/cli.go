@@ -0,0 +1,178 @@
+// Package cli implements the client subcommand, which scripts a running server from the command line
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/josepheid/file-explorer/client"
+	"golang.org/x/term"
+)
+
+const usage = `Usage: file-explorer client <command> [flags] [arguments]
+
+Commands:
+  login    log in to a server, or store a personal access token with -token
+  logout   end the session and forget the stored credentials
+  ls       list a directory
+  find     list everything below a directory
+  get      download a file, or a directory with -r
+  put      upload a file, or a directory with -r
+  rm       remove files, or directories with -r
+  mv       move or rename a file or directory
+
+Every command takes -json to print machine readable output, and -h for its flags.
+Credentials are stored in %s,
+FILE_EXPLORER_SERVER and FILE_EXPLORER_TOKEN override them.
+`
+
+// errUsage is returned for invalid arguments, after the usage has been printed
+var errUsage = errors.New("invalid arguments")
+
+// command runs a subcommand with its arguments
+type command func(ctx context.Context, e *env, args []string) error
+
+var commands = map[string]command{
+	"login":  login,
+	"logout": logout,
+	"ls":     ls,
+	"find":   find,
+	"get":    get,
+	"put":    put,
+	"rm":     rm,
+	"mv":     mv,
+}
+
+// env holds what commands read from and write to
+type env struct {
+	stdin  *bufio.Reader
+	stdout io.Writer
+	stderr io.Writer
+	// terminal is set if stdin is a terminal, so secrets can be read without echoing them
+	terminal *os.File
+	json     bool
+}
+
+// Run runs the client command in args and returns the exit status: 0 on success, 1 if the command failed
+// and 2 for invalid arguments
+func Run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	e := &env{stdin: bufio.NewReader(stdin), stdout: stdout, stderr: stderr}
+	if f, ok := stdin.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		e.terminal = f
+	}
+
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "help" {
+		p, _ := configPath()
+		fmt.Fprintf(stderr, usage, p)
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "file-explorer client: unknown command %q, run file-explorer client help for a list\n", args[0])
+		return 2
+	}
+
+	err := cmd(ctx, e, args[1:])
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	default:
+		if h := hint(err); h != "" {
+			fmt.Fprintf(stderr, "file-explorer client %s: %s, %s\n", args[0], err, h)
+		} else {
+			fmt.Fprintf(stderr, "file-explorer client %s: %s\n", args[0], err)
+		}
+		return 1
+	}
+}
+
+// flags creates the flag set of a command, with the -json flag every command has
+func (e *env) flags(name, arguments string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.BoolVar(&e.json, "json", false, "print machine readable JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(e.stderr, "Usage: file-explorer client %s [flags] %s\n\nFlags:\n", name, arguments)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses args with fs and checks the number of arguments left is between min and max, -1 means no maximum
+func (e *env) parse(fs *flag.FlagSet, args []string, min, max int) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	if fs.NArg() < min || (max >= 0 && fs.NArg() > max) {
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+// printJSON writes v to stdout as indented JSON
+func (e *env) printJSON(v any) error {
+	enc := json.NewEncoder(e.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// readLine reads a line from stdin, prompting for it if stdin is a terminal
+func (e *env) readLine(prompt string) (string, error) {
+	if e.terminal != nil {
+		fmt.Fprint(e.stderr, prompt)
+	}
+	line, err := e.stdin.ReadString('\n')
+	if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+		return "", fmt.Errorf("failed to read %s: %w", strings.ToLower(strings.TrimSuffix(prompt, ": ")), err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readSecret reads a line from stdin like readLine, without echoing it on a terminal
+func (e *env) readSecret(prompt string) (string, error) {
+	if e.terminal == nil {
+		return e.readLine(prompt)
+	}
+	fmt.Fprint(e.stderr, prompt)
+	b, err := term.ReadPassword(int(e.terminal.Fd()))
+	fmt.Fprintln(e.stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// connect creates a client from the stored credentials
+func connect() (*client.Client, config, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, cfg, err
+	}
+	c, err := newClient(cfg)
+	return c, cfg, err
+}
+
+// remotePath cleans a path on the server, which is always relative to the root
+func remotePath(p string) string {
+	return path.Clean("/" + p)
+}
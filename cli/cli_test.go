@@ -0,0 +1,208 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/josepheid/file-explorer/api"
+	"github.com/josepheid/file-explorer/api/handlers"
+)
+
+// startServer serves a root directory holding docs/readme.txt with WebDAV writes allowed,
+// and points the client's credentials at a temporary file
+func startServer(t *testing.T) (url, root string) {
+	t.Helper()
+
+	root = t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "docs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "docs", "readme.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	webassets := fstest.MapFS{"index.html": {Data: []byte("<html></html>")}}
+	s, err := api.NewServer(webassets, root, api.WithThumbnails(t.TempDir(), 1), api.WithWebDAV(true, true))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	server := httptest.NewTLSServer(s)
+	t.Cleanup(func() {
+		server.Close()
+		s.Shutdown(context.Background())
+	})
+
+	t.Setenv("FILE_EXPLORER_CLIENT_CONFIG", filepath.Join(t.TempDir(), "client.json"))
+	t.Setenv("FILE_EXPLORER_SERVER", "")
+	t.Setenv("FILE_EXPLORER_TOKEN", "")
+	return server.URL, root
+}
+
+// run runs the client with args, reading stdin from the given string
+func run(t *testing.T, stdin string, args ...string) (stdout, stderr string, code int) {
+	t.Helper()
+	var out, errOut bytes.Buffer
+	code = Run(context.Background(), args, strings.NewReader(stdin), &out, &errOut)
+	return out.String(), errOut.String(), code
+}
+
+// mustRun runs the client with args and fails the test unless it succeeds
+func mustRun(t *testing.T, args ...string) string {
+	t.Helper()
+	stdout, stderr, code := run(t, "", args...)
+	if code != 0 {
+		t.Fatalf("%v exited with %d: %s", args, code, stderr)
+	}
+	return stdout
+}
+
+func TestLogin(t *testing.T) {
+	url, _ := startServer(t)
+
+	if _, stderr, code := run(t, "", "ls"); code != 1 || !strings.Contains(stderr, "not logged in") {
+		t.Errorf("ls before login = %d %q, want a not logged in error", code, stderr)
+	}
+	if _, _, code := run(t, "wrong\n", "login", "-server", url, "-insecure", "-user", "testuser"); code != 1 {
+		t.Errorf("login with a wrong password exited with %d, want 1", code)
+	}
+	if _, _, code := run(t, "testuser\npassword123\n", "login", "-server", url); code != 1 {
+		t.Errorf("login without -insecure to a self-signed server exited with %d, want 1", code)
+	}
+
+	stdout, stderr, code := run(t, "testuser\npassword123\n", "login", "-server", url, "-insecure")
+	if code != 0 {
+		t.Fatalf("login exited with %d: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "as testuser") {
+		t.Errorf("login output = %q", stdout)
+	}
+
+	p, _ := configPath()
+	info, err := os.Stat(p)
+	if err != nil {
+		t.Fatalf("credentials were not stored: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("credentials mode = %v, want 0600", info.Mode().Perm())
+	}
+	cfg, err := loadConfig()
+	if err != nil || cfg.Session == "" || cfg.User != "testuser" {
+		t.Errorf("stored credentials = %+v, %v, want a session for testuser", cfg, err)
+	}
+
+	mustRun(t, "ls")
+
+	mustRun(t, "logout")
+	if _, err := os.Stat(p); !os.IsNotExist(err) {
+		t.Errorf("credentials still stored after logout: %v", err)
+	}
+	// the session was ended on the server, so reusing it fails
+	if err := saveConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if _, stderr, code := run(t, "", "ls"); code != 1 || !strings.Contains(stderr, "401") {
+		t.Errorf("ls with an ended session = %d %q, want 401", code, stderr)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	url, root := startServer(t)
+	if _, stderr, code := run(t, "password123\n", "login", "-server", url, "-insecure", "-user", "testuser"); code != 0 {
+		t.Fatalf("login exited with %d: %s", code, stderr)
+	}
+
+	var listing handlers.BrowseResponse
+	if err := json.Unmarshal([]byte(mustRun(t, "ls", "-json", "/docs")), &listing); err != nil {
+		t.Fatalf("ls -json output is not a listing: %v", err)
+	}
+	if len(listing.Contents) != 1 || listing.Contents[0].Name != "readme.txt" {
+		t.Errorf("ls -json /docs = %+v, want readme.txt", listing.Contents)
+	}
+
+	// upload a directory tree and a single file
+	local := t.TempDir()
+	for name, content := range map[string]string{"photos/a.jpg": "a", "photos/2024/b.jpg": "bb", "notes.txt": "notes"} {
+		p := filepath.Join(local, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, stderr, code := run(t, "", "put", filepath.Join(local, "photos"), "/"); code != 1 || !strings.Contains(stderr, "-r") {
+		t.Errorf("put of a directory without -r = %d %q, want an error suggesting -r", code, stderr)
+	}
+	mustRun(t, "put", "-r", filepath.Join(local, "photos"), "/")
+	mustRun(t, "put", filepath.Join(local, "notes.txt"), "/docs")
+	if b, err := os.ReadFile(filepath.Join(root, "photos", "2024", "b.jpg")); err != nil || string(b) != "bb" {
+		t.Errorf("uploaded file = %q, %v, want %q", b, err, "bb")
+	}
+	if b, err := os.ReadFile(filepath.Join(root, "docs", "notes.txt")); err != nil || string(b) != "notes" {
+		t.Errorf("uploaded file = %q, %v, want %q", b, err, "notes")
+	}
+
+	var found []Entry
+	if err := json.Unmarshal([]byte(mustRun(t, "find", "-json", "-name", "*.jpg")), &found); err != nil {
+		t.Fatalf("find -json output is not a list: %v", err)
+	}
+	if len(found) != 2 || found[0].Path != "/photos/2024/b.jpg" && found[1].Path != "/photos/2024/b.jpg" {
+		t.Errorf("find -name *.jpg = %+v, want the two photos", found)
+	}
+	if got := mustRun(t, "find", "-type", "d", "/photos"); got != "/photos/2024\n" {
+		t.Errorf("find -type d /photos = %q", got)
+	}
+
+	// download them again
+	download := t.TempDir()
+	mustRun(t, "get", "-r", "/photos", download)
+	mustRun(t, "get", "/docs/readme.txt", filepath.Join(download, "readme.txt"))
+	for name, want := range map[string]string{"photos/a.jpg": "a", "photos/2024/b.jpg": "bb", "readme.txt": "hello"} {
+		if b, err := os.ReadFile(filepath.Join(download, filepath.FromSlash(name))); err != nil || string(b) != want {
+			t.Errorf("downloaded %s = %q, %v, want %q", name, b, err, want)
+		}
+	}
+
+	// move into an existing directory, then rename
+	mustRun(t, "mv", "/docs/notes.txt", "/photos")
+	mustRun(t, "mv", "/photos/notes.txt", "/photos/renamed.txt")
+	if _, err := os.Stat(filepath.Join(root, "photos", "renamed.txt")); err != nil {
+		t.Errorf("moved file not found: %v", err)
+	}
+	if _, stderr, code := run(t, "", "mv", "/photos/renamed.txt", "/docs/readme.txt"); code != 1 || !strings.Contains(stderr, "already exists") {
+		t.Errorf("mv over an existing file = %d %q, want an already exists error", code, stderr)
+	}
+
+	if _, stderr, code := run(t, "", "rm", "/photos"); code != 1 || !strings.Contains(stderr, "-r") {
+		t.Errorf("rm of a directory without -r = %d %q, want an error suggesting -r", code, stderr)
+	}
+	var removed []string
+	if err := json.Unmarshal([]byte(mustRun(t, "rm", "-json", "-r", "/photos")), &removed); err != nil || len(removed) != 1 {
+		t.Errorf("rm -json -r /photos = %v, %v", removed, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "photos")); !os.IsNotExist(err) {
+		t.Errorf("removed directory still exists: %v", err)
+	}
+}
+
+func TestRunUsage(t *testing.T) {
+	if _, _, code := run(t, ""); code != 2 {
+		t.Errorf("no command exited with %d, want 2", code)
+	}
+	if _, _, code := run(t, "", "frobnicate"); code != 2 {
+		t.Errorf("unknown command exited with %d, want 2", code)
+	}
+	if _, _, code := run(t, "", "mv", "/only-one"); code != 2 {
+		t.Errorf("mv with one argument exited with %d, want 2", code)
+	}
+	if _, _, code := run(t, "", "ls", "-h"); code != 0 {
+		t.Errorf("ls -h exited with %d, want 0", code)
+	}
+}
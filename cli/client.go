@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/josepheid/file-explorer/client"
+)
+
+// newClient creates a client for the server in cfg, authenticated with its session or token
+func newClient(cfg config) (*client.Client, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.Insecure}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	httpClient := &http.Client{
+		Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig},
+	}
+	c, err := client.New(cfg.Server, client.WithHTTPClient(httpClient), client.WithSession(cfg.Session), client.WithToken(cfg.Token))
+	if err != nil {
+		return nil, fmt.Errorf("invalid server URL %q, expected e.g. https://localhost:8080", cfg.Server)
+	}
+	return c, nil
+}
+
+// hint suggests how to fix common errors from the server
+func hint(err error) string {
+	switch {
+	case errors.Is(err, client.ErrUnauthorized):
+		return "the session may have expired, run file-explorer client login again"
+	case errors.Is(err, client.ErrMethodNotAllowed):
+		return "the server may not allow changes over WebDAV, which needs WEBDAV=write"
+	}
+	var apiErr *client.Error
+	if errors.As(err, &apiErr) && apiErr.Code == "webdav_disabled" {
+		return "the server does not serve WebDAV, which needs WEBDAV=read or WEBDAV=write"
+	}
+	return ""
+}
@@ -0,0 +1,517 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/josepheid/file-explorer/client"
+)
+
+// Entry is a file or directory found by find
+type Entry struct {
+	Path string `json:"path"`
+	Type string `json:"type"`
+	Size int64  `json:"size"`
+}
+
+// Transfer is a file copied by get or put
+type Transfer struct {
+	Remote string `json:"remote"`
+	Local  string `json:"local"`
+	Size   int64  `json:"size"`
+}
+
+// login stores a session, or with -token a personal access token, for the other commands
+func login(ctx context.Context, e *env, args []string) error {
+	flags := e.flags("login", "")
+	server := flags.String("server", os.Getenv("FILE_EXPLORER_SERVER"), "server URL, e.g. https://localhost:8080")
+	user := flags.String("user", "", "username, read from stdin if not given")
+	useToken := flags.Bool("token", false, "store a personal access token, read from stdin, instead of logging in")
+	insecure := flags.Bool("insecure", false, "do not verify the server's certificate, e.g. the development certificate")
+	caFile := flags.String("ca-file", "", "PEM bundle of CAs to verify the server's certificate with")
+	if err := e.parse(flags, args, 0, 0); err != nil {
+		return err
+	}
+	if *server == "" {
+		flags.Usage()
+		return errUsage
+	}
+
+	cfg := config{Server: strings.TrimSuffix(*server, "/"), Insecure: *insecure, CAFile: *caFile}
+	c, err := newClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	if *useToken {
+		token, err := e.readSecret("Token: ")
+		if err != nil {
+			return err
+		}
+		cfg.Token = token
+		if c, err = newClient(cfg); err != nil {
+			return err
+		}
+		// a token restricted to a subtree cannot list the root, but it was still accepted
+		if _, err := c.Browse(ctx, "/", nil); err != nil && !errors.Is(err, client.ErrForbidden) {
+			return err
+		}
+	} else {
+		if *user == "" {
+			if *user, err = e.readLine("Username: "); err != nil {
+				return err
+			}
+		}
+		password, err := e.readSecret("Password: ")
+		if err != nil {
+			return err
+		}
+
+		err = c.Login(ctx, *user, password)
+		var totp *client.TOTPRequiredError
+		if errors.As(err, &totp) {
+			code, err := e.readLine("Authentication code: ")
+			if err != nil {
+				return err
+			}
+			if err := c.LoginTOTP(ctx, totp.Challenge, code); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+		cfg.User, cfg.Session = *user, c.Session()
+	}
+
+	if err := saveConfig(cfg); err != nil {
+		return fmt.Errorf("failed to store credentials: %w", err)
+	}
+
+	if e.json {
+		return e.printJSON(map[string]any{"server": cfg.Server, "user": cfg.User, "token": *useToken})
+	}
+	if *useToken {
+		fmt.Fprintf(e.stdout, "Stored token for %s\n", cfg.Server)
+	} else {
+		fmt.Fprintf(e.stdout, "Logged in to %s as %s\n", cfg.Server, cfg.User)
+	}
+	return nil
+}
+
+// logout ends the stored session and forgets the credentials, tokens stay valid until they are revoked
+func logout(ctx context.Context, e *env, args []string) error {
+	flags := e.flags("logout", "")
+	if err := e.parse(flags, args, 0, 0); err != nil {
+		return err
+	}
+
+	c, cfg, err := connect()
+	if err != nil && !errors.Is(err, errNotLoggedIn) {
+		return err
+	}
+	if c != nil && cfg.Session != "" {
+		// the credentials are forgotten even if the session already expired
+		if err := c.Logout(ctx); err != nil && !errors.Is(err, client.ErrUnauthorized) {
+			fmt.Fprintf(e.stderr, "failed to end session: %s\n", err)
+		}
+	}
+	if err := removeConfig(); err != nil {
+		return err
+	}
+
+	if e.json {
+		return e.printJSON(map[string]any{"loggedOut": true})
+	}
+	fmt.Fprintln(e.stdout, "Logged out")
+	return nil
+}
+
+// ls lists a directory, the root by default
+func ls(ctx context.Context, e *env, args []string) error {
+	flags := e.flags("ls", "[path]")
+	if err := e.parse(flags, args, 0, 1); err != nil {
+		return err
+	}
+
+	c, _, err := connect()
+	if err != nil {
+		return err
+	}
+	listing, err := c.Browse(ctx, remotePath(flags.Arg(0)), nil)
+	if err != nil {
+		return err
+	}
+
+	if e.json {
+		return e.printJSON(listing)
+	}
+	w := tabwriter.NewWriter(e.stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for _, entry := range listing.Contents {
+		name := entry.Name
+		if entry.Type == "dir" {
+			name += "/"
+		}
+		fmt.Fprintf(w, "%d\t %s\n", entry.Size, name)
+	}
+	return w.Flush()
+}
+
+// find lists everything below a directory, optionally only entries of a type or matching a name
+func find(ctx context.Context, e *env, args []string) error {
+	flags := e.flags("find", "[path]")
+	name := flags.String("name", "", "only list entries whose name matches the shell pattern, e.g. '*.log'")
+	fileType := flags.String("type", "", "only list files (f) or directories (d)")
+	if err := e.parse(flags, args, 0, 1); err != nil {
+		return err
+	}
+	if _, err := path.Match(*name, ""); err != nil {
+		return fmt.Errorf("invalid -name pattern: %w", err)
+	}
+	switch *fileType {
+	case "", "f", "d":
+	default:
+		flags.Usage()
+		return errUsage
+	}
+
+	c, _, err := connect()
+	if err != nil {
+		return err
+	}
+
+	entries := []Entry{}
+	err = walk(ctx, c, e, remotePath(flags.Arg(0)), func(p string, info client.FileInfo) error {
+		if *fileType == "f" && info.Type == "dir" || *fileType == "d" && info.Type != "dir" {
+			return nil
+		}
+		if matched, _ := path.Match(*name, info.Name); *name != "" && !matched {
+			return nil
+		}
+		if e.json {
+			entries = append(entries, Entry{Path: p, Type: info.Type, Size: info.Size})
+		} else {
+			fmt.Fprintln(e.stdout, p)
+		}
+		return nil
+	})
+
+	if e.json {
+		if printErr := e.printJSON(entries); printErr != nil {
+			return printErr
+		}
+	}
+	return err
+}
+
+// get downloads a file, or with -r a directory, to a local path
+func get(ctx context.Context, e *env, args []string) error {
+	flags := e.flags("get", "remote-path [local-path]")
+	recursive := flags.Bool("r", false, "download directories and everything in them")
+	if err := e.parse(flags, args, 1, 2); err != nil {
+		return err
+	}
+
+	c, _, err := connect()
+	if err != nil {
+		return err
+	}
+
+	remote := remotePath(flags.Arg(0))
+	info, err := c.Stat(ctx, remote)
+	if err != nil {
+		return err
+	}
+	if info.Type == "dir" && !*recursive {
+		return fmt.Errorf("%s is a directory, use -r to download it", remote)
+	}
+
+	// like cp, an existing directory is copied into
+	local := flags.Arg(1)
+	if local == "" {
+		if remote == "/" {
+			return errors.New("name a local directory to download the root into")
+		}
+		local = path.Base(remote)
+	} else if localInfo, err := os.Stat(local); err == nil && localInfo.IsDir() && remote != "/" {
+		local = filepath.Join(local, path.Base(remote))
+	}
+
+	transfers := []Transfer{}
+	record := func(t Transfer) {
+		if e.json {
+			transfers = append(transfers, t)
+		} else {
+			fmt.Fprintf(e.stdout, "%s -> %s\n", t.Remote, t.Local)
+		}
+	}
+
+	if info.Type != "dir" {
+		n, err := downloadFile(ctx, c, remote, local)
+		if err != nil {
+			return err
+		}
+		record(Transfer{Remote: remote, Local: local, Size: n})
+	} else {
+		if err := os.MkdirAll(local, 0755); err != nil {
+			return err
+		}
+		err = walk(ctx, c, e, remote, func(p string, info client.FileInfo) error {
+			rel := strings.TrimPrefix(strings.TrimPrefix(p, remote), "/")
+			target := filepath.Join(local, filepath.FromSlash(rel))
+			if info.Type == "dir" {
+				return os.MkdirAll(target, 0755)
+			}
+			n, err := downloadFile(ctx, c, p, target)
+			if err != nil {
+				return err
+			}
+			record(Transfer{Remote: p, Local: target, Size: n})
+			return nil
+		})
+	}
+
+	if e.json {
+		if printErr := e.printJSON(transfers); printErr != nil {
+			return printErr
+		}
+	}
+	return err
+}
+
+// downloadFile downloads remote to local, which is only replaced once the download is complete
+func downloadFile(ctx context.Context, c *client.Client, remote, local string) (int64, error) {
+	f, err := os.CreateTemp(filepath.Dir(local), "."+filepath.Base(local)+".*")
+	if err != nil {
+		return 0, err
+	}
+	n, err := c.Download(ctx, remote, f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), local)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return 0, fmt.Errorf("failed to download %s: %w", remote, err)
+	}
+	return n, nil
+}
+
+// put uploads a file, or with -r a directory, to a path on the server, the root by default
+func put(ctx context.Context, e *env, args []string) error {
+	flags := e.flags("put", "local-path [remote-path]")
+	recursive := flags.Bool("r", false, "upload directories and everything in them")
+	if err := e.parse(flags, args, 1, 2); err != nil {
+		return err
+	}
+
+	local := flags.Arg(0)
+	localInfo, err := os.Stat(local)
+	if err != nil {
+		return err
+	}
+	if localInfo.IsDir() && !*recursive {
+		return fmt.Errorf("%s is a directory, use -r to upload it", local)
+	}
+
+	c, _, err := connect()
+	if err != nil {
+		return err
+	}
+
+	// like cp, an existing directory is copied into
+	remote := remotePath(flags.Arg(1))
+	if info, err := c.Stat(ctx, remote); err == nil && info.Type == "dir" {
+		remote = path.Join(remote, filepath.Base(local))
+	} else if err != nil && !errors.Is(err, client.ErrNotFound) {
+		return err
+	}
+
+	transfers := []Transfer{}
+	upload := func(local, remote string, size int64) error {
+		f, err := os.Open(local)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := c.Upload(ctx, remote, f); err != nil {
+			return fmt.Errorf("failed to upload %s: %w", local, err)
+		}
+		if e.json {
+			transfers = append(transfers, Transfer{Remote: remote, Local: local, Size: size})
+		} else {
+			fmt.Fprintf(e.stdout, "%s -> %s\n", local, remote)
+		}
+		return nil
+	}
+
+	if !localInfo.IsDir() {
+		err = upload(local, remote, localInfo.Size())
+	} else {
+		err = filepath.WalkDir(local, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(local, p)
+			if err != nil {
+				return err
+			}
+			target := path.Join(remote, filepath.ToSlash(rel))
+
+			switch {
+			case d.IsDir():
+				// directories that already exist are uploaded into
+				if info, err := c.Stat(ctx, target); err == nil && info.Type == "dir" {
+					return nil
+				}
+				return c.Mkdir(ctx, target)
+			case d.Type().IsRegular():
+				info, err := d.Info()
+				if err != nil {
+					return err
+				}
+				return upload(p, target, info.Size())
+			default:
+				fmt.Fprintf(e.stderr, "skipping %s, it is not a regular file\n", p)
+				return nil
+			}
+		})
+	}
+
+	if e.json {
+		if printErr := e.printJSON(transfers); printErr != nil {
+			return printErr
+		}
+	}
+	return err
+}
+
+// rm removes files, or with -r directories and everything in them
+func rm(ctx context.Context, e *env, args []string) error {
+	flags := e.flags("rm", "path...")
+	recursive := flags.Bool("r", false, "remove directories and everything in them")
+	if err := e.parse(flags, args, 1, -1); err != nil {
+		return err
+	}
+
+	c, _, err := connect()
+	if err != nil {
+		return err
+	}
+
+	removed := []string{}
+	for _, arg := range flags.Args() {
+		p := remotePath(arg)
+		if p == "/" {
+			err = errors.New("refusing to remove the root directory")
+			break
+		}
+		var info *client.FileInfo
+		if info, err = c.Stat(ctx, p); err != nil {
+			break
+		}
+		if info.Type == "dir" && !*recursive {
+			err = fmt.Errorf("%s is a directory, use -r to remove it", p)
+			break
+		}
+		if err = c.Remove(ctx, p); err != nil {
+			break
+		}
+		removed = append(removed, p)
+		if !e.json {
+			fmt.Fprintf(e.stdout, "removed %s\n", p)
+		}
+	}
+
+	if e.json {
+		if printErr := e.printJSON(removed); printErr != nil {
+			return printErr
+		}
+	}
+	return err
+}
+
+// mv moves or renames a file or directory, into the destination if it is an existing directory
+func mv(ctx context.Context, e *env, args []string) error {
+	flags := e.flags("mv", "source destination")
+	if err := e.parse(flags, args, 2, 2); err != nil {
+		return err
+	}
+
+	c, _, err := connect()
+	if err != nil {
+		return err
+	}
+
+	from, to := remotePath(flags.Arg(0)), remotePath(flags.Arg(1))
+	if info, err := c.Stat(ctx, to); err == nil && info.Type == "dir" {
+		to = path.Join(to, path.Base(from))
+	} else if err != nil && !errors.Is(err, client.ErrNotFound) {
+		return err
+	}
+	if err := c.Move(ctx, from, to, false); err != nil {
+		if errors.Is(err, client.ErrPreconditionFailed) {
+			return fmt.Errorf("%s already exists", to)
+		}
+		return err
+	}
+
+	if e.json {
+		return e.printJSON(map[string]string{"from": from, "to": to})
+	}
+	fmt.Fprintf(e.stdout, "%s -> %s\n", from, to)
+	return nil
+}
+
+// walk calls fn for everything below the directory root, depth first in the server's order.
+// Directories that cannot be listed are reported and skipped, walk then fails once it is done.
+func walk(ctx context.Context, c *client.Client, e *env, root string, fn func(p string, info client.FileInfo) error) error {
+	var failed bool
+	var visit func(dir string) error
+	visit = func(dir string) error {
+		listing, err := c.Browse(ctx, dir, nil)
+		if err != nil {
+			if ctx.Err() != nil || dir == root {
+				return err
+			}
+			fmt.Fprintf(e.stderr, "skipping %s: %s\n", dir, err)
+			failed = true
+			return nil
+		}
+
+		for _, entry := range listing.Contents {
+			// names come from the server, one that is not a plain name could escape a local directory
+			if entry.Name == "" || entry.Name == "." || entry.Name == ".." || strings.ContainsAny(entry.Name, `/\`) {
+				fmt.Fprintf(e.stderr, "skipping invalid name %q in %s\n", entry.Name, dir)
+				failed = true
+				continue
+			}
+			p := path.Join(dir, entry.Name)
+			if err := fn(p, entry); err != nil {
+				return err
+			}
+			if entry.Type == "dir" {
+				if err := visit(p); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	if err := visit(root); err != nil {
+		return err
+	}
+	if failed {
+		return errors.New("some entries were skipped")
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// errNotLoggedIn is returned by commands run before login
+var errNotLoggedIn = errors.New("not logged in, run file-explorer client login first")
+
+// config is what login stores for the other commands
+type config struct {
+	// Server is the base URL of the server, e.g. https://localhost:8080
+	Server string `json:"server"`
+	User   string `json:"user,omitempty"`
+	// Session or Token authenticates requests, only one of them is set
+	Session string `json:"session,omitempty"`
+	Token   string `json:"token,omitempty"`
+	// Insecure skips verifying the server's certificate, e.g. the development certificate
+	Insecure bool `json:"insecure,omitempty"`
+	// CAFile is a PEM bundle the server's certificate is verified with instead of the system roots
+	CAFile string `json:"caFile,omitempty"`
+}
+
+// configPath returns where credentials are stored, FILE_EXPLORER_CLIENT_CONFIG overrides the default
+// of client.json in the user's config directory
+func configPath() (string, error) {
+	if p := os.Getenv("FILE_EXPLORER_CLIENT_CONFIG"); p != "" {
+		return p, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "file-explorer", "client.json"), nil
+}
+
+// loadConfig reads the stored credentials. FILE_EXPLORER_SERVER and FILE_EXPLORER_TOKEN override them,
+// so scripts can run without logging in first.
+func loadConfig() (config, error) {
+	var cfg config
+
+	p, err := configPath()
+	if err != nil {
+		return cfg, err
+	}
+	b, err := os.ReadFile(p)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return cfg, err
+	default:
+		// like SSH keys, credentials other users could read are refused rather than used
+		info, err := os.Stat(p)
+		if err != nil {
+			return cfg, err
+		}
+		if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+			return cfg, fmt.Errorf("%s is accessible by other users, restrict it with chmod 600", p)
+		}
+		if err := json.Unmarshal(b, &cfg); err != nil {
+			return cfg, fmt.Errorf("invalid credentials file %s: %w", p, err)
+		}
+	}
+
+	if server := os.Getenv("FILE_EXPLORER_SERVER"); server != "" {
+		cfg.Server = server
+	}
+	if token := os.Getenv("FILE_EXPLORER_TOKEN"); token != "" {
+		cfg.Token, cfg.Session = token, ""
+	}
+	if cfg.Server == "" || (cfg.Session == "" && cfg.Token == "") {
+		return cfg, errNotLoggedIn
+	}
+
+	return cfg, nil
+}
+
+// saveConfig stores cfg so only the current user can read it
+func saveConfig(cfg config) error {
+	p, err := configPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// written to a temporary file first, which is created with mode 0600, so it is never readable by others
+	f, err := os.CreateTemp(filepath.Dir(p), ".client-*.json")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+// removeConfig forgets the stored credentials
+func removeConfig() error {
+	p, err := configPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestConfig(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "nested", "client.json")
+	t.Setenv("FILE_EXPLORER_CLIENT_CONFIG", p)
+	t.Setenv("FILE_EXPLORER_SERVER", "")
+	t.Setenv("FILE_EXPLORER_TOKEN", "")
+
+	if _, err := loadConfig(); !errors.Is(err, errNotLoggedIn) {
+		t.Fatalf("loadConfig() without credentials error = %v, want errNotLoggedIn", err)
+	}
+
+	want := config{Server: "https://files.example.com", User: "testuser", Session: "abc"}
+	if err := saveConfig(want); err != nil {
+		t.Fatalf("saveConfig() error = %v", err)
+	}
+	got, err := loadConfig()
+	if err != nil || got != want {
+		t.Errorf("loadConfig() = %+v, %v, want %+v", got, err, want)
+	}
+
+	// the environment takes precedence, so scripts can use a token without logging in
+	t.Setenv("FILE_EXPLORER_TOKEN", "fe_token")
+	got, err = loadConfig()
+	if err != nil || got.Token != "fe_token" || got.Session != "" {
+		t.Errorf("loadConfig() with FILE_EXPLORER_TOKEN = %+v, %v, want the token instead of the session", got, err)
+	}
+	t.Setenv("FILE_EXPLORER_TOKEN", "")
+
+	if runtime.GOOS != "windows" {
+		if err := os.Chmod(p, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadConfig(); err == nil {
+			t.Error("loadConfig() of credentials readable by other users succeeded")
+		}
+	}
+
+	if err := removeConfig(); err != nil {
+		t.Fatalf("removeConfig() error = %v", err)
+	}
+	if _, err := loadConfig(); !errors.Is(err, errNotLoggedIn) {
+		t.Errorf("loadConfig() after removeConfig() error = %v, want errNotLoggedIn", err)
+	}
+}
@@ -0,0 +1,478 @@
+// Package client is a Go client for the file explorer's HTTP API.
+// Directories are listed through the API, files are transferred and changed through the server's WebDAV endpoint.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults used unless overridden with WithRetries
+const (
+	DefaultRetries = 3
+	DefaultBackoff = 200 * time.Millisecond
+)
+
+// davPrefix is where the server mounts WebDAV, handlers.DAVPrefix
+const davPrefix = "/dav"
+
+// maxErrorBody bounds how much of an error response is read
+const maxErrorBody = 64 << 10
+
+// FileInfo describes an entry of a directory listing, it mirrors handlers.FileInfo
+type FileInfo struct {
+	Name string `json:"name"`
+	// Type is "file" or "dir"
+	Type string `json:"type"`
+	Size int64  `json:"size"`
+	// Thumbnail links to a preview of images, it is only set when requested
+	Thumbnail string `json:"thumbnail,omitempty"`
+	// Approximate is set for directories whose recursive size could not be computed in full
+	Approximate bool `json:"approximate,omitempty"`
+}
+
+// IsDir reports whether the entry is a directory
+func (f FileInfo) IsDir() bool {
+	return f.Type == "dir"
+}
+
+// BrowseResponse is a directory listing, it mirrors handlers.BrowseResponse
+type BrowseResponse struct {
+	Name     string     `json:"name"`
+	Type     string     `json:"type"`
+	Size     int64      `json:"size"`
+	Contents []FileInfo `json:"contents"`
+	// Approximate is set if a recursive size could not be computed in full
+	Approximate bool `json:"approximate,omitempty"`
+}
+
+// Metadata is the full metadata of a single entry, it mirrors handlers.StatResponse.
+// Fields the server's platform or filesystem does not record are left zero.
+type Metadata struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	// Type is "file", "dir" or "symlink", symlinks are not followed
+	Type string `json:"type"`
+	Size int64  `json:"size"`
+	// Mode is the file mode as ls shows it, e.g. -rw-r--r--, and Permissions its permission bits in octal
+	Mode        string     `json:"mode"`
+	Permissions string     `json:"permissions"`
+	ModifiedAt  time.Time  `json:"modifiedAt"`
+	AccessedAt  *time.Time `json:"accessedAt,omitempty"`
+	ChangedAt   *time.Time `json:"changedAt,omitempty"`
+	// CreatedAt is the birth time, which few filesystems record
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+	Owner     *Owner     `json:"owner,omitempty"`
+	// SymlinkTarget is the path a symlink points to, it is empty for targets outside the root directory
+	SymlinkTarget string            `json:"symlinkTarget,omitempty"`
+	MIMEType      string            `json:"mimeType,omitempty"`
+	Xattrs        map[string][]byte `json:"xattrs,omitempty"`
+}
+
+// Owner is the user and group owning an entry, it mirrors handlers.Owner
+type Owner struct {
+	UID   int    `json:"uid"`
+	GID   int    `json:"gid"`
+	User  string `json:"user,omitempty"`
+	Group string `json:"group,omitempty"`
+}
+
+// BrowseOptions select the optional parts of a listing
+type BrowseOptions struct {
+	// RecursiveSize sizes directories by their contents like du, rather than by the directory inode
+	RecursiveSize bool
+	// Thumbnails links image entries to their thumbnails
+	Thumbnails bool
+}
+
+// Client calls the API of a server. It is safe for concurrent use.
+type Client struct {
+	base    *url.URL
+	http    *http.Client
+	token   string
+	retries int
+	backoff time.Duration
+
+	mu      sync.Mutex
+	session string
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client requests are sent with, e.g. to trust a private CA. Defaults to http.DefaultClient.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.http = httpClient
+	}
+}
+
+// WithToken authenticates requests with a personal access token instead of logging in
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithSession authenticates requests with the ID of a session from an earlier Login, see Session
+func WithSession(id string) Option {
+	return func(c *Client) {
+		c.session = id
+	}
+}
+
+// WithRetries sets how often requests failing with a transient error are retried, and the delay before the
+// first retry, which doubles for each one after. Only requests that can safely be repeated are retried.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.backoff = backoff
+	}
+}
+
+// New creates a Client for the server at baseURL, e.g. https://localhost:8080
+func New(baseURL string, opts ...Option) (*Client, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil || (base.Scheme != "https" && base.Scheme != "http") || base.Host == "" {
+		return nil, fmt.Errorf("client: invalid server URL %q", baseURL)
+	}
+	base.Path = strings.TrimSuffix(base.Path, "/")
+
+	c := &Client{
+		base:    base,
+		http:    http.DefaultClient,
+		retries: DefaultRetries,
+		backoff: DefaultBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Session returns the ID of the session from the last Login, to be reused with WithSession
+func (c *Client) Session() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.session
+}
+
+// Login logs in with a username and password, the session is used for all further requests.
+// Users with two-factor authentication enabled get a *TOTPRequiredError, to be completed with LoginTOTP.
+func (c *Client) Login(ctx context.Context, username, password string) error {
+	var totp struct {
+		TOTPRequired bool   `json:"totpRequired"`
+		Challenge    string `json:"challenge"`
+	}
+	resp, err := c.doJSON(ctx, http.MethodPost, "/api/v1/login", nil, map[string]string{"username": username, "password": password}, &totp)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusAccepted && totp.TOTPRequired {
+		return &TOTPRequiredError{Challenge: totp.Challenge}
+	}
+	return c.keepSession(resp)
+}
+
+// LoginTOTP completes a login with the challenge from a *TOTPRequiredError and a code from the user's authenticator app
+func (c *Client) LoginTOTP(ctx context.Context, challenge, code string) error {
+	resp, err := c.doJSON(ctx, http.MethodPost, "/api/v1/login/totp", nil, map[string]string{"challenge": challenge, "code": code}, nil)
+	if err != nil {
+		return err
+	}
+	return c.keepSession(resp)
+}
+
+// keepSession takes the session from a successful login response
+func (c *Client) keepSession(resp *http.Response) error {
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "session_id" && cookie.Value != "" {
+			c.mu.Lock()
+			c.session = cookie.Value
+			c.mu.Unlock()
+			return nil
+		}
+	}
+	return errors.New("client: server did not return a session")
+}
+
+// Logout ends the session on the server
+func (c *Client) Logout(ctx context.Context) error {
+	_, err := c.doJSON(ctx, http.MethodPost, "/api/v1/logout", nil, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.session = ""
+	c.mu.Unlock()
+	return nil
+}
+
+// Browse lists the directory p, opts may be nil
+func (c *Client) Browse(ctx context.Context, p string, opts *BrowseOptions) (*BrowseResponse, error) {
+	query := url.Values{"path": {cleanPath(p)}}
+	if opts != nil && opts.RecursiveSize {
+		query.Set("size", "recursive")
+	}
+	if opts != nil && opts.Thumbnails {
+		query.Set("thumbnails", "true")
+	}
+
+	var listing BrowseResponse
+	if _, err := c.doJSON(ctx, http.MethodGet, "/api/v1/browse", query, nil, &listing); err != nil {
+		return nil, err
+	}
+	return &listing, nil
+}
+
+// Metadata returns the full metadata of p, without following symlinks
+func (c *Client) Metadata(ctx context.Context, p string) (*Metadata, error) {
+	var meta Metadata
+	if _, err := c.doJSON(ctx, http.MethodGet, "/api/v1/stat", url.Values{"path": {cleanPath(p)}}, nil, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// Stat describes p by listing its parent directory, so unlike Metadata it follows symlinks. The root is always a directory.
+func (c *Client) Stat(ctx context.Context, p string) (*FileInfo, error) {
+	p = cleanPath(p)
+	if p == "/" {
+		return &FileInfo{Name: "/", Type: "dir"}, nil
+	}
+
+	listing, err := c.Browse(ctx, path.Dir(p), nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range listing.Contents {
+		if entry.Name == path.Base(p) {
+			return &entry, nil
+		}
+	}
+	return nil, &Error{Code: "path_not_found", Message: "Path not found", StatusCode: http.StatusNotFound}
+}
+
+// Download writes the file p to w and returns the number of bytes written.
+// Failed requests are only retried before anything was written.
+func (c *Client) Download(ctx context.Context, p string, w io.Writer) (int64, error) {
+	resp, err := c.do(ctx, http.MethodGet, davPrefix+cleanPath(p), nil, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	return io.Copy(w, resp.Body)
+}
+
+// Upload creates or replaces the file p with the content of r. It is only retried if r is an io.Seeker.
+// The server must allow changes over WebDAV.
+func (c *Client) Upload(ctx context.Context, p string, r io.Reader) error {
+	return c.discard(c.do(ctx, http.MethodPut, davPrefix+cleanPath(p), nil, r, nil))
+}
+
+// Mkdir creates the directory p, its parent must already exist
+func (c *Client) Mkdir(ctx context.Context, p string) error {
+	return c.discard(c.do(ctx, "MKCOL", davPrefix+cleanPath(p), nil, nil, nil))
+}
+
+// Remove deletes p, directories are removed with everything in them
+func (c *Client) Remove(ctx context.Context, p string) error {
+	return c.discard(c.do(ctx, http.MethodDelete, davPrefix+cleanPath(p), nil, nil, nil))
+}
+
+// Move renames from to to. Unless overwrite is set it fails with ErrPreconditionFailed if to already exists.
+func (c *Client) Move(ctx context.Context, from, to string, overwrite bool) error {
+	destination := *c.base
+	destination.Path = c.base.Path + davPrefix + cleanPath(to)
+
+	header := http.Header{}
+	header.Set("Destination", destination.String())
+	header.Set("Overwrite", "F")
+	if overwrite {
+		header.Set("Overwrite", "T")
+	}
+	return c.discard(c.do(ctx, "MOVE", davPrefix+cleanPath(from), nil, nil, header))
+}
+
+// discard closes the body of a response that carries nothing of interest
+func (c *Client) discard(resp *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// doJSON sends v as a JSON body and decodes the response into out, if they are not nil
+func (c *Client) doJSON(ctx context.Context, method, p string, query url.Values, v, out any) (*http.Response, error) {
+	var body io.Reader
+	header := http.Header{}
+	if v != nil {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(b)
+		header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.do(ctx, method, p, query, body, header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return nil, fmt.Errorf("client: invalid response: %w", err)
+		}
+	}
+	return resp, nil
+}
+
+// do sends a request for p, a path below the server URL, retrying transient failures of requests that can be
+// repeated. Error responses are returned as an *Error, otherwise the caller must close the response body.
+func (c *Client) do(ctx context.Context, method, p string, query url.Values, body io.Reader, header http.Header) (*http.Response, error) {
+	u := *c.base
+	u.Path = c.base.Path + p
+	u.RawQuery = query.Encode()
+
+	// a body is replayed by seeking back to where it started
+	var start int64
+	seeker, replayable := body.(io.Seeker)
+	if replayable {
+		var err error
+		if start, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			replayable = false
+		}
+	}
+	retries := 0
+	if idempotent(method) && (body == nil || replayable) {
+		retries = c.retries
+	}
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && body != nil {
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := c.send(ctx, method, u.String(), body, header)
+		if attempt == retries || ctx.Err() != nil || !transient(resp, err) {
+			if err != nil {
+				return nil, err
+			}
+			if resp.StatusCode >= http.StatusBadRequest {
+				return nil, readError(resp)
+			}
+			return resp, nil
+		}
+
+		delay := c.backoff << attempt
+		if resp != nil {
+			if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+				delay = time.Duration(seconds) * time.Second
+			}
+			io.Copy(io.Discard, io.LimitReader(resp.Body, maxErrorBody))
+			resp.Body.Close()
+		}
+		// jitter keeps clients that failed together from retrying together
+		delay += rand.N(delay/2 + 1)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// send sends a single request, authenticated with the token or session
+func (c *Client) send(ctx context.Context, method, rawURL string, body io.Reader, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if sizer, ok := body.(interface{ Stat() (fs.FileInfo, error) }); ok {
+		// files are uploaded with a length rather than chunked
+		if info, err := sizer.Stat(); err == nil && info.Mode().IsRegular() {
+			req.ContentLength = info.Size()
+		}
+	}
+
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else if session := c.Session(); session != "" {
+		req.AddCookie(&http.Cookie{Name: "session_id", Value: session})
+	}
+
+	return c.http.Do(req)
+}
+
+// readError reads an error response, which the API sends as JSON but WebDAV sometimes as plain text
+func readError(resp *http.Response) error {
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+
+	apiErr := &Error{}
+	if json.Unmarshal(b, apiErr) != nil || apiErr.Message == "" {
+		apiErr.Message = strings.TrimSpace(string(b))
+		if apiErr.Message == "" {
+			apiErr.Message = http.StatusText(resp.StatusCode)
+		}
+	}
+	apiErr.StatusCode = resp.StatusCode
+	if apiErr.RequestID == "" {
+		apiErr.RequestID = resp.Header.Get("X-Request-ID")
+	}
+	return apiErr
+}
+
+// idempotent reports whether a request can be repeated without changing its outcome
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete, "PROPFIND":
+		return true
+	}
+	return false
+}
+
+// transient reports whether a request failed in a way that may not happen again
+func transient(resp *http.Response, err error) bool {
+	if err != nil {
+		// connections can fail on the way, an untrusted certificate stays untrusted
+		var certErr *tls.CertificateVerificationError
+		return !errors.As(err, &certErr)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// cleanPath cleans a path on the server, which is always relative to the root
+func cleanPath(p string) string {
+	return path.Clean("/" + p)
+}
@@ -0,0 +1,337 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/josepheid/file-explorer/api"
+	"github.com/josepheid/file-explorer/api/handlers"
+)
+
+// startServer serves a root directory holding docs/readme.txt through api.NewServer, with WebDAV writes allowed.
+// wrap, if set, wraps the server's handler, e.g. to inject failures.
+func startServer(t *testing.T, wrap func(http.Handler) http.Handler) (*httptest.Server, string) {
+	t.Helper()
+
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "docs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "docs", "readme.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	webassets := fstest.MapFS{"index.html": {Data: []byte("<html></html>")}}
+	s, err := api.NewServer(webassets, root, api.WithThumbnails(t.TempDir(), 1), api.WithWebDAV(true, true))
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	var h http.Handler = s
+	if wrap != nil {
+		h = wrap(s)
+	}
+	server := httptest.NewTLSServer(h)
+	t.Cleanup(func() {
+		server.Close()
+		s.Shutdown(context.Background())
+	})
+	return server, root
+}
+
+func newClient(t *testing.T, server *httptest.Server, opts ...Option) *Client {
+	t.Helper()
+	c, err := New(server.URL, append([]Option{WithHTTPClient(server.Client()), WithRetries(3, time.Millisecond)}, opts...)...)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return c
+}
+
+// packageName matches the package qualifiers in type names, which differ between mirrored types
+var packageName = regexp.MustCompile(`\b(client|handlers)\.`)
+
+// jsonFields lists the JSON names and Go types of a struct's fields
+func jsonFields(t reflect.Type) map[string]string {
+	fields := make(map[string]string)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		fields[name] = packageName.ReplaceAllString(f.Type.String(), "")
+	}
+	return fields
+}
+
+func TestTypesMirrorHandlers(t *testing.T) {
+	pairs := []struct {
+		client, server any
+	}{
+		{FileInfo{}, handlers.FileInfo{}},
+		{BrowseResponse{}, handlers.BrowseResponse{}},
+		{Metadata{}, handlers.StatResponse{}},
+		{Owner{}, handlers.Owner{}},
+	}
+	for _, p := range pairs {
+		got, want := jsonFields(reflect.TypeOf(p.client)), jsonFields(reflect.TypeOf(p.server))
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%T fields = %v, want those of %T: %v", p.client, got, p.server, want)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, u := range []string{"", "localhost:8080", "ftp://localhost", "https://"} {
+		if _, err := New(u); err == nil {
+			t.Errorf("New(%q) succeeded, want an error", u)
+		}
+	}
+}
+
+func TestLoginLogout(t *testing.T) {
+	server, _ := startServer(t, nil)
+	c := newClient(t, server)
+	ctx := context.Background()
+
+	if _, err := c.Browse(ctx, "/", nil); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Browse() before login error = %v, want ErrUnauthorized", err)
+	}
+	if err := c.Login(ctx, "testuser", "wrong"); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Login() with a wrong password error = %v, want ErrUnauthorized", err)
+	}
+
+	if err := c.Login(ctx, "testuser", "password123"); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	if c.Session() == "" {
+		t.Fatal("Session() is empty after Login()")
+	}
+	listing, err := c.Browse(ctx, "/", nil)
+	if err != nil {
+		t.Fatalf("Browse() error = %v", err)
+	}
+	if len(listing.Contents) != 1 || !listing.Contents[0].IsDir() || listing.Contents[0].Name != "docs" {
+		t.Errorf("Browse() contents = %+v, want the docs directory", listing.Contents)
+	}
+
+	// the session can be picked up by another client
+	other := newClient(t, server, WithSession(c.Session()))
+	if _, err := other.Browse(ctx, "/docs", &BrowseOptions{RecursiveSize: true}); err != nil {
+		t.Errorf("Browse() with a reused session error = %v", err)
+	}
+
+	if err := c.Logout(ctx); err != nil {
+		t.Fatalf("Logout() error = %v", err)
+	}
+	if _, err := other.Browse(ctx, "/", nil); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Browse() after logout error = %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestLoginTOTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		switch {
+		case r.URL.Path == "/api/v1/login":
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(handlers.TOTPRequiredResponse{TOTPRequired: true, Challenge: "challenge"})
+		case r.URL.Path == "/api/v1/login/totp" && body["challenge"] == "challenge" && body["code"] == "123456":
+			http.SetCookie(w, &http.Cookie{Name: "session_id", Value: "session"})
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(Error{Message: "Invalid code", StatusCode: http.StatusUnauthorized})
+		}
+	}))
+	defer server.Close()
+
+	c := newClient(t, server)
+	ctx := context.Background()
+
+	err := c.Login(ctx, "testuser", "password123")
+	var totpErr *TOTPRequiredError
+	if !errors.As(err, &totpErr) || totpErr.Challenge != "challenge" {
+		t.Fatalf("Login() error = %v, want a TOTPRequiredError", err)
+	}
+	if err := c.LoginTOTP(ctx, totpErr.Challenge, "000000"); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("LoginTOTP() with a wrong code error = %v, want ErrUnauthorized", err)
+	}
+	if err := c.LoginTOTP(ctx, totpErr.Challenge, "123456"); err != nil || c.Session() != "session" {
+		t.Errorf("LoginTOTP() = %v with session %q, want session", err, c.Session())
+	}
+}
+
+func TestToken(t *testing.T) {
+	server, _ := startServer(t, nil)
+	ctx := context.Background()
+
+	admin := newClient(t, server)
+	if err := admin.Login(ctx, "testuser", "password123"); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	var created handlers.CreateTokenResponse
+	req := handlers.CreateTokenRequest{Name: "docs", Scopes: []string{"read"}, Path: "/docs"}
+	if _, err := admin.doJSON(ctx, http.MethodPost, "/api/v1/tokens", nil, req, &created); err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+
+	c := newClient(t, server, WithToken(created.Secret))
+	if _, err := c.Browse(ctx, "/docs", nil); err != nil {
+		t.Errorf("Browse() within the token's path error = %v", err)
+	}
+	_, err := c.Browse(ctx, "/", nil)
+	var apiErr *Error
+	if !errors.Is(err, ErrForbidden) || !errors.As(err, &apiErr) || apiErr.Message == "" || apiErr.RequestID == "" {
+		t.Errorf("Browse() outside the token's path error = %#v, want ErrForbidden with a message and request ID", err)
+	}
+	if err := c.Upload(ctx, "/docs/new.txt", strings.NewReader("new")); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Upload() with a read token error = %v, want ErrForbidden", err)
+	}
+}
+
+func TestFiles(t *testing.T) {
+	server, root := startServer(t, nil)
+	c := newClient(t, server)
+	ctx := context.Background()
+	if err := c.Login(ctx, "testuser", "password123"); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+
+	if _, err := c.Browse(ctx, "/missing", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Browse() of a missing directory error = %v, want ErrNotFound", err)
+	}
+	_, err := c.Browse(ctx, "/docs/readme.txt", nil)
+	if !errors.Is(err, ErrBadRequest) {
+		t.Errorf("Browse() of a file error = %v, want ErrBadRequest", err)
+	}
+	if apiErr := (*Error)(nil); !errors.As(err, &apiErr) || apiErr.Code != "not_a_directory" {
+		t.Errorf("Browse() of a file error = %#v, want code not_a_directory", err)
+	}
+
+	if err := c.Mkdir(ctx, "/archive"); err != nil {
+		t.Fatalf("Mkdir() error = %v", err)
+	}
+	if err := c.Upload(ctx, "/archive/notes.txt", strings.NewReader("notes")); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+	info, err := c.Stat(ctx, "/archive/notes.txt")
+	if err != nil || info.IsDir() || info.Size != 5 {
+		t.Errorf("Stat() = %+v, %v, want a file of 5 bytes", info, err)
+	}
+	if _, err := c.Stat(ctx, "/archive/missing.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat() of a missing file error = %v, want ErrNotFound", err)
+	}
+	meta, err := c.Metadata(ctx, "/archive/notes.txt")
+	if err != nil || meta.Type != "file" || meta.Size != 5 || meta.Path != "/archive/notes.txt" || meta.ModifiedAt.IsZero() {
+		t.Errorf("Metadata() = %+v, %v, want a file of 5 bytes", meta, err)
+	}
+	if _, err := c.Metadata(ctx, "/archive/missing.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Metadata() of a missing file error = %v, want ErrNotFound", err)
+	}
+
+	if err := c.Move(ctx, "/archive/notes.txt", "/docs/readme.txt", false); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("Move() over an existing file error = %v, want ErrPreconditionFailed", err)
+	}
+	if err := c.Move(ctx, "/archive/notes.txt", "/docs/notes.txt", false); err != nil {
+		t.Fatalf("Move() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	if n, err := c.Download(ctx, "/docs/notes.txt", &buf); err != nil || n != 5 || buf.String() != "notes" {
+		t.Errorf("Download() = %d %q, %v, want notes", n, buf.String(), err)
+	}
+
+	if err := c.Remove(ctx, "/archive"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "archive")); !os.IsNotExist(err) {
+		t.Errorf("removed directory still exists: %v", err)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	// every request fails with a 503 until failures is used up
+	var failures, requests atomic.Int32
+	server, _ := startServer(t, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			if failures.Add(-1) >= 0 {
+				io.Copy(io.Discard, r.Body)
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	c := newClient(t, server)
+	ctx := context.Background()
+
+	// logins are not repeated, they are not idempotent
+	failures.Store(1)
+	if err := c.Login(ctx, "testuser", "password123"); !errors.Is(err, ErrServer) {
+		t.Fatalf("Login() error = %v, want ErrServer", err)
+	}
+	if err := c.Login(ctx, "testuser", "password123"); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+
+	failures.Store(2)
+	requests.Store(0)
+	if _, err := c.Browse(ctx, "/", nil); err != nil {
+		t.Errorf("Browse() error = %v, want it to succeed after retrying", err)
+	}
+	if got := requests.Load(); got != 3 {
+		t.Errorf("Browse() sent %d requests, want 3", got)
+	}
+
+	// uploads are repeated with the whole body
+	failures.Store(1)
+	if err := c.Upload(ctx, "/retried.txt", strings.NewReader("retried")); err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := c.Download(ctx, "/retried.txt", &buf); err != nil || buf.String() != "retried" {
+		t.Errorf("Download() = %q, %v, want retried", buf.String(), err)
+	}
+
+	// a body that cannot be replayed is sent once
+	failures.Store(1)
+	requests.Store(0)
+	if err := c.Upload(ctx, "/once.txt", io.MultiReader(strings.NewReader("once"))); !errors.Is(err, ErrServer) {
+		t.Errorf("Upload() of a stream error = %v, want ErrServer", err)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("Upload() of a stream sent %d requests, want 1", got)
+	}
+
+	// giving up after the configured retries
+	failures.Store(10)
+	requests.Store(0)
+	if _, err := c.Browse(ctx, "/", nil); !errors.Is(err, ErrServer) {
+		t.Errorf("Browse() error = %v, want ErrServer", err)
+	}
+	if got := requests.Load(); got != 4 {
+		t.Errorf("Browse() sent %d requests, want 4", got)
+	}
+	failures.Store(0)
+
+	// a cancelled context stops retrying
+	failures.Store(10)
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := c.Browse(cancelled, "/", nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("Browse() with a cancelled context error = %v, want context.Canceled", err)
+	}
+}
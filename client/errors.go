@@ -0,0 +1,72 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Errors matching the status of an error response, use errors.Is on the errors returned by a Client
+var (
+	ErrBadRequest         = errors.New("client: bad request")
+	ErrUnauthorized       = errors.New("client: unauthorized")
+	ErrForbidden          = errors.New("client: forbidden")
+	ErrNotFound           = errors.New("client: not found")
+	ErrMethodNotAllowed   = errors.New("client: method not allowed")
+	ErrConflict           = errors.New("client: conflict")
+	ErrGone               = errors.New("client: gone")
+	ErrPreconditionFailed = errors.New("client: precondition failed")
+	ErrTooManyRequests    = errors.New("client: too many requests")
+	// ErrServer matches every 5xx status
+	ErrServer = errors.New("client: server error")
+)
+
+var statusErrors = map[int]error{
+	http.StatusBadRequest:         ErrBadRequest,
+	http.StatusUnauthorized:       ErrUnauthorized,
+	http.StatusForbidden:          ErrForbidden,
+	http.StatusNotFound:           ErrNotFound,
+	http.StatusMethodNotAllowed:   ErrMethodNotAllowed,
+	http.StatusConflict:           ErrConflict,
+	http.StatusGone:               ErrGone,
+	http.StatusPreconditionFailed: ErrPreconditionFailed,
+	http.StatusTooManyRequests:    ErrTooManyRequests,
+}
+
+// Error is an error response from the server, it mirrors respond.Error
+type Error struct {
+	// Code identifies the kind of error, e.g. path_not_found, and is stable unlike the message.
+	// It is empty for errors from servers that predate codes and for some WebDAV errors.
+	Code       string `json:"code,omitempty"`
+	Message    string `json:"message"`
+	StatusCode int    `json:"statusCode"`
+	// Details holds further information for some codes, e.g. the parameter that was invalid
+	Details map[string]any `json:"details,omitempty"`
+	// RequestID identifies the request in the server logs
+	RequestID string `json:"requestId,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.RequestID != "" {
+		return fmt.Sprintf("%s (status %d, request %s)", e.Message, e.StatusCode, e.RequestID)
+	}
+	return fmt.Sprintf("%s (status %d)", e.Message, e.StatusCode)
+}
+
+// Unwrap returns the error matching the status, e.g. ErrNotFound, or nil for statuses without one
+func (e *Error) Unwrap() error {
+	if e.StatusCode >= 500 {
+		return ErrServer
+	}
+	return statusErrors[e.StatusCode]
+}
+
+// TOTPRequiredError is returned by Login for users with two-factor authentication enabled,
+// the login is completed by passing the challenge to LoginTOTP along with a code
+type TOTPRequiredError struct {
+	Challenge string
+}
+
+func (e *TOTPRequiredError) Error() string {
+	return "client: authentication code required"
+}
@@ -1,13 +1,23 @@
 package main
 
 import (
+	"context"
 	"embed"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/josepheid/file-explorer/api"
+	"github.com/josepheid/file-explorer/cli"
 )
 
 const listenPort = 8080
@@ -16,6 +26,21 @@ const listenPort = 8080
 var assets embed.FS
 
 func main() {
+	// file-explorer client talks to a running server instead of serving
+	if len(os.Args) > 1 && os.Args[1] == "client" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		code := cli.Run(ctx, os.Args[2:], os.Stdin, os.Stdout, os.Stderr)
+		stop()
+		os.Exit(code)
+	}
+
+	logger, err := newLogger(os.Getenv("LOG_LEVEL"), os.Getenv("LOG_FORMAT"))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	// the log package is routed through the same handler
+	slog.SetDefault(logger)
+
 	webassets, err := fs.Sub(assets, "web/dist")
 	if err != nil {
 		log.Fatalln("could not embed webassets", err)
@@ -35,10 +60,175 @@ func main() {
 		log.Fatal("Root directory not a directory: ", rootPath)
 	}
 
-	s, err := api.NewServer(webassets, rootPath)
+	opts := []api.Option{api.WithLogger(logger)}
+
+	// optional mutual TLS for machine clients
+	if caFile := os.Getenv("CLIENT_CA_FILE"); caFile != "" {
+		opts = append(opts, api.WithClientCA(caFile))
+
+		// CLIENT_CERT_USERS maps certificate identities to usernames, e.g. "ci.example.com=testuser,bot@example.com=testuser"
+		for _, mapping := range strings.Split(os.Getenv("CLIENT_CERT_USERS"), ",") {
+			identity, username, ok := strings.Cut(strings.TrimSpace(mapping), "=")
+			if !ok {
+				continue
+			}
+			opts = append(opts, api.WithClientCertUser(identity, username))
+		}
+	}
+
+	// optional single sign-on through an OpenID Connect provider
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		opts = append(opts, api.WithOIDC(api.OIDCConfig{
+			Issuer:        issuer,
+			ClientID:      os.Getenv("OIDC_CLIENT_ID"),
+			ClientSecret:  os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:   os.Getenv("OIDC_REDIRECT_URL"),
+			Scopes:        strings.Fields(os.Getenv("OIDC_SCOPES")),
+			UsernameClaim: os.Getenv("OIDC_USERNAME_CLAIM"),
+			GroupsClaim:   os.Getenv("OIDC_GROUPS_CLAIM"),
+		}))
+	}
+
+	// optional LDAP or Active Directory users, checked after the local users
+	if ldapURL := os.Getenv("LDAP_URL"); ldapURL != "" {
+		opts = append(opts, api.WithLDAP(api.LDAPConfig{
+			URL:            ldapURL,
+			StartTLS:       os.Getenv("LDAP_STARTTLS") == "true",
+			CAFile:         os.Getenv("LDAP_CA_FILE"),
+			UserDNTemplate: os.Getenv("LDAP_USER_DN_TEMPLATE"),
+			BindDN:         os.Getenv("LDAP_BIND_DN"),
+			BindPassword:   os.Getenv("LDAP_BIND_PASSWORD"),
+			BaseDN:         os.Getenv("LDAP_BASE_DN"),
+			UserFilter:     os.Getenv("LDAP_USER_FILTER"),
+			GroupBaseDN:    os.Getenv("LDAP_GROUP_BASE_DN"),
+			GroupFilter:    os.Getenv("LDAP_GROUP_FILTER"),
+		}))
+	}
+
+	// optional audit log of logins and every API request
+	if auditPath := os.Getenv("AUDIT_LOG"); auditPath != "" {
+		maxSizeMB := envInt("AUDIT_LOG_MAX_SIZE_MB", 100)
+		opts = append(opts, api.WithAuditLog(auditPath, int64(maxSizeMB)<<20, envInt("AUDIT_LOG_MAX_BACKUPS", 5)))
+	}
+	opts = append(opts, api.WithAdminUsers(strings.FieldsFunc(os.Getenv("ADMIN_USERS"), func(r rune) bool { return r == ',' })...))
+
+	// optional Prometheus metrics, METRICS_ADDR serves them on a separate listener instead of the API's
+	if os.Getenv("METRICS") == "true" || os.Getenv("METRICS_ADDR") != "" {
+		opts = append(opts, api.WithMetrics(os.Getenv("METRICS_ADDR")))
+	}
+
+	if certFile := os.Getenv("TLS_CERT_FILE"); certFile != "" {
+		opts = append(opts, api.WithTLSCertificate(certFile, os.Getenv("TLS_KEY_FILE")))
+	}
+	// thumbnails are only kept across restarts if THUMBNAIL_CACHE_DIR names a directory for them
+	if cacheDir := os.Getenv("THUMBNAIL_CACHE_DIR"); cacheDir != "" || os.Getenv("THUMBNAIL_WORKERS") != "" {
+		opts = append(opts, api.WithThumbnails(cacheDir, envInt("THUMBNAIL_WORKERS", 0)))
+	}
+	// WebDAV is opt-in, so upgrading does not open a second way into the files
+	switch mode := os.Getenv("WEBDAV"); mode {
+	case "", "off":
+	case "read":
+		opts = append(opts, api.WithWebDAV(true, false))
+	case "write":
+		opts = append(opts, api.WithWebDAV(true, true))
+	default:
+		log.Fatalf("WEBDAV must be off, read or write: %s\n", mode)
+	}
+	// optional SFTP server, read-only unless SFTP_WRITE is set
+	if sftpAddr := os.Getenv("SFTP_ADDR"); sftpAddr != "" {
+		opts = append(opts, api.WithSFTP(api.SFTPConfig{
+			Addr:              sftpAddr,
+			HostKeyFile:       os.Getenv("SFTP_HOST_KEY_FILE"),
+			AuthorizedKeysDir: os.Getenv("SFTP_KEYS_DIR"),
+			Writable:          os.Getenv("SFTP_WRITE") == "true",
+		}))
+	}
+	opts = append(opts, api.WithTimeouts(
+		envDuration("READ_HEADER_TIMEOUT", api.DefaultReadHeaderTimeout),
+		envDuration("WRITE_TIMEOUT", api.DefaultWriteTimeout),
+		envDuration("IDLE_TIMEOUT", api.DefaultIdleTimeout),
+	))
+
+	s, err := api.NewServer(webassets, rootPath, opts...)
 	if err != nil {
 		log.Fatalln(err)
 	}
-	log.Println("starting server on port", listenPort)
-	log.Fatalln(s.ListenAndServe(fmt.Sprintf("localhost:%d", listenPort)))
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	logger.Info("starting server", slog.Int("port", listenPort), slog.String("root", rootPath))
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.ListenAndServe(fmt.Sprintf("localhost:%d", listenPort))
+	}()
+
+	select {
+	case err := <-serveErr:
+		log.Fatalln(err)
+	case <-ctx.Done():
+	}
+	// a second signal kills the process without waiting for the drain
+	stop()
+
+	drainTimeout := envDuration("SHUTDOWN_TIMEOUT", 30*time.Second)
+	logger.Info("shutting down, draining connections", slog.Duration("timeout", drainTimeout))
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		logger.Error("shutdown did not complete cleanly", slog.Any("error", err))
+		os.Exit(1)
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("server stopped", slog.Any("error", err))
+	}
+	logger.Info("server stopped")
+}
+
+// envInt reads an integer environment variable, falling back to def if it is unset
+func envInt(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("%s must be an integer: %s\n", name, err)
+	}
+	return n
+}
+
+// envDuration reads a duration environment variable such as "30s", falling back to def if it is unset
+func envDuration(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("%s must be a duration: %s\n", name, err)
+	}
+	return d
+}
+
+// newLogger builds the server logger, level is one of debug, info (the default), warn or error
+// and format is text (the default) or json
+func newLogger(level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if level != "" {
+		if err := lvl.UnmarshalText([]byte(level)); err != nil {
+			return nil, fmt.Errorf("invalid LOG_LEVEL %q: %w", level, err)
+		}
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch strings.ToLower(format) {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid LOG_FORMAT %q, expected text or json", format)
+	}
 }